@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// AccountsFile structure for the multi-account config file
+type AccountsFile struct {
+	Workers   int                      `json:"workers"`
+	DataDir   string                   `json:"data_dir"`
+	Layout    string                   `json:"layout"`
+	Providers map[string]ProviderLimit `json:"providers"`
+	Defaults  AccountConfig            `json:"defaults"`
+	Accounts  []AccountConfig          `json:"accounts"`
+}
+
+// ProviderLimit structure for limits shared by every account on one IMAP server
+type ProviderLimit struct {
+	MaxConnections   int `json:"max_connections"`
+	BatchesPerMinute int `json:"batches_per_minute"`
+}
+
+// AccountConfig structure for one account in the accounts file
+type AccountConfig struct {
+	User           string      `json:"user"`
+	Pass           string      `json:"pass"`
+	PassEnv        string      `json:"pass_env"`
+	Server         string      `json:"server"`
+	DB             string      `json:"db"`
+	Config         string      `json:"config"`
+	Folder         string      `json:"folder"`
+	Folders        []string    `json:"folders"`
+	Batch          int         `json:"batch"`
+	FollowForwards bool        `json:"follow_forwards"`
+	Signatures     bool        `json:"signatures"`
+	Invites        bool        `json:"invites"`
+	Organizers     bool        `json:"invite_organizers"`
+	Replies        bool        `json:"replies"`
+	Exports        []ExportJob `json:"exports"`
+}
+
+// AccountResult structure for one row of the combined status view
+type AccountResult struct {
+	User      string
+	Server    string
+	Status    string
+	Code      int
+	Message   string
+	Senders   int
+	Processed uint32
+	Total     uint32
+	Duration  time.Duration
+}
+
+// Connection slots and batch pacing shared by all accounts of one provider
+type providerLimiter struct {
+	slots    chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Create a limiter; zero values mean unlimited
+func newProviderLimiter(limit ProviderLimit) *providerLimiter {
+	l := &providerLimiter{}
+	if limit.MaxConnections > 0 {
+		l.slots = make(chan struct{}, limit.MaxConnections)
+	}
+	if limit.BatchesPerMinute > 0 {
+		l.interval = time.Minute / time.Duration(limit.BatchesPerMinute)
+	}
+	return l
+}
+
+// Take a connection slot
+func (l *providerLimiter) acquire() {
+	if l != nil && l.slots != nil {
+		l.slots <- struct{}{}
+	}
+}
+
+// Return a connection slot
+func (l *providerLimiter) release() {
+	if l != nil && l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Block until the provider allows the next batch fetch
+func (l *providerLimiter) wait() {
+	if l == nil || l.interval == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	at := l.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// Run the accounts command
+func runAccounts(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: accounts requires an action: run, status")
+		os.Exit(1)
+	}
+	action, args := args[0], args[1:]
+
+	var path, logPath, dataDir, layout string
+	var workers int
+	var showHelp, logStdout bool
+
+	fs := flag.NewFlagSet("accounts", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&path, "accounts", "accounts.json", "Accounts file path")
+	fs.StringVar(&logPath, "log", "", "Log file path (default: {data dir}/accounts_log_{date}.txt)")
+	fs.BoolVar(&logStdout, "log-stdout", false, "Write logs to stdout instead of a log file")
+	fs.StringVar(&dataDir, "data-dir", "", "Root directory for databases, logs and status files (overrides the accounts file)")
+	fs.StringVar(&layout, "layout", "", "File layout: user or flat (overrides the accounts file)")
+	fs.Func("encrypt-to", "Encrypt logs and status files to a public key from peep keygen", setArtifactRecipient)
+	fs.BoolFunc("redact-emails", "Replace email addresses in logs with ***@domain", setRedactEmails)
+	fs.IntVar(&workers, "workers", 0, "Accounts scanned in parallel (overrides the accounts file)")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.Parse(args)
+
+	if showHelp {
+		showUsage()
+		os.Exit(0)
+	}
+
+	accounts, err := loadAccountsFile(path)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+	if workers > 0 {
+		accounts.Workers = workers
+	}
+	if dataDir != "" {
+		accounts.DataDir = dataDir
+	}
+	if layout != "" {
+		accounts.Layout = layout
+	}
+	if _, err := pathLayout(accounts.Layout); err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "run":
+		if logPath == "" {
+			logPath = filepath.Join(stateRoot(accounts.DataDir), fmt.Sprintf("accounts_log_%s.txt", time.Now().Format("2006-01-02")))
+		}
+		os.MkdirAll(filepath.Dir(logPath), 0755)
+		setupLogging(&Config{Command: "accounts", LogPath: logPath, LogStdout: logStdout})
+
+		fmt.Printf("📧 Scanning %d accounts with %d workers\n", len(accounts.Accounts), accounts.Workers)
+		if !logStdout {
+			fmt.Println("📋 Detailed logs:", logPath)
+		}
+		ctx, stop := interruptContext()
+		results := runAccountScans(ctx, accounts)
+		stop()
+		writeAccountStatus(os.Stdout, results)
+
+		failed := 0
+		for _, result := range results {
+			if result.Status != "SUCCESS" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("❌ %d of %d accounts failed\n", failed, len(results))
+			os.Exit(accountsExitCode(results))
+		}
+		fmt.Println("✅ All accounts scanned successfully!")
+	case "status":
+		var results []AccountResult
+		for _, account := range accounts.Accounts {
+			results = append(results, accountStatus(accountScanConfig(accounts, account)))
+		}
+		writeAccountStatus(os.Stdout, results)
+	default:
+		fmt.Printf("❌ Error: unknown accounts action %q\n", action)
+		os.Exit(1)
+	}
+}
+
+// Load and validate the accounts file
+func loadAccountsFile(path string) (*AccountsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts file: %v", err)
+	}
+
+	var accounts AccountsFile
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts file %s: %v", path, err)
+	}
+	if len(accounts.Accounts) == 0 {
+		return nil, fmt.Errorf("no accounts in %s", path)
+	}
+	if err := validateExportJobs(accounts.Defaults.Exports); err != nil {
+		return nil, fmt.Errorf("%s: defaults: %v", path, err)
+	}
+	for i, account := range accounts.Accounts {
+		if account.User == "" {
+			return nil, fmt.Errorf("account %d in %s has no user", i+1, path)
+		}
+		if err := validateExportJobs(account.Exports); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, account.User, err)
+		}
+	}
+	if _, err := pathLayout(accounts.Layout); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if accounts.Workers < 1 {
+		accounts.Workers = 4
+	}
+
+	// Provider keys are matched against the lowercased server host
+	providers := make(map[string]ProviderLimit)
+	for key, limit := range accounts.Providers {
+		providers[providerKey(key)] = limit
+	}
+	accounts.Providers = providers
+
+	return &accounts, nil
+}
+
+// Build the scan config of one account, falling back to the file defaults
+func accountScanConfig(accounts *AccountsFile, account AccountConfig) *Config {
+	defaults := accounts.Defaults
+	config := &Config{
+		Command:        "scan",
+		IMAPServer:     firstNonEmpty(account.Server, defaults.Server, "imap.gmail.com:993"),
+		Username:       account.User,
+		Password:       account.Pass,
+		DBPath:         account.DB,
+		ConfigPath:     firstNonEmpty(account.Config, defaults.Config),
+		Folder:         firstNonEmpty(account.Folder, defaults.Folder, "INBOX"),
+		Folders:        account.Folders,
+		FolderWorkers:  defaultFolderWorkers,
+		BatchSize:      account.Batch,
+		FollowForwards: account.FollowForwards || defaults.FollowForwards,
+		Signatures:     account.Signatures || defaults.Signatures,
+		Invites:        account.Invites || defaults.Invites,
+		Organizers:     account.Organizers || defaults.Organizers,
+		Replies:        account.Replies || defaults.Replies,
+		BatchTimeout:   defaultBatchTimeout,
+		DataDir:        accounts.DataDir,
+		Layout:         accounts.Layout,
+	}
+	if passEnv := firstNonEmpty(account.PassEnv, defaults.PassEnv); config.Password == "" && passEnv != "" {
+		config.Password = os.Getenv(strings.ReplaceAll(passEnv, "{user}", envName(account.User)))
+	}
+	logSecret(config.Password)
+	if config.BatchSize == 0 {
+		config.BatchSize = defaults.Batch
+	}
+	if len(config.Folders) == 0 {
+		config.Folders = defaults.Folders
+	}
+	config.Exports = account.Exports
+	if len(config.Exports) == 0 {
+		config.Exports = defaults.Exports
+	}
+	if config.BatchSize < 100 || config.BatchSize > 2000 {
+		config.BatchSize = 500
+	}
+
+	resolvePaths(config)
+	return config
+}
+
+// Return the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Turn an address into an environment variable name part (a.b@c.com -> A_B_C_COM)
+func envName(user string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, user))
+}
+
+// Provider key of an IMAP server address (host without port)
+func providerKey(server string) string {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+	}
+	return strings.ToLower(host)
+}
+
+// Scan all accounts with a worker pool, returning results in file order
+//
+// Cancelling ctx stops the running scans and skips the accounts not started yet.
+func runAccountScans(ctx context.Context, accounts *AccountsFile) []AccountResult {
+	configs := make([]*Config, len(accounts.Accounts))
+	limiters := make(map[string]*providerLimiter)
+	for i, account := range accounts.Accounts {
+		configs[i] = accountScanConfig(accounts, account)
+		key := providerKey(configs[i].IMAPServer)
+		if limiters[key] == nil {
+			limiters[key] = newProviderLimiter(accounts.Providers[key])
+		}
+		configs[i].Limiter = limiters[key]
+	}
+
+	results := make([]AccountResult, len(configs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(accounts.Workers, len(configs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				config := configs[i]
+				if ctx.Err() != nil {
+					results[i] = AccountResult{User: config.Username, Server: config.IMAPServer,
+						Status: "ERROR", Code: exitFailure, Message: "Not scanned, the run was interrupted"}
+					continue
+				}
+				config.Limiter.acquire()
+				results[i] = scanAccount(ctx, config)
+				config.Limiter.release()
+
+				fmt.Printf("%s %s: %s\n", statusIcon(results[i].Status), results[i].User, results[i].Message)
+			}
+		}()
+	}
+	for i := range configs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Scan one account, recording its status file like a single scan would
+func scanAccount(ctx context.Context, config *Config) AccountResult {
+	start := time.Now()
+	result := AccountResult{User: config.Username, Server: config.IMAPServer}
+
+	fail := func(err error) AccountResult {
+		log.Printf("Account %s failed: %v", config.Username, err)
+		writeStatus(config.StatusPath, "ERROR", err.Error())
+		publishStatusEvent(config, "ERROR", err.Error())
+		result.Status, result.Code, result.Message = "ERROR", exitCode(err), err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if config.Password == "" && !hasOAuthToken(config) {
+		return fail(withExitCode(exitUsage, fmt.Errorf("no password (set pass or pass_env, or run peep oauth login -user %s)", config.Username)))
+	}
+	if config.ConfigPath != "" {
+		fileConfig, err := loadFileConfig(config.ConfigPath)
+		if err != nil {
+			return fail(withExitCode(exitUsage, err))
+		}
+		if err := applyFileConfig(config, fileConfig); err != nil {
+			return fail(withExitCode(exitUsage, err))
+		}
+	}
+
+	// Another run of this account keeps its status file
+	lock, err := acquireLock(config)
+	if err != nil {
+		log.Printf("Account %s skipped: %v", config.Username, err)
+		result.Status, result.Code, result.Message = "LOCKED", exitCode(err), err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer lock.Release()
+
+	log.Printf("Account %s: scan started (%s)", config.Username, config.IMAPServer)
+	writeStatus(config.StatusPath, "RUNNING", "Email scanning started")
+	publishStatusEvent(config, "RUNNING", "Email scanning started")
+
+	db, err := initDB(config.DBPath)
+	if err != nil {
+		return fail(withExitCode(exitDatabase, fmt.Errorf("database error: %v", err)))
+	}
+	defer db.Close()
+	config.AuditDB = db
+
+	config.Pool = newIMAPPool(config)
+	defer config.Pool.close()
+	err = scanEmailsBatch(ctx, config, db)
+	sendScanSummary(config, db, start, err)
+	if err != nil && exitCode(err) != exitPartial {
+		return fail(withExitCode(exitCode(err), fmt.Errorf("scanning error: %v", err)))
+	}
+	checkAnomalies(db, config, recordRunSnapshot(db, config, start, err))
+	runExportJobs(db, config)
+
+	result = accountStatus(config)
+	result.Duration = time.Since(start)
+	result.Status = "SUCCESS"
+	result.Message = fmt.Sprintf("Scanning completed successfully. Found %d unique senders.", result.Senders)
+	if err != nil {
+		result.Status, result.Code = "PARTIAL", exitPartial
+		result.Message = fmt.Sprintf("Scanning completed partially: %v", err)
+	}
+	writeStatus(config.StatusPath, result.Status, result.Message)
+	publishStatusEvent(config, result.Status, result.Message)
+	log.Printf("Account %s: %s", config.Username, result.Message)
+	return result
+}
+
+// Exit code of a multi-account run: partial if some accounts succeeded,
+// otherwise the failure class shared by all accounts
+func accountsExitCode(results []AccountResult) int {
+	code := exitOK
+	for i, result := range results {
+		switch {
+		case result.Status == "SUCCESS":
+			return exitPartial
+		case i == 0:
+			code = result.Code
+		case result.Code != code:
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+// Read an account's status file and database counters
+func accountStatus(config *Config) AccountResult {
+	result := AccountResult{User: config.Username, Server: config.IMAPServer, Status: "NEVER"}
+
+	if file, err := os.Open(config.StatusPath); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch key {
+			case "STATUS":
+				result.Status = value
+			case "MESSAGE":
+				result.Message = value
+			}
+		}
+		file.Close()
+	} else if _, err := os.Stat(config.StatusPath + encryptedSuffix); err == nil {
+		// Only readable with peep decrypt
+		result.Status = "ENCRYPTED"
+	}
+
+	if _, err := os.Stat(config.DBPath); err != nil {
+		return result
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(config.DBPath))
+	if err != nil {
+		return result
+	}
+	defer db.Close()
+
+	db.QueryRow("SELECT COUNT(*) FROM senders").Scan(&result.Senders)
+	db.QueryRow("SELECT COALESCE(SUM(processed_count), 0), COALESCE(SUM(total_messages), 0) FROM scan_progress").
+		Scan(&result.Processed, &result.Total)
+	return result
+}
+
+// Emoji for an account status
+func statusIcon(status string) string {
+	switch status {
+	case "SUCCESS":
+		return "✅"
+	case "ERROR":
+		return "❌"
+	case "ENCRYPTED":
+		return "🔒"
+	default:
+		return "⚠️ "
+	}
+}
+
+// Print the combined status table
+func writeAccountStatus(out io.Writer, results []AccountResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nACCOUNT\tSERVER\tSTATUS\tSENDERS\tPROCESSED\tDURATION\tMESSAGE")
+	for _, r := range results {
+		duration := "-"
+		if r.Duration > 0 {
+			duration = r.Duration.Round(time.Second).String()
+		}
+		message := r.Message
+		if r.Status == "SUCCESS" {
+			message = ""
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d/%d\t%s\t%s\n",
+			r.User, providerKey(r.Server), r.Status, r.Senders, r.Processed, r.Total, duration, message)
+	}
+	w.Flush()
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Timeout of a CardDAV address book download
+	carddavTimeout = 60 * time.Second
+	// Largest address book read from a file or server
+	maxAddressBookSize = 64 << 20
+)
+
+// Phone numbers of senders, all numbers of a matching address book card
+const createSenderPhonesTable = `
+	CREATE TABLE IF NOT EXISTS sender_phones (
+		email TEXT,
+		phone TEXT,
+		kind TEXT,
+		source TEXT,
+		PRIMARY KEY (email, phone)
+	) WITHOUT ROWID;`
+
+// Body of the CardDAV query for every card of an address book
+const carddavQuery = `<?xml version="1.0" encoding="utf-8"?>
+<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:prop><D:getetag/><C:address-data/></D:prop>
+</C:addressbook-query>`
+
+// AddressCard structure for the parts of a vCard merged into senders
+type AddressCard struct {
+	Emails  []string
+	Phones  []CardPhone
+	Company string
+	Title   string
+	// URL of the photo, or a data: URI for embedded photos
+	Photo string
+}
+
+// CardPhone structure for a phone number and its type (cell, work, home, ...)
+type CardPhone struct {
+	Number string
+	Kind   string
+	Pref   bool
+}
+
+// Run the address book merge command
+func runAddressBook(args []string) {
+	config := &Config{}
+	var carddavURL, carddavUser, passwordEnv string
+	var dryRun bool
+
+	fs := accountFlags("addressbook", config)
+	fs.StringVar(&carddavURL, "carddav", "", "CardDAV address book URL to merge instead of files")
+	fs.StringVar(&carddavUser, "carddav-user", "", "CardDAV user name (default: -user)")
+	fs.StringVar(&passwordEnv, "password-env", "CARDDAV_PASSWORD", "Environment variable holding the CardDAV password")
+	fs.BoolVar(&dryRun, "dry-run", false, "Show the matching senders without changing them")
+	parseLocalFlags(fs, config, args)
+
+	if carddavURL == "" && fs.NArg() == 0 {
+		fmt.Println("❌ Error: addressbook requires .vcf files or -carddav, e.g. peep addressbook -user john@gmail.com contacts.vcf")
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	var cards []AddressCard
+	sources := fs.Args()
+	for _, path := range sources {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("❌ Failed to open address book: %v\n", err)
+			os.Exit(1)
+		}
+		fileCards, err := parseVCards(io.LimitReader(file, maxAddressBookSize))
+		file.Close()
+		if err != nil {
+			fmt.Printf("❌ Failed to read %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		cards = append(cards, fileCards...)
+	}
+	if carddavURL != "" {
+		davCards, err := fetchCardDAV(carddavURL, firstNonEmpty(carddavUser, config.Username), logSecret(os.Getenv(passwordEnv)))
+		if err != nil {
+			log.Printf("CardDAV download failed: %v", err)
+			fmt.Printf("❌ CardDAV download failed: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		cards = append(cards, davCards...)
+		sources = append(sources, carddavURL)
+	}
+	log.Printf("Address book read: %d cards from %s", len(cards), strings.Join(sources, ", "))
+
+	matched, err := mergeAddressBook(db, config, cards, dryRun)
+	if err != nil {
+		fmt.Printf("❌ Failed to merge the address book: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	if dryRun {
+		for _, email := range matched {
+			fmt.Println(email)
+		}
+		fmt.Printf("%s would be merged (dry run)\n", plural(len(matched), "sender"))
+		return
+	}
+	log.Printf("Address book merged: %d cards, %d senders matched", len(cards), len(matched))
+	fmt.Printf("✅ Address book merged: %s matched %s\n", plural(len(cards), "card"), plural(len(matched), "sender"))
+}
+
+// Merge the cards into the senders with one of their addresses: the phone numbers,
+// company, job title and photo of a card replace the values found in signatures or
+// imports, fields the card leaves out are kept. Returns the matched senders
+func mergeAddressBook(db *sql.DB, config *Config, cards []AddressCard, dryRun bool) ([]string, error) {
+	var matched []string
+	write := func(tx *sql.Tx) error {
+		matched = nil
+		for _, card := range cards {
+			var phone string
+			if len(card.Phones) > 0 {
+				phone = card.Phones[0].Number
+				for _, p := range card.Phones {
+					if p.Pref {
+						phone = p.Number
+						break
+					}
+				}
+			}
+			for _, email := range card.Emails {
+				if dryRun {
+					var found int
+					if err := tx.QueryRow("SELECT COUNT(*) FROM senders WHERE email = ?", email).Scan(&found); err != nil {
+						return err
+					}
+					if found > 0 {
+						matched = append(matched, email)
+					}
+					continue
+				}
+
+				result, err := tx.Exec(`
+					UPDATE senders SET
+						phone = COALESCE(NULLIF(?, ''), phone),
+						company = COALESCE(NULLIF(?, ''), company),
+						job_title = COALESCE(NULLIF(?, ''), job_title),
+						photo = COALESCE(NULLIF(?, ''), photo),
+						addressbook_at = CURRENT_TIMESTAMP
+					WHERE email = ?`, phone, card.Company, card.Title, card.Photo, email)
+				if err != nil {
+					return err
+				}
+				if n, _ := result.RowsAffected(); n == 0 {
+					continue
+				}
+				matched = append(matched, email)
+
+				// Numbers of an earlier merge are replaced, so removed numbers go away
+				if _, err := tx.Exec("DELETE FROM sender_phones WHERE email = ? AND source = 'addressbook'", email); err != nil {
+					return err
+				}
+				for _, p := range card.Phones {
+					if _, err := tx.Exec("INSERT OR IGNORE INTO sender_phones (email, phone, kind, source) VALUES (?, ?, ?, 'addressbook')",
+						email, p.Number, p.Kind); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	ctx := context.Background()
+	err := retryWrite(ctx, config, "Address book merge", func() error { return inTx(ctx, db, write) })
+	return matched, err
+}
+
+// Download every card of a CardDAV address book collection
+func fetchCardDAV(url, user, password string) ([]AddressCard, error) {
+	req, err := http.NewRequest("REPORT", url, strings.NewReader(carddavQuery))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if user != "" || password != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	client := &http.Client{Timeout: carddavTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, withExitCode(exitConnection, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusMultiStatus, http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, withExitCode(exitAuth, fmt.Errorf("login rejected"))
+	default:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var multistatus struct {
+		Responses []struct {
+			Href      string `xml:"href"`
+			Propstats []struct {
+				AddressData string `xml:"prop>address-data"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxAddressBookSize)).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("invalid CardDAV response: %v", err)
+	}
+
+	var cards []AddressCard
+	for _, r := range multistatus.Responses {
+		for _, propstat := range r.Propstats {
+			if strings.TrimSpace(propstat.AddressData) == "" {
+				continue
+			}
+			parsed, err := parseVCards(strings.NewReader(propstat.AddressData))
+			if err != nil {
+				log.Printf("CardDAV card %s skipped: %v", r.Href, err)
+				continue
+			}
+			cards = append(cards, parsed...)
+		}
+	}
+	return cards, nil
+}
+
+// vcardProperty structure for one unfolded content line of a vCard
+type vcardProperty struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// Parse the cards of a vCard 2.1, 3.0 or 4.0 file
+func parseVCards(r io.Reader) ([]AddressCard, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxAddressBookSize)
+
+	// Folded lines continue with a space or tab; the first one is complete once the
+	// next unfolded line starts
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var cards []AddressCard
+	var card *AddressCard
+	for _, line := range lines {
+		prop, ok := parseVCardLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			card = &AddressCard{}
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if card != nil && len(card.Emails) > 0 {
+				cards = append(cards, *card)
+			}
+			card = nil
+		case card != nil:
+			card.add(prop)
+		}
+	}
+	return cards, nil
+}
+
+// Split a content line into its name, parameters and value
+func parseVCardLine(line string) (vcardProperty, bool) {
+	// The value starts at the first colon outside a quoted parameter value
+	quoted, split := false, -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			split = i
+			break
+		}
+	}
+	if split < 0 {
+		return vcardProperty{}, false
+	}
+
+	parts := strings.Split(line[:split], ";")
+	name := strings.ToUpper(parts[0])
+	if _, after, ok := strings.Cut(name, "."); ok {
+		name = after // item1.EMAIL
+	}
+	prop := vcardProperty{Name: name, Params: make(map[string][]string), Value: line[split+1:]}
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			// vCard 2.1 writes bare types: TEL;CELL;PREF
+			key, value = "TYPE", param
+		}
+		key = strings.ToUpper(key)
+		for _, v := range strings.Split(strings.Trim(value, `"`), ",") {
+			prop.Params[key] = append(prop.Params[key], strings.ToLower(v))
+		}
+	}
+	return prop, true
+}
+
+// Take the merged fields from a property
+func (c *AddressCard) add(prop vcardProperty) {
+	switch prop.Name {
+	case "EMAIL":
+		email := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(unescapeVCard(prop.Value), "mailto:")))
+		if strings.Contains(email, "@") && !slices.Contains(c.Emails, email) {
+			c.Emails = append(c.Emails, email)
+		}
+	case "TEL":
+		number := strings.TrimSpace(strings.TrimPrefix(unescapeVCard(prop.Value), "tel:"))
+		if number == "" {
+			return
+		}
+		types := prop.Params["TYPE"]
+		phone := CardPhone{Number: number, Pref: slices.Contains(types, "pref") || len(prop.Params["PREF"]) > 0}
+		for _, t := range types {
+			if t != "pref" && t != "voice" && t != "" {
+				phone.Kind = t
+				break
+			}
+		}
+		c.Phones = append(c.Phones, phone)
+	case "ORG":
+		// Organization name first, then units
+		c.Company = unescapeVCard(splitVCardComponents(prop.Value)[0])
+	case "TITLE":
+		c.Title = unescapeVCard(prop.Value)
+	case "PHOTO":
+		c.Photo = vcardPhoto(prop)
+	}
+}
+
+// Photo of a card as a URL or data: URI; vCard 3.0 and 2.1 embed photos as base64
+// with an image type parameter
+func vcardPhoto(prop vcardProperty) string {
+	value := strings.TrimSpace(prop.Value)
+	encoding := prop.Params["ENCODING"]
+	if !slices.Contains(encoding, "b") && !slices.Contains(encoding, "base64") {
+		return value
+	}
+	mediaType := "image/jpeg"
+	for _, t := range prop.Params["TYPE"] {
+		if t != "" {
+			mediaType = "image/" + strings.TrimPrefix(t, "image/")
+			break
+		}
+	}
+	return "data:" + mediaType + ";base64," + strings.Join(strings.Fields(value), "")
+}
+
+// Split a structured value at the semicolons that are not escaped
+func splitVCardComponents(value string) []string {
+	var components []string
+	var current strings.Builder
+	escaped := false
+	for _, c := range value {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ';':
+			components = append(components, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	return append(components, current.String())
+}
+
+// Escape sequences of vCard text values
+var vcardUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// Undo the escaping of a vCard text value
+func unescapeVCard(value string) string {
+	return strings.TrimSpace(vcardUnescaper.Replace(value))
+}
+
+// Characters escaped in vCard text values
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// Escape a vCard text value
+func escapeVCard(value string) string {
+	return vcardEscaper.Replace(strings.ReplaceAll(value, "\r", ""))
+}
+
+// Stable UID of the card of a sender, so exported cards replace earlier exports
+func cardUID(email string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(email)))
+	return fmt.Sprintf("peep-%016x", h.Sum64())
+}
+
+// Write a sender as a vCard 3.0 card
+func writeVCard(w io.Writer, s ExportedSender) error {
+	name := firstNonEmpty(s.Name, s.Email)
+	given, family := "", name
+	if i := strings.LastIndex(s.Name, " "); i > 0 {
+		given, family = s.Name[:i], s.Name[i+1:]
+	}
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"UID:" + cardUID(s.Email),
+		"FN:" + escapeVCard(name),
+		"N:" + escapeVCard(family) + ";" + escapeVCard(given) + ";;;",
+		"EMAIL;TYPE=INTERNET:" + s.Email,
+	}
+	if s.Company != "" {
+		lines = append(lines, "ORG:"+escapeVCard(s.Company))
+	}
+	if s.JobTitle != "" {
+		lines = append(lines, "TITLE:"+escapeVCard(s.JobTitle))
+	}
+	phones := s.Phones
+	if len(phones) == 0 && s.Phone != "" {
+		phones = []string{s.Phone}
+	}
+	for _, phone := range phones {
+		lines = append(lines, "TEL:"+escapeVCard(phone))
+	}
+	if photo, ok := strings.CutPrefix(s.Photo, "data:"); ok {
+		// Embedded photos are written the vCard 3.0 way, as base64 with their image type
+		if mediaType, data, ok := strings.Cut(photo, ";base64,"); ok {
+			lines = append(lines, "PHOTO;ENCODING=b;TYPE="+strings.ToUpper(strings.TrimPrefix(mediaType, "image/"))+":"+data)
+		}
+	} else if s.Photo != "" {
+		lines = append(lines, "PHOTO;VALUE=uri:"+s.Photo)
+	}
+	if s.Category != "" {
+		lines = append(lines, "CATEGORIES:"+escapeVCard(s.Category))
+	}
+	lines = append(lines, "END:VCARD")
+
+	var b strings.Builder
+	for _, line := range lines {
+		foldVCardLine(&b, line)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write a content line folded at 75 octets, continuation lines starting with a space
+func foldVCardLine(b *strings.Builder, line string) {
+	width := 75
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		width = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// Store senders as cards of a CardDAV address book collection, one PUT per card
+// named after its UID so later exports replace it
+func putCardDAV(collection, user, password string, senders []ExportedSender) error {
+	client := &http.Client{Timeout: carddavTimeout}
+	for _, s := range senders {
+		var card strings.Builder
+		writeVCard(&card, s)
+		req, err := http.NewRequest("PUT", strings.TrimSuffix(collection, "/")+"/"+cardUID(s.Email)+".vcf", strings.NewReader(card.String()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+		req.Header.Set("Content-Type", "text/vcard; charset=utf-8")
+		if user != "" || password != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return withExitCode(exitConnection, err)
+		}
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			return withExitCode(exitAuth, fmt.Errorf("login rejected"))
+		case resp.StatusCode/100 != 2:
+			return fmt.Errorf("card of %s: %s: %s", s.Email, resp.Status, strings.TrimSpace(string(detail)))
+		}
+	}
+	return nil
+}
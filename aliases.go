@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/emersion/go-message"
+)
+
+// AliasReport structure for one row of the alias report
+type AliasReport struct {
+	Alias     string
+	Senders   int
+	Messages  int
+	FirstSeen string
+	Domains   []string
+}
+
+// Own address a message was delivered to: X-Original-To, or the first Delivered-To
+// added on the way (the last one in the header), before any forwarding
+func deliveredTo(header message.Header) string {
+	value := header.Get("X-Original-To")
+	if value == "" {
+		values := header.Values("Delivered-To")
+		if len(values) == 0 {
+			return ""
+		}
+		value = values[len(values)-1]
+	}
+	value, _, _ = strings.Cut(value, ",")
+	value = strings.ToLower(strings.Trim(strings.TrimSpace(value), "<>"))
+	if !strings.Contains(value, "@") {
+		return ""
+	}
+	return value
+}
+
+// Add delivered-to address counts per sender
+func saveSenderAliases(tx *sql.Tx, stats map[string]*SenderStats) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO sender_aliases (email, alias, message_count) VALUES (?, ?, ?)
+		ON CONFLICT(email, alias) DO UPDATE SET
+			message_count = message_count + excluded.message_count, last_seen = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, s := range stats {
+		for alias, count := range s.Aliases {
+			if _, err := stmt.Exec(email, alias, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Aggregate the senders per own address they mail, showing where each address has spread
+func loadAliasReport(db *sql.DB, limit int, tags []string, includeIgnored, starred bool) ([]AliasReport, error) {
+	var conditions []string
+	condition, args := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	query := `SELECT a.alias, a.email, a.message_count, COALESCE(a.first_seen, '')
+		FROM sender_aliases a JOIN senders ON senders.email = a.email`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byAlias := make(map[string]*AliasReport)
+	domains := make(map[string]map[string]bool)
+	for rows.Next() {
+		var alias, email, firstSeen string
+		var messages int
+		if err := rows.Scan(&alias, &email, &messages, &firstSeen); err != nil {
+			return nil, err
+		}
+		r := byAlias[alias]
+		if r == nil {
+			r = &AliasReport{Alias: alias, FirstSeen: firstSeen}
+			byAlias[alias] = r
+			domains[alias] = make(map[string]bool)
+		}
+		r.Senders++
+		r.Messages += messages
+		if firstSeen != "" && (r.FirstSeen == "" || firstSeen < r.FirstSeen) {
+			r.FirstSeen = firstSeen
+		}
+		domains[alias][emailDomain(email)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var reports []AliasReport
+	for alias, r := range byAlias {
+		for domain := range domains[alias] {
+			r.Domains = append(r.Domains, domain)
+		}
+		sort.Strings(r.Domains)
+		reports = append(reports, *r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Senders != reports[j].Senders {
+			return reports[i].Senders > reports[j].Senders
+		}
+		return reports[i].Alias < reports[j].Alias
+	})
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+// Write the alias report as an aligned table or CSV
+func writeAliasReport(out io.Writer, format string, reports []AliasReport) error {
+	header := []string{"alias", "senders", "messages", "first_seen", "domains"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", r.Alias, r.Senders, r.Messages, lastSeenDate(r.FirstSeen), strings.Join(r.Domains, ", "))
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range reports {
+			w.Write([]string{r.Alias, strconv.Itoa(r.Senders), strconv.Itoa(r.Messages), r.FirstSeen, strings.Join(r.Domains, " ")})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// Earlier runs needed before a run can be judged unusual
+const minAnomalyHistory = 5
+
+// Default limits of anomaly detection
+const (
+	defaultMinNewDomains = 5
+	defaultMinChurn      = 25
+	defaultAnomalyFactor = 3.0
+	defaultAnomalyWindow = 20
+)
+
+// AnomalyConfig structure for the "anomaly" section of the config file
+type AnomalyConfig struct {
+	Disabled bool `json:"disabled"`
+	// A run is unusual above mean + factor × standard deviation of the last runs,
+	// but never below these minimums
+	MinNewDomains int     `json:"min_new_domains"`
+	MinChurn      int     `json:"min_churn"`
+	Factor        float64 `json:"factor"`
+	// Number of earlier runs forming the baseline
+	History int `json:"history"`
+}
+
+// Compare a recorded run of a scheduled scan with the runs before it and alert the
+// notifiers about bursts of new domains or sender churn, which often follow an
+// account compromise (sign-ups and password resets sent to the address)
+func checkAnomalies(db *sql.DB, config *Config, run *RunSnapshot) {
+	if run == nil {
+		return
+	}
+	var settings AnomalyConfig
+	if config.Anomaly != nil {
+		settings = *config.Anomaly
+	}
+	if settings.Disabled {
+		return
+	}
+
+	findings, err := detectAnomalies(db, settings, run)
+	if err != nil {
+		log.Printf("Anomaly check failed: %v", err)
+		return
+	}
+	if len(findings) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🚨 Unusual mail for %s (run #%d):\n", config.Username, run.ID)
+	for _, finding := range findings {
+		log.Printf("ANOMALY %s: %s", config.Username, finding)
+		fmt.Fprintf(&b, "• %s\n", finding)
+	}
+	b.WriteString("A burst of new senders can mean the address was used to sign up for services; check recent sign-ups and password resets.")
+	notifyChats(config, chatEventAnomaly, b.String())
+}
+
+// Findings of a run that stands out against the earlier runs. The first run is
+// never part of the baseline, its senders are all new
+func detectAnomalies(db *sql.DB, settings AnomalyConfig, run *RunSnapshot) ([]string, error) {
+	window := settings.History
+	if window <= 0 {
+		window = defaultAnomalyWindow
+	}
+	rows, err := db.Query(`SELECT new_domains, new_senders + gone_senders FROM runs
+		WHERE id < ? AND id > (SELECT MIN(id) FROM runs) ORDER BY id DESC LIMIT ?`, run.ID, window)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domainHistory, churnHistory []float64
+	for rows.Next() {
+		var domains, churn int
+		if err := rows.Scan(&domains, &churn); err != nil {
+			return nil, err
+		}
+		domainHistory = append(domainHistory, float64(domains))
+		churnHistory = append(churnHistory, float64(churn))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(domainHistory) < minAnomalyHistory {
+		return nil, nil
+	}
+
+	factor := settings.Factor
+	if factor <= 0 {
+		factor = defaultAnomalyFactor
+	}
+	minDomains := settings.MinNewDomains
+	if minDomains <= 0 {
+		minDomains = defaultMinNewDomains
+	}
+	minChurn := settings.MinChurn
+	if minChurn <= 0 {
+		minChurn = defaultMinChurn
+	}
+
+	var findings []string
+	if mean, limit := anomalyLimit(domainHistory, factor, minDomains); float64(run.NewDomains) > limit {
+		finding := fmt.Sprintf("%s (usually %.1f per run)", plural(run.NewDomains, "new domain"), mean)
+		if len(run.AddedDomains) > 0 {
+			shown := run.AddedDomains
+			if len(shown) > maxAlertSenders {
+				shown = shown[:maxAlertSenders]
+			}
+			finding += ": " + strings.Join(shown, ", ")
+			if len(run.AddedDomains) > len(shown) {
+				finding += fmt.Sprintf(" … and %d more", len(run.AddedDomains)-len(shown))
+			}
+		}
+		findings = append(findings, finding)
+	}
+	churn := run.NewSenders + run.GoneSenders
+	if mean, limit := anomalyLimit(churnHistory, factor, minChurn); float64(churn) > limit {
+		findings = append(findings, fmt.Sprintf("%d senders added, %d gone (usually %.1f changes per run)",
+			run.NewSenders, run.GoneSenders, mean))
+	}
+	return findings, nil
+}
+
+// Mean of the history and the value above which a run is unusual
+func anomalyLimit(history []float64, factor float64, minimum int) (float64, float64) {
+	var sum float64
+	for _, v := range history {
+		sum += v
+	}
+	mean := sum / float64(len(history))
+	var variance float64
+	for _, v := range history {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(history)))
+	return mean, math.Max(float64(minimum), mean+factor*stddev)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+)
+
+// Messages fetched per request when saving attachments
+const attachmentFetchSize = 20
+
+// AttachmentOptions structure for the attachments command
+type AttachmentOptions struct {
+	Sender  string
+	Types   string
+	Output  string
+	Mailbox string
+	DryRun  bool
+}
+
+// Attachment structure for a file found in a message
+type Attachment struct {
+	UID      uint32
+	Date     time.Time
+	Filename string
+	Type     string
+	Data     []byte
+}
+
+// Run the attachment export
+func runAttachments(args []string) {
+	config := &Config{}
+	opts := &AttachmentOptions{}
+
+	fs := accountFlags("attachments", config)
+	fs.StringVar(&opts.Sender, "sender", "", "Sender address, or @domain for every sender of a domain (required)")
+	fs.StringVar(&opts.Types, "type", "", "Comma separated file extensions or MIME types to save (default: all)")
+	fs.StringVar(&opts.Output, "o", "attachments", "Output directory")
+	fs.StringVar(&opts.Mailbox, "mailbox", "INBOX", "Mailbox to search")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "List the attachments without saving them")
+	parseFlags(fs, config, args)
+
+	opts.Sender = strings.ToLower(strings.TrimSpace(opts.Sender))
+	if !strings.Contains(opts.Sender, "@") {
+		fmt.Println("❌ Error: -sender requires an address or @domain")
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+
+	config.Pool = newIMAPPool(config)
+	defer config.Pool.close()
+	if err := exportAttachments(config, opts); err != nil {
+		log.Printf("Attachment export error: %v", err)
+		fmt.Printf("❌ Attachment export failed: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// Search a mailbox for the sender's messages and save their attachments
+func exportAttachments(config *Config, opts *AttachmentOptions) error {
+	c, err := config.Pool.get(context.Background())
+	if err != nil {
+		return err
+	}
+	defer config.Pool.put(c)
+
+	if _, err := c.Select(opts.Mailbox, true); err != nil {
+		return withExitCode(exitMailbox, fmt.Errorf("failed to select %s: %v", opts.Mailbox, err))
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("From", opts.Sender)
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return withExitCode(exitMailbox, fmt.Errorf("search failed: %v", err))
+	}
+	log.Printf("Attachment export: %d messages from %s in %s", len(uids), opts.Sender, opts.Mailbox)
+	if len(uids) == 0 {
+		fmt.Printf("No messages from %s in %s\n", opts.Sender, opts.Mailbox)
+		return nil
+	}
+
+	if !opts.DryRun {
+		if err := os.MkdirAll(opts.Output, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+
+	types := splitList(opts.Types)
+	known := existingFileHashes(opts.Output)
+	found, saved, duplicates := 0, 0, 0
+	for start := 0; start < len(uids); start += attachmentFetchSize {
+		chunk := uids[start:min(start+attachmentFetchSize, len(uids))]
+		attachments, err := fetchAttachments(c, chunk, opts.Sender, types)
+		if err != nil {
+			return withExitCode(exitMailbox, fmt.Errorf("failed to fetch messages: %v", err))
+		}
+
+		for _, a := range attachments {
+			found++
+			if opts.DryRun {
+				fmt.Printf("  %s  %s (%s, %d KB)\n", a.Date.Format(time.DateOnly), a.Filename, a.Type, (len(a.Data)+1023)/1024)
+				continue
+			}
+			sum := sha256.Sum256(a.Data)
+			if known[sum] {
+				duplicates++
+				continue
+			}
+			path, err := saveAttachment(opts.Output, a)
+			if err != nil {
+				return err
+			}
+			known[sum] = true
+			saved++
+			if config.Verbose {
+				log.Printf("Saved %s (UID %d)", path, a.UID)
+			}
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Printf("✅ %s in %d messages from %s\n", plural(found, "attachment"), len(uids), opts.Sender)
+		return nil
+	}
+	log.Printf("Attachment export completed: %d saved, %d duplicates skipped", saved, duplicates)
+	fmt.Printf("✅ Saved %s from %d messages to %s", plural(saved, "attachment"), len(uids), opts.Output)
+	if duplicates > 0 {
+		fmt.Printf(" (%d duplicates skipped)", duplicates)
+	}
+	fmt.Println()
+	return nil
+}
+
+// Fetch whole messages by UID and collect their matching attachments
+func fetchAttachments(c *client.Client, uids []uint32, sender string, types []string) ([]Attachment, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}
+
+	messages := make(chan *imap.Message, attachmentFetchSize)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, items, messages)
+	}()
+
+	var attachments []Attachment
+	for msg := range messages {
+		r := msg.GetBody(section)
+		if r == nil {
+			continue
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		entity, err := message.Read(bytes.NewReader(raw))
+		if err != nil && !message.IsUnknownCharset(err) {
+			log.Printf("Skipping UID %d: %v", msg.Uid, err)
+			continue
+		}
+		// The server search matches substrings, e.g. "bob@x.com" in "jimbob@x.com"
+		if !fromMatches(entity.Header.Get("From"), sender) {
+			continue
+		}
+		for _, a := range messageAttachments(entity, types) {
+			a.UID = msg.Uid
+			a.Date = msg.InternalDate
+			attachments = append(attachments, a)
+		}
+	}
+
+	return attachments, <-done
+}
+
+// Check if a From header contains the sender address, or an address of the @domain
+func fromMatches(from, sender string) bool {
+	addrs, err := mail.ParseAddressList(from)
+	if err != nil {
+		return strings.Contains(strings.ToLower(from), sender)
+	}
+	for _, addr := range addrs {
+		email := strings.ToLower(addr.Address)
+		if email == sender || (strings.HasPrefix(sender, "@") && strings.HasSuffix(email, sender)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect the attached files of a message, limited to the wanted types
+func messageAttachments(entity *message.Entity, types []string) []Attachment {
+	var attachments []Attachment
+
+	entity.Walk(func(path []int, part *message.Entity, err error) error {
+		if err != nil || len(path) == 0 {
+			return nil
+		}
+		mediaType, typeParams, _ := part.Header.ContentType()
+		if strings.HasPrefix(mediaType, "multipart/") {
+			return nil
+		}
+		disposition, params, _ := part.Header.ContentDisposition()
+		filename := params["filename"]
+		if filename == "" {
+			filename = typeParams["name"]
+		}
+		if disposition != "attachment" && filename == "" {
+			return nil
+		}
+		filename = attachmentFilename(filename, mediaType, len(attachments)+1)
+		if !matchesAttachmentType(filename, mediaType, types) {
+			return nil
+		}
+
+		data, err := io.ReadAll(part.Body)
+		if err != nil {
+			log.Printf("Failed to read attachment %s: %v", filename, err)
+			return nil
+		}
+		attachments = append(attachments, Attachment{Filename: filename, Type: mediaType, Data: data})
+		return nil
+	})
+
+	return attachments
+}
+
+// Safe file name for an attachment, decoding encoded words and dropping directories
+func attachmentFilename(name, mediaType string, n int) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name != "" {
+		return name
+	}
+
+	name = fmt.Sprintf("attachment-%d", n)
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
+
+// Check an attachment against the wanted extensions ("pdf") and MIME types ("image/png", "image/*")
+func matchesAttachmentType(filename, mediaType string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	for _, t := range types {
+		t = strings.TrimPrefix(strings.ToLower(t), ".")
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if t == ext || t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Content hashes of the files already in the output directory, so repeated exports
+// only add new attachments
+func existingFileHashes(dir string) map[[sha256.Size]byte]bool {
+	hashes := make(map[[sha256.Size]byte]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return hashes
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, entry.Name())); err == nil {
+			hashes[sha256.Sum256(data)] = true
+		}
+	}
+	return hashes
+}
+
+// Write an attachment without overwriting existing files, dated like its message
+func saveAttachment(dir string, a Attachment) (string, error) {
+	ext := filepath.Ext(a.Filename)
+	base := strings.TrimSuffix(a.Filename, ext)
+	path := filepath.Join(dir, a.Filename)
+	for i := 2; ; i++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to save %s: %v", a.Filename, err)
+		}
+		_, err = file.Write(a.Data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to save %s: %v", path, err)
+		}
+		if !a.Date.IsZero() {
+			os.Chtimes(path, a.Date, a.Date)
+		}
+		return path, nil
+	}
+}
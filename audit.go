@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Record of the actions that change a mailbox, remove data or send it elsewhere:
+// moves, purges, exports, uploads, webhook posts and published events. Parameters
+// are stored as JSON, with credentials redacted as in the logs
+const createAuditTable = `
+	CREATE TABLE IF NOT EXISTS audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		command TEXT,
+		action TEXT,
+		target TEXT,
+		params TEXT,
+		result TEXT,
+		error TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_created ON audit(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_action ON audit(action, created_at);`
+
+// Audited actions
+const (
+	auditMove    = "move"
+	auditPurge   = "purge"
+	auditExport  = "export"
+	auditUpload  = "upload"
+	auditMigrate = "migrate"
+	auditWebhook = "webhook"
+	auditPublish = "publish"
+	auditEmail   = "email"
+)
+
+// AuditEntry structure for one recorded action
+type AuditEntry struct {
+	ID      int64          `json:"id"`
+	Time    string         `json:"time"`
+	Command string         `json:"command"`
+	Action  string         `json:"action"`
+	Target  string         `json:"target"`
+	Params  map[string]any `json:"params,omitempty"`
+	Result  string         `json:"result"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// Record an action in the audit table of the account, with its outcome. Failing to
+// record is logged but never stops the action
+func recordAudit(config *Config, action, target string, params map[string]any, actionErr error) {
+	if config.AuditDB == nil {
+		return
+	}
+	result, message := "ok", ""
+	if actionErr != nil {
+		result, message = "failed", redactCredentials(actionErr.Error())
+	}
+	encoded := ""
+	if len(params) > 0 {
+		data, err := json.Marshal(params)
+		if err != nil {
+			log.Printf("Failed to encode audit parameters: %v", err)
+		}
+		encoded = redactCredentials(string(data))
+	}
+	_, err := config.AuditDB.Exec("INSERT INTO audit (command, action, target, params, result, error) VALUES (?, ?, ?, ?, ?, ?)",
+		config.Command, action, redactCredentials(target), encoded, result, message)
+	if err != nil {
+		log.Printf("Failed to record %s of %s in the audit log: %v", action, target, err)
+	}
+}
+
+// Connection recording the actions of a command that reads the database read-only.
+// It runs no schema upgrade: databases without the audit table, or that can't be
+// written, leave the actions unrecorded (logged)
+func openAuditDB(config *Config) *sql.DB {
+	db, _ := sql.Open("sqlite", sqliteDSN(config.DBPath))
+	return db
+}
+
+// Load audit entries, newest first
+func loadAudit(db *sql.DB, actions []string, since string, limit int) ([]AuditEntry, error) {
+	query := `SELECT id, strftime('%Y-%m-%d %H:%M:%S', created_at), COALESCE(command, ''), action, COALESCE(target, ''),
+		COALESCE(params, ''), result, COALESCE(error, '') FROM audit WHERE 1 = 1`
+	var args []any
+	var placeholders []string
+	for _, action := range actions {
+		for _, a := range strings.Split(action, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				placeholders = append(placeholders, "?")
+				args = append(args, a)
+			}
+		}
+	}
+	if len(placeholders) > 0 {
+		query += " AND action IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if since != "" {
+		query += " AND created_at >= ?"
+		args = append(args, since)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var params string
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.Command, &entry.Action, &entry.Target, &params, &entry.Result, &entry.Error); err != nil {
+			return nil, err
+		}
+		if params != "" {
+			json.Unmarshal([]byte(params), &entry.Params)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Parse -since: a duration back from now (24h, 30m) or a date (2025-01-31), as
+// the UTC timestamp stored in created_at
+func parseAuditSince(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().UTC().Add(-d).Format("2006-01-02 15:04:05"), nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day.UTC().Format("2006-01-02 15:04:05"), nil
+	}
+	return "", fmt.Errorf("invalid -since %q (use a duration like 24h or a date like 2025-01-31)", value)
+}
+
+// Run the audit command
+func runAudit(args []string) {
+	config := &Config{}
+	var actions stringList
+	var since, format string
+	var limit int
+
+	fs := accountFlags("audit", config)
+	fs.Var(&actions, "action", "Only these actions (repeatable, or comma-separated)")
+	fs.StringVar(&since, "since", "", "Only actions since a duration ago (24h) or a date (2025-01-31)")
+	fs.IntVar(&limit, "limit", 50, "Maximum number of entries")
+	fs.StringVar(&format, "format", "text", "Output format (text, json)")
+	parseLocalFlags(fs, config, args)
+
+	if format != "text" && format != "json" {
+		fmt.Printf("❌ Error: unsupported format %q (use text or json)\n", format)
+		os.Exit(exitUsage)
+	}
+	sinceTime, err := parseAuditSince(since)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	entries, err := loadAudit(db, actions, sinceTime, limit)
+	if err != nil {
+		fmt.Printf("❌ Failed to load audit log: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+		if err := encoder.Encode(entries); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME (UTC)\tCOMMAND\tACTION\tTARGET\tRESULT\tPARAMETERS")
+	for _, entry := range entries {
+		result := entry.Result
+		if entry.Error != "" {
+			result += ": " + entry.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time, entry.Command, entry.Action, entry.Target, result, formatAuditParams(entry.Params))
+	}
+	w.Flush()
+	fmt.Printf("Total entries: %d\n", len(entries))
+}
+
+// Format parameters as key=value pairs in key order
+func formatAuditParams(params map[string]any) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		value, _ := json.Marshal(params[key])
+		parts = append(parts, key+"="+strings.Trim(string(value), `"`))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// FlaggedEntry structure for a flagged sender or domain
+type FlaggedEntry struct {
+	Value  string
+	Kind   string
+	Reason string
+}
+
+// Run the flag command (add/remove/list)
+func runFlag(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: flag requires an action: add, remove or list")
+		os.Exit(1)
+	}
+	action, args := args[0], args[1:]
+
+	config := &Config{}
+	var reason string
+	fs := accountFlags("flag", config)
+	fs.StringVar(&reason, "reason", "", "Reason for flagging")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	switch action {
+	case "add":
+		for _, value := range fs.Args() {
+			entry := newFlaggedEntry(value, reason)
+			if err := addFlagged(db, entry); err != nil {
+				log.Printf("Failed to flag %s: %v", entry.Value, err)
+				fmt.Printf("❌ Failed to flag %s: %v\n", entry.Value, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Flagged %s: %s\n", entry.Kind, entry.Value)
+		}
+	case "remove":
+		for _, value := range fs.Args() {
+			entry := newFlaggedEntry(value, "")
+			if _, err := db.Exec("DELETE FROM flagged WHERE value = ?", entry.Value); err != nil {
+				log.Printf("Failed to unflag %s: %v", entry.Value, err)
+				fmt.Printf("❌ Failed to unflag %s: %v\n", entry.Value, err)
+				os.Exit(1)
+			}
+			log.Printf("Unflagged: %s", entry.Value)
+			fmt.Printf("Unflagged %s\n", entry.Value)
+		}
+	case "list":
+		entries, err := loadFlagged(db)
+		if err != nil {
+			fmt.Printf("❌ Failed to load flagged entries: %v\n", err)
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			if entry.Reason != "" {
+				fmt.Printf("  - [%s] %s (%s)\n", entry.Kind, entry.Value, entry.Reason)
+			} else {
+				fmt.Printf("  - [%s] %s\n", entry.Kind, entry.Value)
+			}
+		}
+		fmt.Printf("Total flagged: %d\n", len(entries))
+	default:
+		fmt.Printf("❌ Error: unknown flag action %q\n", action)
+		os.Exit(1)
+	}
+}
+
+// Build a flagged entry, detecting whether it is an email or a domain
+func newFlaggedEntry(value, reason string) FlaggedEntry {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.TrimPrefix(value, "*@")
+	value = strings.TrimPrefix(value, "@")
+
+	kind := "domain"
+	if strings.Contains(value, "@") {
+		kind = "email"
+	}
+
+	return FlaggedEntry{Value: value, Kind: kind, Reason: reason}
+}
+
+// Save a flagged entry
+func addFlagged(db *sql.DB, entry FlaggedEntry) error {
+	_, err := db.Exec(`
+		INSERT INTO flagged (value, kind, reason) VALUES (?, ?, ?)
+		ON CONFLICT(value) DO UPDATE SET reason = excluded.reason`,
+		entry.Value, entry.Kind, entry.Reason)
+	if err == nil {
+		log.Printf("Flagged %s: %s", entry.Kind, entry.Value)
+	}
+	return err
+}
+
+// Load all flagged entries
+func loadFlagged(db *sql.DB) ([]FlaggedEntry, error) {
+	rows, err := db.Query("SELECT value, kind, COALESCE(reason, '') FROM flagged ORDER BY kind, value")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []FlaggedEntry
+	for rows.Next() {
+		var entry FlaggedEntry
+		if err := rows.Scan(&entry.Value, &entry.Kind, &entry.Reason); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Run the blocklist export command
+func runBlocklist(args []string) {
+	config := &Config{}
+	var format, output, action string
+
+	fs := accountFlags("blocklist", config)
+	fs.StringVar(&format, "format", "spamassassin", "Output format (spamassassin, postfix, rspamd)")
+	fs.StringVar(&output, "o", "", "Output file (default: stdout)")
+	fs.StringVar(&action, "action", "REJECT", "Postfix access map action")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	entries, err := loadFlagged(db)
+	if err != nil {
+		fmt.Printf("❌ Failed to load flagged entries: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	err = writeBlocklist(out, format, action, entries)
+	recordAudit(config, auditExport, firstNonEmpty(output, "stdout"), map[string]any{"list": "blocklist", "format": format, "entries": len(entries)}, err)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	log.Printf("Blocklist exported: %d entries (%s)", len(entries), format)
+	if output != "" {
+		fmt.Printf("✅ Blocklist written to %s (%d entries)\n", output, len(entries))
+	}
+}
+
+// Write flagged entries in the given spam filter format
+func writeBlocklist(out io.Writer, format, action string, entries []FlaggedEntry) error {
+	w := bufio.NewWriter(out)
+
+	switch format {
+	case "spamassassin":
+		fmt.Fprintln(w, "# SpamAssassin blacklist generated by Peep")
+		for _, entry := range entries {
+			if entry.Kind == "domain" {
+				fmt.Fprintf(w, "blacklist_from *@%s\n", entry.Value)
+			} else {
+				fmt.Fprintf(w, "blacklist_from %s\n", entry.Value)
+			}
+		}
+	case "postfix":
+		fmt.Fprintln(w, "# Postfix sender access map generated by Peep (run postmap on this file)")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s %s\n", entry.Value, action)
+		}
+	case "rspamd":
+		fmt.Fprintln(w, "# rspamd multimap generated by Peep")
+		for _, entry := range entries {
+			fmt.Fprintln(w, entry.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported blocklist format %q", format)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Chart image size in pixels
+const (
+	chartWidth  = 800
+	chartHeight = 400
+)
+
+// Slice colors of pie charts, bars use the first
+var chartPalette = []color.RGBA{
+	{0x4e, 0x79, 0xa7, 0xff}, {0xf2, 0x8e, 0x2b, 0xff}, {0xe1, 0x57, 0x59, 0xff}, {0x76, 0xb7, 0xb2, 0xff},
+	{0x59, 0xa1, 0x4f, 0xff}, {0xed, 0xc9, 0x48, 0xff}, {0xb0, 0x7a, 0xa1, 0xff}, {0xff, 0x9d, 0xa7, 0xff},
+	{0x9c, 0x75, 0x5f, 0xff}, {0xba, 0xb0, 0xac, 0xff},
+}
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartInk        = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartGrid       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+)
+
+// ChartPoint structure for one bar or slice of a chart
+type ChartPoint struct {
+	Label string
+	Value int
+}
+
+// Chart structure for the data of a bar (timeline) or pie chart
+type Chart struct {
+	Title  string
+	Pie    bool
+	Points []ChartPoint
+}
+
+// chartShape structure for one drawing primitive, rendered as SVG or rasterized to PNG.
+// Text is anchored at its baseline ("start", "middle", "end"); slices are angles in
+// radians, clockwise from 12 o'clock
+type chartShape struct {
+	kind       string
+	x, y, w, h int
+	radius     int
+	start, end float64
+	text       string
+	scale      int
+	anchor     string
+	fill       color.RGBA
+}
+
+// Run the chart command
+func runChart(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: chart requires a type: senders-per-month, domains")
+		os.Exit(exitUsage)
+	}
+	kind, args := args[0], args[1:]
+
+	config := &Config{}
+	var format, output string
+	var months, limit int
+	var tags stringList
+	var includeIgnored, starred bool
+
+	fs := accountFlags("chart", config)
+	fs.StringVar(&output, "o", "chart.png", "Output file")
+	fs.StringVar(&format, "format", "", "Image format (png, svg; default: from the -o extension)")
+	fs.IntVar(&months, "months", 24, "Months shown by senders-per-month, up to the latest (0 = all)")
+	fs.IntVar(&limit, "limit", 8, "Slices of the domains chart, the rest is grouped as other")
+	fs.Var(&tags, "tag", "Only senders with this tag (repeatable, or comma-separated)")
+	fs.BoolVar(&includeIgnored, "include-ignored", false, "Include ignored senders")
+	fs.BoolVar(&starred, "starred", false, "Only starred senders")
+	parseLocalFlags(fs, config, args)
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	}
+	if format != "png" && format != "svg" {
+		fmt.Printf("❌ Error: unsupported chart format %q (use -format png or svg)\n", format)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	var conditions []string
+	condition, filterArgs := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	where := "senders.message_count > 0"
+	if len(conditions) > 0 {
+		where += " AND " + strings.Join(conditions, " AND ")
+	}
+
+	var chart *Chart
+	var err error
+	switch kind {
+	case "senders-per-month":
+		chart, err = loadSendersPerMonth(db, where, filterArgs, months)
+	case "domains":
+		chart, err = loadDomainShares(db, where, filterArgs, limit)
+	default:
+		fmt.Printf("❌ Error: unknown chart type %q\n", kind)
+		os.Exit(exitUsage)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to load chart data: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	if len(chart.Points) == 0 {
+		fmt.Println("❌ Nothing to chart, scan the mailbox first")
+		os.Exit(1)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("❌ Failed to create output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	if err := writeChart(file, format, chart); err != nil {
+		fmt.Printf("❌ Failed to write chart: %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Chart %s written to %s: %d points", kind, output, len(chart.Points))
+	fmt.Printf("✅ Chart written to %s\n", output)
+}
+
+// New senders per month of their first message, empty months included, ending with
+// the latest month seen. Senders stored before first messages were recorded count by
+// their last message
+func loadSendersPerMonth(db *sql.DB, where string, args []any, months int) (*Chart, error) {
+	rows, err := db.Query(`
+		SELECT substr(COALESCE(NULLIF(first_seen_at, ''), NULLIF(last_seen_at, ''), created_at), 1, 7) AS month, COUNT(*)
+		FROM senders WHERE `+where+` GROUP BY month ORDER BY month`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	var first, last time.Time
+	for rows.Next() {
+		var month string
+		var count int
+		if err := rows.Scan(&month, &count); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01", month)
+		if err != nil {
+			continue
+		}
+		counts[month] = count
+		if first.IsZero() {
+			first = t
+		}
+		last = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chart := &Chart{Title: "New senders per month"}
+	if first.IsZero() {
+		return chart, nil
+	}
+	if months > 0 {
+		if earliest := last.AddDate(0, 1-months, 0); first.Before(earliest) {
+			first = earliest
+		}
+	}
+	for t := first; !t.After(last); t = t.AddDate(0, 1, 0) {
+		month := t.Format("2006-01")
+		chart.Points = append(chart.Points, ChartPoint{Label: month, Value: counts[month]})
+	}
+	return chart, nil
+}
+
+// Messages per sender domain, the busiest limit-1 domains and the rest as "other"
+func loadDomainShares(db *sql.DB, where string, args []any, limit int) (*Chart, error) {
+	rows, err := db.Query(`
+		SELECT lower(substr(email, instr(email, '@') + 1)) AS domain, SUM(message_count)
+		FROM senders WHERE `+where+` GROUP BY domain ORDER BY 2 DESC, domain`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chart := &Chart{Title: "Messages per domain", Pie: true}
+	limit = min(max(limit, 2), len(chartPalette))
+	other := ChartPoint{Label: "other"}
+	for rows.Next() {
+		var p ChartPoint
+		if err := rows.Scan(&p.Label, &p.Value); err != nil {
+			return nil, err
+		}
+		if len(chart.Points) < limit-1 {
+			chart.Points = append(chart.Points, p)
+		} else {
+			other.Value += p.Value
+		}
+	}
+	if other.Value > 0 {
+		chart.Points = append(chart.Points, other)
+	}
+	return chart, rows.Err()
+}
+
+// Write a chart as PNG or SVG
+func writeChart(out io.Writer, format string, chart *Chart) error {
+	shapes := []chartShape{{kind: "text", x: 20, y: 30, text: chart.Title, scale: 2, anchor: "start", fill: chartInk}}
+	if chart.Pie {
+		shapes = append(shapes, pieShapes(chart.Points)...)
+	} else {
+		shapes = append(shapes, barShapes(chart.Points)...)
+	}
+
+	switch format {
+	case "png":
+		return png.Encode(out, rasterizeChart(shapes))
+	case "svg":
+		return writeChartSVG(out, shapes)
+	default:
+		return fmt.Errorf("unsupported chart format %q", format)
+	}
+}
+
+// Bars with a value axis and every label that fits under them
+func barShapes(points []ChartPoint) []chartShape {
+	left, right, top, bottom := 60, chartWidth-20, 50, chartHeight-40
+	peak := 0
+	for _, p := range points {
+		peak = max(peak, p.Value)
+	}
+	axisMax := niceAxisMax(peak)
+
+	var shapes []chartShape
+	const gridLines = 4
+	for i := 0; i <= gridLines; i++ {
+		y := bottom - (bottom-top)*i/gridLines
+		shapes = append(shapes,
+			chartShape{kind: "rect", x: left, y: y, w: right - left, h: 1, fill: chartGrid},
+			chartShape{kind: "text", x: left - 8, y: y + 4, text: fmt.Sprint(axisMax * i / gridLines), scale: 1, anchor: "end", fill: chartInk})
+	}
+
+	slot := float64(right-left) / float64(len(points))
+	labelEvery := int(math.Ceil(float64(len(points[0].Label)*chartGlyphAdvance+10) / slot))
+	for i, p := range points {
+		x := left + int(float64(i)*slot)
+		h := (bottom - top) * p.Value / axisMax
+		barWidth := max(1, int(slot*0.8))
+		shapes = append(shapes, chartShape{kind: "rect", x: x + int(slot-float64(barWidth))/2, y: bottom - h, w: barWidth, h: h, fill: chartPalette[0]})
+		if i%labelEvery == 0 {
+			shapes = append(shapes, chartShape{kind: "text", x: x + int(slot/2), y: bottom + 18, text: p.Label, scale: 1, anchor: "middle", fill: chartInk})
+		}
+	}
+	return append(shapes, chartShape{kind: "rect", x: left, y: bottom, w: right - left, h: 1, fill: chartInk})
+}
+
+// Pie slices clockwise from the top, with a legend of labels and shares
+func pieShapes(points []ChartPoint) []chartShape {
+	total := 0
+	for _, p := range points {
+		total += p.Value
+	}
+	var shapes []chartShape
+	angle := 0.0
+	for i, p := range points {
+		sweep := 2 * math.Pi * float64(p.Value) / float64(total)
+		fill := chartPalette[i%len(chartPalette)]
+		y := 80 + i*28
+		shapes = append(shapes,
+			chartShape{kind: "slice", x: 200, y: 220, radius: 150, start: angle, end: angle + sweep, fill: fill},
+			chartShape{kind: "rect", x: 400, y: y - 12, w: 14, h: 14, fill: fill},
+			chartShape{kind: "text", x: 424, y: y, text: fmt.Sprintf("%s %.0f%% (%d)", p.Label, 100*float64(p.Value)/float64(total), p.Value),
+				scale: 1, anchor: "start", fill: chartInk})
+		angle += sweep
+	}
+	return shapes
+}
+
+// Round the highest value up to a 1, 2 or 5 step of four grid lines
+func niceAxisMax(peak int) int {
+	for magnitude := 1; ; magnitude *= 10 {
+		for _, step := range []int{1, 2, 5} {
+			if step*magnitude*4 >= peak {
+				return step * magnitude * 4
+			}
+		}
+	}
+}
+
+// Draw the shapes into an image, text in the built-in bitmap font
+func rasterizeChart(shapes []chartShape) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fillRect(img, 0, 0, chartWidth, chartHeight, chartBackground)
+	for _, s := range shapes {
+		switch s.kind {
+		case "rect":
+			fillRect(img, s.x, s.y, s.w, s.h, s.fill)
+		case "slice":
+			for y := s.y - s.radius; y <= s.y+s.radius; y++ {
+				for x := s.x - s.radius; x <= s.x+s.radius; x++ {
+					dx, dy := float64(x-s.x), float64(y-s.y)
+					if dx*dx+dy*dy > float64(s.radius*s.radius) {
+						continue
+					}
+					angle := math.Atan2(dx, -dy)
+					if angle < 0 {
+						angle += 2 * math.Pi
+					}
+					if angle >= s.start && angle < s.end {
+						img.SetRGBA(x, y, s.fill)
+					}
+				}
+			}
+		case "text":
+			drawChartText(img, s)
+		}
+	}
+	return img
+}
+
+// Fill a rectangle of an image
+func fillRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	for py := y; py < y+h; py++ {
+		for px := x; px < x+w; px++ {
+			img.SetRGBA(px, py, c)
+		}
+	}
+}
+
+// Draw a text shape glyph by glyph; the bitmap font has capitals only
+func drawChartText(img *image.RGBA, s chartShape) {
+	text := []rune(strings.ToUpper(s.text))
+	x := s.x
+	switch s.anchor {
+	case "middle":
+		x -= len(text) * chartGlyphAdvance * s.scale / 2
+	case "end":
+		x -= len(text) * chartGlyphAdvance * s.scale
+	}
+	top := s.y - chartGlyphHeight*s.scale
+	for _, r := range text {
+		glyph, ok := chartGlyphs[r]
+		if !ok && r != ' ' {
+			glyph = chartGlyphs['?']
+		}
+		for row, bits := range glyph {
+			for col := 0; col < chartGlyphWidth; col++ {
+				if bits&(1<<(chartGlyphWidth-1-col)) != 0 {
+					fillRect(img, x+col*s.scale, top+row*s.scale, s.scale, s.scale, s.fill)
+				}
+			}
+		}
+		x += chartGlyphAdvance * s.scale
+	}
+}
+
+// Write the shapes as an SVG document
+func writeChartSVG(out io.Writer, shapes []chartShape) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %[1]d %[2]d" font-family="sans-serif">`+"\n",
+		chartWidth, chartHeight)
+	fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(chartBackground))
+	for _, s := range shapes {
+		switch s.kind {
+		case "rect":
+			fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", s.x, s.y, s.w, s.h, svgColor(s.fill))
+		case "slice":
+			if s.end-s.start >= 2*math.Pi-1e-9 {
+				fmt.Fprintf(w, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>`+"\n", s.x, s.y, s.radius, svgColor(s.fill))
+				continue
+			}
+			point := func(angle float64) (float64, float64) {
+				return float64(s.x) + float64(s.radius)*math.Sin(angle), float64(s.y) - float64(s.radius)*math.Cos(angle)
+			}
+			x1, y1 := point(s.start)
+			x2, y2 := point(s.end)
+			large := 0
+			if s.end-s.start > math.Pi {
+				large = 1
+			}
+			fmt.Fprintf(w, `<path d="M%d %d L%.2f %.2f A%d %d 0 %d 1 %.2f %.2f Z" fill="%s"/>`+"\n",
+				s.x, s.y, x1, y1, s.radius, s.radius, large, x2, y2, svgColor(s.fill))
+		case "text":
+			fmt.Fprintf(w, `<text x="%d" y="%d" font-size="%d" text-anchor="%s" fill="%s">%s</text>`+"\n",
+				s.x, s.y, 11*s.scale, s.anchor, svgColor(s.fill), html.EscapeString(s.text))
+		}
+	}
+	fmt.Fprintln(w, "</svg>")
+	return w.Flush()
+}
+
+// SVG notation of a color
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Chat events a notifier can subscribe to
+const (
+	chatEventSummary   = "summary"
+	chatEventNewSender = "new_sender"
+	chatEventAnomaly   = "anomaly"
+)
+
+// Senders listed in one new-sender alert
+const maxAlertSenders = 20
+
+// Base URL of the Telegram Bot API
+const telegramAPI = "https://api.telegram.org"
+
+// Control characters of Slack message text
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// NotifierConfig structure for a chat integration in the "notifiers" list of the config file
+type NotifierConfig struct {
+	Type          string   `json:"type"`
+	WebhookURL    string   `json:"webhook_url"`
+	WebhookURLEnv string   `json:"webhook_url_env"`
+	BotToken      string   `json:"bot_token"`
+	BotTokenEnv   string   `json:"bot_token_env"`
+	ChatID        string   `json:"chat_id"`
+	Events        []string `json:"events"`
+}
+
+// Check a notifier of the config file
+func validateNotifier(n NotifierConfig) error {
+	switch n.Type {
+	case "slack", "discord":
+		if n.WebhookURL == "" && n.WebhookURLEnv == "" {
+			return fmt.Errorf("%s notifier needs webhook_url or webhook_url_env", n.Type)
+		}
+	case "telegram":
+		if (n.BotToken == "" && n.BotTokenEnv == "") || n.ChatID == "" {
+			return fmt.Errorf("telegram notifier needs bot_token (or bot_token_env) and chat_id")
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %q (use slack, discord or telegram)", n.Type)
+	}
+	for _, event := range n.Events {
+		if event != chatEventSummary && event != chatEventNewSender && event != chatEventAnomaly {
+			return fmt.Errorf("unknown notifier event %q (use %s, %s or %s)", event, chatEventSummary, chatEventNewSender, chatEventAnomaly)
+		}
+	}
+	return nil
+}
+
+// Check if a notifier posts an event, summaries and anomaly alerts unless events are listed
+func (n NotifierConfig) wants(event string) bool {
+	if len(n.Events) == 0 {
+		return event == chatEventSummary || event == chatEventAnomaly
+	}
+	for _, e := range n.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if any notifier of the run posts an event
+func wantsChatEvent(config *Config, event string) bool {
+	for _, n := range config.Notifiers {
+		if n.wants(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Post a message to every notifier subscribed to the event, logging failures
+func notifyChats(config *Config, event, text string) {
+	for _, n := range config.Notifiers {
+		if !n.wants(event) {
+			continue
+		}
+		err := postChat(n, text)
+		recordAudit(config, auditWebhook, n.Type, map[string]any{"event": event}, err)
+		if err != nil {
+			log.Printf("%s notification failed: %v", n.Type, err)
+			continue
+		}
+		log.Printf("%s notification sent (%s)", n.Type, event)
+	}
+}
+
+// Alert the notifiers about senders saved for the first time
+func announceNewSenders(config *Config, senders []EmailSender) {
+	if len(senders) == 0 || !wantsChatEvent(config, chatEventNewSender) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "🆕 %s for %s:\n", plural(len(senders), "new sender"), config.Username)
+	for i, sender := range senders {
+		if i == maxAlertSenders {
+			fmt.Fprintf(&b, "… and %d more\n", len(senders)-i)
+			break
+		}
+		if sender.FullName != "" {
+			fmt.Fprintf(&b, "• %s <%s>\n", sender.FullName, sender.Email)
+		} else {
+			fmt.Fprintf(&b, "• %s\n", sender.Email)
+		}
+	}
+	notifyChats(config, chatEventNewSender, b.String())
+}
+
+// Send a text message with one notifier
+func postChat(n NotifierConfig, text string) error {
+	var url string
+	var payload map[string]string
+	switch n.Type {
+	case "slack":
+		url = logSecret(firstNonEmpty(n.WebhookURL, os.Getenv(n.WebhookURLEnv)))
+		// Slack reads <...> as links, so the angle brackets of addresses are escaped
+		payload = map[string]string{"text": slackEscaper.Replace(text)}
+	case "discord":
+		url = logSecret(firstNonEmpty(n.WebhookURL, os.Getenv(n.WebhookURLEnv)))
+		payload = map[string]string{"content": truncateRunes(text, 2000)}
+	case "telegram":
+		token := logSecret(firstNonEmpty(n.BotToken, os.Getenv(n.BotTokenEnv)))
+		if token == "" {
+			return fmt.Errorf("bot token is empty (is %s set?)", n.BotTokenEnv)
+		}
+		url = fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, token)
+		payload = map[string]string{"chat_id": n.ChatID, "text": truncateRunes(text, 4096)}
+	default:
+		return fmt.Errorf("unknown notifier type %q", n.Type)
+	}
+	if url == "" {
+		return fmt.Errorf("webhook URL is empty (is %s set?)", n.WebhookURLEnv)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error contains the URL, which holds the secret of webhooks and bot tokens
+		return fmt.Errorf("request failed: %v", redactURL(err, url))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Error text with a secret URL replaced
+func redactURL(err error, url string) string {
+	return strings.ReplaceAll(err.Error(), url, "<url>")
+}
+
+// Shorten a message to a platform's length limit
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// Sender category for receipts, shipping notices, one-time codes and alerts
+const categoryTransactional = "transactional"
+
+var (
+	transactionalSubject = regexp.MustCompile(`(?i)\b(receipt|invoice|order (confirmation|confirmed|#|number|no\.?)|your order|has shipped|shipping (confirmation|update)|out for delivery|delivered|tracking number|payment (received|confirmation|failed)|verification code|security code|login code|sign-in code|one[- ]time (pass)?code|otp|passcode|password reset|reset your password|confirm your (email|account|address)|verify your (email|account)|new sign-in|login attempt|security alert|account alert|statement is ready|booking confirmation|reservation confirmed|your ticket)\b`)
+	transactionalLocal   = regexp.MustCompile(`(?i)^(no-?reply|do-?not-?reply|notifications?|alerts?|billing|receipts?|orders?|invoices?|accounts?|security|verify|verification|auth|shipping|payments?)([._+-]|$)`)
+)
+
+// Check if a message looks like a receipt, shipping notice, one-time code or alert
+func isTransactionalMessage(header message.Header, email string) bool {
+	subject, err := header.Text("Subject")
+	if err != nil {
+		subject = header.Get("Subject")
+	}
+	if transactionalSubject.MatchString(subject) {
+		return true
+	}
+
+	// Automated notification addresses without list headers are rarely newsletters
+	local, _, _ := strings.Cut(email, "@")
+	if transactionalLocal.MatchString(local) && header.Get("List-Unsubscribe") == "" && header.Get("List-Id") == "" {
+		return true
+	}
+
+	autoSubmitted := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted")))
+	return strings.HasPrefix(autoSubmitted, "auto-generated")
+}
+
+// Mark senders whose messages are mostly transactional
+func updateSenderCategories(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE senders SET category = CASE
+			WHEN message_count > 0 AND transactional_count * 2 > message_count THEN ?
+			WHEN category = ? THEN NULL
+			ELSE category
+		END`, categoryTransactional, categoryTransactional)
+	return err
+}
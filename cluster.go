@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// A signing domain or sending network shared by more organizations than this
+// belongs to an email service provider and says nothing about ownership
+const maxSharedOrgs = 3
+
+// Shortest display name word that can name an organization
+const minBrandLength = 4
+
+// Clusters found by the last analysis pass
+const createClustersTable = `
+	CREATE TABLE IF NOT EXISTS clusters (
+		id INTEGER PRIMARY KEY,
+		name TEXT,
+		domains TEXT,
+		sender_count INTEGER DEFAULT 0,
+		reasons TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+// Mailbox providers whose users are unrelated people, never clustered
+var freeMailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "outlook.com": true, "hotmail.com": true, "live.com": true,
+	"msn.com": true, "yahoo.com": true, "ymail.com": true, "icloud.com": true, "me.com": true, "mac.com": true,
+	"aol.com": true, "proton.me": true, "protonmail.com": true, "gmx.com": true, "gmx.de": true, "gmx.net": true,
+	"web.de": true, "mail.com": true, "yandex.ru": true, "zoho.com": true, "fastmail.com": true,
+}
+
+// Words of display names that describe a department or mailing rather than the organization
+var genericNameWords = map[string]bool{
+	"team": true, "support": true, "notifications": true, "notification": true, "news": true, "newsletter": true,
+	"billing": true, "info": true, "noreply": true, "reply": true, "service": true, "services": true,
+	"customer": true, "account": true, "accounts": true, "security": true, "alerts": true, "mail": true,
+	"the": true, "from": true, "via": true, "your": true, "hello": true, "admin": true, "sales": true,
+}
+
+// SenderCluster structure for a group of senders likely belonging to one organization
+type SenderCluster struct {
+	ID       int
+	Name     string
+	Domains  []string
+	Senders  int
+	Messages int
+	Reasons  []string
+}
+
+// Run the cluster command
+func runCluster(args []string) {
+	config := &Config{}
+	var minDomains int
+
+	fs := accountFlags("cluster", config)
+	fs.IntVar(&minDomains, "min-domains", 2, "Only show clusters spanning at least this many domains")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	fmt.Println("🔗 Clustering senders by organization...")
+	clusters, err := buildClusters(db)
+	if err != nil {
+		log.Printf("Clustering failed: %v", err)
+		fmt.Printf("❌ Clustering failed: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	if err := saveClusters(db, config, clusters); err != nil {
+		log.Printf("Failed to save clusters: %v", err)
+		fmt.Printf("❌ Failed to save clusters: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tNAME\tSENDERS\tDOMAINS\tLINKED BY")
+	shown := 0
+	for _, c := range clusters {
+		if len(c.Domains) < minDomains {
+			continue
+		}
+		fmt.Fprintf(w, "#%d\t%s\t%d\t%s\t%s\n", c.ID, c.Name, c.Senders, strings.Join(c.Domains, ", "), strings.Join(c.Reasons, ", "))
+		shown++
+	}
+	w.Flush()
+	log.Printf("Clustering completed: %d clusters, %d spanning several domains", len(clusters), shown)
+	fmt.Printf("✅ %s saved, %d spanning several domains (details: report clusters)\n", plural(len(clusters), "cluster"), shown)
+}
+
+// Group senders into clusters. Senders of one organizational domain always share a
+// cluster; domains are joined when they share a DKIM signing domain, a sending
+// network (/24 or /48) or when a display name names the other domain
+func buildClusters(db *sql.DB) ([]SenderCluster, error) {
+	rows, err := db.Query("SELECT email, COALESCE(full_name, ''), COALESCE(dkim_domain, ''), spoof_suspect FROM senders")
+	if err != nil {
+		return nil, err
+	}
+	type senderRow struct {
+		org, name, dkim string
+		spoofed         bool
+	}
+	var senders []senderRow
+	orgs := make(map[string]int)
+	for rows.Next() {
+		var email, name, dkim string
+		var spoofed bool
+		if err := rows.Scan(&email, &name, &dkim, &spoofed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		org := orgDomain(emailDomain(email))
+		senders = append(senders, senderRow{org: org, name: name, dkim: dkim, spoofed: spoofed})
+		orgs[org]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	uf := newUnionFind()
+	reasons := make(map[string]map[string]bool)
+	link := func(domains map[string]bool, reason string) {
+		var members []string
+		for domain := range domains {
+			if !freeMailDomains[domain] {
+				members = append(members, domain)
+			}
+		}
+		if len(members) < 2 || len(members) > maxSharedOrgs {
+			return
+		}
+		sort.Strings(members)
+		for _, domain := range members[1:] {
+			uf.union(members[0], domain)
+		}
+		if reasons[members[0]] == nil {
+			reasons[members[0]] = make(map[string]bool)
+		}
+		reasons[members[0]][reason] = true
+	}
+
+	// Shared DKIM signing domains
+	signers := make(map[string]map[string]bool)
+	for _, s := range senders {
+		if s.dkim == "" {
+			continue
+		}
+		signer := orgDomain(s.dkim)
+		if signers[signer] == nil {
+			signers[signer] = make(map[string]bool)
+		}
+		signers[signer][s.org] = true
+	}
+	for signer, domains := range signers {
+		link(domains, "dkim "+signer)
+	}
+
+	// Shared sending networks
+	ipRows, err := db.Query("SELECT email, ip FROM sender_ips")
+	if err != nil {
+		return nil, err
+	}
+	networks := make(map[string]map[string]bool)
+	for ipRows.Next() {
+		var email, ip string
+		if err := ipRows.Scan(&email, &ip); err != nil {
+			ipRows.Close()
+			return nil, err
+		}
+		network := ipNetwork(ip)
+		if network == "" {
+			continue
+		}
+		if networks[network] == nil {
+			networks[network] = make(map[string]bool)
+		}
+		networks[network][orgDomain(emailDomain(email))] = true
+	}
+	ipRows.Close()
+	if err := ipRows.Err(); err != nil {
+		return nil, err
+	}
+	for network, domains := range networks {
+		link(domains, "network "+network)
+	}
+
+	// Display names naming another domain ("Amazon Web Services" <aws@marketing.example>),
+	// unless the label is ambiguous or the sender looks spoofed, which is how phishing works
+	labels := make(map[string]string)
+	for org := range orgs {
+		label := strings.SplitN(org, ".", 2)[0]
+		if _, taken := labels[label]; taken {
+			labels[label] = ""
+		} else {
+			labels[label] = org
+		}
+	}
+	for _, s := range senders {
+		if s.spoofed {
+			continue
+		}
+		brand := brandWord(s.name)
+		if org := labels[brand]; brand != "" && org != "" && org != s.org {
+			link(map[string]bool{org: true, s.org: true}, "name "+brand)
+		}
+	}
+
+	// Collect clusters, largest first, numbered in that order
+	members := make(map[string][]string)
+	for org := range orgs {
+		root := uf.find(org)
+		members[root] = append(members[root], org)
+	}
+	var clusters []SenderCluster
+	for _, domains := range members {
+		sort.Slice(domains, func(i, j int) bool {
+			if orgs[domains[i]] != orgs[domains[j]] {
+				return orgs[domains[i]] > orgs[domains[j]]
+			}
+			return domains[i] < domains[j]
+		})
+		c := SenderCluster{Name: domains[0], Domains: domains}
+		found := make(map[string]bool)
+		for _, domain := range domains {
+			c.Senders += orgs[domain]
+			for reason := range reasons[domain] {
+				found[reason] = true
+			}
+		}
+		for reason := range found {
+			c.Reasons = append(c.Reasons, reason)
+		}
+		sort.Strings(c.Reasons)
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Domains) != len(clusters[j].Domains) {
+			return len(clusters[i].Domains) > len(clusters[j].Domains)
+		}
+		if clusters[i].Senders != clusters[j].Senders {
+			return clusters[i].Senders > clusters[j].Senders
+		}
+		return clusters[i].Name < clusters[j].Name
+	})
+	for i := range clusters {
+		clusters[i].ID = i + 1
+	}
+	return clusters, nil
+}
+
+// Replace the stored clusters and the cluster IDs of senders
+func saveClusters(db *sql.DB, config *Config, clusters []SenderCluster) error {
+	return retryWrite(context.Background(), config, "save clusters", func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DELETE FROM clusters"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE senders SET cluster_id = NULL"); err != nil {
+			return err
+		}
+		insert, err := tx.Prepare("INSERT INTO clusters (id, name, domains, sender_count, reasons) VALUES (?, ?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		// Senders of subdomains belong to the cluster of their organizational domain
+		assign, err := tx.Prepare(`UPDATE senders SET cluster_id = ?
+			WHERE lower(substr(email, instr(email, '@') + 1)) = ? OR lower(substr(email, instr(email, '@') + 1)) LIKE ?`)
+		if err != nil {
+			return err
+		}
+		defer assign.Close()
+
+		for _, c := range clusters {
+			if _, err := insert.Exec(c.ID, c.Name, strings.Join(c.Domains, ","), c.Senders, strings.Join(c.Reasons, ", ")); err != nil {
+				return err
+			}
+			for _, domain := range c.Domains {
+				if _, err := assign.Exec(c.ID, domain, "%."+domain); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// The network of a sending IP: /24 for IPv4, /48 for IPv6
+func ipNetwork(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// First word of a display name that could name an organization, lower case
+func brandWord(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	for _, word := range words {
+		if genericNameWords[word] {
+			continue
+		}
+		if len(word) >= minBrandLength {
+			return word
+		}
+		return ""
+	}
+	return ""
+}
+
+// unionFind structure joining domains into clusters
+type unionFind struct {
+	parent map[string]string
+}
+
+// Create an empty union-find
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[string]string)}
+}
+
+// Root of an element's set
+func (u *unionFind) find(x string) string {
+	if _, ok := u.parent[x]; !ok {
+		u.parent[x] = x
+	}
+	for u.parent[x] != x {
+		u.parent[x] = u.parent[u.parent[x]]
+		x = u.parent[x]
+	}
+	return x
+}
+
+// Join the sets of two elements
+func (u *unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
+
+// Load the stored clusters with their message counts, for the cluster report
+func loadClusterReport(db *sql.DB, limit int) ([]SenderCluster, error) {
+	query := `
+		SELECT clusters.id, COALESCE(clusters.name, ''), COALESCE(clusters.domains, ''), COUNT(senders.email),
+			COALESCE(SUM(senders.message_count), 0), COALESCE(clusters.reasons, '')
+		FROM clusters LEFT JOIN senders ON senders.cluster_id = clusters.id
+		GROUP BY clusters.id ORDER BY clusters.id`
+	var args []any
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []SenderCluster
+	for rows.Next() {
+		var c SenderCluster
+		var domains, reasons string
+		if err := rows.Scan(&c.ID, &c.Name, &domains, &c.Senders, &c.Messages, &reasons); err != nil {
+			return nil, err
+		}
+		c.Domains = strings.Split(domains, ",")
+		if reasons != "" {
+			c.Reasons = strings.Split(reasons, ", ")
+		}
+		clusters = append(clusters, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters yet; run peep cluster first")
+	}
+	return clusters, nil
+}
+
+// Write the cluster report as an aligned table or CSV
+func writeClusterReport(out io.Writer, format string, clusters []SenderCluster) error {
+	header := []string{"cluster", "name", "senders", "messages", "domains", "linked_by"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, c := range clusters {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n", c.ID, c.Name, c.Senders, c.Messages,
+				strings.Join(c.Domains, ", "), strings.Join(c.Reasons, ", "))
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, c := range clusters {
+			w.Write([]string{strconv.Itoa(c.ID), c.Name, strconv.Itoa(c.Senders), strconv.Itoa(c.Messages),
+				strings.Join(c.Domains, " "), strings.Join(c.Reasons, "; ")})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/emersion/go-message"
+)
+
+// CompanyMapping structure for a domain-to-company override from the "companies"
+// list of the config file, e.g. mail sent through Amazon SES for Acme:
+//
+//	{"domain": "*.amazonses.com", "header": "X-SES-Outgoing", "company": "Acme Corp"}
+type CompanyMapping struct {
+	// Domain of the From address, Return-Path or DKIM signature; "*." also matches subdomains
+	Domain string `json:"domain"`
+	// Optional header the message must carry, "Name" or "Name: regex" to match its value
+	Header  string `json:"header"`
+	Company string `json:"company"`
+
+	headerName  string
+	headerValue *regexp.Regexp
+}
+
+// CompanyReport structure for one row of the company report
+type CompanyReport struct {
+	Company  string
+	Domains  []string
+	Senders  int
+	Messages int
+	AvgScore float64
+}
+
+// Check and prepare a company mapping of the config file
+func compileCompanyMapping(m CompanyMapping) (CompanyMapping, error) {
+	m.Domain = strings.ToLower(strings.TrimSpace(m.Domain))
+	m.Company = strings.TrimSpace(m.Company)
+	if m.Domain == "" || m.Company == "" {
+		return m, fmt.Errorf("company mapping needs domain and company")
+	}
+	if strings.Contains(strings.TrimPrefix(m.Domain, "*."), "*") {
+		return m, fmt.Errorf("company mapping %q: only a leading *. is supported", m.Domain)
+	}
+	if m.Header != "" {
+		name, value, hasValue := strings.Cut(m.Header, ":")
+		m.headerName = strings.TrimSpace(name)
+		if hasValue {
+			re, err := regexp.Compile("(?i)" + strings.TrimSpace(value))
+			if err != nil {
+				return m, fmt.Errorf("company mapping %q: %v", m.Header, err)
+			}
+			m.headerValue = re
+		}
+	}
+	return m, nil
+}
+
+// Check if the pattern of a mapping matches any of the domains
+func (m CompanyMapping) matchesDomain(domains ...string) bool {
+	for _, domain := range domains {
+		if domain == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(m.Domain, "*."); ok {
+			if domainInList(domain, []string{rest}) {
+				return true
+			}
+		} else if domain == m.Domain {
+			return true
+		}
+	}
+	return false
+}
+
+// Company of a message by the first matching mapping, empty if none matches
+func companyForMessage(mappings []CompanyMapping, header message.Header, domains ...string) string {
+	for _, m := range mappings {
+		if !m.matchesDomain(domains...) {
+			continue
+		}
+		if m.headerName != "" {
+			values := header.Values(m.headerName)
+			if len(values) == 0 {
+				continue
+			}
+			if m.headerValue != nil && !anyMatch(m.headerValue, values) {
+				continue
+			}
+		}
+		return m.Company
+	}
+	return ""
+}
+
+// Company of a stored sender by the mappings that need no headers
+func companyForSender(mappings []CompanyMapping, domains ...string) string {
+	for _, m := range mappings {
+		if m.headerName == "" && m.matchesDomain(domains...) {
+			return m.Company
+		}
+	}
+	return ""
+}
+
+// Check if any value matches a regex
+func anyMatch(re *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregate senders per company: the configured mapping, the company recorded at
+// scan time (header mappings) or else the organizational domain
+func loadCompanyReport(db *sql.DB, config *Config, limit int, tags []string, includeIgnored, starred bool) ([]CompanyReport, error) {
+	var conditions []string
+	condition, args := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	query := `SELECT email, COALESCE(return_path, ''), COALESCE(dkim_domain, ''), COALESCE(organization, ''),
+		message_count, score FROM senders`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byCompany := make(map[string]*CompanyReport)
+	domains := make(map[string]map[string]bool)
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var email, returnPath, dkim, organization string
+		var messages int
+		var score float64
+		if err := rows.Scan(&email, &returnPath, &dkim, &organization, &messages, &score); err != nil {
+			return nil, err
+		}
+		domain := emailDomain(email)
+		company := firstNonEmpty(companyForSender(config.Companies, domain, returnPath, dkim), organization, orgDomain(domain))
+		r := byCompany[company]
+		if r == nil {
+			r = &CompanyReport{Company: company}
+			byCompany[company] = r
+			domains[company] = make(map[string]bool)
+		}
+		r.Senders++
+		r.Messages += messages
+		scores[company] += score
+		domains[company][domain] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var reports []CompanyReport
+	for company, r := range byCompany {
+		for domain := range domains[company] {
+			r.Domains = append(r.Domains, domain)
+		}
+		sort.Strings(r.Domains)
+		r.AvgScore = scores[company] / float64(r.Senders)
+		reports = append(reports, *r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Messages != reports[j].Messages {
+			return reports[i].Messages > reports[j].Messages
+		}
+		return reports[i].Company < reports[j].Company
+	})
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+// Write the company report as an aligned table or CSV
+func writeCompanyReport(out io.Writer, format string, reports []CompanyReport) error {
+	header := []string{"company", "senders", "messages", "avg_score", "domains"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\n", r.Company, r.Senders, r.Messages, r.AvgScore, strings.Join(r.Domains, ", "))
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range reports {
+			w.Write([]string{r.Company, strconv.Itoa(r.Senders), strconv.Itoa(r.Messages),
+				strconv.FormatFloat(r.AvgScore, 'f', 1, 64), strings.Join(r.Domains, " ")})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CompletionCommand structure describing a command for shell completion
+type CompletionCommand struct {
+	Name    string
+	Actions []string
+	// Command specific flags; a trailing "=" marks flags that take a value
+	Flags []string
+	// Fixed values of command specific flags
+	Values map[string][]string
+	// Whether the command accepts the common account flags, and the scan flags on top
+	Account bool
+	Scan    bool
+}
+
+// Commands offered by shell completion, in usage order
+var completionCommands = []CompletionCommand{
+	{Name: "scan", Account: true, Scan: true},
+	{Name: "retry", Account: true, Scan: true},
+	{Name: "watch", Account: true, Scan: true},
+	{Name: "verify-progress", Account: true},
+	{Name: "quarantine", Actions: []string{"list", "reprocess", "clear"}, Account: true},
+	{Name: "reprocess", Account: true},
+	{Name: "reextract", Flags: []string{"dry-run"}, Account: true},
+	{Name: "organize", Flags: []string{"by=", "prefix=", "mailbox=", "min=", "dry-run"},
+		Values: map[string][]string{"by": {"domain", "tag"}}, Account: true},
+	{Name: "attachments", Flags: []string{"sender=", "type=", "o=", "mailbox=", "dry-run"}, Account: true},
+	{Name: "flag", Actions: []string{"add", "remove", "list"}, Flags: []string{"reason="}, Account: true},
+	{Name: "tag", Actions: []string{"add", "remove", "list"}, Account: true},
+	{Name: "note", Actions: []string{"add", "remove", "list"}, Account: true},
+	{Name: "ignore", Actions: []string{"add", "remove", "list"}, Account: true},
+	{Name: "star", Actions: []string{"add", "remove", "list"}, Account: true},
+	{Name: "blocklist", Flags: []string{"format=", "o=", "action="},
+		Values: map[string][]string{"format": {"spamassassin", "postfix", "rspamd"}}, Account: true},
+	{Name: "export", Flags: []string{"format=", "o=", "include-transactional", "include-ignored", "starred", "tag=", "upload=", "to=", "since-last", "watermark=", "remote="},
+		Values: map[string][]string{"format": {"csv", "json", "vcard"}, "to": {"gsheet"}}, Account: true},
+	{Name: "diff", Flags: []string{"runs", "format="},
+		Values: map[string][]string{"format": {"text", "json"}}, Account: true},
+	{Name: "report", Actions: []string{"domains", "clusters", "companies", "unread", "aliases", "leaks", "summary"},
+		Flags:  []string{"format=", "o=", "limit=", "tag=", "include-ignored", "starred", "min-messages=", "max-read-rate="},
+		Values: map[string][]string{"format": {"text", "csv", "pdf"}}, Account: true},
+	{Name: "chart", Actions: []string{"senders-per-month", "domains"},
+		Flags:  []string{"o=", "format=", "months=", "limit=", "tag=", "include-ignored", "starred"},
+		Values: map[string][]string{"format": {"png", "svg"}}, Account: true},
+	{Name: "graph", Flags: []string{"o=", "format=", "min-messages=", "tag=", "include-ignored", "starred"},
+		Values: map[string][]string{"format": {"gexf", "dot"}}, Account: true},
+	{Name: "stats", Flags: []string{"remote="}, Account: true},
+	{Name: "show", Flags: []string{"format="},
+		Values: map[string][]string{"format": {"text", "json"}}, Account: true},
+	{Name: "cluster", Flags: []string{"min-domains="}, Account: true},
+	{Name: "search", Flags: []string{"limit=", "include-ignored"}, Account: true},
+	{Name: "list", Flags: []string{"sort=", "limit=", "offset=", "filter=", "format=", "o=", "include-ignored", "starred", "remote="},
+		Values: map[string][]string{"sort": {"count", "flagged", "last_seen", "name", "score", "email"}, "format": {"table", "csv", "json"},
+			"filter": {"domain=", "email=", "name=", "company=", "category=", "tag="}}, Account: true},
+	{Name: "repl", Flags: []string{"include-ignored"}, Account: true},
+	{Name: "query", Flags: []string{"sql=", "arg=", "format=", "o=", "remote="},
+		Values: map[string][]string{"format": {"text", "csv", "json"}}, Account: true},
+	{Name: "audit", Flags: []string{"action=", "since=", "limit=", "format="},
+		Values: map[string][]string{"action": {"move", "purge", "export", "upload", "migrate", "webhook", "publish", "email"},
+			"format": {"text", "json"}}, Account: true},
+	{Name: "geoip", Flags: []string{"country-db=", "asn-db=", "refresh"}, Account: true},
+	{Name: "rdns", Flags: []string{"refresh"}, Account: true},
+	{Name: "hibp", Flags: []string{"account=", "key-env="}, Account: true},
+	{Name: "verify", Flags: []string{"smtp", "from=", "helo=", "delay=", "timeout=", "limit=", "refresh"}, Account: true},
+	{Name: "import", Flags: []string{"format=", "map="},
+		Values: map[string][]string{"format": {"csv", "json"}}, Account: true},
+	{Name: "addressbook", Flags: []string{"carddav=", "carddav-user=", "password-env=", "dry-run"}, Account: true},
+	{Name: "db", Actions: []string{"migrate"}, Flags: []string{"to=", "schema=", "drop", "dry-run"}, Account: true},
+	{Name: "accounts", Actions: []string{"run", "status"},
+		Flags: []string{"accounts=", "workers=", "log=", "log-stdout", "data-dir=", "layout=", "encrypt-to=", "redact-emails", "help"}},
+	{Name: "service", Actions: []string{"install", "uninstall", "run"},
+		Flags: []string{"accounts=", "interval=", "name=", "dir=", "user-unit", "log-stdout", "data-dir=", "layout=", "encrypt-to=", "redact-emails", "dry-run", "help"}},
+	{Name: "serve", Flags: []string{"listen=", "data-dir=", "layout=", "token-env=", "tls-cert=", "tls-key=", "max-rows=", "scan-interval=", "workers=",
+		"log-stdout", "encrypt-to=", "redact-emails", "help"}},
+	{Name: "tenants", Actions: []string{"add", "list", "remove", "token", "tokens", "revoke", "enroll", "mailboxes", "unenroll"},
+		Flags: []string{"remote=", "label=", "server=", "pass=", "pass-env=", "folders="}},
+	{Name: "oauth", Actions: []string{"login", "status", "logout"},
+		Flags:  []string{"provider=", "client-id=", "client-secret-env=", "auth-url=", "token-url=", "scope="},
+		Values: map[string][]string{"provider": {"google", "microsoft"}}, Account: true},
+	{Name: "keygen", Flags: []string{"o="}},
+	{Name: "decrypt", Flags: []string{"identity=", "o="}},
+	{Name: "version", Flags: []string{"json"}},
+	{Name: "self-update", Flags: []string{"check", "force", "repo=", "version=", "insecure"}},
+	{Name: "completion", Actions: []string{"bash", "zsh", "fish"}},
+}
+
+// Fixed values of flags shared by several commands
+var completionValues = map[string][]string{
+	"layout":      {"user", "flat"},
+	"tail-format": {"text", "json"},
+}
+
+const bashCompletion = `# bash completion for peep
+_peep() {
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(peep completion __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _peep peep
+`
+
+const zshCompletion = `#compdef peep
+# zsh completion for peep
+_peep() {
+    local -a candidates
+    candidates=("${(@f)$(peep completion __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _peep peep
+`
+
+const fishCompletion = `# fish completion for peep
+function __peep_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    peep completion __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c peep -a '(__peep_complete)'
+`
+
+// Run the completion command
+func runCompletion(args []string) {
+	if len(args) == 0 {
+		fmt.Println("❌ Error: completion requires a shell: bash, zsh, fish")
+		os.Exit(exitUsage)
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	case "__complete":
+		for _, candidate := range completeWords(args[1:]) {
+			fmt.Println(candidate)
+		}
+	default:
+		fmt.Printf("❌ Error: unsupported shell %q (use bash, zsh or fish)\n", args[0])
+		os.Exit(exitUsage)
+	}
+}
+
+// Candidates for the last of the typed words (the one being completed)
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+
+	// Without a command the scanner runs, so flags complete as scan flags
+	command := completionCommands[0]
+	if len(words) == 1 && !strings.HasPrefix(current, "-") {
+		var names []string
+		for _, c := range completionCommands {
+			names = append(names, c.Name)
+		}
+		return filterPrefix(names, current)
+	}
+	for _, c := range completionCommands {
+		if c.Name == words[0] {
+			command = c
+		}
+	}
+
+	// Value of the previous flag
+	if len(words) >= 2 {
+		if name, ok := strings.CutPrefix(words[len(words)-2], "-"); ok {
+			name = strings.TrimPrefix(name, "-")
+			switch {
+			case name == "user":
+				return filterPrefix(completionUsers(words), current)
+			case command.Values[name] != nil:
+				return filterPrefix(command.Values[name], current)
+			case completionValues[name] != nil:
+				return filterPrefix(completionValues[name], current)
+			case takesValue(command, name):
+				return nil
+			}
+		}
+	}
+
+	if strings.HasPrefix(current, "-") {
+		var flags []string
+		for _, name := range commandFlags(command) {
+			flags = append(flags, "-"+strings.TrimSuffix(name, "="))
+		}
+		return filterPrefix(flags, current)
+	}
+
+	if len(command.Actions) > 0 && len(words) == 2 && command.Name == words[0] {
+		return filterPrefix(command.Actions, current)
+	}
+	return nil
+}
+
+// All flags of a command, value flags marked with a trailing "="
+func commandFlags(command CompletionCommand) []string {
+	flags := append([]string(nil), command.Flags...)
+	collect := func(fs *flag.FlagSet) {
+		fs.VisitAll(func(f *flag.Flag) {
+			name := f.Name
+			if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !boolFlag.IsBoolFlag() {
+				name += "="
+			}
+			for _, existing := range flags {
+				if existing == name {
+					return
+				}
+			}
+			flags = append(flags, name)
+		})
+	}
+
+	switch {
+	case command.Scan:
+		collect(scanFlags(&Config{}))
+	case command.Account:
+		collect(accountFlags(command.Name, &Config{}))
+	}
+	return flags
+}
+
+// Whether a flag of the command expects a value
+func takesValue(command CompletionCommand, name string) bool {
+	for _, flagName := range commandFlags(command) {
+		if flagName == name+"=" {
+			return true
+		}
+	}
+	return false
+}
+
+// Account names from the accounts file (-accounts on the command line, else accounts.json)
+func completionUsers(words []string) []string {
+	path := "accounts.json"
+	for i, word := range words[:len(words)-1] {
+		if (word == "-accounts" || word == "--accounts") && i+1 < len(words)-1 {
+			path = words[i+1]
+		}
+	}
+
+	accounts, err := loadAccountsFile(path)
+	if err != nil {
+		return nil
+	}
+	var users []string
+	seen := make(map[string]bool)
+	for _, account := range accounts.Accounts {
+		if !seen[account.User] {
+			seen[account.User] = true
+			users = append(users, account.User)
+		}
+	}
+	return users
+}
+
+// Keep the values starting with prefix
+func filterPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			matches = append(matches, value)
+		}
+	}
+	return matches
+}
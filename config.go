@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileConfig structure for the optional JSON config file
+type FileConfig struct {
+	SkipDomains []string     `json:"skip_domains"`
+	OnlyDomains []string     `json:"only_domains"`
+	Rules       []RuleConfig `json:"rules"`
+	// Group ESP and vanity domains under the real company in reports
+	Companies []CompanyMapping `json:"companies"`
+	// Email a summary after each scan
+	SummaryEmail *SummaryConfig `json:"summary_email"`
+	// Chat integrations for summaries and new-sender alerts
+	Notifiers []NotifierConfig `json:"notifiers"`
+	// Publish new-sender and scan status events to an MQTT broker
+	MQTT *MQTTConfig `json:"mqtt"`
+	// Publish every new sender to NATS or Kafka for data pipelines
+	NATS  *NATSConfig  `json:"nats"`
+	Kafka *KafkaConfig `json:"kafka"`
+	// Credentials of export upload destinations
+	Upload *UploadConfig `json:"upload"`
+	// Credentials and tab of the Google Sheets export
+	GSheet *GSheetConfig `json:"gsheet"`
+	// Alerts on bursts of new domains or sender churn in scheduled scans
+	Anomaly *AnomalyConfig `json:"anomaly"`
+	// Retries of failed connects, fetches and database writes
+	Retry *RetryConfig `json:"retry"`
+}
+
+// RuleConfig structure for a sender rule in the config file
+type RuleConfig struct {
+	Pattern string `json:"pattern"`
+	Field   string `json:"field"`
+	Action  string `json:"action"`
+	Tag     string `json:"tag"`
+}
+
+// Load the JSON config file
+func loadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig FileConfig
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return &fileConfig, nil
+}
+
+// Merge config file settings into the command line config
+func applyFileConfig(config *Config, fileConfig *FileConfig) error {
+	config.SkipDomains = append(config.SkipDomains, normalizeDomains(fileConfig.SkipDomains)...)
+	config.OnlyDomains = append(config.OnlyDomains, normalizeDomains(fileConfig.OnlyDomains)...)
+	if fileConfig.SummaryEmail != nil {
+		config.SummaryEmail = fileConfig.SummaryEmail
+	}
+	if fileConfig.MQTT != nil {
+		if err := validateMQTT(fileConfig.MQTT); err != nil {
+			return err
+		}
+		config.MQTT = fileConfig.MQTT
+	}
+	if fileConfig.NATS != nil {
+		if err := validateNATS(fileConfig.NATS); err != nil {
+			return err
+		}
+		config.NATS = fileConfig.NATS
+	}
+	if fileConfig.Kafka != nil {
+		if err := validateKafka(fileConfig.Kafka); err != nil {
+			return err
+		}
+		config.Kafka = fileConfig.Kafka
+	}
+	if fileConfig.Upload != nil {
+		config.Upload = fileConfig.Upload
+	}
+	if fileConfig.GSheet != nil {
+		config.GSheet = fileConfig.GSheet
+	}
+	if fileConfig.Anomaly != nil {
+		config.Anomaly = fileConfig.Anomaly
+	}
+	if fileConfig.Retry != nil {
+		policy, err := compileRetryPolicy(fileConfig.Retry)
+		if err != nil {
+			return err
+		}
+		config.Retry = policy
+	}
+	for _, mapping := range fileConfig.Companies {
+		compiled, err := compileCompanyMapping(mapping)
+		if err != nil {
+			return err
+		}
+		config.Companies = append(config.Companies, compiled)
+	}
+	for _, notifier := range fileConfig.Notifiers {
+		if err := validateNotifier(notifier); err != nil {
+			return err
+		}
+		config.Notifiers = append(config.Notifiers, notifier)
+	}
+
+	for _, ruleConfig := range fileConfig.Rules {
+		rule, err := compileSenderRule(ruleConfig)
+		if err != nil {
+			return err
+		}
+		config.Rules = append(config.Rules, rule)
+	}
+
+	return nil
+}
+
+// Split a comma separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Lowercase domains and strip leading "@" or "*."
+func normalizeDomains(domains []string) []string {
+	var normalized []string
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		domain = strings.TrimPrefix(domain, "@")
+		domain = strings.TrimPrefix(domain, "*.")
+		if domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
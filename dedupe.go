@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap"
+)
+
+// Tables of the messages counted so far, keyed by an ID all copies of a message
+// share: Gmail's X-GM-MSGID, or on other servers a hash of the Message-ID header
+const (
+	gmailMessagesTable = "gmail_messages"
+	messageIDsTable    = "message_ids"
+)
+
+// Message-ID hashes counted so far with the folder and UID of the copy counted
+const createMessageIDsTable = `
+	CREATE TABLE IF NOT EXISTS message_ids (
+		msgid INTEGER PRIMARY KEY,
+		folder TEXT,
+		uid INTEGER,
+		recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+// messageKey structure for the ID shared by the copies of a message and the table
+// it is recorded in
+type messageKey struct {
+	Table string
+	ID    uint64
+}
+
+// messageCopy structure for the folder and UID a message was counted in
+type messageCopy struct {
+	Folder string
+	UID    uint32
+}
+
+// countedMessage structure for a message counted first in a batch
+type countedMessage struct {
+	Key messageKey
+	UID uint32
+}
+
+// Key of a fetched message: its Gmail message ID, else the hash of the Message-ID
+// of its senders; false for messages without either
+func countedMessageKey(msg *imap.Message, senders []EmailSender) (messageKey, bool) {
+	if id := gmailMessageID(msg); id != 0 {
+		return messageKey{gmailMessagesTable, id}, true
+	}
+	if len(senders) > 0 && senders[0].MessageID != "" {
+		return messageKey{messageIDsTable, hashMessageID(senders[0].MessageID)}, true
+	}
+	return messageKey{}, false
+}
+
+// 64-bit hash of a Message-ID, without its angle brackets and case-insensitive
+// as some servers rewrite the domain part
+func hashMessageID(messageID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(strings.Trim(strings.TrimSpace(messageID), "<>"))))
+	return h.Sum64()
+}
+
+// countedMessages structure for the messages counted so far. A message copied or
+// labeled into several folders (Gmail shows one message in the folder of each of its
+// labels) has a copy with its own UID in each; only the copy in the folder that
+// counted it first is counted again
+type countedMessages struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	counted map[messageKey]messageCopy
+}
+
+// Track the messages counted in this run and those stored by earlier scans
+func newCountedMessages(db *sql.DB) *countedMessages {
+	return &countedMessages{db: db, counted: make(map[messageKey]messageCopy)}
+}
+
+// Claim a message for counting in folder. False with the counted copy when the
+// message was already counted from another folder; copies in the same folder (a
+// retried batch, a message filed twice) are counted
+func (m *countedMessages) claim(key messageKey, folder string, uid uint32) (messageCopy, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if first, ok := m.counted[key]; ok {
+		return first, first.Folder == folder
+	}
+
+	var first messageCopy
+	err := m.db.QueryRow(fmt.Sprintf("SELECT folder, uid FROM %s WHERE msgid = ?", key.Table), int64(key.ID)).Scan(&first.Folder, &first.UID)
+	if err == nil {
+		m.counted[key] = first
+		return first, first.Folder == folder
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Counted message lookup error: %v", err)
+	}
+	m.counted[key] = messageCopy{Folder: folder, UID: uid}
+	return m.counted[key], true
+}
+
+// Give up the claims of a batch of folder that was not stored, so a copy in another
+// folder counts the message instead of it being skipped everywhere
+func (m *countedMessages) release(folder string, messages []countedMessage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range messages {
+		if first, ok := m.counted[c.Key]; ok && first == (messageCopy{Folder: folder, UID: c.UID}) {
+			delete(m.counted, c.Key)
+		}
+	}
+}
+
+// Record the messages counted first in a batch of folder
+func saveCountedMessages(tx *sql.Tx, folder string, messages []countedMessage) error {
+	for _, table := range []string{gmailMessagesTable, messageIDsTable} {
+		var stmt *sql.Stmt
+		for _, m := range messages {
+			if m.Key.Table != table {
+				continue
+			}
+			if stmt == nil {
+				var err error
+				if stmt, err = tx.Prepare(fmt.Sprintf("INSERT OR IGNORE INTO %s (msgid, folder, uid) VALUES (?, ?, ?)", table)); err != nil {
+					return err
+				}
+				defer stmt.Close()
+			}
+			if _, err := stmt.Exec(int64(m.Key.ID), folder, m.UID); err != nil {
+				return fmt.Errorf("message %d: %v", m.UID, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status files and logs name the addresses of a mailbox, so on shared servers they
+// can be encrypted to a public key: only the holder of the secret key (peep keygen)
+// can read them with peep decrypt. Keys are X25519; every writer (a log opened by
+// one run, a status file) draws an ephemeral key and seals its records with
+// AES-256-GCM under a key derived with HKDF-SHA256, like a NaCl sealed box.
+//
+// An encrypted file is a sequence of records, each written with one write so runs
+// appending to the same daily log never split each other's records:
+//
+//	"PEEP" 'K' id[8] ephemeral[32]                  key of segment id
+//	"PEEP" 'D' id[8] counter[8] length[4] sealed    data sealed with the key of id
+const (
+	sealMagic       = "PEEP"
+	sealKeyRecord   = 'K'
+	sealDataRecord  = 'D'
+	sealInfo        = "peep artifact v1"
+	maxSealedRecord = 16 << 20
+
+	// Prefixes of encoded keys
+	publicKeyPrefix = "peep-pub-"
+	secretKeyPrefix = "PEEP-SECRET-KEY-"
+
+	// Suffix of encrypted status and log files
+	encryptedSuffix = ".enc"
+)
+
+// Public key status files and logs are encrypted to, nil when they are written
+// in plain text. Set once at startup, for every account of the process
+var artifactRecipient *ecdh.PublicKey
+
+// Encrypt status files and logs to a public key
+func setArtifactRecipient(value string) error {
+	key, err := parsePublicKey(value)
+	if err != nil {
+		return err
+	}
+	artifactRecipient = key
+	return nil
+}
+
+// Path a status file or log is written to: with .enc appended when encrypted
+func artifactPath(path string) string {
+	if artifactRecipient == nil {
+		return path
+	}
+	return path + encryptedSuffix
+}
+
+// Decode a public key (peep-pub-...)
+func parsePublicKey(value string) (*ecdh.PublicKey, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(value), publicKeyPrefix)
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("invalid public key %q (expected %s..., see peep keygen)", value, publicKeyPrefix)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// Encode a public key
+func formatPublicKey(key *ecdh.PublicKey) string {
+	return publicKeyPrefix + base64.RawURLEncoding.EncodeToString(key.Bytes())
+}
+
+// Read the secret key of a key file, skipping comment lines
+func loadSecretKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if encoded, ok := strings.CutPrefix(strings.TrimSpace(line), secretKeyPrefix); ok {
+			raw, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret key in %s", path)
+			}
+			return ecdh.X25519().NewPrivateKey(raw)
+		}
+	}
+	return nil, fmt.Errorf("no secret key in %s", path)
+}
+
+// Derive the AEAD of a segment from the X25519 shared secret
+func segmentAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, shared, append(append([]byte(nil), ephemeral...), recipient...), sealInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWriter structure for a writer encrypting each Write as one data record of
+// its own segment, preceded by the segment key on the first Write
+type sealWriter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	aead    cipher.AEAD
+	id      [8]byte
+	header  []byte
+	counter uint64
+}
+
+// Start a segment encrypted to recipient
+func newSealWriter(w io.Writer, recipient *ecdh.PublicKey) (*sealWriter, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	s := &sealWriter{w: w}
+	if s.aead, err = segmentAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes()); err != nil {
+		return nil, err
+	}
+	rand.Read(s.id[:])
+	s.header = append(append(append([]byte(sealMagic), sealKeyRecord), s.id[:]...), ephemeral.PublicKey().Bytes()...)
+	return s, nil
+}
+
+// Encrypt p as one record
+func (s *sealWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], s.counter)
+	record := append([]byte(nil), s.header...)
+	record = append(append(append(record, sealMagic...), sealDataRecord), s.id[:]...)
+	record = binary.BigEndian.AppendUint64(record, s.counter)
+	record = binary.BigEndian.AppendUint32(record, uint32(len(p)+s.aead.Overhead()))
+	record = s.aead.Seal(record, nonce, p, s.id[:])
+	if _, err := s.w.Write(record); err != nil {
+		return 0, err
+	}
+	s.header = nil
+	s.counter++
+	return len(p), nil
+}
+
+// Encrypt data as a file of its own
+func sealBytes(recipient *ecdh.PublicKey, data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	s, err := newSealWriter(&out, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Write(data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Decrypt an encrypted file to out, returning the number of damaged records skipped
+// (e.g. the last record of a run killed while writing)
+func openSealed(r io.Reader, identity *ecdh.PrivateKey, out io.Writer) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	segments := make(map[[8]byte]cipher.AEAD)
+	opened, skipped := 0, 0
+	for len(data) > 0 {
+		plain, size, ok := openRecord(data, identity, segments)
+		if !ok {
+			// Resynchronize at the next record
+			skipped++
+			next := bytes.Index(data[1:], []byte(sealMagic))
+			if next < 0 {
+				break
+			}
+			data = data[1+next:]
+			continue
+		}
+		if plain != nil {
+			if _, err := out.Write(plain); err != nil {
+				return skipped, err
+			}
+			opened++
+		}
+		data = data[size:]
+	}
+	if opened == 0 && skipped > 0 {
+		return skipped, fmt.Errorf("cannot decrypt, wrong key or not an encrypted file")
+	}
+	return skipped, nil
+}
+
+// Read the record at the start of data, returning the plain text of a data record
+// and the record size. Key records are added to segments
+func openRecord(data []byte, identity *ecdh.PrivateKey, segments map[[8]byte]cipher.AEAD) ([]byte, int, bool) {
+	head := len(sealMagic) + 1 + 8
+	if len(data) < head || string(data[:len(sealMagic)]) != sealMagic {
+		return nil, 0, false
+	}
+	var id [8]byte
+	copy(id[:], data[len(sealMagic)+1:head])
+
+	switch data[len(sealMagic)] {
+	case sealKeyRecord:
+		if len(data) < head+32 {
+			return nil, 0, false
+		}
+		ephemeral := data[head : head+32]
+		public, err := ecdh.X25519().NewPublicKey(ephemeral)
+		if err != nil {
+			return nil, 0, false
+		}
+		shared, err := identity.ECDH(public)
+		if err != nil {
+			return nil, 0, false
+		}
+		aead, err := segmentAEAD(shared, ephemeral, identity.PublicKey().Bytes())
+		if err != nil {
+			return nil, 0, false
+		}
+		segments[id] = aead
+		return nil, head + 32, true
+	case sealDataRecord:
+		if len(data) < head+12 {
+			return nil, 0, false
+		}
+		length := int(binary.BigEndian.Uint32(data[head+8:]))
+		aead, ok := segments[id]
+		if !ok || length > maxSealedRecord || len(data) < head+12+length {
+			return nil, 0, false
+		}
+		nonce := make([]byte, aead.NonceSize())
+		copy(nonce[len(nonce)-8:], data[head:head+8])
+		plain, err := aead.Open(nil, nonce, data[head+12:head+12+length], id[:])
+		if err != nil {
+			return nil, 0, false
+		}
+		return plain, head + 12 + length, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// Run the keygen command
+func runKeygen(args []string) {
+	var output string
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&output, "o", "", "Secret key file to create (default: print the key)")
+	fs.Parse(args)
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Printf("❌ Failed to generate key: %v\n", err)
+		os.Exit(1)
+	}
+	public := formatPublicKey(key.PublicKey())
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s%s\n", time.Now().Format(time.RFC3339), public,
+		secretKeyPrefix, base64.RawURLEncoding.EncodeToString(key.Bytes()))
+
+	if output == "" {
+		fmt.Print(content)
+		return
+	}
+	// Never overwrite a key that may still be needed to read older files
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Printf("❌ Failed to create key file: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		fmt.Printf("❌ Failed to write key file: %v\n", err)
+		os.Exit(1)
+	}
+	file.Close()
+	fmt.Printf("✅ Secret key written to %s\n", output)
+	fmt.Printf("Public key: %s\n", public)
+}
+
+// Run the decrypt command
+func runDecrypt(args []string) {
+	var identityPath, output string
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&identityPath, "identity", "", "Secret key file from peep keygen (required)")
+	fs.StringVar(&output, "o", "", "Output file (default: stdout)")
+	fs.Parse(args)
+
+	if identityPath == "" || fs.NArg() == 0 {
+		fmt.Println("❌ Usage: peep decrypt -identity <key file> <file.enc>...")
+		os.Exit(exitUsage)
+	}
+	identity, err := loadSecretKey(identityPath)
+	if err != nil {
+		fmt.Printf("❌ Failed to load secret key: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		skipped, err := openSealed(file, identity, out)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %d damaged records skipped\n", path, skipped)
+		}
+	}
+}
+
+// Key file encrypting credentials peep stores, such as the accounts of mailboxes
+// enrolled on a serve instance: $PEEP_TOKEN_KEY_FILE, else token.key in the user's
+// configuration directory. It is kept out of the data directory, so a copy or
+// backup of the data doesn't hold the key that decrypts it
+func tokenKeyPath() (string, error) {
+	if path := os.Getenv("PEEP_TOKEN_KEY_FILE"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no configuration directory for the token key (%v), set $PEEP_TOKEN_KEY or $PEEP_TOKEN_KEY_FILE", err)
+	}
+	return filepath.Join(dir, "peep", "token.key"), nil
+}
+
+// Key encrypting stored credentials: $PEEP_TOKEN_KEY (base64), e.g. from a secret
+// manager, or the key file, created on first use when create is set
+func tokenStoreKey(create bool) ([]byte, error) {
+	if encoded := os.Getenv("PEEP_TOKEN_KEY"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("$PEEP_TOKEN_KEY must be 32 bytes in base64")
+		}
+		return key, nil
+	}
+	path, err := tokenKeyPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		key := make([]byte, 32)
+		rand.Read(key)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to create token key: %v", err)
+		}
+		log.Printf("Token key created: %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid token key in %s", path)
+	}
+	return key, nil
+}
+
+// AEAD of the stored credentials
+func tokenStoreAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// SenderEvent structure for the event published when a sender is saved for the first time
+type SenderEvent struct {
+	Event     string `json:"event"`
+	User      string `json:"user"`
+	Email     string `json:"email"`
+	Name      string `json:"name,omitempty"`
+	Domain    string `json:"domain"`
+	NewDomain bool   `json:"new_domain"`
+	Time      string `json:"time"`
+}
+
+// StatusEvent structure for the event published when a scan starts or ends
+type StatusEvent struct {
+	Event   string `json:"event"`
+	User    string `json:"user"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Time    string `json:"time"`
+}
+
+// Check if the run publishes events
+func eventsEnabled(config *Config) bool {
+	return config.MQTT != nil || config.NATS != nil || config.Kafka != nil || config.TailOut != nil
+}
+
+// Build the events of senders about to be saved; must run before they are stored
+// so senders of domains never seen before can be marked
+func newSenderEvents(db *sql.DB, config *Config, senders []EmailSender) []SenderEvent {
+	if !eventsEnabled(config) {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	known := make(map[string]bool)
+	var events []SenderEvent
+	for _, sender := range senders {
+		domain := emailDomain(sender.Email)
+		seen, checked := known[domain]
+		if !checked {
+			var exists int
+			if err := db.QueryRow("SELECT 1 FROM senders WHERE email LIKE ? LIMIT 1", "%@"+domain).Scan(&exists); err != nil && err != sql.ErrNoRows {
+				log.Printf("Failed to check domain %s: %v", domain, err)
+			}
+			seen = exists == 1
+			known[domain] = seen
+		}
+		events = append(events, SenderEvent{
+			Event:     "new_sender",
+			User:      config.Username,
+			Email:     sender.Email,
+			Name:      sender.FullName,
+			Domain:    domain,
+			NewDomain: !seen,
+			Time:      now,
+		})
+	}
+	return events
+}
+
+// Events of the senders that were actually inserted, dropping those another worker stored first
+func savedSenderEvents(events []SenderEvent, saved []EmailSender) []SenderEvent {
+	inserted := make(map[string]bool, len(saved))
+	for _, sender := range saved {
+		inserted[sender.Email] = true
+	}
+	var kept []SenderEvent
+	for _, event := range events {
+		if inserted[event.Email] {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+// Publish new-sender events to the configured sinks, logging failures
+func publishSenderEvents(config *Config, events []SenderEvent) {
+	if len(events) == 0 {
+		return
+	}
+	var records []SinkRecord
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode event: %v", err)
+			continue
+		}
+		records = append(records, SinkRecord{Key: event.Email, Payload: payload})
+	}
+
+	if config.MQTT != nil {
+		topic := mqttTopic(config.MQTT, config.Username, "sender")
+		var messages []MQTTMessage
+		for _, record := range records {
+			messages = append(messages, MQTTMessage{Topic: topic, Payload: record.Payload})
+		}
+		err := publishMQTT(config.MQTT, messages)
+		recordAudit(config, auditPublish, "mqtt:"+topic, map[string]any{"events": len(messages)}, err)
+		if err != nil {
+			log.Printf("MQTT publish failed: %v", err)
+		} else {
+			log.Printf("MQTT: %d new-sender events published to %s", len(messages), topic)
+		}
+	}
+	if config.NATS != nil {
+		err := publishNATS(config.NATS, records)
+		recordAudit(config, auditPublish, "nats:"+firstNonEmpty(config.NATS.Subject, "peep.senders"), map[string]any{"events": len(records)}, err)
+		if err != nil {
+			log.Printf("NATS publish failed: %v", err)
+		} else {
+			log.Printf("NATS: %d new-sender events published", len(records))
+		}
+	}
+	if config.Kafka != nil {
+		err := publishKafka(config.Kafka, records)
+		recordAudit(config, auditPublish, "kafka:"+config.Kafka.Topic, map[string]any{"events": len(records)}, err)
+		if err != nil {
+			log.Printf("Kafka publish failed: %v", err)
+		} else {
+			log.Printf("Kafka: %d new-sender records produced to %s", len(records), config.Kafka.Topic)
+		}
+	}
+}
+
+// Publish the status of a scan to the configured sinks, logging failures
+func publishStatusEvent(config *Config, status, message string) {
+	if config.MQTT == nil {
+		return
+	}
+	payload, err := json.Marshal(StatusEvent{
+		Event:   "status",
+		User:    config.Username,
+		Command: config.Command,
+		Status:  status,
+		Message: message,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Failed to encode event: %v", err)
+		return
+	}
+	topic := mqttTopic(config.MQTT, config.Username, "status")
+	if err := publishMQTT(config.MQTT, []MQTTMessage{{Topic: topic, Payload: payload, Retain: config.MQTT.RetainStatus}}); err != nil {
+		log.Printf("MQTT publish failed: %v", err)
+		return
+	}
+	log.Printf("MQTT: status %s published to %s", status, topic)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "errors"
+
+// Exit codes, one per failure class, so wrapper scripts and schedulers can react to each
+const (
+	exitOK         = 0
+	exitFailure    = 1 // any other error
+	exitUsage      = 2 // invalid command line (also used by the flag package)
+	exitAuth       = 3 // IMAP login rejected
+	exitConnection = 4 // IMAP server unreachable
+	exitMailbox    = 5 // mailbox could not be selected or listed
+	exitDatabase   = 6 // database could not be opened or read
+	exitPartial    = 7 // finished, but some messages or accounts were not processed
+	exitLocked     = 8 // another run is using the database
+)
+
+// ExitError structure for an error tagged with the exit code of its failure class
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Message of the underlying error
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Underlying error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Tag an error with an exit code
+func withExitCode(code int, err error) error {
+	return &ExitError{Code: code, Err: err}
+}
+
+// Exit code for an error; untagged errors are general failures
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return exitFailure
+}
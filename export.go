@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Senders read per query when exporting
+const exportPageSize = 20000
+
+// ExportOptions structure for the export command
+type ExportOptions struct {
+	Format               string
+	Output               string
+	IncludeTransactional bool
+	Tags                 stringList
+	IncludeIgnored       bool
+	Starred              bool
+	Upload               string
+	To                   string
+	SinceLast            bool
+	Watermark            string
+	SinceSeq             int64
+	UntilSeq             int64
+}
+
+// ExportedSender structure for one exported contact
+type ExportedSender struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Domain   string   `json:"domain"`
+	Category string   `json:"category,omitempty"`
+	Score    float64  `json:"score"`
+	Messages int      `json:"messages"`
+	Flagged  int      `json:"flagged"`
+	LastSeen string   `json:"last_seen,omitempty"`
+	Phone    string   `json:"phone,omitempty"`
+	JobTitle string   `json:"job_title,omitempty"`
+	Company  string   `json:"company,omitempty"`
+	Verified string   `json:"verify_status,omitempty"`
+	Phones   []string `json:"phones,omitempty"`
+	Photo    string   `json:"photo,omitempty"`
+}
+
+// Run the contact export command
+func runExport(args []string) {
+	config := &Config{}
+	opts := &ExportOptions{}
+
+	fs := accountFlags("export", config)
+	fs.StringVar(&opts.Format, "format", "csv", "Output format (csv, json, vcard)")
+	fs.StringVar(&opts.Output, "o", "", "Output file (default: stdout)")
+	fs.BoolVar(&opts.IncludeTransactional, "include-transactional", false, "Include senders of receipts, notifications and alerts")
+	fs.Var(&opts.Tags, "tag", "Only senders with this tag (repeatable, or comma-separated)")
+	fs.BoolVar(&opts.IncludeIgnored, "include-ignored", false, "Include ignored senders")
+	fs.BoolVar(&opts.Starred, "starred", false, "Only starred senders")
+	fs.StringVar(&opts.Upload, "upload", "", "Upload the export to s3://bucket/key, sftp://user@host/path or a WebDAV https:// URL")
+	fs.StringVar(&opts.To, "to", "", "Export to a service instead of a file (gsheet)")
+	fs.BoolVar(&opts.SinceLast, "since-last", false, "Only senders added or changed since the previous -since-last export")
+	fs.StringVar(&opts.Watermark, "watermark", defaultWatermark, "Name of the -since-last watermark, one per downstream sync")
+	fs.StringVar(&config.Remote, "remote", "", "Read the database of -user from a peep serve instance (https://host:port)")
+	parseLocalFlags(fs, config, args)
+
+	var sheetID string
+	switch opts.To {
+	case "":
+	case "gsheet":
+		if fs.NArg() != 1 {
+			fmt.Println("❌ Usage: peep export [options] -to gsheet <sheet-id>")
+			os.Exit(exitUsage)
+		}
+		sheetID = parseSheetID(fs.Arg(0))
+	default:
+		fmt.Printf("❌ Unsupported export target %q (use gsheet)\n", opts.To)
+		os.Exit(exitUsage)
+	}
+
+	if opts.SinceLast && config.Remote != "" {
+		fmt.Println("❌ Error: -since-last needs a local database, it moves its watermark")
+		os.Exit(exitUsage)
+	}
+
+	// Only -since-last writes to the database, its watermark
+	config.ReadOnly = !opts.SinceLast
+	setupLogging(config)
+	var db *sql.DB
+	if config.ReadOnly {
+		db = mustOpenReadOnlyDB(config)
+		if config.Remote == "" {
+			config.AuditDB = openAuditDB(config)
+			defer config.AuditDB.Close()
+		}
+	} else {
+		db = mustOpenDB(config)
+	}
+	defer db.Close()
+
+	if opts.SinceLast {
+		if err := loadExportWatermark(db, opts); err != nil {
+			fmt.Printf("❌ Failed to load export watermark: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		log.Printf("Exporting changes %d-%d (watermark %s)", opts.SinceSeq+1, opts.UntilSeq, opts.Watermark)
+	}
+
+	if sheetID != "" {
+		senders, err := loadExportSenders(db, opts)
+		if err != nil {
+			fmt.Printf("❌ Failed to load senders: %v\n", err)
+			os.Exit(1)
+		}
+		result, err := syncGoogleSheet(config, sheetID, senders)
+		auditExportTarget(config, opts, auditUpload, "gsheet:"+sheetID, len(senders), err)
+		if err != nil {
+			log.Printf("Google Sheets export failed: %v", err)
+			fmt.Printf("❌ Google Sheets export failed: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Senders exported to Google Sheet %s (%s): %d updated, %d appended", sheetID, result.Sheet, result.Updated, result.Appended)
+		fmt.Printf("✅ Google Sheet updated (tab %s): %d senders updated, %d appended\n", result.Sheet, result.Updated, result.Appended)
+		markExported(db, opts, len(senders))
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+	// Uploads are collected in memory; the export goes to stdout only without a destination
+	var upload bytes.Buffer
+	if opts.Upload != "" {
+		if opts.Output != "" {
+			out = io.MultiWriter(out, &upload)
+		} else {
+			out = &upload
+		}
+	}
+
+	w, err := newExportWriter(out, opts.Format)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	// Without a file, only an export to stdout is one of its own
+	target := firstNonEmpty(opts.Output, "stdout")
+	local := opts.Output != "" || opts.Upload == ""
+	if err := eachExportPage(db, opts, w.write); err != nil {
+		if local {
+			auditExportTarget(config, opts, auditExport, target, w.count, err)
+		}
+		fmt.Printf("❌ Failed to export senders: %v\n", err)
+		os.Exit(1)
+	}
+	err = w.close()
+	if local {
+		auditExportTarget(config, opts, auditExport, target, w.count, err)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	log.Printf("Senders exported: %d (%s)", w.count, opts.Format)
+	if opts.Output != "" {
+		fmt.Printf("✅ Senders written to %s (%d senders)\n", opts.Output, w.count)
+	}
+	if opts.Upload != "" {
+		name := fmt.Sprintf("peep_export_%s.%s", time.Now().Format("2006-01-02"), exportExtension(opts.Format))
+		location, err := uploadFile(config, opts.Upload, name, upload.Bytes())
+		auditExportTarget(config, opts, auditUpload, firstNonEmpty(location, opts.Upload), w.count, err)
+		if err != nil {
+			log.Printf("Upload failed: %v", err)
+			fmt.Printf("❌ Upload failed: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Export uploaded: %s", location)
+		fmt.Printf("✅ Senders uploaded to %s (%d senders)\n", location, w.count)
+	}
+	markExported(db, opts, w.count)
+}
+
+// Record an export in the audit log with its filters
+func auditExportTarget(config *Config, opts *ExportOptions, action, target string, count int, err error) {
+	params := map[string]any{"format": opts.Format, "senders": count}
+	if len(opts.Tags) > 0 {
+		params["tags"] = opts.Tags
+	}
+	if opts.Starred {
+		params["starred"] = true
+	}
+	if opts.IncludeTransactional {
+		params["include_transactional"] = true
+	}
+	if opts.IncludeIgnored {
+		params["include_ignored"] = true
+	}
+	if opts.SinceLast {
+		params["watermark"] = opts.Watermark
+	}
+	recordAudit(config, action, target, params, err)
+}
+
+// Move the -since-last watermark once the export is written
+func markExported(db *sql.DB, opts *ExportOptions, count int) {
+	if !opts.SinceLast {
+		return
+	}
+	if err := saveExportWatermark(db, opts, count); err != nil {
+		log.Printf("Failed to save export watermark %s: %v", opts.Watermark, err)
+		fmt.Printf("❌ Failed to save export watermark: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	log.Printf("Export watermark %s moved to change %d", opts.Watermark, opts.UntilSeq)
+}
+
+// Load senders for export, most important first
+func loadExportSenders(db *sql.DB, opts *ExportOptions) ([]ExportedSender, error) {
+	var senders []ExportedSender
+	err := eachExportPage(db, opts, func(page []ExportedSender) error {
+		senders = append(senders, page...)
+		return nil
+	})
+	return senders, err
+}
+
+// Page through the senders for export, most important first. Each page continues
+// after the last sender of the previous one instead of skipping rows with an
+// OFFSET, so large databases are never read into memory at once
+func eachExportPage(db *sql.DB, opts *ExportOptions, fn func([]ExportedSender) error) error {
+	var conditions []string
+	var args []any
+	if !opts.IncludeTransactional {
+		conditions = append(conditions, "COALESCE(category, '') != ?")
+		args = append(args, categoryTransactional)
+	}
+	if !opts.IncludeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if opts.Starred {
+		conditions = append(conditions, starredCondition)
+	}
+	if condition, tagArgs := tagFilterCondition("senders.email", opts.Tags); condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+	if opts.SinceLast {
+		conditions = append(conditions, "change_seq > ? AND change_seq <= ?")
+		args = append(args, opts.SinceSeq, opts.UntilSeq)
+	}
+
+	where := func(extra ...string) string {
+		all := append(append([]string(nil), conditions...), extra...)
+		if len(all) == 0 {
+			return ""
+		}
+		return " WHERE " + strings.Join(all, " AND ")
+	}
+	const order = " ORDER BY score DESC, email LIMIT ?"
+	firstPage := "SELECT " + exportColumns + " FROM senders" + where() + order
+	nextPage := "SELECT " + exportColumns + " FROM senders" + where("(score < ? OR (score = ? AND email > ?))") + order
+
+	stmts := newStmtCache(db)
+	defer stmts.close()
+	var last *ExportedSender
+	for {
+		query, pageArgs := firstPage, append([]any(nil), args...)
+		if last != nil {
+			query = nextPage
+			pageArgs = append(pageArgs, last.Score, last.Score, last.Email)
+		}
+		stmt, err := stmts.prepare(query)
+		if err != nil {
+			return err
+		}
+		rows, err := stmt.Query(append(pageArgs, exportPageSize)...)
+		if err != nil {
+			return err
+		}
+		page, err := scanExportedSenders(rows)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		last = &page[len(page)-1]
+	}
+}
+
+// Columns of the senders table read into an ExportedSender
+const exportColumns = `COALESCE(full_name, ''), email, COALESCE(category, ''), score, message_count, flagged_count,
+	COALESCE(last_seen_at, ''), COALESCE(phone, ''), COALESCE(job_title, ''), COALESCE(company, ''),
+	COALESCE(verify_status, ''), COALESCE((SELECT group_concat(p.phone, '; ') FROM sender_phones p WHERE p.email = senders.email), ''),
+	COALESCE(photo, '')`
+
+// Read sender rows selected with exportColumns, closing the rows
+func scanExportedSenders(rows *sql.Rows) ([]ExportedSender, error) {
+	defer rows.Close()
+
+	var senders []ExportedSender
+	for rows.Next() {
+		var s ExportedSender
+		var phones string
+		if err := rows.Scan(&s.Name, &s.Email, &s.Category, &s.Score, &s.Messages, &s.Flagged,
+			&s.LastSeen, &s.Phone, &s.JobTitle, &s.Company, &s.Verified, &phones, &s.Photo); err != nil {
+			return nil, err
+		}
+		if phones != "" {
+			s.Phones = strings.Split(phones, "; ")
+		}
+		s.Domain = emailDomain(s.Email)
+		senders = append(senders, s)
+	}
+	return senders, rows.Err()
+}
+
+// Write exported senders in the given format
+func writeExport(out io.Writer, format string, senders []ExportedSender) error {
+	w, err := newExportWriter(out, format)
+	if err != nil {
+		return err
+	}
+	if err := w.write(senders); err != nil {
+		return err
+	}
+	return w.close()
+}
+
+// exportWriter structure for writing exported senders page by page
+type exportWriter struct {
+	out    io.Writer
+	format string
+	csv    *csv.Writer
+	count  int
+}
+
+// Start an export in the given format
+func newExportWriter(out io.Writer, format string) (*exportWriter, error) {
+	w := &exportWriter{out: out, format: format}
+	switch format {
+	case "csv":
+		w.csv = csv.NewWriter(out)
+		w.csv.Write([]string{"name", "email", "domain", "category", "score", "messages", "flagged", "last_seen", "phone", "job_title", "company", "verify_status", "phones", "photo"})
+	case "json", "vcard":
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+	return w, nil
+}
+
+// File extension of an export format
+func exportExtension(format string) string {
+	if format == "vcard" {
+		return "vcf"
+	}
+	return format
+}
+
+// Write a page of senders
+func (w *exportWriter) write(senders []ExportedSender) error {
+	for _, s := range senders {
+		if w.csv != nil {
+			w.csv.Write([]string{s.Name, s.Email, s.Domain, s.Category, strconv.FormatFloat(s.Score, 'f', 1, 64),
+				strconv.Itoa(s.Messages), strconv.Itoa(s.Flagged), s.LastSeen, s.Phone, s.JobTitle, s.Company, s.Verified,
+				strings.Join(s.Phones, "; "), s.Photo})
+			w.count++
+			continue
+		}
+		if w.format == "vcard" {
+			if err := writeVCard(w.out, s); err != nil {
+				return err
+			}
+			w.count++
+			continue
+		}
+		// An indented JSON array, written one element at a time
+		data, err := json.MarshalIndent(s, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n  "
+		if w.count == 0 {
+			separator = "[\n  "
+		}
+		if _, err := io.WriteString(w.out, separator+string(data)); err != nil {
+			return err
+		}
+		w.count++
+	}
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// Finish the export
+func (w *exportWriter) close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	if w.format == "vcard" {
+		return nil
+	}
+	end := "\n]\n"
+	if w.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.out, end)
+	return err
+}
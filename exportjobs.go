@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportJob structure for a recurring export in the accounts file, run after the
+// scan of each account it applies to
+type ExportJob struct {
+	Name                 string   `json:"name"`
+	Format               string   `json:"format"`
+	Output               string   `json:"output"`
+	Upload               string   `json:"upload"`
+	CardDAV              string   `json:"carddav"`
+	CardDAVUser          string   `json:"carddav_user"`
+	PasswordEnv          string   `json:"password_env"`
+	Tags                 []string `json:"tags"`
+	Starred              bool     `json:"starred"`
+	IncludeTransactional bool     `json:"include_transactional"`
+	IncludeIgnored       bool     `json:"include_ignored"`
+	SinceLast            bool     `json:"since_last"`
+	Every                string   `json:"every"`
+}
+
+// Check the export jobs of an account, filling in default formats
+func validateExportJobs(jobs []ExportJob) error {
+	names := make(map[string]bool)
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Name == "" {
+			return fmt.Errorf("export %d has no name", i+1)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("export %s is defined twice", job.Name)
+		}
+		names[job.Name] = true
+
+		destinations := 0
+		for _, destination := range []string{job.Output, job.Upload, job.CardDAV} {
+			if destination != "" {
+				destinations++
+			}
+		}
+		if destinations != 1 {
+			return fmt.Errorf("export %s needs exactly one of output, upload or carddav", job.Name)
+		}
+		if job.CardDAV != "" {
+			if job.Format != "" && job.Format != "vcard" {
+				return fmt.Errorf("export %s: carddav exports are vcard, not %s", job.Name, job.Format)
+			}
+			job.Format = "vcard"
+		}
+		job.Format = firstNonEmpty(job.Format, "csv")
+		if job.Format != "csv" && job.Format != "json" && job.Format != "vcard" {
+			return fmt.Errorf("export %s: unsupported format %q (use csv, json or vcard)", job.Name, job.Format)
+		}
+		if job.Every != "" {
+			if every, err := time.ParseDuration(job.Every); err != nil || every <= 0 {
+				return fmt.Errorf("export %s: invalid every %q (e.g. 30m, 24h)", job.Name, job.Every)
+			}
+		}
+	}
+	return nil
+}
+
+// Run the export jobs of an account that are due, after its scan. Failures are
+// reported and leave the job due for the next scan
+func runExportJobs(db *sql.DB, config *Config) {
+	for _, job := range config.Exports {
+		due, err := exportJobDue(db, job)
+		if err != nil {
+			log.Printf("Export %s of %s: %v", job.Name, config.Username, err)
+			continue
+		}
+		if !due {
+			log.Printf("Export %s of %s: not due yet (every %s)", job.Name, config.Username, job.Every)
+			continue
+		}
+
+		count, location, err := runExportJob(db, config, job)
+		if err != nil || count > 0 || !job.SinceLast {
+			action := auditExport
+			if job.Upload != "" || job.CardDAV != "" {
+				action = auditUpload
+			}
+			recordAudit(config, action, location, map[string]any{"job": job.Name, "format": job.Format, "senders": count}, err)
+		}
+		if err != nil {
+			log.Printf("Export %s of %s failed: %v", job.Name, config.Username, err)
+			fmt.Printf("❌ %s: export %s failed: %v\n", config.Username, job.Name, err)
+			continue
+		}
+		if count == 0 && job.SinceLast {
+			log.Printf("Export %s of %s: no changes", job.Name, config.Username)
+			fmt.Printf("✅ %s: export %s has no changes\n", config.Username, job.Name)
+			continue
+		}
+		log.Printf("Export %s of %s: %d senders to %s", job.Name, config.Username, count, location)
+		fmt.Printf("✅ %s: export %s wrote %s to %s\n", config.Username, job.Name, plural(count, "sender"), location)
+	}
+}
+
+// Whether a job is due: never run, or without every, or last run every ago
+func exportJobDue(db *sql.DB, job ExportJob) (bool, error) {
+	if job.Every == "" {
+		return true, nil
+	}
+	every, _ := time.ParseDuration(job.Every)
+	var recent bool
+	err := db.QueryRow("SELECT exported_at > datetime('now', ?) FROM export_watermarks WHERE name = ?",
+		fmt.Sprintf("-%d seconds", int(every.Seconds())), job.Name).Scan(&recent)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return !recent, err
+}
+
+// Run one export job, returning the number of senders exported and where to. The
+// job name is its watermark, moved once the export went through
+func runExportJob(db *sql.DB, config *Config, job ExportJob) (int, string, error) {
+	opts := &ExportOptions{
+		Format:               job.Format,
+		IncludeTransactional: job.IncludeTransactional,
+		Tags:                 stringList(job.Tags),
+		IncludeIgnored:       job.IncludeIgnored,
+		Starred:              job.Starred,
+		SinceLast:            job.SinceLast,
+		Watermark:            job.Name,
+	}
+	if err := loadExportWatermark(db, opts); err != nil {
+		return 0, "", err
+	}
+
+	var count int
+	var location string
+	var err error
+	switch {
+	case job.CardDAV != "":
+		user := firstNonEmpty(job.CardDAVUser, config.Username)
+		password := logSecret(os.Getenv(strings.ReplaceAll(firstNonEmpty(job.PasswordEnv, "CARDDAV_PASSWORD"), "{user}", envName(config.Username))))
+		location = exportJobPath(job.CardDAV, config.Username)
+		err = eachExportPage(db, opts, func(page []ExportedSender) error {
+			if err := putCardDAV(location, user, password, page); err != nil {
+				return err
+			}
+			count += len(page)
+			return nil
+		})
+	case job.Upload != "":
+		var data bytes.Buffer
+		location = exportJobPath(job.Upload, config.Username)
+		count, err = writeExportJob(db, opts, &data)
+		// An incremental export without changes uploads nothing
+		if err == nil && (count > 0 || !job.SinceLast) {
+			name := fmt.Sprintf("peep_export_%s.%s", time.Now().Format("2006-01-02"), exportExtension(job.Format))
+			location, err = uploadFile(config, location, name, data.Bytes())
+		}
+	default:
+		location = exportJobPath(job.Output, config.Username)
+		count, err = writeExportJobFile(db, opts, location)
+	}
+	if err != nil {
+		return count, location, err
+	}
+	if err := saveExportWatermark(db, opts, count); err != nil {
+		return count, location, fmt.Errorf("watermark save: %v", err)
+	}
+	return count, location, nil
+}
+
+// Write the senders of an export to out
+func writeExportJob(db *sql.DB, opts *ExportOptions, out io.Writer) (int, error) {
+	w, err := newExportWriter(out, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	if err := eachExportPage(db, opts, w.write); err != nil {
+		return w.count, err
+	}
+	return w.count, w.close()
+}
+
+// Write an export to a file through a temporary file, so readers never see a
+// partial export. An incremental export without changes keeps the previous file
+func writeExportJobFile(db *sql.DB, opts *ExportOptions, path string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	// Like os.Create, instead of the private mode of temporary files
+	file.Chmod(0644)
+
+	count, err := writeExportJob(db, opts, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || count == 0 && opts.SinceLast {
+		return count, err
+	}
+	return count, os.Rename(file.Name(), path)
+}
+
+// Destination of a job for an account: {user} becomes the account folder name
+// (john_at_gmail_com) and {date} today's date
+func exportJobPath(destination, username string) string {
+	return strings.NewReplacer("{user}", safeUsername(username), "{date}", time.Now().Format("2006-01-02")).Replace(destination)
+}
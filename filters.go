@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Check if a domain equals or is a subdomain of any listed domain
+func domainInList(domain string, list []string) bool {
+	for _, entry := range list {
+		if domain == entry || strings.HasSuffix(domain, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if senders from a domain should be collected
+func domainAllowed(config *Config, domain string) bool {
+	if domainInList(domain, config.SkipDomains) {
+		return false
+	}
+	if len(config.OnlyDomains) > 0 && !domainInList(domain, config.OnlyDomains) {
+		return false
+	}
+	return true
+}
+
+// SenderRule structure for a compiled regex rule
+type SenderRule struct {
+	Pattern string
+	Field   string
+	Action  string
+	Tag     string
+	re      *regexp.Regexp
+}
+
+// Compile a rule from the config file or command line
+func compileSenderRule(ruleConfig RuleConfig) (SenderRule, error) {
+	rule := SenderRule{
+		Pattern: ruleConfig.Pattern,
+		Field:   ruleConfig.Field,
+		Action:  ruleConfig.Action,
+		Tag:     strings.ToLower(strings.TrimSpace(ruleConfig.Tag)),
+	}
+
+	if rule.Field == "" {
+		rule.Field = "email"
+	}
+	if rule.Field != "email" && rule.Field != "name" {
+		return rule, fmt.Errorf("rule %q: unknown field %q (use email or name)", rule.Pattern, rule.Field)
+	}
+
+	switch rule.Action {
+	case "exclude":
+	case "tag":
+		if rule.Tag == "" {
+			return rule, fmt.Errorf("rule %q: tag action requires a tag", rule.Pattern)
+		}
+	default:
+		return rule, fmt.Errorf("rule %q: unknown action %q (use exclude or tag)", rule.Pattern, rule.Action)
+	}
+
+	re, err := regexp.Compile("(?i)" + rule.Pattern)
+	if err != nil {
+		return rule, fmt.Errorf("rule %q: %v", rule.Pattern, err)
+	}
+	rule.re = re
+
+	return rule, nil
+}
+
+// Evaluate rules against a parsed sender
+func applySenderRules(sender *EmailSender, rules []SenderRule) {
+	for _, rule := range rules {
+		value := sender.Email
+		if rule.Field == "name" {
+			value = sender.FullName
+		}
+		if !rule.re.MatchString(value) {
+			continue
+		}
+
+		switch rule.Action {
+		case "exclude":
+			sender.Excluded = true
+			return
+		case "tag":
+			if !slices.Contains(sender.Tags, rule.Tag) {
+				sender.Tags = append(sender.Tags, rule.Tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap"
+)
+
+// Folders scanned at a time with -folders
+const defaultFolderWorkers = 2
+
+// Special-use folders left out of -folders all: folders that are not mailboxes,
+// copies of mail in other folders (All Mail, Starred, Important), your own mail
+// and deleted or junk mail
+var skippedFolderAttrs = []string{
+	imap.NoSelectAttr, imap.AllAttr, imap.FlaggedAttr, "\\Important",
+	imap.SentAttr, imap.DraftsAttr, imap.TrashAttr, imap.JunkAttr,
+}
+
+// Folders of a multi-folder scan: the -folders list, or every mailbox the server
+// lists except the special-use ones and the Sent folder for "all"
+func resolveScanFolders(ctx context.Context, config *Config) ([]string, error) {
+	if !slices.ContainsFunc(config.Folders, func(f string) bool { return strings.EqualFold(f, "all") }) {
+		var folders []string
+		for _, folder := range config.Folders {
+			if !slices.Contains(folders, folder) {
+				folders = append(folders, folder)
+			}
+		}
+		return folders, nil
+	}
+
+	c, err := config.Pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer config.Pool.put(c)
+
+	mailboxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	var folders []string
+	for m := range mailboxes {
+		// Servers without special-use attributes still name their Sent folder
+		skipped := slices.ContainsFunc(sentFolderNames, func(name string) bool { return strings.EqualFold(name, m.Name) })
+		for _, attr := range m.Attributes {
+			if slices.ContainsFunc(skippedFolderAttrs, func(a string) bool { return strings.EqualFold(a, attr) }) {
+				skipped = true
+			}
+		}
+		if skipped {
+			log.Printf("Folder %s skipped (%s)", m.Name, strings.Join(m.Attributes, " "))
+			continue
+		}
+		folders = append(folders, m.Name)
+	}
+	if err := <-done; err != nil {
+		return nil, withExitCode(exitMailbox, fmt.Errorf("failed to list folders: %v", err))
+	}
+	return folders, nil
+}
+
+// Scan the folders of a multi-folder scan, up to -folder-workers at a time on
+// connections of the pool. Every folder resumes from its own progress row; a
+// folder that fails leaves the others running
+func scanFolders(ctx context.Context, config *Config, db *sql.DB) error {
+	folders, err := resolveScanFolders(ctx, config)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		log.Printf("No folders to scan")
+		fmt.Println("No folders to scan")
+		return nil
+	}
+
+	// New senders are found against one set shared by all folders
+	if config.Known == nil {
+		if config.Known, err = loadKnownSenders(db); err != nil {
+			return withExitCode(exitDatabase, fmt.Errorf("failed to load senders: %v", err))
+		}
+	}
+
+	workers := min(max(config.FolderWorkers, 1), maxPoolConnections, len(folders))
+	log.Printf("Scanning %d folders, %d at a time: %s", len(folders), workers, strings.Join(folders, ", "))
+	if config.ShowProgress {
+		fmt.Printf("Scanning %s, %d at a time\n", plural(len(folders), "folder"), workers)
+	}
+
+	errs := make([]error, len(folders))
+	starred := make([]map[string]int, len(folders))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Batch output of parallel folders would interleave, so only the
+				// result of each folder is printed
+				folderConfig := *config
+				folderConfig.Folder = folders[i]
+				folderConfig.ShowProgress = false
+				folderConfig.StarredMail = nil
+				errs[i] = scanFolder(ctx, &folderConfig, db, folders[i])
+				starred[i] = folderConfig.StarredMail
+
+				if ctx.Err() != nil {
+					continue
+				}
+				if errs[i] != nil && exitCode(errs[i]) != exitPartial {
+					log.Printf("Folder %s failed: %v", folders[i], errs[i])
+					fmt.Printf("❌ %s: %v\n", folders[i], errs[i])
+					continue
+				}
+				progress, err := loadProgress(db, folders[i])
+				if err != nil {
+					log.Printf("Failed to load progress of %s: %v", folders[i], err)
+					continue
+				}
+				icon := "✅"
+				if errs[i] != nil {
+					icon = "⚠️ "
+				}
+				fmt.Printf("%s %s: %d/%d messages processed\n", icon, folders[i], progress.ProcessedCount, progress.TotalMessages)
+			}
+		}()
+	}
+	for i := range folders {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, counts := range starred {
+		for label, n := range counts {
+			if config.StarredMail == nil {
+				config.StarredMail = make(map[string]int)
+			}
+			config.StarredMail[label] += n
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("scan interrupted: %v", ctx.Err())
+	}
+
+	// Partial when only some folders failed or left failed ranges behind
+	var failed []string
+	var firstErr error
+	partial := false
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case exitCode(err) == exitPartial:
+			partial = true
+		default:
+			failed = append(failed, folders[i])
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) == len(folders) {
+		return firstErr
+	}
+	if len(failed) > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d folders failed: %s", len(failed), len(folders), strings.Join(failed, ", ")))
+	}
+	if partial {
+		return withExitCode(exitPartial, fmt.Errorf("failed ranges remain (run 'retry' with -folder)"))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// Only this much of a text part is searched for an inline forward
+const maxForwardScan = 64 * 1024
+
+var (
+	errStopWalk           = errors.New("stop walk")
+	inlineForwardMarker   = regexp.MustCompile(`(?i)^\s*(-+\s*(forwarded message|original message)\s*-+|begin forwarded message:)`)
+	inlineForwardFromLine = regexp.MustCompile(`(?i)^\s*\*?(from|von|de)\s*:\*?\s*(.+)$`)
+)
+
+// Find the original sender of a forwarded message
+//
+// Returns the original From value (empty to keep the message's own From) and
+// the address that forwarded it (empty if the message was not forwarded).
+func originalFrom(entity *message.Entity) (string, string) {
+	fromHeader := entity.Header.Get("From")
+
+	// Mailing lists and groups that rewrite From keep the original here
+	if original := entity.Header.Get("X-Original-From"); original != "" {
+		return original, fromHeader
+	}
+
+	// Forwarded as attachment or inline in the body
+	if original := embeddedFrom(entity); original != "" {
+		return original, fromHeader
+	}
+
+	// Resent messages keep the author in From; Resent-From is the forwarder
+	if resentFrom := entity.Header.Get("Resent-From"); resentFrom != "" {
+		return "", resentFrom
+	}
+
+	// Provider-side forwarding (e.g. Gmail) lists the forwarding account
+	if forwardedFor := strings.Fields(entity.Header.Get("X-Forwarded-For")); len(forwardedFor) > 0 {
+		return "", forwardedFor[0]
+	}
+
+	return "", ""
+}
+
+// Look for a message/rfc822 part or an inline forward block and return its From
+func embeddedFrom(entity *message.Entity) string {
+	var found string
+
+	entity.Walk(func(path []int, part *message.Entity, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		mediaType, _, _ := part.Header.ContentType()
+		switch {
+		case mediaType == "message/rfc822":
+			if embedded, err := message.Read(part.Body); err == nil || message.IsUnknownCharset(err) {
+				found = embedded.Header.Get("From")
+			}
+		case mediaType == "text/plain" || (mediaType == "" && len(path) == 0):
+			found = inlineForwardFrom(part.Body)
+		}
+
+		if found != "" {
+			return errStopWalk
+		}
+		return nil
+	})
+
+	return found
+}
+
+// Find the From line that follows an inline "Forwarded message" marker
+func inlineForwardFrom(body io.Reader) string {
+	scanner := bufio.NewScanner(io.LimitReader(body, maxForwardScan))
+	inForward := false
+
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), ">")
+		if !inForward {
+			inForward = inlineForwardMarker.MatchString(line)
+			continue
+		}
+		if match := inlineForwardFromLine.FindStringSubmatch(line); match != nil {
+			return strings.TrimSpace(match[2])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Recent distinct subjects kept per sender for the search index
+	maxSenderSubjects = 20
+	// Candidates read from the search index before fuzzy ranking
+	maxSearchCandidates = 5000
+)
+
+// Full-text index over sender names, subjects and organizations (company and domain),
+// kept in sync with the senders table by triggers
+const createSearchIndex = `
+	CREATE VIRTUAL TABLE sender_fts USING fts5(
+		name, subjects, organization, email,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS senders_fts_insert AFTER INSERT ON senders BEGIN
+		INSERT INTO sender_fts (rowid, name, subjects, organization, email)
+		VALUES (new.id, COALESCE(new.full_name, ''), COALESCE(new.subjects, ''),
+			COALESCE(new.company, '') || ' ' || substr(new.email, instr(new.email, '@') + 1), new.email);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS senders_fts_update AFTER UPDATE OF full_name, subjects, company, email ON senders BEGIN
+		DELETE FROM sender_fts WHERE rowid = old.id;
+		INSERT INTO sender_fts (rowid, name, subjects, organization, email)
+		VALUES (new.id, COALESCE(new.full_name, ''), COALESCE(new.subjects, ''),
+			COALESCE(new.company, '') || ' ' || substr(new.email, instr(new.email, '@') + 1), new.email);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS senders_fts_delete AFTER DELETE ON senders BEGIN
+		DELETE FROM sender_fts WHERE rowid = old.id;
+	END;
+
+	INSERT INTO sender_fts (rowid, name, subjects, organization, email)
+	SELECT id, COALESCE(full_name, ''), COALESCE(subjects, ''),
+		COALESCE(company, '') || ' ' || substr(email, instr(email, '@') + 1), email
+	FROM senders;`
+
+// Create the search index on first use, filling it from existing senders
+func ensureSearchIndex(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'sender_fts'`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	log.Printf("Upgrading schema: building full-text search index")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(createSearchIndex); err != nil {
+		return fmt.Errorf("failed to build search index: %v", err)
+	}
+	return tx.Commit()
+}
+
+// Remember the latest subjects of each sender, most recent first
+func saveSenderSubjects(tx *sql.Tx, stats map[string]*SenderStats) error {
+	for email, s := range stats {
+		if len(s.Subjects) == 0 {
+			continue
+		}
+		var stored string
+		if err := tx.QueryRow(`SELECT COALESCE(subjects, '') FROM senders WHERE email = ?`, email).Scan(&stored); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return err
+		}
+
+		subjects := mergeSubjects(s.Subjects, strings.Split(stored, "\n"))
+		if subjects == stored {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE senders SET subjects = ? WHERE email = ?`, subjects, email); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Join recent and stored subjects without duplicates, keeping at most maxSenderSubjects
+func mergeSubjects(recent, stored []string) string {
+	var subjects []string
+	seen := make(map[string]bool)
+	for _, subject := range append(recent, stored...) {
+		subject = strings.TrimSpace(subject)
+		if subject == "" || seen[subject] {
+			continue
+		}
+		seen[subject] = true
+		subjects = append(subjects, subject)
+		if len(subjects) == maxSenderSubjects {
+			break
+		}
+	}
+	return strings.Join(subjects, "\n")
+}
+
+// Add a subject to the batch statistics of a sender, most recent first
+func addSubject(stats *SenderStats, subject string) {
+	subject = strings.Join(strings.Fields(subject), " ")
+	if subject == "" {
+		return
+	}
+	for _, existing := range stats.Subjects {
+		if existing == subject {
+			return
+		}
+	}
+	stats.Subjects = append([]string{subject}, stats.Subjects...)
+	if len(stats.Subjects) > maxSenderSubjects {
+		stats.Subjects = stats.Subjects[:maxSenderSubjects]
+	}
+}
+
+// Turn free text into an FTS5 query matching any word by prefix ("acme inc" -> "acme"* OR "inc"*)
+func searchIndexQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var terms []string
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " OR ")
+}
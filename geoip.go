@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoCountryRecord structure for the fields read from a GeoLite2 Country/City database
+type GeoCountryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// GeoASNRecord structure for the fields read from a GeoLite2 ASN database
+type GeoASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Run the GeoIP enrichment command
+func runGeoIP(args []string) {
+	config := &Config{}
+	var countryDB, asnDB string
+	var refresh bool
+
+	fs := accountFlags("geoip", config)
+	fs.StringVar(&countryDB, "country-db", "", "GeoLite2 Country or City database (.mmdb)")
+	fs.StringVar(&asnDB, "asn-db", "", "GeoLite2 ASN database (.mmdb)")
+	fs.BoolVar(&refresh, "refresh", false, "Look up IPs that already have GeoIP data again")
+	parseLocalFlags(fs, config, args)
+
+	if countryDB == "" && asnDB == "" {
+		fmt.Println("❌ Error: -country-db or -asn-db is required")
+		os.Exit(1)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	if err := enrichGeoIP(db, countryDB, asnDB, refresh); err != nil {
+		log.Printf("GeoIP error: %v", err)
+		fmt.Printf("❌ GeoIP error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Open a MaxMind database if a path was given
+func openGeoDB(path string) (*maxminddb.Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	return reader, nil
+}
+
+// Look up country and ASN of recorded sending IPs
+func enrichGeoIP(db *sql.DB, countryPath, asnPath string, refresh bool) error {
+	countryDB, err := openGeoDB(countryPath)
+	if err != nil {
+		return err
+	}
+	if countryDB != nil {
+		defer countryDB.Close()
+	}
+	asnDB, err := openGeoDB(asnPath)
+	if err != nil {
+		return err
+	}
+	if asnDB != nil {
+		defer asnDB.Close()
+	}
+
+	query := "SELECT DISTINCT ip FROM sender_ips"
+	if !refresh {
+		query += " WHERE geo_checked_at IS NULL"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			rows.Close()
+			return err
+		}
+		ips = append(ips, ip)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	found := 0
+	for _, value := range ips {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			continue
+		}
+
+		var country, asOrg string
+		var asn uint
+		if countryDB != nil {
+			var record GeoCountryRecord
+			if err := countryDB.Lookup(ip, &record); err != nil {
+				log.Printf("Country lookup failed (%s): %v", value, err)
+			}
+			country = record.Country.ISOCode
+			if country == "" {
+				country = record.RegisteredCountry.ISOCode
+			}
+		}
+		if asnDB != nil {
+			var record GeoASNRecord
+			if err := asnDB.Lookup(ip, &record); err != nil {
+				log.Printf("ASN lookup failed (%s): %v", value, err)
+			}
+			asn, asOrg = record.Number, record.Organization
+		}
+
+		if _, err := db.Exec(`
+			UPDATE sender_ips SET
+				country = COALESCE(NULLIF(?, ''), country),
+				asn = COALESCE(NULLIF(?, 0), asn),
+				as_org = COALESCE(NULLIF(?, ''), as_org),
+				geo_checked_at = CURRENT_TIMESTAMP
+			WHERE ip = ?`, country, asn, asOrg, value); err != nil {
+			return err
+		}
+		if country != "" || asn != 0 {
+			found++
+		}
+	}
+
+	log.Printf("GeoIP completed: %d IPs looked up, %d found", len(ips), found)
+	fmt.Printf("✅ GeoIP completed: %d IPs looked up, %d found\n", len(ips), found)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// Capability of Gmail's IMAP extensions
+const gmailCapability = "X-GM-EXT-1"
+
+// Fetch items with the Gmail labels and the stable ID of a message
+const (
+	gmailLabelsItem imap.FetchItem = "X-GM-LABELS"
+	gmailMsgIDItem  imap.FetchItem = "X-GM-MSGID"
+)
+
+// Gmail labels carried by each sender's mail, e.g. Finance or \Important, and the
+// Gmail messages counted so far with the folder and UID of the copy counted
+const createGmailTables = `
+	CREATE TABLE IF NOT EXISTS sender_labels (
+		email TEXT,
+		label TEXT,
+		message_count INTEGER DEFAULT 0,
+		first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (email, label)
+	) WITHOUT ROWID;
+	CREATE INDEX IF NOT EXISTS idx_sender_labels_label ON sender_labels(label);
+
+	CREATE TABLE IF NOT EXISTS gmail_messages (
+		msgid INTEGER PRIMARY KEY,
+		folder TEXT,
+		uid INTEGER,
+		recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+// Check if the server is Gmail, whose labels and message IDs are fetched with every message
+func isGmail(c *client.Client) bool {
+	ok, err := c.Support(gmailCapability)
+	return err == nil && ok
+}
+
+// Fetch items of the scanned messages: UID, flags, date and the section, plus the
+// labels and message ID on Gmail
+func messageFetchItems(c *client.Client, section *imap.BodySectionName) []imap.FetchItem {
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, section.FetchItem()}
+	if isGmail(c) {
+		items = append(items, gmailLabelsItem, gmailMsgIDItem)
+	}
+	return items
+}
+
+// Gmail labels of a fetched message, none on other servers
+func gmailLabels(msg *imap.Message) []string {
+	values, _ := msg.Items[gmailLabelsItem].([]interface{})
+	var labels []string
+	for _, value := range values {
+		if label, err := imap.ParseString(value); err == nil && label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// Gmail message ID of a fetched message, 0 on other servers
+func gmailMessageID(msg *imap.Message) uint64 {
+	switch value := msg.Items[gmailMsgIDItem].(type) {
+	case string:
+		id, _ := strconv.ParseUint(value, 10, 64)
+		return id
+	case uint32:
+		return uint64(value)
+	}
+	return 0
+}
+
+// Add label counts per sender
+func saveSenderLabels(tx *sql.Tx, stats map[string]*SenderStats) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO sender_labels (email, label, message_count) VALUES (?, ?, ?)
+		ON CONFLICT(email, label) DO UPDATE SET
+			message_count = message_count + excluded.message_count, last_seen = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, s := range stats {
+		for label, count := range s.Labels {
+			if _, err := stmt.Exec(email, label, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Node kinds of the correspondence graph
+const (
+	graphDomain    = "domain"
+	graphSender    = "sender"
+	graphRecipient = "recipient"
+)
+
+// GraphNode structure for a domain, sender or own address of the graph
+type GraphNode struct {
+	ID       string
+	Label    string
+	Kind     string
+	Messages int
+}
+
+// GraphEdge structure for a weighted, directed edge: domain to sender, sender to
+// the own address it mails, your account to the senders you reply to
+type GraphEdge struct {
+	Source string
+	Target string
+	Kind   string
+	Weight int
+}
+
+// Graph structure for the correspondence graph of an account
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+	nodes map[string]int
+}
+
+// Add messages to a node, creating it on first use
+func (g *Graph) node(kind, label string, messages int) string {
+	id := kind + ":" + label
+	if i, ok := g.nodes[id]; ok {
+		g.Nodes[i].Messages += messages
+		return id
+	}
+	g.nodes[id] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, GraphNode{ID: id, Label: label, Kind: kind, Messages: messages})
+	return id
+}
+
+// Run the graph command
+func runGraph(args []string) {
+	config := &Config{}
+	var format, output string
+	var minMessages int
+	var tags stringList
+	var includeIgnored, starred bool
+
+	fs := accountFlags("graph", config)
+	fs.StringVar(&output, "o", "graph.gexf", "Output file")
+	fs.StringVar(&format, "format", "", "Graph format (gexf, dot; default: from the -o extension)")
+	fs.IntVar(&minMessages, "min-messages", 1, "Leave out senders with fewer messages")
+	fs.Var(&tags, "tag", "Only senders with this tag (repeatable, or comma-separated)")
+	fs.BoolVar(&includeIgnored, "include-ignored", false, "Include ignored senders")
+	fs.BoolVar(&starred, "starred", false, "Only starred senders")
+	parseLocalFlags(fs, config, args)
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+		if format == "gv" {
+			format = "dot"
+		}
+	}
+	if format != "gexf" && format != "dot" {
+		fmt.Printf("❌ Error: unsupported graph format %q (use -format gexf or dot)\n", format)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	conditions := []string{"senders.message_count >= ?"}
+	filterArgs := []any{max(minMessages, 1)}
+	condition, tagArgs := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+		filterArgs = append(filterArgs, tagArgs...)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+
+	graph, err := loadGraph(db, strings.Join(conditions, " AND "), filterArgs, strings.ToLower(config.Username))
+	if err != nil {
+		fmt.Printf("❌ Failed to load graph data: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	if len(graph.Edges) == 0 {
+		fmt.Println("❌ Nothing to graph, scan the mailbox first")
+		os.Exit(1)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("❌ Failed to create output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	if format == "dot" {
+		err = writeDOT(w, graph)
+	} else {
+		err = writeGEXF(w, graph)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to write graph: %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Graph written to %s: %d nodes, %d edges", output, len(graph.Nodes), len(graph.Edges))
+	fmt.Printf("✅ Graph written to %s (%d nodes, %d edges)\n", output, len(graph.Nodes), len(graph.Edges))
+}
+
+// Build the graph of the senders matching where: each sender is linked from its
+// domain and to the own addresses it mails (from Delivered-To aliases, else the
+// account), and your account is linked to the senders you reply to
+func loadGraph(db *sql.DB, where string, args []any, account string) (*Graph, error) {
+	graph := &Graph{nodes: make(map[string]int)}
+
+	rows, err := db.Query(`
+		SELECT email, lower(substr(email, instr(email, '@') + 1)), message_count,
+			(SELECT COALESCE(SUM(message_count), 0) FROM sender_aliases a WHERE a.email = senders.email),
+			(SELECT COALESCE(reply_count, 0) FROM replies r WHERE r.email = senders.email)
+		FROM senders WHERE `+where+` ORDER BY message_count DESC, email`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Messages not delivered to a recorded alias go to the account itself
+	unaliased := make(map[string]int)
+	for rows.Next() {
+		var email, domain string
+		var messages, aliased int
+		var replies sql.NullInt64
+		if err := rows.Scan(&email, &domain, &messages, &aliased, &replies); err != nil {
+			return nil, err
+		}
+		sender := graph.node(graphSender, email, messages)
+		graph.Edges = append(graph.Edges, GraphEdge{graph.node(graphDomain, domain, messages), sender, "domain", messages})
+		if messages > aliased {
+			unaliased[sender] = messages - aliased
+		}
+		if replies.Int64 > 0 {
+			graph.Edges = append(graph.Edges, GraphEdge{graph.node(graphRecipient, account, 0), sender, "reply", int(replies.Int64)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	aliasRows, err := db.Query(`
+		SELECT a.email, lower(a.alias), a.message_count FROM sender_aliases a JOIN senders ON senders.email = a.email
+		WHERE a.message_count > 0 AND `+where+` ORDER BY a.message_count DESC, a.email`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer aliasRows.Close()
+	for aliasRows.Next() {
+		var email, alias string
+		var messages int
+		if err := aliasRows.Scan(&email, &alias, &messages); err != nil {
+			return nil, err
+		}
+		graph.Edges = append(graph.Edges, GraphEdge{graph.node(graphSender, email, 0), graph.node(graphRecipient, alias, messages), "mails", messages})
+	}
+	if err := aliasRows.Err(); err != nil {
+		return nil, err
+	}
+
+	senders := make([]string, 0, len(unaliased))
+	for sender := range unaliased {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+	for _, sender := range senders {
+		graph.Edges = append(graph.Edges, GraphEdge{sender, graph.node(graphRecipient, account, unaliased[sender]), "mails", unaliased[sender]})
+	}
+	return graph, nil
+}
+
+// GEXF 1.3 document, the native format of Gephi
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Creator string    `xml:"meta>creator"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+// gexfGraph structure for the graph element with its node attributes
+type gexfGraph struct {
+	Mode       string         `xml:"mode,attr"`
+	EdgeType   string         `xml:"defaultedgetype,attr"`
+	Attributes gexfAttributes `xml:"attributes"`
+	Nodes      []gexfNode     `xml:"nodes>node"`
+	Edges      []gexfEdge     `xml:"edges>edge"`
+}
+
+// gexfAttributes structure for the declared attributes of a class of elements
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+// gexfAttribute structure for one declared attribute
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+// gexfNode structure for a node with its attribute values
+type gexfNode struct {
+	ID     string          `xml:"id,attr"`
+	Label  string          `xml:"label,attr"`
+	Values []gexfAttrValue `xml:"attvalues>attvalue"`
+}
+
+// gexfAttrValue structure for the value of a declared attribute
+type gexfAttrValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// gexfEdge structure for a weighted edge
+type gexfEdge struct {
+	ID     int    `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Label  string `xml:"label,attr"`
+	Weight int    `xml:"weight,attr"`
+}
+
+// Write the graph as GEXF, with the node kind and message count as node attributes
+func writeGEXF(w io.Writer, g *Graph) error {
+	doc := gexfDocument{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Creator: "peep",
+		Graph: gexfGraph{
+			Mode:     "static",
+			EdgeType: "directed",
+			Attributes: gexfAttributes{Class: "node", Attributes: []gexfAttribute{
+				{ID: "kind", Title: "kind", Type: "string"},
+				{ID: "messages", Title: "messages", Type: "integer"},
+			}},
+		},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{ID: n.ID, Label: n.Label, Values: []gexfAttrValue{
+			{For: "kind", Value: n.Kind},
+			{For: "messages", Value: fmt.Sprint(n.Messages)},
+		}})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{ID: i, Source: e.Source, Target: e.Target, Label: e.Kind, Weight: e.Weight})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Characters escaped in quoted DOT strings
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ")
+
+// Quote a DOT identifier
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// Write the graph as GraphViz DOT: domains as boxes, own addresses as double
+// circles, edges thicker with more messages
+func writeDOT(w io.Writer, g *Graph) error {
+	shapes := map[string]string{graphDomain: "box", graphSender: "ellipse", graphRecipient: "doublecircle"}
+	fmt.Fprintln(w, "digraph peep {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, `  node [fontname="sans-serif", fontsize=10];`)
+	for _, n := range g.Nodes {
+		fmt.Fprintf(w, "  %s [label=%s, shape=%s, tooltip=%s];\n",
+			dotQuote(n.ID), dotQuote(n.Label), shapes[n.Kind], dotQuote(fmt.Sprintf("%s, %s", n.Kind, plural(n.Messages, "message"))))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  %s -> %s [weight=%d, penwidth=%.1f, label=%s];\n",
+			dotQuote(e.Source), dotQuote(e.Target), e.Weight, 1+math.Log10(float64(max(e.Weight, 1))), dotQuote(fmt.Sprint(e.Weight)))
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
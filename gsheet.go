@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Base URL of the Google Sheets API
+const sheetsAPI = "https://sheets.googleapis.com/v4/spreadsheets"
+
+// OAuth scope needed to read and write spreadsheets
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// Timeout of one Google API request
+const sheetsTimeout = 60 * time.Second
+
+// Spreadsheet ID inside a docs.google.com URL
+var sheetURLRegex = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+
+// Header row of the sender sheet; the email column identifies rows on updates
+var sheetHeader = []any{"name", "email", "domain", "category", "score", "messages", "last_seen", "phone", "job_title", "company", "verify_status"}
+
+// GSheetConfig structure for the "gsheet" section of the config file
+type GSheetConfig struct {
+	// Service account key (JSON) with edit access to the spreadsheet
+	CredentialsFile string `json:"credentials_file"`
+	// Alternatively an OAuth access token, e.g. from `gcloud auth print-access-token`
+	AccessTokenEnv string `json:"access_token_env"`
+	// Tab holding the sender list, created when missing
+	Sheet string `json:"sheet"`
+}
+
+// GSheetResult structure for the outcome of a spreadsheet sync
+type GSheetResult struct {
+	Sheet    string
+	Updated  int
+	Appended int
+}
+
+// serviceAccountKey structure for the fields used from a service account key file
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// Spreadsheet ID from an ID or a spreadsheet URL
+func parseSheetID(value string) string {
+	if match := sheetURLRegex.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	return strings.TrimSpace(value)
+}
+
+// Write senders to a spreadsheet tab: rows of known senders (matched by email) are
+// updated in place, new senders are appended. Columns right of the export and rows
+// of senders no longer exported are left alone, so notes added in the sheet survive
+func syncGoogleSheet(config *Config, sheetID string, senders []ExportedSender) (*GSheetResult, error) {
+	var gsheet GSheetConfig
+	if config.GSheet != nil {
+		gsheet = *config.GSheet
+	}
+	token, err := sheetsAccessToken(gsheet)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GSheetResult{Sheet: firstNonEmpty(gsheet.Sheet, "Senders")}
+	tab := "'" + strings.ReplaceAll(result.Sheet, "'", "''") + "'"
+	base := sheetsAPI + "/" + url.PathEscape(sheetID)
+
+	var current struct {
+		Values [][]any `json:"values"`
+	}
+	err = sheetsRequest(token, "GET", base+"/values/"+url.PathEscape(tab+"!A:K"), nil, &current)
+	if err != nil && strings.Contains(err.Error(), "Unable to parse range") {
+		// The tab does not exist yet
+		addSheet := map[string]any{"requests": []any{
+			map[string]any{"addSheet": map[string]any{"properties": map[string]any{"title": result.Sheet}}},
+		}}
+		err = sheetsRequest(token, "POST", base+":batchUpdate", addSheet, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing rows by email, the header always being row 1
+	rows := [][]any{sheetHeader}
+	index := make(map[string]int)
+	for i, row := range current.Values {
+		if i == 0 {
+			continue
+		}
+		rows = append(rows, row)
+		if len(row) > 1 {
+			if email, ok := row[1].(string); ok && email != "" {
+				index[strings.ToLower(email)] = i
+			}
+		}
+	}
+
+	for _, s := range senders {
+		row := []any{s.Name, s.Email, s.Domain, s.Category, math.Round(s.Score*10) / 10, s.Messages,
+			s.LastSeen, s.Phone, s.JobTitle, s.Company, s.Verified}
+		if i, ok := index[s.Email]; ok {
+			rows[i] = row
+			result.Updated++
+		} else {
+			index[s.Email] = len(rows)
+			rows = append(rows, row)
+			result.Appended++
+		}
+	}
+	// Short rows are padded so stale cells of a row are cleared
+	for i, row := range rows {
+		for len(row) < len(sheetHeader) {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+
+	// RAW keeps values like "+49 ..." or "=..." from being read as formulas
+	body := map[string]any{"range": tab + "!A1", "majorDimension": "ROWS", "values": rows}
+	target := base + "/values/" + url.PathEscape(tab+"!A1") + "?valueInputOption=RAW"
+	if err := sheetsRequest(token, "PUT", target, body, nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Send a Google Sheets API request, decoding the JSON response into out if given
+func sheetsRequest(token, method, endpoint string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+
+	client := &http.Client{Timeout: sheetsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 32*1024*1024))
+	if resp.StatusCode/100 != 2 {
+		var apiError struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiError) == nil && apiError.Error.Message != "" {
+			message = apiError.Error.Message
+		}
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound {
+			message += " (is the spreadsheet shared with the service account?)"
+		}
+		return fmt.Errorf("%s: %s", resp.Status, message)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// Access token for the Sheets API, from the environment or a service account key
+func sheetsAccessToken(gsheet GSheetConfig) (string, error) {
+	if gsheet.AccessTokenEnv != "" {
+		if token := os.Getenv(gsheet.AccessTokenEnv); token != "" {
+			return logSecret(token), nil
+		}
+	}
+	path := firstNonEmpty(gsheet.CredentialsFile, os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if path == "" {
+		return "", fmt.Errorf("no Google credentials (gsheet.credentials_file in the config file or GOOGLE_APPLICATION_CREDENTIALS)")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials: %v", err)
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("failed to parse credentials %s: %v", path, err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return "", fmt.Errorf("%s is not a service account key", path)
+	}
+	token, err := serviceAccountToken(key)
+	return logSecret(token), err
+}
+
+// Exchange a signed JWT of a service account for an access token
+func serviceAccountToken(key serviceAccountKey) (string, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key of %s", key.ClientEmail)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid private key of %s: %v", key.ClientEmail, err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key of %s is not an RSA key", key.ClientEmail)
+	}
+
+	tokenURI := firstNonEmpty(key.TokenURI, "https://oauth2.googleapis.com/token")
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   key.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	client := &http.Client{Timeout: sheetsTimeout}
+	resp, err := client.PostForm(tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&token); err != nil {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token request failed: %s", strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CachedHeader structure for a raw header kept on disk
+type CachedHeader struct {
+	UID    uint32
+	Header []byte
+}
+
+// Directory holding cached headers of a folder
+func headerCacheFolderDir(cacheDir, folder string, uidValidity uint32) string {
+	safeFolder := strings.NewReplacer("/", "_", "\\", "_", ".", "_").Replace(folder)
+	return filepath.Join(cacheDir, safeFolder, strconv.FormatUint(uint64(uidValidity), 10))
+}
+
+// Write headers into a gzip file named after their UID range
+//
+// Each record is "UID <uid> <length>\n" followed by the header bytes and a newline.
+func writeHeaderCache(cacheDir, folder string, uidValidity uint32, headers []CachedHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	dir := headerCacheFolderDir(cacheDir, folder, uidValidity)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	first, last := headers[0].UID, headers[len(headers)-1].UID
+	path := filepath.Join(dir, fmt.Sprintf("%010d-%010d.hdr.gz", first, last))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+	for _, h := range headers {
+		fmt.Fprintf(zw, "UID %d %d\n", h.UID, len(h.Header))
+		zw.Write(h.Header)
+		zw.Write([]byte("\n"))
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Header cache written: %s (%d headers)", path, len(headers))
+	return nil
+}
+
+// Read every cached header below cacheDir, calling fn for each
+func readHeaderCache(cacheDir string, fn func(path string, h CachedHeader) error) error {
+	var paths []string
+	err := filepath.WalkDir(cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".hdr.gz") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := readHeaderCacheFile(path, fn); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Read one header cache file
+func readHeaderCacheFile(path string, fn func(path string, h CachedHeader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	r := bufio.NewReader(zr)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var h CachedHeader
+		var size int
+		if _, err := fmt.Sscanf(line, "UID %d %d\n", &h.UID, &size); err != nil {
+			return fmt.Errorf("corrupt record: %v", err)
+		}
+
+		h.Header = make([]byte, size+1)
+		if _, err := io.ReadFull(r, h.Header); err != nil {
+			return err
+		}
+		h.Header = h.Header[:size]
+
+		if err := fn(path, h); err != nil {
+			return err
+		}
+	}
+}
+
+// Run the reprocess command
+func runReprocess(args []string) {
+	if code := reprocess(args); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// Reprocess under the lock and return the exit code, so the deferred cleanup runs before exiting
+func reprocess(args []string) int {
+	config := &Config{}
+	parseLocalFlags(accountFlags("reprocess", config), config, args)
+
+	setupLogging(config)
+	lock, err := takeLock(config)
+	if err != nil {
+		return exitCode(err)
+	}
+	defer lock.Release()
+	db, err := openDB(config)
+	if err != nil {
+		return exitDatabase
+	}
+	defer db.Close()
+
+	if err := reprocessHeaderCache(db, config); err != nil {
+		log.Printf("Reprocess error: %v", err)
+		fmt.Printf("❌ Reprocess error: %v\n", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// Re-extract senders from every cached header
+func reprocessHeaderCache(db *sql.DB, config *Config) error {
+	if _, err := os.Stat(config.HeaderCacheDir); err != nil {
+		return fmt.Errorf("no header cache found at %s (scan with -cache-headers first)", config.HeaderCacheDir)
+	}
+
+	senderMap := make(map[string]EmailSender)
+	total, failed := 0, 0
+
+	err := readHeaderCache(config.HeaderCacheDir, func(path string, h CachedHeader) error {
+		total++
+		senders, err := sendersFromRaw(append(h.Header, "\r\n\r\n"...), config)
+		if err != nil {
+			failed++
+			if config.Verbose {
+				log.Printf("Cached message %d: %v", h.UID, err)
+			}
+			return nil
+		}
+		for _, sender := range senders {
+			if _, exists := senderMap[sender.Email]; !exists && !sender.Excluded {
+				senderMap[sender.Email] = sender
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	senders := make([]EmailSender, 0, len(senderMap))
+	for _, sender := range senderMap {
+		senders = append(senders, sender)
+	}
+
+	newCount, err := storeSenders(db, config, senders)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reprocess completed: %d cached headers, %d failed, %d senders, %d new", total, failed, len(senders), newCount)
+	fmt.Printf("✅ Reprocessed %d cached headers: %d senders found, %d new, %d failed\n", total, len(senders), newCount, failed)
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Have I Been Pwned API
+	hibpAPI = "https://haveibeenpwned.com/api/v3"
+	// Timeout of a single API request
+	hibpTimeout = 30 * time.Second
+)
+
+// Breach structure for a breach of the Have I Been Pwned catalogue
+type Breach struct {
+	Name        string   `json:"Name"`
+	Title       string   `json:"Title"`
+	Domain      string   `json:"Domain"`
+	BreachDate  string   `json:"BreachDate"`
+	PwnCount    int      `json:"PwnCount"`
+	DataClasses []string `json:"DataClasses"`
+}
+
+// Schema of the breach catalogue, own marks breaches containing the checked address,
+// and the senders from breached services
+const createBreachesTable = `
+	CREATE TABLE IF NOT EXISTS breaches (
+		name TEXT PRIMARY KEY,
+		title TEXT,
+		domain TEXT,
+		breach_date TEXT,
+		pwn_count INTEGER,
+		data_classes TEXT,
+		own INTEGER DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS sender_breaches (
+		email TEXT,
+		breach TEXT,
+		PRIMARY KEY (email, breach)
+	) WITHOUT ROWID;`
+
+// Run the Have I Been Pwned enrichment command
+func runHIBP(args []string) {
+	config := &Config{}
+	var account, keyEnv string
+
+	fs := accountFlags("hibp", config)
+	fs.StringVar(&account, "account", "", "Own address to look up in breaches (default: -user)")
+	fs.StringVar(&keyEnv, "key-env", "HIBP_API_KEY", "Environment variable holding the API key needed for the address lookup")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	account = firstNonEmpty(account, config.Username)
+	if err := enrichHIBP(db, account, logSecret(os.Getenv(keyEnv))); err != nil {
+		log.Printf("HIBP error: %v", err)
+		fmt.Printf("❌ HIBP error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Load the breach catalogue, mark the breaches of the own address (with an API key)
+// and flag senders from breached services
+func enrichHIBP(db *sql.DB, account, apiKey string) error {
+	var breaches []Breach
+	if err := hibpRequest("/breaches", "", &breaches); err != nil {
+		return fmt.Errorf("failed to load breaches: %v", err)
+	}
+
+	own := make(map[string]bool)
+	if !strings.Contains(account, "@") {
+		fmt.Printf("⚠️  %q is not an address, use -account to look up your own address\n", account)
+		apiKey = ""
+	} else if apiKey == "" {
+		fmt.Println("⚠️  No API key, skipping the lookup of your own address")
+	} else {
+		var found []Breach
+		if err := hibpRequest("/breachedaccount/"+url.PathEscape(account), apiKey, &found); err != nil {
+			return fmt.Errorf("failed to look up %s: %v", account, err)
+		}
+		for _, breach := range found {
+			own[breach.Name] = true
+		}
+	}
+
+	if err := saveBreaches(db, breaches, own); err != nil {
+		return fmt.Errorf("failed to save breaches: %v", err)
+	}
+	flagged, err := flagBreachedSenders(db, breaches)
+	if err != nil {
+		return fmt.Errorf("failed to flag senders: %v", err)
+	}
+
+	log.Printf("HIBP completed: %d breaches, %d in own address, %d senders flagged", len(breaches), len(own), flagged)
+	if apiKey != "" {
+		if len(own) == 0 {
+			fmt.Printf("✅ %s was not found in any breach\n", account)
+		} else {
+			fmt.Printf("⚠️  Breaches containing %s:\n", account)
+			for _, breach := range breaches {
+				if own[breach.Name] {
+					fmt.Printf("  - %s (%s): %s\n", breach.Title, breach.BreachDate, strings.Join(breach.DataClasses, ", "))
+				}
+			}
+		}
+	}
+	fmt.Printf("✅ %d breaches checked, %d senders from breached services\n", len(breaches), flagged)
+	showBreachedSenders(db)
+	return nil
+}
+
+// Call the API and decode its JSON answer; a 404 means nothing was found
+func hibpRequest(path, apiKey string, result any) error {
+	req, err := http.NewRequest("GET", hibpAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	if apiKey != "" {
+		req.Header.Set("hibp-api-key", apiKey)
+	}
+
+	client := &http.Client{Timeout: hibpTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(result)
+	case http.StatusNotFound:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("API key rejected")
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("rate limited, retry in %ss", firstNonEmpty(resp.Header.Get("Retry-After"), "a few "))
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// Replace the stored breach catalogue
+func saveBreaches(db *sql.DB, breaches []Breach, own map[string]bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM breaches"); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO breaches (name, title, domain, breach_date, pwn_count, data_classes, own)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, b := range breaches {
+		if _, err := stmt.Exec(b.Name, b.Title, strings.ToLower(b.Domain), b.BreachDate, b.PwnCount,
+			strings.Join(b.DataClasses, ", "), own[b.Name]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Link each sender to the breaches of its organizational domain
+func flagBreachedSenders(db *sql.DB, breaches []Breach) (int, error) {
+	byDomain := make(map[string][]string)
+	for _, b := range breaches {
+		if b.Domain != "" {
+			domain := orgDomain(strings.ToLower(b.Domain))
+			byDomain[domain] = append(byDomain[domain], b.Name)
+		}
+	}
+
+	rows, err := db.Query("SELECT email FROM senders")
+	if err != nil {
+		return 0, err
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM sender_breaches"); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare("INSERT INTO sender_breaches (email, breach) VALUES (?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	flagged := 0
+	for _, email := range emails {
+		names := byDomain[orgDomain(emailDomain(email))]
+		if len(names) == 0 {
+			continue
+		}
+		for _, name := range names {
+			if _, err := stmt.Exec(email, name); err != nil {
+				return 0, err
+			}
+		}
+		flagged++
+	}
+	return flagged, tx.Commit()
+}
+
+// Breaches of the senders per domain ("Adobe 2013-10-04 (your address)"), after hibp
+func domainBreaches(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT lower(substr(sb.email, instr(sb.email, '@') + 1)) AS domain, b.title, b.breach_date, b.own
+		FROM sender_breaches sb JOIN breaches b ON b.name = sb.breach
+		ORDER BY domain, b.own DESC, b.breach_date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDomain := make(map[string][]string)
+	for rows.Next() {
+		var domain, title, date string
+		var own bool
+		if err := rows.Scan(&domain, &title, &date, &own); err != nil {
+			return nil, err
+		}
+		breach := title + " " + date
+		if own {
+			breach += " (your address)"
+		}
+		byDomain[domain] = append(byDomain[domain], breach)
+	}
+
+	summaries := make(map[string]string)
+	for domain, breaches := range byDomain {
+		summaries[domain] = strings.Join(breaches, ", ")
+	}
+	return summaries, rows.Err()
+}
+
+// Print the breached services that send mail, those with the own address first
+func showBreachedSenders(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT b.title, b.domain, b.breach_date, b.own, COUNT(*)
+		FROM breaches b JOIN sender_breaches sb ON sb.breach = b.name
+		GROUP BY b.name ORDER BY b.own DESC, COUNT(*) DESC LIMIT 20`)
+	if err != nil {
+		log.Printf("Failed to query breached senders: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		if i == 0 {
+			fmt.Printf("\nSenders from breached services:\n")
+		}
+		var title, domain, date string
+		var own bool
+		var senders int
+		rows.Scan(&title, &domain, &date, &own, &senders)
+		note := ""
+		if own {
+			note = ", includes your address"
+		}
+		fmt.Printf("  - %s (%s, breached %s%s): %s\n", title, domain, date, note, plural(senders, "sender"))
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Run the ignore command: ignore [add] <email|domain>..., ignore remove <email|domain>..., ignore list
+func runIgnore(args []string) {
+	action := "add"
+	if len(args) > 0 && (args[0] == "add" || args[0] == "remove" || args[0] == "list") {
+		action, args = args[0], args[1:]
+	}
+
+	config := &Config{}
+	fs := accountFlags("ignore", config)
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	switch action {
+	case "add":
+		if fs.NArg() == 0 {
+			fmt.Println("❌ Error: usage: ignore <email|domain>...")
+			os.Exit(exitUsage)
+		}
+		for _, value := range fs.Args() {
+			entry := newFlaggedEntry(value, "")
+			if _, err := db.Exec("INSERT OR IGNORE INTO ignored (value, kind) VALUES (?, ?)", entry.Value, entry.Kind); err != nil {
+				log.Printf("Failed to ignore %s: %v", entry.Value, err)
+				fmt.Printf("❌ Failed to ignore %s: %v\n", entry.Value, err)
+				os.Exit(exitDatabase)
+			}
+			log.Printf("Ignored %s: %s", entry.Kind, entry.Value)
+			fmt.Printf("Ignored %s: %s\n", entry.Kind, entry.Value)
+		}
+	case "remove":
+		for _, value := range fs.Args() {
+			entry := newFlaggedEntry(value, "")
+			if _, err := db.Exec("DELETE FROM ignored WHERE value = ?", entry.Value); err != nil {
+				log.Printf("Failed to unignore %s: %v", entry.Value, err)
+				fmt.Printf("❌ Failed to unignore %s: %v\n", entry.Value, err)
+				os.Exit(exitDatabase)
+			}
+			log.Printf("Unignored: %s", entry.Value)
+			fmt.Printf("No longer ignored: %s\n", entry.Value)
+		}
+	case "list":
+		rows, err := db.Query("SELECT value, kind FROM ignored ORDER BY kind, value")
+		if err != nil {
+			fmt.Printf("❌ Failed to load ignored entries: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		defer rows.Close()
+		total := 0
+		for rows.Next() {
+			var value, kind string
+			if err := rows.Scan(&value, &kind); err != nil {
+				fmt.Printf("❌ Failed to load ignored entries: %v\n", err)
+				os.Exit(exitDatabase)
+			}
+			fmt.Printf("  - [%s] %s\n", kind, value)
+			total++
+		}
+		fmt.Printf("Total ignored: %d\n", total)
+	}
+}
+
+// Load ignored addresses and domains
+func loadIgnored(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT value FROM ignored")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ignored := make(map[string]bool)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		ignored[value] = true
+	}
+	return ignored, rows.Err()
+}
+
+// Check if an address or its domain is ignored
+func isIgnored(ignored map[string]bool, email string) bool {
+	email = strings.ToLower(email)
+	return ignored[email] || ignored[emailDomain(email)]
+}
+
+// SQL condition keeping senders (by their email column) that are not ignored
+func notIgnoredCondition(emailColumn string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM ignored i
+		WHERE i.value = lower(%[1]s) OR i.value = lower(substr(%[1]s, instr(%[1]s, '@') + 1)))`, emailColumn)
+}
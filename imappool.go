@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+)
+
+const (
+	// Connections of one account open at a time, well below the per-account limits
+	// of the big providers (Gmail allows 15)
+	maxPoolConnections = 4
+	// Connections unused for longer are checked with a NOOP before they are handed out again
+	poolHealthCheckAfter = 30 * time.Second
+)
+
+// imapPool structure for the logged-in connections of one account. A connection is
+// used by one caller at a time and returned after use; the next caller gets it back
+// after a health check instead of dialing and logging in again
+type imapPool struct {
+	config *Config
+	slots  chan struct{}
+
+	mu   sync.Mutex
+	idle []pooledConn
+}
+
+// pooledConn structure for an idle connection and when it was returned
+type pooledConn struct {
+	c     *client.Client
+	since time.Time
+}
+
+// Create an empty pool for the account of config
+func newIMAPPool(config *Config) *imapPool {
+	return &imapPool{config: config, slots: make(chan struct{}, maxPoolConnections)}
+}
+
+// Take a connection: an idle one that is still alive, or a new one once fewer than
+// maxPoolConnections are in use
+func (p *imapPool) get(ctx context.Context) (*client.Client, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if healthy(ctx, conn) {
+			return conn.c, nil
+		}
+		conn.c.Terminate()
+	}
+
+	c, err := connectIMAP(ctx, p.config)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// Check if an idle connection can be handed out: it must still be open and, after
+// sitting unused for a while, answer a NOOP
+func healthy(ctx context.Context, conn pooledConn) bool {
+	if imapClosed(conn.c) {
+		return false
+	}
+	if time.Since(conn.since) < poolHealthCheckAfter {
+		return true
+	}
+	defer closeOnCancel(ctx, conn.c)()
+	if err := conn.c.Noop(); err != nil {
+		log.Printf("Pooled IMAP connection failed the health check: %v", err)
+		return false
+	}
+	return true
+}
+
+// Return a connection taken with get. Closed connections are dropped, the next get
+// dials a new one
+func (p *imapPool) put(c *client.Client) {
+	defer func() { <-p.slots }()
+	if imapClosed(c) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = append(p.idle, pooledConn{c: c, since: time.Now()})
+}
+
+// Log out the idle connections
+func (p *imapPool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, conn := range idle {
+		conn.c.Logout()
+	}
+	if len(idle) > 0 {
+		log.Printf("Closed %d pooled IMAP connections", len(idle))
+	}
+}
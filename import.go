@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Column names recognized without an explicit -map, keyed by normalized header
+var importColumnAliases = map[string]string{
+	"email":          "email",
+	"e-mail":         "email",
+	"email address":  "email",
+	"e-mail address": "email",
+	"mail":           "email",
+	"name":           "name",
+	"full name":      "name",
+	"full_name":      "name",
+	"display name":   "name",
+	"first name":     "first_name",
+	"first_name":     "first_name",
+	"given name":     "first_name",
+	"last name":      "last_name",
+	"last_name":      "last_name",
+	"family name":    "last_name",
+	"surname":        "last_name",
+	"phone":          "phone",
+	"phone number":   "phone",
+	"mobile":         "phone",
+	"telephone":      "phone",
+	"company":        "company",
+	"organization":   "company",
+	"organisation":   "company",
+	"title":          "job_title",
+	"job title":      "job_title",
+	"job_title":      "job_title",
+	"tags":           "tags",
+	"labels":         "tags",
+}
+
+// Fields that columns can be mapped to
+var importFields = []string{"email", "name", "first_name", "last_name", "phone", "company", "job_title", "tags"}
+
+// ImportRecord structure for one imported row, keyed by field
+type ImportRecord map[string]string
+
+// Run the import command
+func runImport(args []string) {
+	config := &Config{}
+	var format, mapping string
+
+	fs := accountFlags("import", config)
+	fs.StringVar(&format, "format", "", "Input format (csv, json; default: from file extension)")
+	fs.StringVar(&mapping, "map", "", "Column mapping, e.g. \"E-Mail Address=email,Org=company\"")
+	parseLocalFlags(fs, config, args)
+
+	if fs.NArg() == 0 {
+		fmt.Println("❌ Error: import requires a file, e.g. peep import -user john@gmail.com senders.csv")
+		os.Exit(1)
+	}
+
+	columns, err := parseImportMap(mapping)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	for _, path := range fs.Args() {
+		if err := importFile(db, config, path, format, columns); err != nil {
+			log.Printf("Import error (%s): %v", path, err)
+			fmt.Printf("❌ Import error (%s): %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Parse a "Column=field,..." mapping
+func parseImportMap(value string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, item := range splitList(value) {
+		column, field, ok := strings.Cut(item, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || !slices.Contains(importFields, field) {
+			return nil, fmt.Errorf("invalid mapping %q (fields: %s)", item, strings.Join(importFields, ", "))
+		}
+		columns[normalizeImportColumn(column)] = field
+	}
+	return columns, nil
+}
+
+// Normalize a column header for matching
+func normalizeImportColumn(column string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(column, "\ufeff")), " "))
+}
+
+// Resolve the field of a column from the explicit mapping or the known aliases
+func importField(columns map[string]string, column string) string {
+	column = normalizeImportColumn(column)
+	if field, ok := columns[column]; ok {
+		return field
+	}
+	if len(columns) == 0 {
+		return importColumnAliases[column]
+	}
+	return ""
+}
+
+// Read records from a CSV file with a header row
+func readImportCSV(r io.Reader, columns map[string]string) ([]ImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	fields := make([]string, len(header))
+	for i, column := range header {
+		fields[i] = importField(columns, column)
+	}
+
+	var records []ImportRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := make(ImportRecord)
+		for i, value := range row {
+			if i < len(fields) && fields[i] != "" && strings.TrimSpace(value) != "" {
+				record[fields[i]] = strings.TrimSpace(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Read records from a JSON array of objects
+func readImportJSON(r io.Reader, columns map[string]string) ([]ImportRecord, error) {
+	var objects []map[string]any
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of objects: %v", err)
+	}
+
+	var records []ImportRecord
+	for _, object := range objects {
+		record := make(ImportRecord)
+		for key, value := range object {
+			field := importField(columns, key)
+			if field == "" || value == nil {
+				continue
+			}
+			var text string
+			switch v := value.(type) {
+			case string:
+				text = v
+			case []any:
+				var parts []string
+				for _, part := range v {
+					parts = append(parts, fmt.Sprint(part))
+				}
+				text = strings.Join(parts, ",")
+			default:
+				text = fmt.Sprint(v)
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				record[field] = text
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Import one file into the senders table
+func importFile(db *sql.DB, config *Config, path, format string, columns map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	var records []ImportRecord
+	switch format {
+	case "csv":
+		records, err = readImportCSV(file, columns)
+	case "json":
+		records, err = readImportJSON(file, columns)
+	default:
+		return fmt.Errorf("unsupported import format %q (use -format csv or json)", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	var senders, tagged []EmailSender
+	invalid, skipped := 0, 0
+	for _, record := range records {
+		sender, ok := importSender(record, config)
+		if !ok {
+			invalid++
+			continue
+		}
+		if sender.Excluded || !domainAllowed(config, emailDomain(sender.Email)) {
+			skipped++
+			continue
+		}
+		senders = append(senders, sender)
+
+		// Tags from the file are saved separately from rule tags
+		var tags []string
+		for _, tag := range splitList(record["tags"]) {
+			tags = append(tags, strings.ToLower(tag))
+		}
+		if len(tags) > 0 {
+			tagged = append(tagged, EmailSender{Email: sender.Email, Tags: tags})
+		}
+	}
+
+	newCount, err := storeSenders(db, config, senders)
+	if err != nil {
+		return err
+	}
+	if err := saveImportDetails(db, senders); err != nil {
+		return err
+	}
+	if err := inTx(context.Background(), db, func(tx *sql.Tx) error { return saveSenderTags(tx, tagged, "import") }); err != nil {
+		return err
+	}
+
+	log.Printf("Import completed (%s): %d records, %d new, %d existing, %d skipped, %d invalid",
+		path, len(records), newCount, len(senders)-newCount, skipped, invalid)
+	fmt.Printf("✅ Imported %s: %d new, %d existing, %d skipped, %d invalid\n",
+		path, newCount, len(senders)-newCount, skipped, invalid)
+	return nil
+}
+
+// Build a sender from an imported record, normalized like scanned senders
+func importSender(record ImportRecord, config *Config) (EmailSender, bool) {
+	name := record["name"]
+	if name == "" {
+		name = strings.TrimSpace(record["first_name"] + " " + record["last_name"])
+	}
+
+	addr, err := mail.ParseAddress(record["email"])
+	if err != nil {
+		return EmailSender{}, false
+	}
+	if name == "" {
+		name = addr.Name
+	}
+
+	senders := parseSenders((&mail.Address{Name: name, Address: addr.Address}).String(), config)
+	if len(senders) != 1 {
+		return EmailSender{}, false
+	}
+	sender := senders[0]
+	sender.RawFrom = ""
+
+	if record["phone"] != "" || record["job_title"] != "" || record["company"] != "" {
+		sender.Signature = &Signature{Phone: record["phone"], Title: record["job_title"], Company: record["company"]}
+	}
+	return sender, true
+}
+
+// Fill contact details of imported senders without overwriting known values
+func saveImportDetails(db *sql.DB, senders []EmailSender) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		UPDATE senders SET
+			phone = COALESCE(phone, NULLIF(?, '')),
+			job_title = COALESCE(job_title, NULLIF(?, '')),
+			company = COALESCE(company, NULLIF(?, ''))
+		WHERE email = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sender := range senders {
+		if sender.Signature == nil {
+			continue
+		}
+		sig := sender.Signature
+		if _, err := stmt.Exec(sig.Phone, sig.Title, sig.Company, sender.Email); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// Calendar parts longer than this are only read up to it
+const maxInviteScan = 64 * 1024
+
+// Invite structure for the meeting invite carried by a message
+type Invite struct {
+	// ORGANIZER of the events as "Name <address>"
+	Organizers []string
+}
+
+// Find a meeting invite (text/calendar with METHOD:REQUEST) in a message
+func messageInvite(raw []byte) *Invite {
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil
+	}
+
+	var invite *Invite
+	entity.Walk(func(path []int, part *message.Entity, err error) error {
+		if err != nil {
+			return nil
+		}
+		mediaType, params, _ := part.Header.ContentType()
+		if mediaType != "text/calendar" && mediaType != "application/ics" {
+			return nil
+		}
+		// Replies to an invite (accepted, declined) come from attendees
+		if method := strings.ToUpper(params["method"]); method != "" && method != "REQUEST" {
+			return nil
+		}
+		if found := parseInvite(io.LimitReader(part.Body, maxInviteScan)); found != nil {
+			invite = found
+			return errStopWalk
+		}
+		return nil
+	})
+
+	return invite
+}
+
+// Read the METHOD and ORGANIZER properties of an iCalendar object, nil if it is
+// not a request
+func parseInvite(r io.Reader) *Invite {
+	invite := &Invite{}
+	for _, line := range unfoldICS(r) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "METHOD":
+			if !strings.EqualFold(strings.TrimSpace(value), "REQUEST") {
+				return nil
+			}
+		case "ORGANIZER":
+			address := strings.TrimSpace(value)
+			if len(address) < 7 || !strings.EqualFold(address[:7], "mailto:") || !strings.Contains(address, "@") {
+				continue
+			}
+			organizer := "<" + address[7:] + ">"
+			if name := icsParam(params, "CN"); name != "" {
+				organizer = `"` + strings.ReplaceAll(name, `"`, "") + `" ` + organizer
+			}
+			invite.Organizers = append(invite.Organizers, organizer)
+		}
+	}
+	return invite
+}
+
+// Lines of an iCalendar object with folded continuation lines joined
+func unfoldICS(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxInviteScan)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Value of a property parameter such as CN="Jane Doe"
+func icsParam(params, name string) string {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if ok && strings.EqualFold(key, name) {
+			return strings.TrimSpace(strings.Trim(value, `"`))
+		}
+	}
+	return ""
+}
+
+// Organizers of an invite as additional senders, skipping addresses already found in From
+func inviteOrganizerSenders(invite *Invite, senders []EmailSender, config *Config) []EmailSender {
+	known := make(map[string]bool)
+	for _, sender := range senders {
+		known[sender.Email] = true
+	}
+
+	var organizers []EmailSender
+	for _, organizer := range invite.Organizers {
+		for _, sender := range parseSenders(organizer, config) {
+			if known[sender.Email] {
+				continue
+			}
+			known[sender.Email] = true
+			sender.Invite = true
+			organizers = append(organizers, sender)
+		}
+	}
+	return organizers
+}
+
+// Print the senders sending the most meeting invites
+func showInviteSenders(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT COALESCE(full_name, ''), email, invite_count
+		FROM senders WHERE invite_count > 0 ORDER BY invite_count DESC, email LIMIT 10`)
+	if err != nil {
+		log.Printf("Failed to query invite senders: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		if i == 0 {
+			fmt.Printf("\n📅 Senders of meeting invites:\n")
+		}
+		var fullName, email string
+		var invites int
+		rows.Scan(&fullName, &email, &invites)
+		fmt.Printf("  - %s <%s> (%s)\n", fullName, email, plural(invites, "invite"))
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// Journal of the UID ranges handled per folder: every message in a range was
+// counted exactly once, so later fetches of the same UIDs (retries, reconnects,
+// overlapping -last windows) skip them
+const createJournalTable = `
+	CREATE TABLE IF NOT EXISTS uid_journal (
+		folder TEXT,
+		uid_validity INTEGER,
+		start_uid INTEGER,
+		end_uid INTEGER,
+		messages INTEGER,
+		recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (folder, uid_validity, start_uid)
+	) WITHOUT ROWID;
+	CREATE INDEX IF NOT EXISTS idx_uid_journal_end ON uid_journal(folder, uid_validity, end_uid);`
+
+// uidRange structure for an inclusive range of UIDs
+type uidRange struct {
+	Start uint32
+	End   uint32
+}
+
+// Parts of start-end not covered by the sorted ranges
+func uncoveredRanges(start, end uint32, covered []uidRange) []uidRange {
+	var ranges []uidRange
+	next := start
+	for _, r := range covered {
+		if r.End < next || r.Start > end {
+			continue
+		}
+		if r.Start > next {
+			ranges = append(ranges, uidRange{next, r.Start - 1})
+		}
+		if r.End >= end {
+			return ranges
+		}
+		next = r.End + 1
+	}
+	return append(ranges, uidRange{next, end})
+}
+
+// Parts of the ranges within start-end
+func clipRanges(ranges []uidRange, start, end uint32) []uidRange {
+	var clipped []uidRange
+	for _, r := range ranges {
+		if r.End < start || r.Start > end {
+			continue
+		}
+		clipped = append(clipped, uidRange{max(r.Start, start), min(r.End, end)})
+	}
+	return clipped
+}
+
+// Load the journaled ranges of a folder overlapping start-end, in UID order
+func loadJournal(db *sql.DB, folder string, uidValidity, start, end uint32) ([]uidRange, error) {
+	rows, err := db.Query(`
+		SELECT start_uid, end_uid FROM uid_journal
+		WHERE folder = ? AND uid_validity = ? AND start_uid <= ? AND end_uid >= ?
+		ORDER BY start_uid`, folder, uidValidity, end, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranges []uidRange
+	for rows.Next() {
+		var r uidRange
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// Journal the ranges a batch covered with the number of messages handled in each,
+// joining them to adjacent ranges
+func journalBatch(tx *sql.Tx, folder string, uidValidity uint32, covered []uidRange, uids []uint32) error {
+	for _, r := range covered {
+		messages := 0
+		for _, uid := range uids {
+			if uid >= r.Start && uid <= r.End {
+				messages++
+			}
+		}
+
+		// Fold in a range starting right after this one
+		var nextEnd uint32
+		var nextMessages int
+		err := tx.QueryRow(`SELECT end_uid, messages FROM uid_journal WHERE folder = ? AND uid_validity = ? AND start_uid = ?`,
+			folder, uidValidity, r.End+1).Scan(&nextEnd, &nextMessages)
+		if err == nil {
+			if _, err := tx.Exec(`DELETE FROM uid_journal WHERE folder = ? AND uid_validity = ? AND start_uid = ?`,
+				folder, uidValidity, r.End+1); err != nil {
+				return err
+			}
+			r.End = nextEnd
+			messages += nextMessages
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		// Extend the range ending right before this one, or start a new one
+		result, err := tx.Exec(`UPDATE uid_journal SET end_uid = ?, messages = messages + ?, recorded_at = CURRENT_TIMESTAMP
+			WHERE folder = ? AND uid_validity = ? AND end_uid = ?`, r.End, messages, folder, uidValidity, r.Start-1)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO uid_journal (folder, uid_validity, start_uid, end_uid, messages) VALUES (?, ?, ?, ?, ?)`,
+			folder, uidValidity, r.Start, r.End, messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Journal the progress of a folder scanned before the journal existed, leaving out
+// its failed ranges so they are still retried
+func seedJournal(db *sql.DB, progress *Progress) error {
+	if progress.LastProcessedUID == 0 {
+		return nil
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM uid_journal WHERE folder = ? AND uid_validity = ?",
+		progress.Folder, progress.UIDValidity).Scan(&count); err != nil || count > 0 {
+		return err
+	}
+
+	failed, err := loadFailedRanges(db, progress.Folder, progress.UIDValidity, 0)
+	if err != nil {
+		return err
+	}
+	var skipped []uidRange
+	for _, r := range failed {
+		skipped = append(skipped, uidRange{r.StartUID, r.EndUID})
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Start < skipped[j].Start })
+
+	return inTx(context.Background(), db, func(tx *sql.Tx) error {
+		// The messages counted so far are recorded on the first range
+		messages := progress.ProcessedCount
+		for _, r := range uncoveredRanges(1, progress.LastProcessedUID, skipped) {
+			if _, err := tx.Exec(`INSERT INTO uid_journal (folder, uid_validity, start_uid, end_uid, messages) VALUES (?, ?, ?, ?, ?)`,
+				progress.Folder, progress.UIDValidity, r.Start, r.End, messages); err != nil {
+				return err
+			}
+			messages = 0
+		}
+		log.Printf("UID journal started for %s: UID 1-%d processed before", progress.Folder, progress.LastProcessedUID)
+		return nil
+	})
+}
+
+// Drop journaled ranges recorded under an older UIDVALIDITY
+func clearStaleJournal(db *sql.DB, folder string, uidValidity uint32) {
+	result, err := db.Exec("DELETE FROM uid_journal WHERE folder = ? AND uid_validity != ?", folder, uidValidity)
+	if err != nil {
+		log.Printf("Failed to clear stale UID journal: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Cleared %d journaled ranges from previous UIDVALIDITY", n)
+	}
+}
+
+// JournalCheck structure for the result of checking a folder's progress against its journal
+type JournalCheck struct {
+	Folder    string
+	Progress  Progress
+	Journaled int
+	Ranges    int
+	Overlaps  []uidRange
+	Missed    []uidRange
+}
+
+// Check if the progress of a folder matches its journal
+func (c JournalCheck) OK() bool {
+	return len(c.Overlaps) == 0 && len(c.Missed) == 0 && c.Journaled == int(c.Progress.ProcessedCount)
+}
+
+// Compare the progress of a folder with its journal: processed counts must match,
+// no UID may be journaled twice and every UID up to the resume point must be
+// journaled or queued as a failed range
+func checkJournal(db *sql.DB, progress Progress) (JournalCheck, error) {
+	check := JournalCheck{Folder: progress.Folder, Progress: progress}
+	journal, err := loadJournal(db, progress.Folder, progress.UIDValidity, 0, ^uint32(0))
+	if err != nil {
+		return check, err
+	}
+	if err := db.QueryRow("SELECT COALESCE(SUM(messages), 0) FROM uid_journal WHERE folder = ? AND uid_validity = ?",
+		progress.Folder, progress.UIDValidity).Scan(&check.Journaled); err != nil {
+		return check, err
+	}
+	check.Ranges = len(journal)
+
+	covered := journal
+	for i := 1; i < len(journal); i++ {
+		if journal[i].Start <= journal[i-1].End {
+			check.Overlaps = append(check.Overlaps, uidRange{journal[i].Start, min(journal[i].End, journal[i-1].End)})
+		}
+	}
+
+	failed, err := loadFailedRanges(db, progress.Folder, progress.UIDValidity, 0)
+	if err != nil {
+		return check, err
+	}
+	for _, r := range failed {
+		covered = append(covered, uidRange{r.StartUID, r.EndUID})
+	}
+	sort.Slice(covered, func(i, j int) bool { return covered[i].Start < covered[j].Start })
+	if progress.LastProcessedUID > 0 {
+		check.Missed = uncoveredRanges(1, progress.LastProcessedUID, covered)
+	}
+	return check, nil
+}
+
+// Run the verify-progress command
+func runVerifyProgress(args []string) {
+	config := &Config{}
+	fs := accountFlags("verify-progress", config)
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	folders, err := loadFolderProgress(db)
+	if err != nil {
+		fmt.Printf("❌ Database error: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	if len(folders) == 0 {
+		fmt.Println("No scanned folders")
+		return
+	}
+
+	failed := 0
+	for _, progress := range folders {
+		check, err := checkJournal(db, progress)
+		if err != nil {
+			fmt.Printf("❌ Database error: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		if check.Ranges == 0 && progress.LastProcessedUID > 0 {
+			fmt.Printf("⚠️  %s: no UID journal yet, it starts with the next scan of the folder\n", check.Folder)
+			continue
+		}
+		if check.OK() {
+			fmt.Printf("✅ %s: %d messages up to UID %d, journal matches (%s)\n",
+				check.Folder, progress.ProcessedCount, progress.LastProcessedUID, plural(check.Ranges, "range"))
+			continue
+		}
+
+		failed++
+		fmt.Printf("❌ %s: progress does not match the UID journal\n", check.Folder)
+		if check.Journaled != int(progress.ProcessedCount) {
+			fmt.Printf("   Processed count %d, journal %d\n", progress.ProcessedCount, check.Journaled)
+		}
+		for _, r := range check.Overlaps {
+			fmt.Printf("   UID %d-%d journaled twice\n", r.Start, r.End)
+		}
+		for _, r := range check.Missed {
+			fmt.Printf("   UID %d-%d never processed and not queued for retry\n", r.Start, r.End)
+		}
+		log.Printf("Progress check failed for %s: processed %d, journaled %d, %d overlaps, %d missed ranges",
+			check.Folder, progress.ProcessedCount, check.Journaled, len(check.Overlaps), len(check.Missed))
+	}
+	if failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Largest senders table kept in memory as a set (about 100 bytes per address);
+// bigger databases are checked with queries instead
+const maxKnownSenders = 2000000
+
+// Addresses looked up per query when the senders are not kept in memory
+const existsChunkSize = 500
+
+// knownSenders structure for the addresses of the senders table, loaded once per
+// run so new senders are found without a query per address. Without emails the
+// database is too big for the set and is asked instead
+type knownSenders struct {
+	db     *sql.DB
+	mu     sync.Mutex
+	emails map[string]struct{}
+}
+
+// Load the stored addresses
+func loadKnownSenders(db *sql.DB) (*knownSenders, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM senders").Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > maxKnownSenders {
+		log.Printf("%d senders stored, checking new senders with queries instead of in memory", count)
+		return &knownSenders{db: db}, nil
+	}
+
+	rows, err := db.Query("SELECT email FROM senders")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := &knownSenders{db: db, emails: make(map[string]struct{}, count)}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		known.emails[email] = struct{}{}
+	}
+	return known, rows.Err()
+}
+
+// Senders of the list that are not stored yet
+func (k *knownSenders) unknown(senders []EmailSender) ([]EmailSender, error) {
+	if k.emails == nil {
+		return unknownSenders(k.db, senders)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var unknown []EmailSender
+	for _, sender := range senders {
+		if _, ok := k.emails[sender.Email]; !ok {
+			unknown = append(unknown, sender)
+		}
+	}
+	return unknown, nil
+}
+
+// Senders of the list that are not stored yet, looked up with one query per chunk
+// of addresses instead of one per sender
+func unknownSenders(db *sql.DB, senders []EmailSender) ([]EmailSender, error) {
+	stored := make(map[string]bool)
+	for start := 0; start < len(senders); start += existsChunkSize {
+		chunk := senders[start:min(start+existsChunkSize, len(senders))]
+		args := make([]any, len(chunk))
+		for i, sender := range chunk {
+			args[i] = sender.Email
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		rows, err := db.Query("SELECT email FROM senders WHERE email IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var email string
+			if err := rows.Scan(&email); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			stored[email] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var unknown []EmailSender
+	for _, sender := range senders {
+		if !stored[sender.Email] {
+			unknown = append(unknown, sender)
+		}
+	}
+	return unknown, nil
+}
+
+// Record senders saved to the database
+func (k *knownSenders) add(senders []EmailSender) {
+	if k.emails == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, sender := range senders {
+		k.emails[sender.Email] = struct{}{}
+	}
+}
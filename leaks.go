@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// LeakReport structure for one plus-tagged address of the leak report
+type LeakReport struct {
+	Tag     string
+	Address string
+	// Organization the tagged address was given to
+	GivenTo string
+	// Other organizations mailing the tagged address
+	LeakedTo []string
+	Senders  int
+	Messages int
+}
+
+// leakOrg structure for the senders of one organizational domain mailing a tagged address
+type leakOrg struct {
+	domain    string
+	messages  int
+	firstSeen string
+	cluster   int64
+}
+
+// Split a plus-tagged address (me+shop@example.com) into its tag, empty if untagged
+func plusTag(address string) string {
+	local, _, ok := strings.Cut(address, "@")
+	if !ok {
+		return ""
+	}
+	_, tag, _ := strings.Cut(local, "+")
+	return tag
+}
+
+// Check if a tag names an organizational domain: "acme" for acme.com or mail.acme.co.uk
+func tagMatchesDomain(tag, domain string) bool {
+	label, _, _ := strings.Cut(orgDomain(domain), ".")
+	tag = strings.ToLower(strings.NewReplacer("-", "", "_", "", ".", "").Replace(tag))
+	label = strings.ReplaceAll(label, "-", "")
+	if len(tag) < 3 || len(label) < 3 {
+		return tag == label
+	}
+	return strings.Contains(label, tag) || strings.Contains(tag, label)
+}
+
+// For every plus-tagged own address, the organization it was given to (named by
+// the tag, else the first to mail it) and the other organizations that mail it.
+// Organizations found to be one by cluster (same DKIM signer, network) are not leaks
+func loadLeakReport(db *sql.DB, limit int, tags []string, includeIgnored, starred bool) ([]LeakReport, error) {
+	conditions := []string{"a.alias LIKE '%+%@%'"}
+	condition, args := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	rows, err := db.Query(`SELECT a.alias, a.email, a.message_count, COALESCE(a.first_seen, ''), COALESCE(senders.cluster_id, 0)
+		FROM sender_aliases a JOIN senders ON senders.email = a.email
+		WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byAlias := make(map[string]*LeakReport)
+	orgs := make(map[string]map[string]*leakOrg)
+	for rows.Next() {
+		var alias, email, firstSeen string
+		var messages int
+		var cluster int64
+		if err := rows.Scan(&alias, &email, &messages, &firstSeen, &cluster); err != nil {
+			return nil, err
+		}
+		tag := plusTag(alias)
+		if tag == "" {
+			continue
+		}
+		r := byAlias[alias]
+		if r == nil {
+			r = &LeakReport{Tag: tag, Address: alias}
+			byAlias[alias] = r
+			orgs[alias] = make(map[string]*leakOrg)
+		}
+		r.Senders++
+		r.Messages += messages
+
+		domain := orgDomain(emailDomain(email))
+		org := orgs[alias][domain]
+		if org == nil {
+			org = &leakOrg{domain: domain, firstSeen: firstSeen}
+			orgs[alias][domain] = org
+		}
+		org.messages += messages
+		if firstSeen != "" && firstSeen < org.firstSeen {
+			org.firstSeen = firstSeen
+		}
+		if org.cluster == 0 {
+			org.cluster = cluster
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var reports []LeakReport
+	for alias, r := range byAlias {
+		var candidates []*leakOrg
+		for _, org := range orgs[alias] {
+			candidates = append(candidates, org)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if matchA, matchB := tagMatchesDomain(r.Tag, a.domain), tagMatchesDomain(r.Tag, b.domain); matchA != matchB {
+				return matchA
+			}
+			if a.firstSeen != b.firstSeen {
+				return a.firstSeen < b.firstSeen
+			}
+			if a.messages != b.messages {
+				return a.messages > b.messages
+			}
+			return a.domain < b.domain
+		})
+
+		owner := candidates[0]
+		r.GivenTo = owner.domain
+		for _, org := range candidates[1:] {
+			if owner.cluster != 0 && org.cluster == owner.cluster {
+				continue
+			}
+			r.LeakedTo = append(r.LeakedTo, org.domain)
+		}
+		sort.Strings(r.LeakedTo)
+		reports = append(reports, *r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if len(reports[i].LeakedTo) != len(reports[j].LeakedTo) {
+			return len(reports[i].LeakedTo) > len(reports[j].LeakedTo)
+		}
+		return reports[i].Address < reports[j].Address
+	})
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+// Write the leak report as an aligned table or CSV
+func writeLeakReport(out io.Writer, format string, reports []LeakReport) error {
+	header := []string{"tag", "address", "given_to", "leaked_to", "senders", "messages"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, r := range reports {
+			leaked := strings.Join(r.LeakedTo, ", ")
+			if leaked == "" {
+				leaked = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", r.Tag, r.Address, r.GivenTo, leaked, r.Senders, r.Messages)
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range reports {
+			w.Write([]string{r.Tag, r.Address, r.GivenTo, strings.Join(r.LeakedTo, " "),
+				strconv.Itoa(r.Senders), strconv.Itoa(r.Messages)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+const (
+	// Largest header block read per message; bigger headers are quarantined
+	maxHeaderSize = 256 * 1024
+	// Body bytes read per message for signature and forward detection
+	maxBodySize = 256 * 1024
+	// Fetched messages queued for parsing ahead of the one being handled
+	parseAhead = 100
+)
+
+// Time a batch may take before it is aborted and queued for retry
+const defaultBatchTimeout = 10 * time.Minute
+
+// Whether the scan needs message bodies or headers alone are enough
+func needsBody(config *Config) bool {
+	return config.Signatures || config.FollowForwards || config.Invites || config.Organizers
+}
+
+// Section to fetch per message: the header only, or a capped prefix of the
+// whole message when bodies are needed, so large attachments are never downloaded
+func messageSection(config *Config) *imap.BodySectionName {
+	if !needsBody(config) {
+		return headerSection()
+	}
+	return &imap.BodySectionName{Peek: true, Partial: []int{0, maxHeaderSize + maxBodySize}}
+}
+
+// Section for the header block alone
+func headerSection() *imap.BodySectionName {
+	return &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true}
+}
+
+// Read a header block line by line up to and including the blank separator line,
+// failing once it grows past limit instead of buffering it
+func readHeaderBlock(br *bufio.Reader, limit int) ([]byte, error) {
+	var header bytes.Buffer
+	continued := false
+	for {
+		line, err := br.ReadSlice('\n')
+		partial := err == bufio.ErrBufferFull
+		if partial {
+			err = nil
+		}
+		if header.Len()+len(line) > limit {
+			return header.Bytes(), fmt.Errorf("header exceeds %d bytes", limit)
+		}
+		header.Write(line)
+
+		if err == io.EOF {
+			return header.Bytes(), nil
+		} else if err != nil {
+			return header.Bytes(), err
+		}
+		if !continued && !partial && len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return header.Bytes(), nil
+		}
+		continued = partial
+	}
+}
+
+// Read a message as its header block plus at most maxBody bytes of body
+func readLimitedMessage(r io.Reader, maxHeader, maxBody int) ([]byte, error) {
+	br := bufio.NewReader(r)
+	raw, err := readHeaderBlock(br, maxHeader)
+	if err != nil || maxBody == 0 {
+		return raw, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(br, int64(maxBody)))
+	if err != nil {
+		return raw, err
+	}
+	return append(raw, body...), nil
+}
+
+// Parse a size such as "5MB", "512KB" or "1048576" into bytes
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(number), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// Split a batch by RFC822.SIZE: messages above maxSize are fetched header only
+// and returned in UID order, the remaining UIDs are left for the regular fetch
+func fetchOversized(c *client.Client, seqset *imap.SeqSet, maxSize int64) ([]*imap.Message, *imap.SeqSet, error) {
+	sizes := make(chan *imap.Message, 50)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchRFC822Size}, sizes)
+	}()
+
+	large := new(imap.SeqSet)
+	rest := new(imap.SeqSet)
+	for msg := range sizes {
+		if int64(msg.Size) > maxSize {
+			large.AddNum(msg.Uid)
+		} else {
+			rest.AddNum(msg.Uid)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, nil, fmt.Errorf("size fetch failed: %v", err)
+	}
+	if large.Empty() {
+		return nil, rest, nil
+	}
+
+	items := messageFetchItems(c, headerSection())
+	headers := make(chan *imap.Message, 50)
+	go func() {
+		done <- c.UidFetch(large, items, headers)
+	}()
+
+	var oversized []*imap.Message
+	for msg := range headers {
+		oversized = append(oversized, msg)
+	}
+	if err := <-done; err != nil {
+		return nil, nil, fmt.Errorf("header fetch failed: %v", err)
+	}
+
+	sort.Slice(oversized, func(i, j int) bool { return oversized[i].Uid < oversized[j].Uid })
+	return oversized, rest, nil
+}
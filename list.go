@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Sort orders of the list command
+var listSorts = map[string]string{
+	"count":     "message_count DESC, email",
+	"last_seen": "COALESCE(last_seen_at, '') DESC, email",
+	"name":      "COALESCE(NULLIF(full_name, ''), email) COLLATE NOCASE, email",
+	"score":     "score DESC, email",
+	"flagged":   "flagged_count DESC, message_count DESC, email",
+	"email":     "email",
+}
+
+// Conditions of the list filters; "*" in a value matches anything
+var listFilters = map[string]string{
+	"domain":   "lower(substr(email, instr(email, '@') + 1)) LIKE ? ESCAPE '\\'",
+	"email":    "email LIKE ? ESCAPE '\\'",
+	"name":     "COALESCE(full_name, '') LIKE ? ESCAPE '\\'",
+	"company":  "COALESCE(company, '') LIKE ? ESCAPE '\\'",
+	"category": "COALESCE(category, '') LIKE ? ESCAPE '\\'",
+	"tag":      "EXISTS (SELECT 1 FROM sender_tags t WHERE t.email = senders.email AND t.tag LIKE ? ESCAPE '\\')",
+	"alias":    "EXISTS (SELECT 1 FROM sender_aliases a WHERE a.email = senders.email AND a.alias LIKE ? ESCAPE '\\')",
+	"label":    "EXISTS (SELECT 1 FROM sender_labels l WHERE l.email = senders.email AND l.label LIKE ? ESCAPE '\\')",
+}
+
+// ListOptions structure for the list command
+type ListOptions struct {
+	Sort    string
+	Limit   int
+	Offset  int
+	Filters stringList
+	Format  string
+	Output  string
+	// Show ignored senders too
+	IncludeIgnored bool
+	Starred        bool
+}
+
+// stringList collects the values of a flag given several times
+type stringList []string
+
+// Values joined for flag defaults
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Add one value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Run the list command
+func runList(args []string) {
+	config := &Config{ReadOnly: true}
+	opts := &ListOptions{}
+
+	fs := accountFlags("list", config)
+	fs.StringVar(&opts.Sort, "sort", "count", "Sort by count, flagged, last_seen, name, score or email")
+	fs.IntVar(&opts.Limit, "limit", 50, "Rows per page (0 = all)")
+	fs.IntVar(&opts.Offset, "offset", 0, "Rows to skip")
+	fs.Var(&opts.Filters, "filter", "Filter key=value (domain, email, name, company, category, tag, alias, label; repeatable)")
+	fs.StringVar(&opts.Format, "format", "table", "Output format (table, csv, json)")
+	fs.StringVar(&opts.Output, "o", "", "Output file (default: stdout)")
+	fs.BoolVar(&opts.IncludeIgnored, "include-ignored", false, "Include ignored senders")
+	fs.BoolVar(&opts.Starred, "starred", false, "Only starred senders")
+	fs.StringVar(&config.Remote, "remote", "", "Read the database of -user from a peep serve instance (https://host:port)")
+	parseLocalFlags(fs, config, args)
+
+	where, whereArgs, err := listConditions(opts.Filters, opts.IncludeIgnored, opts.Starred)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	order, ok := listSorts[opts.Sort]
+	if !ok {
+		fmt.Printf("❌ Error: unknown sort %q (use count, flagged, last_seen, name, score or email)\n", opts.Sort)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenReadOnlyDB(config)
+	defer db.Close()
+
+	senders, total, err := loadListSenders(db, where, whereArgs, order, opts.Limit, opts.Offset)
+	if err != nil {
+		log.Printf("List error: %v", err)
+		fmt.Printf("❌ Failed to list senders: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if opts.Format == "table" {
+		var notes map[string]string
+		if notes, err = latestNotes(db); err != nil {
+			log.Printf("Failed to load notes: %v", err)
+		}
+		err = writeListTable(out, senders, notes, total, opts.Offset)
+	} else {
+		err = writeExport(out, opts.Format, senders)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Senders listed: %d of %d (%s)", len(senders), total, opts.Format)
+}
+
+// Turn key=value filters into SQL conditions
+func listConditions(filters []string, includeIgnored, starred bool) (string, []any, error) {
+	var conditions []string
+	var args []any
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		condition, known := listFilters[strings.TrimSpace(key)]
+		if !ok || !known {
+			return "", nil, fmt.Errorf("invalid filter %q (use key=value with domain, email, name, company, category, tag, alias or label)", filter)
+		}
+		conditions = append(conditions, condition)
+		args = append(args, likePattern(strings.TrimSpace(value)))
+	}
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// LIKE pattern for a filter value, with "*" as the only wildcard
+func likePattern(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return strings.ReplaceAll(value, "*", "%")
+}
+
+// Load one page of senders and the number of senders matching the filters
+func loadListSenders(db *sql.DB, where string, args []any, order string, limit, offset int) ([]ExportedSender, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM senders"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + exportColumns + " FROM senders" + where + " ORDER BY " + order
+	pageArgs := append([]any(nil), args...)
+	if limit > 0 || offset > 0 {
+		// SQLite needs a LIMIT for an OFFSET; -1 means no limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		pageArgs = append(pageArgs, limit, max(offset, 0))
+	}
+
+	rows, err := db.Query(query, pageArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	senders, err := scanExportedSenders(rows)
+	return senders, total, err
+}
+
+// Write a page of senders as an aligned table with their latest note and the position in the full list
+func writeListTable(out io.Writer, senders []ExportedSender, notes map[string]string, total, offset int) error {
+	if len(senders) == 0 {
+		fmt.Fprintf(out, "No senders (%d match)\n", total)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tEMAIL\tMESSAGES\tFLAGGED\tLAST SEEN\tSCORE\tCATEGORY\tNOTE")
+	for _, s := range senders {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%.1f\t%s\t%s\n", s.Name, s.Email, s.Messages, s.Flagged, lastSeenDate(s.LastSeen), s.Score, s.Category,
+			shortNote(notes[s.Email]))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\nSenders %d-%d of %d\n", offset+1, offset+len(senders), total)
+	return err
+}
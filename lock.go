@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Lock files without readable details are only taken over after this long,
+// so a lock that is being written right now is not mistaken for a stale one
+const unreadableLockAge = time.Minute
+
+// ScanLock structure for the lock file held while a run writes to a user's database
+type ScanLock struct {
+	Path string
+}
+
+// LockInfo structure for the details written into a lock file
+type LockInfo struct {
+	PID     int
+	Host    string
+	Command string
+	Started string
+}
+
+// Lock file of a database
+func lockPath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// Take the lock of the user's database, replacing a lock left by a run that no longer exists
+func acquireLock(config *Config) (*ScanLock, error) {
+	path := lockPath(config.DBPath)
+	host, _ := os.Hostname()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "pid=%d\nhost=%s\ncommand=%s\nstarted=%s\n",
+				os.Getpid(), host, config.Command, time.Now().Format(time.RFC3339))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock %s: %v", path, err)
+			}
+			log.Printf("Lock acquired: %s", path)
+			return &ScanLock{Path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %v", path, err)
+		}
+
+		info, readErr := readLock(path)
+		if !lockStale(path, info, readErr, host) {
+			return nil, withExitCode(exitLocked, fmt.Errorf(
+				"%s is in use by another run (%s, PID %d on %s, started %s); delete %s if that run no longer exists",
+				config.DBPath, info.Command, info.PID, info.Host, info.Started, path))
+		}
+		if err := removeStaleLock(path, host); err != nil {
+			return nil, err
+		}
+	}
+	return nil, withExitCode(exitLocked, fmt.Errorf("%s is in use by another run", config.DBPath))
+}
+
+// Remove a stale lock while holding its reclaim file, checking again that it is
+// stale: two runs finding the same stale lock would otherwise both remove it, the
+// second one deleting the lock the first one just took. The lock itself is only
+// ever taken by creating it exclusively
+func removeStaleLock(path, host string) error {
+	reclaim := path + ".reclaim"
+	file, err := os.OpenFile(reclaim, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		// Another run is reclaiming the lock; a reclaim file left by a crash expires
+		if stat, err := os.Stat(reclaim); err == nil && time.Since(stat.ModTime()) > unreadableLockAge {
+			os.Remove(reclaim)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", reclaim, err)
+	}
+	file.Close()
+	defer os.Remove(reclaim)
+
+	info, readErr := readLock(path)
+	if errors.Is(readErr, os.ErrNotExist) || !lockStale(path, info, readErr, host) {
+		return nil
+	}
+	log.Printf("Removing stale lock %s (PID %d on %s)", path, info.PID, info.Host)
+	fmt.Printf("⚠️  Removing stale lock left by PID %d\n", info.PID)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale lock %s: %v", path, err)
+	}
+	return nil
+}
+
+// Acquire the lock, reporting why when another run holds it
+func takeLock(config *Config) (*ScanLock, error) {
+	lock, err := acquireLock(config)
+	if err != nil {
+		log.Printf("Lock error: %v", err)
+		fmt.Printf("❌ %v\n", err)
+	}
+	return lock, err
+}
+
+// Release the lock
+func (l *ScanLock) Release() {
+	if err := os.Remove(l.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove lock %s: %v", l.Path, err)
+		return
+	}
+	log.Printf("Lock released: %s", l.Path)
+}
+
+// Read the details of a lock file
+func readLock(path string) (LockInfo, error) {
+	var info LockInfo
+	file, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "pid":
+			info.PID, _ = strconv.Atoi(value)
+		case "host":
+			info.Host = value
+		case "command":
+			info.Command = value
+		case "started":
+			info.Started = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return info, err
+	}
+	if info.PID <= 0 {
+		return info, fmt.Errorf("no PID in %s", path)
+	}
+	return info, nil
+}
+
+// Check whether a lock was left behind by a run that no longer exists
+func lockStale(path string, info LockInfo, readErr error, host string) bool {
+	if readErr != nil {
+		stat, err := os.Stat(path)
+		return err == nil && time.Since(stat.ModTime()) > unreadableLockAge
+	}
+	// Processes of other machines sharing the directory cannot be checked
+	if info.Host != host {
+		return false
+	}
+	return !processAlive(info.PID)
+}
+
+// Check if a process with the PID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process on Windows and fails if it does not exist
+		process.Release()
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// Longest unrecognized X-Mailer/User-Agent value that is stored
+const maxMailerLength = 100
+
+// Kinds of sending software
+const (
+	mailerClient   = "client"
+	mailerPlatform = "platform"
+	mailerUnknown  = "unknown"
+)
+
+// MailerFingerprint structure for recognized sending software
+type MailerFingerprint struct {
+	Name    string
+	Kind    string
+	Pattern *regexp.Regexp
+}
+
+// Known mail clients and sending platforms, matched against X-Mailer/User-Agent
+var mailerFingerprints = []MailerFingerprint{
+	{"Apple Mail", mailerClient, regexp.MustCompile(`(?i)apple mail|iphone mail|ipad mail|^ios mail`)},
+	{"Outlook", mailerClient, regexp.MustCompile(`(?i)microsoft outlook|outlook-(ios|android)|microsoft office outlook`)},
+	{"Thunderbird", mailerClient, regexp.MustCompile(`(?i)thunderbird|icedove`)},
+	{"Mutt", mailerClient, regexp.MustCompile(`(?i)\b(neo)?mutt\b`)},
+	{"Evolution", mailerClient, regexp.MustCompile(`(?i)\bevolution\b`)},
+	{"K-9 Mail", mailerClient, regexp.MustCompile(`(?i)k-9 mail`)},
+	{"Roundcube", mailerClient, regexp.MustCompile(`(?i)roundcube`)},
+	{"Spark", mailerClient, regexp.MustCompile(`(?i)readdle|\bspark\b`)},
+	{"Airmail", mailerClient, regexp.MustCompile(`(?i)airmail`)},
+	{"eM Client", mailerClient, regexp.MustCompile(`(?i)em client`)},
+	{"Mailchimp", mailerPlatform, regexp.MustCompile(`(?i)mailchimp|mandrill`)},
+	{"SendGrid", mailerPlatform, regexp.MustCompile(`(?i)sendgrid`)},
+	{"Mailgun", mailerPlatform, regexp.MustCompile(`(?i)mailgun`)},
+	{"Amazon SES", mailerPlatform, regexp.MustCompile(`(?i)amazon ses`)},
+	{"HubSpot", mailerPlatform, regexp.MustCompile(`(?i)hubspot`)},
+	{"Salesforce Marketing Cloud", mailerPlatform, regexp.MustCompile(`(?i)exacttarget|salesforce|marketing cloud`)},
+	{"Brevo", mailerPlatform, regexp.MustCompile(`(?i)sendinblue|brevo`)},
+	{"Campaign Monitor", mailerPlatform, regexp.MustCompile(`(?i)campaign monitor|createsend`)},
+	{"Constant Contact", mailerPlatform, regexp.MustCompile(`(?i)constant contact|roving`)},
+	{"Klaviyo", mailerPlatform, regexp.MustCompile(`(?i)klaviyo`)},
+	{"Mailjet", mailerPlatform, regexp.MustCompile(`(?i)mailjet`)},
+	{"Postmark", mailerPlatform, regexp.MustCompile(`(?i)postmark`)},
+	{"SparkPost", mailerPlatform, regexp.MustCompile(`(?i)sparkpost|momentum`)},
+	{"Marketo", mailerPlatform, regexp.MustCompile(`(?i)marketo`)},
+	{"PHPMailer", mailerPlatform, regexp.MustCompile(`(?i)phpmailer`)},
+}
+
+// Platform-specific headers for senders that do not set X-Mailer
+var platformHeaders = [][2]string{
+	{"X-MC-User", "Mailchimp"},
+	{"X-Mandrill-User", "Mailchimp"},
+	{"X-SG-EID", "SendGrid"},
+	{"X-Mailgun-Sid", "Mailgun"},
+	{"X-SES-Outgoing", "Amazon SES"},
+	{"X-PM-Message-Id", "Postmark"},
+	{"X-Mailjet-Campaign", "Mailjet"},
+	{"X-MSYS-API", "SparkPost"},
+}
+
+// Identify the sending software of a message, returning its name and kind
+func messageMailer(header message.Header) (string, string) {
+	value := header.Get("X-Mailer")
+	if value == "" {
+		value = header.Get("User-Agent")
+	}
+
+	if value != "" {
+		for _, fp := range mailerFingerprints {
+			if fp.Pattern.MatchString(value) {
+				return fp.Name, fp.Kind
+			}
+		}
+	}
+
+	for _, platform := range platformHeaders {
+		if header.Has(platform[0]) {
+			return platform[1], mailerPlatform
+		}
+	}
+
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return "", ""
+	}
+	if len(value) > maxMailerLength {
+		value = value[:maxMailerLength]
+	}
+	return value, mailerUnknown
+}
+
+// Get the kind of a recognized mailer name
+func mailerKind(name string) string {
+	for _, fp := range mailerFingerprints {
+		if fp.Name == name {
+			return fp.Kind
+		}
+	}
+	return mailerUnknown
+}
+
+// Add mailer fingerprint counts per sender
+func saveSenderMailers(tx *sql.Tx, stats map[string]*SenderStats) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO sender_mailers (email, mailer, kind, message_count) VALUES (?, ?, ?, ?)
+		ON CONFLICT(email, mailer) DO UPDATE SET
+			message_count = message_count + excluded.message_count, last_seen = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, s := range stats {
+		for mailer, count := range s.Mailers {
+			if _, err := stmt.Exec(email, mailer, mailerKind(mailer), count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Summarize senders by the kind of software they send with
+func showMailerSummary(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT kind, COUNT(DISTINCT email) FROM sender_mailers
+		GROUP BY kind ORDER BY kind`)
+	if err != nil {
+		log.Printf("Failed to query mailer summary: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var parts []string
+	for rows.Next() {
+		var kind string
+		var count int
+		rows.Scan(&kind, &count)
+		parts = append(parts, fmt.Sprintf("%s %d", kind, count))
+	}
+	if len(parts) > 0 {
+		fmt.Printf("\nSenders by sending software: %s\n", strings.Join(parts, ", "))
+	}
+}
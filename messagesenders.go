@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Senders of every scanned message by folder and UID, with the hash of its
+// Message-ID to join copies and threads, so messages can be tied to senders
+// without fetching them again
+const createMessageSendersTable = `
+	CREATE TABLE IF NOT EXISTS message_senders (
+		folder TEXT,
+		uid_validity INTEGER,
+		uid INTEGER,
+		email TEXT,
+		msgid INTEGER,
+		PRIMARY KEY (folder, uid_validity, uid, email)
+	) WITHOUT ROWID;
+	CREATE INDEX IF NOT EXISTS idx_message_senders_email ON message_senders(email);
+	CREATE INDEX IF NOT EXISTS idx_message_senders_msgid ON message_senders(msgid);`
+
+// messageSender structure for a sender of a message in a batch
+type messageSender struct {
+	UID       uint32
+	Email     string
+	MessageID string
+}
+
+// Record the senders of the messages of a batch of folder
+func saveMessageSenders(tx *sql.Tx, folder string, uidValidity uint32, senders []messageSender) error {
+	if len(senders) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO message_senders (folder, uid_validity, uid, email, msgid) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range senders {
+		// Messages without a Message-ID are stored without a hash
+		var msgid any
+		if s.MessageID != "" {
+			msgid = int64(hashMessageID(s.MessageID))
+		}
+		if _, err := stmt.Exec(folder, uidValidity, s.UID, s.Email, msgid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop the message senders of a folder recorded under an older UIDVALIDITY
+func clearStaleMessageSenders(db *sql.DB, folder string, uidValidity uint32) {
+	result, err := db.Exec("DELETE FROM message_senders WHERE folder = ? AND uid_validity != ?", folder, uidValidity)
+	if err != nil {
+		log.Printf("Failed to clear stale message senders: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Cleared %d message senders from previous UIDVALIDITY", n)
+	}
+}
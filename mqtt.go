@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Timeout for connecting to the broker and for each acknowledgement
+const mqttTimeout = 15 * time.Second
+
+// MQTTConfig structure for the "mqtt" section of the config file
+type MQTTConfig struct {
+	Broker       string `json:"broker"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	PasswordEnv  string `json:"password_env"`
+	ClientID     string `json:"client_id"`
+	Topic        string `json:"topic"`
+	QoS          int    `json:"qos"`
+	RetainStatus bool   `json:"retain_status"`
+}
+
+// MQTTMessage structure for a message to publish
+type MQTTMessage struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Check the mqtt section of the config file
+func validateMQTT(m *MQTTConfig) error {
+	if m.Broker == "" {
+		return fmt.Errorf("mqtt.broker is not set")
+	}
+	if _, _, err := mqttAddress(m.Broker); err != nil {
+		return err
+	}
+	if m.QoS != 0 && m.QoS != 1 {
+		return fmt.Errorf("mqtt.qos must be 0 or 1")
+	}
+	return nil
+}
+
+// Host:port of a broker URL and whether it uses TLS (tcp://host:1883, ssl://host:8883)
+func mqttAddress(broker string) (string, bool, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid mqtt.broker %q: %v", broker, err)
+	}
+	useTLS := false
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("invalid mqtt.broker %q: use tcp:// or ssl://", broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// Topic below the configured prefix, with {user} replaced by the scanned address
+func mqttTopic(m *MQTTConfig, user, suffix string) string {
+	prefix := firstNonEmpty(m.Topic, "peep/{user}")
+	// Wildcards and level separators are not allowed inside a level
+	user = strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(user)
+	return strings.TrimSuffix(strings.ReplaceAll(prefix, "{user}", user), "/") + "/" + suffix
+}
+
+// Connect to the broker, publish the messages and disconnect
+func publishMQTT(m *MQTTConfig, messages []MQTTMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	address, useTLS, err := mqttAddress(m.Broker)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	password := m.Password
+	if password == "" && m.PasswordEnv != "" {
+		password = os.Getenv(m.PasswordEnv)
+	}
+	logSecret(password)
+	clientID := firstNonEmpty(m.ClientID, fmt.Sprintf("peep-%d", os.Getpid()))
+
+	// CONNECT with a clean session and a 60 second keep alive
+	var flags byte = 0x02
+	payload := mqttString(clientID)
+	if m.Username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(m.Username)...)
+		if password != "" {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	connect := append(mqttString("MQTT"), 4, flags, 0, 60)
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if err := writeMQTTPacket(conn, 0x10, append(connect, payload...)); err != nil {
+		return err
+	}
+	packetType, body, err := readMQTTPacket(reader)
+	if err != nil {
+		return fmt.Errorf("no CONNACK: %v", err)
+	}
+	if packetType != 0x20 || len(body) != 2 {
+		return fmt.Errorf("unexpected reply to CONNECT (packet type %d)", packetType>>4)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("broker refused the connection: %s", mqttConnectError(body[1]))
+	}
+
+	for i, message := range messages {
+		header := byte(0x30)
+		variable := mqttString(message.Topic)
+		packetID := uint16(i%65535 + 1)
+		if m.QoS == 1 {
+			header |= 0x02
+			variable = binary.BigEndian.AppendUint16(variable, packetID)
+		}
+		if message.Retain {
+			header |= 0x01
+		}
+		conn.SetDeadline(time.Now().Add(mqttTimeout))
+		if err := writeMQTTPacket(conn, header, append(variable, message.Payload...)); err != nil {
+			return err
+		}
+		if m.QoS == 1 {
+			packetType, body, err := readMQTTPacket(reader)
+			if err != nil {
+				return fmt.Errorf("no PUBACK: %v", err)
+			}
+			if packetType != 0x40 || len(body) != 2 || binary.BigEndian.Uint16(body) != packetID {
+				return fmt.Errorf("unexpected reply to PUBLISH (packet type %d)", packetType>>4)
+			}
+		}
+	}
+
+	return writeMQTTPacket(conn, 0xE0, nil)
+}
+
+// Length-prefixed UTF-8 string of the MQTT wire format
+func mqttString(value string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(value))), value...)
+}
+
+// Write a packet with its variable-length "remaining length" header
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// Read a packet, returning its type byte and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed packet length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+// Reason of a refused CONNECT
+func mqttConnectError(code byte) string {
+	switch code {
+	case 1:
+		return "unsupported protocol version"
+	case 2:
+		return "client ID rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("code %d", code)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Display-name cleanup steps, applied in order by normalizeDisplayName
+var nameCleanupSteps = []func(string) string{
+	stripNameQuotes,
+	stripNameEmoji,
+	stripViaSuffix,
+	stripHonorifics,
+	fixAllCapsName,
+	swapLastFirstName,
+	stripAddressName,
+}
+
+var (
+	viaSuffixPattern   = regexp.MustCompile(`(?i)\s*[\(\[]?\s*\bvia\s+[^\)\]]+[\)\]]?\s*$`)
+	honorificPattern   = regexp.MustCompile(`(?i)^(mr|mrs|ms|miss|mx|dr|prof|sir|dame)\.?\s+`)
+	postNominalPattern = regexp.MustCompile(`(?i),?\s+(phd|ph\.d\.|md|m\.d\.|esq\.?)$`)
+	lastFirstPattern   = regexp.MustCompile(`^([\pL'-]+(?: [\pL'-]+){0,2}), ([\pL'-]+(?: [\pL'-]+)?)$`)
+	companySuffixes    = []string{"inc", "llc", "ltd", "gmbh", "co", "corp", "ag", "sa"}
+	nameQuoteChars     = "\"'`“”‘’«»"
+)
+
+// Clean a display name for storage
+func normalizeDisplayName(name string) string {
+	for _, step := range nameCleanupSteps {
+		name = strings.Join(strings.Fields(step(name)), " ")
+		if name == "" {
+			return ""
+		}
+	}
+	return name
+}
+
+// Remove surrounding quotes, including nested and typographic ones
+func stripNameQuotes(name string) string {
+	for {
+		trimmed := strings.TrimSpace(name)
+		runes := []rune(trimmed)
+		if len(runes) < 2 || !strings.ContainsRune(nameQuoteChars, runes[0]) || !strings.ContainsRune(nameQuoteChars, runes[len(runes)-1]) {
+			return trimmed
+		}
+		name = string(runes[1 : len(runes)-1])
+	}
+}
+
+// Remove emoji and pictographic symbols
+func stripNameEmoji(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r) && r > 0x2000:
+			return -1
+		case r == 0x200D, r == 0xFE0F, r == 0xFE0E:
+			return -1
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// Remove "via X" suffixes added by sharing services ("Jane Doe (via Google Docs)")
+func stripViaSuffix(name string) string {
+	if stripped := viaSuffixPattern.ReplaceAllString(name, ""); strings.TrimSpace(stripped) != "" {
+		return stripped
+	}
+	return name
+}
+
+// Remove leading honorifics and trailing post-nominal letters
+func stripHonorifics(name string) string {
+	stripped := honorificPattern.ReplaceAllString(name, "")
+	stripped = postNominalPattern.ReplaceAllString(stripped, "")
+	if strings.TrimSpace(stripped) == "" {
+		return name
+	}
+	return stripped
+}
+
+// Convert ALL-CAPS marketing names to title case, dropping shouted punctuation
+func fixAllCapsName(name string) string {
+	letters, upper := 0, 0
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	// Short single words are usually acronyms (IBM, NASA)
+	if letters == 0 || upper != letters || (letters <= 4 && !strings.Contains(name, " ")) {
+		return name
+	}
+
+	name = strings.TrimRight(name, "!?* ")
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// Turn directory-style names around ("Doe, Jane" -> "Jane Doe"), leaving company
+// names like "Acme, Inc" alone
+func swapLastFirstName(name string) string {
+	parts := lastFirstPattern.FindStringSubmatch(name)
+	if parts == nil || slices.Contains(companySuffixes, strings.ToLower(parts[2])) {
+		return name
+	}
+	return parts[2] + " " + parts[1]
+}
+
+// Drop names that only repeat an email address
+func stripAddressName(name string) string {
+	if strings.Contains(name, "@") && !strings.Contains(name, " ") {
+		return ""
+	}
+	return name
+}
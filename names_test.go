@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestNormalizeDisplayName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		// Quotes
+		{`"Jane Doe"`, "Jane Doe"},
+		{`'"Jane Doe"'`, "Jane Doe"},
+		{"“Jane Doe”", "Jane Doe"},
+		{"«Jane Doe»", "Jane Doe"},
+		{`O'Brien`, "O'Brien"},
+
+		// Emoji
+		{"Jane Doe 🚀", "Jane Doe"},
+		{"🎉 Party Shop 🎉", "Party Shop"},
+		{"Team 👩‍💻 Support", "Team Support"},
+		{"Swiss Shop 🇨🇭", "Swiss Shop"},
+		{"🔥", ""},
+
+		// "X via Y"
+		{"Jane Doe (via Google Docs)", "Jane Doe"},
+		{"Jane Doe via LinkedIn", "Jane Doe"},
+		{"Jane Doe [via Slack]", "Jane Doe"},
+		{"via Google Docs", "via Google Docs"},
+
+		// Honorifics and post-nominals
+		{"Dr. Jane Doe", "Jane Doe"},
+		{"mrs Jane Doe", "Jane Doe"},
+		{"Prof Jane Doe, PhD", "Jane Doe"},
+		{"John Smith, Esq.", "John Smith"},
+		{"Dr.", "Dr."},
+
+		// ALL-CAPS
+		{"ACME DEALS!!!", "Acme Deals"},
+		{"JANE DOE", "Jane Doe"},
+		{"IBM", "IBM"},
+		{"NASA", "NASA"},
+		{"ÉLODIE MARTIN", "Élodie Martin"},
+
+		// "Last, First"
+		{"Doe, Jane", "Jane Doe"},
+		{"DOE, JANE", "Jane Doe"},
+		{"van der Berg, Anna", "Anna van der Berg"},
+		{"Doe, Mary Jane", "Mary Jane Doe"},
+		{"Acme, Inc", "Acme, Inc"},
+		{"Sales, Marketing, Support", "Sales, Marketing, Support"},
+
+		// Addresses and whitespace
+		{"jane@example.com", ""},
+		{`"jane@example.com"`, ""},
+		{"  Jane   Doe  ", "Jane Doe"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := normalizeDisplayName(test.name); got != test.want {
+			t.Errorf("normalizeDisplayName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// SenderNote structure for a note attached to a sender
+type SenderNote struct {
+	ID        int64  `json:"id"`
+	Email     string `json:"email"`
+	Note      string `json:"note"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Run the note command (add/remove/list)
+func runNote(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: note requires an action: add, remove or list")
+		os.Exit(exitUsage)
+	}
+	action, args := args[0], args[1:]
+
+	config := &Config{}
+	fs := accountFlags("note", config)
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	switch action {
+	case "add":
+		if fs.NArg() < 2 {
+			fmt.Println("❌ Error: usage: note add <email> <text>")
+			os.Exit(exitUsage)
+		}
+		email := strings.ToLower(strings.TrimSpace(fs.Arg(0)))
+		text := strings.TrimSpace(strings.Join(fs.Args()[1:], " "))
+		if text == "" {
+			fmt.Println("❌ Error: the note is empty")
+			os.Exit(exitUsage)
+		}
+		if !emailExists(db, email) {
+			fmt.Printf("⚠️  %s is not a known sender yet; the note is kept for when it is\n", email)
+		}
+		id, err := addNote(db, email, text)
+		if err != nil {
+			log.Printf("Failed to add note for %s: %v", email, err)
+			fmt.Printf("❌ Failed to add note: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		log.Printf("Note %d added for %s", id, email)
+		fmt.Printf("Added note %d for %s\n", id, email)
+	case "remove":
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fmt.Printf("❌ Error: invalid note id %q (see note list)\n", arg)
+				os.Exit(exitUsage)
+			}
+			result, err := db.Exec("DELETE FROM sender_notes WHERE id = ?", id)
+			if err != nil {
+				log.Printf("Failed to remove note %d: %v", id, err)
+				fmt.Printf("❌ Failed to remove note %d: %v\n", id, err)
+				os.Exit(exitDatabase)
+			}
+			if count, _ := result.RowsAffected(); count == 0 {
+				fmt.Printf("⚠️  No note %d\n", id)
+				continue
+			}
+			log.Printf("Note %d removed", id)
+			fmt.Printf("Removed note %d\n", id)
+		}
+	case "list":
+		email := ""
+		if fs.NArg() > 0 {
+			email = strings.ToLower(strings.TrimSpace(fs.Arg(0)))
+		}
+		notes, err := loadNotes(db, email)
+		if err != nil {
+			fmt.Printf("❌ Failed to load notes: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tADDED\tNOTE")
+		for _, note := range notes {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", note.ID, note.Email, lastSeenDate(note.CreatedAt), note.Note)
+		}
+		w.Flush()
+		fmt.Printf("Total notes: %d\n", len(notes))
+	default:
+		fmt.Printf("❌ Error: unknown note action %q\n", action)
+		os.Exit(exitUsage)
+	}
+}
+
+// Save a note for a sender, returning its id
+func addNote(db *sql.DB, email, text string) (int64, error) {
+	result, err := db.Exec("INSERT INTO sender_notes (email, note) VALUES (?, ?)", email, text)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Load the notes of one sender, or of all senders when email is empty, newest first
+func loadNotes(db *sql.DB, email string) ([]SenderNote, error) {
+	query := "SELECT id, email, note, COALESCE(created_at, '') FROM sender_notes"
+	var args []any
+	if email != "" {
+		query += " WHERE email = ?"
+		args = append(args, email)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []SenderNote
+	for rows.Next() {
+		var note SenderNote
+		if err := rows.Scan(&note.ID, &note.Email, &note.Note, &note.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// Latest note of every sender with notes
+func latestNotes(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT email, note FROM sender_notes ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := make(map[string]string)
+	for rows.Next() {
+		var email, note string
+		if err := rows.Scan(&email, &note); err != nil {
+			return nil, err
+		}
+		// Later rows are newer and replace earlier ones
+		notes[email] = note
+	}
+	return notes, rows.Err()
+}
+
+// First line of a note, shortened for tables
+func shortNote(note string) string {
+	note, _, _ = strings.Cut(note, "\n")
+	if runes := []rune(note); len(runes) > 40 {
+		return string(runes[:39]) + "…"
+	}
+	return note
+}
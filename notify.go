@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+// PowerShell script showing a toast; title and message come from the environment so they need no quoting
+const windowsToastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:PEEP_NOTIFY_TITLE)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode($env:PEEP_NOTIFY_MESSAGE)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('Peep').Show($toast)
+`
+
+// Show a desktop notification with the tool of the operating system
+func desktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("notify-send", "--app-name=Peep", title, message)
+	case "darwin":
+		// Arguments are passed to the script instead of being pasted into it
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, message)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "PEEP_NOTIFY_TITLE="+title, "PEEP_NOTIFY_MESSAGE="+message)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v %s", cmd.Path, err, output)
+	}
+	return nil
+}
+
+// Notify about the end of a run if -notify is set
+func notifyResult(config *Config, status, message string) {
+	if !config.Notify {
+		return
+	}
+	title := fmt.Sprintf("Peep %s: %s", config.Command, status)
+	if config.Username != "" {
+		title += " (" + config.Username + ")"
+	}
+	if err := desktopNotify(title, message); err != nil {
+		log.Printf("Desktop notification failed: %v", err)
+	}
+}
+
+// Context cancelled when the run is interrupted with Ctrl-C or SIGTERM, so it stops
+// at the next message and can report where; a second signal ends it at once
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// Mark the status and notify of an interrupted run, returning its exit code
+func reportInterrupted(config *Config) int {
+	message := "Interrupted, the next run resumes from the saved progress"
+	log.Printf("Run interrupted")
+	fmt.Printf("⚠️  %s\n", message)
+	writeStatus(config.StatusPath, "ERROR", message)
+	notifyResult(config, "aborted", message)
+	return exitFailure
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Accounts can log in with OAuth (XOAUTH2) instead of a password: peep oauth login
+// stores the refresh token of the account, encrypted with a key of the data
+// directory, and every IMAP login takes an access token from it, refreshing it
+// when it is about to expire. Long scans and daemons reconnect with fresh tokens;
+// a revoked or expired refresh token fails the login with a prompt to log in again
+const (
+	// Magic of encrypted token files
+	oauthTokenMagic = "PEEPTOK1"
+	// Access tokens expiring sooner are refreshed before a login
+	oauthRefreshMargin = 5 * time.Minute
+	// Time to complete the authorization in the browser
+	oauthLoginTimeout = 5 * time.Minute
+)
+
+// OAuthProvider structure for the endpoints and IMAP scope of an OAuth provider
+type OAuthProvider struct {
+	AuthURL  string
+	TokenURL string
+	Scope    string
+}
+
+// Providers selectable with -provider
+var oauthProviders = map[string]OAuthProvider{
+	"google": {
+		AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL: "https://oauth2.googleapis.com/token",
+		Scope:    "https://mail.google.com/",
+	},
+	"microsoft": {
+		AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		Scope:    "https://outlook.office.com/IMAP.AccessAsUser.All offline_access",
+	},
+}
+
+// Provider of well-known IMAP servers, when -provider is not given
+var oauthServerProviders = map[string]string{
+	"imap.gmail.com":        "google",
+	"outlook.office365.com": "microsoft",
+	"imap-mail.outlook.com": "microsoft",
+}
+
+// OAuthToken structure for the stored authorization of one account
+type OAuthToken struct {
+	Provider     string    `json:"provider"`
+	TokenURL     string    `json:"token_url"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	RefreshToken string    `json:"refresh_token"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Response of a token endpoint
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// the token, so a file copied to another account doesn't open
+func saveOAuthToken(path, user string, key []byte, token *OAuthToken) error {
+	aead, err := tokenStoreAEAD(key)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	data := append(append([]byte(oauthTokenMagic), nonce...), aead.Seal(nil, nonce, plain, []byte(strings.ToLower(user)))...)
+
+	// Written aside and renamed, so a crash never leaves half a token
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Read and decrypt the token of an account
+func loadOAuthToken(path, user string, key []byte) (*OAuthToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := tokenStoreAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	head := len(oauthTokenMagic) + aead.NonceSize()
+	if len(data) < head || string(data[:len(oauthTokenMagic)]) != oauthTokenMagic {
+		return nil, fmt.Errorf("%s is not a token file", path)
+	}
+	plain, err := aead.Open(nil, data[len(oauthTokenMagic):head], data[head:], []byte(strings.ToLower(user)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: wrong token key or another account's file", path)
+	}
+	var token OAuthToken
+	if err := json.Unmarshal(plain, &token); err != nil {
+		return nil, err
+	}
+	logSecret(token.RefreshToken)
+	logSecret(token.AccessToken)
+	logSecret(token.ClientSecret)
+	return &token, nil
+}
+
+// Whether the account logs in with a stored OAuth token
+func hasOAuthToken(config *Config) bool {
+	if config.TokenPath == "" {
+		return false
+	}
+	_, err := os.Stat(config.TokenPath)
+	return err == nil
+}
+
+// oauthSource structure for the token of one account, shared by all its
+// connections so one refresh serves them all. It is reread when the file changes,
+// so a daemon picks up a new login without a restart
+type oauthSource struct {
+	path string
+	user string
+
+	mu      sync.Mutex
+	token   *OAuthToken
+	modTime time.Time
+}
+
+// Token sources by token file, for the lifetime of the process
+var oauthSources struct {
+	mu      sync.Mutex
+	sources map[string]*oauthSource
+}
+
+// Token source of an account
+func oauthSourceFor(config *Config) *oauthSource {
+	oauthSources.mu.Lock()
+	defer oauthSources.mu.Unlock()
+	if oauthSources.sources == nil {
+		oauthSources.sources = make(map[string]*oauthSource)
+	}
+	source, ok := oauthSources.sources[config.TokenPath]
+	if !ok {
+		source = &oauthSource{path: config.TokenPath, user: config.Username}
+		oauthSources.sources[config.TokenPath] = source
+	}
+	return source
+}
+
+// Access token for a login, refreshed when it expires within oauthRefreshMargin
+func (s *oauthSource) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", withExitCode(exitAuth, fmt.Errorf("no OAuth token for %s, log in with: peep oauth login -user %s", s.user, s.user))
+	}
+	key, err := tokenStoreKey(false)
+	if err != nil {
+		return "", withExitCode(exitAuth, err)
+	}
+	if s.token == nil || !info.ModTime().Equal(s.modTime) {
+		if s.token, err = loadOAuthToken(s.path, s.user, key); err != nil {
+			return "", withExitCode(exitAuth, err)
+		}
+		s.modTime = info.ModTime()
+	}
+	if s.token.AccessToken != "" && time.Until(s.token.Expiry) > oauthRefreshMargin {
+		return s.token.AccessToken, nil
+	}
+
+	log.Printf("Refreshing the OAuth access token of %s", s.user)
+	response, err := requestOAuthToken(ctx, s.token.TokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.token.RefreshToken},
+		"client_id":     {s.token.ClientID},
+		"client_secret": {s.token.ClientSecret},
+	})
+	if err != nil {
+		if response.Error == "invalid_grant" {
+			log.Printf("OAuth refresh token of %s rejected: %v", s.user, err)
+			return "", withExitCode(exitAuth, fmt.Errorf("the OAuth authorization of %s was revoked or has expired, log in again with: peep oauth login -user %s", s.user, s.user))
+		}
+		return "", err
+	}
+	s.token.AccessToken = response.AccessToken
+	s.token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	// Providers may rotate the refresh token; the old one stops working
+	if response.RefreshToken != "" {
+		s.token.RefreshToken = logSecret(response.RefreshToken)
+	}
+	if err := saveOAuthToken(s.path, s.user, key, s.token); err != nil {
+		log.Printf("Failed to store the refreshed OAuth token of %s: %v", s.user, err)
+	} else if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return s.token.AccessToken, nil
+}
+
+// Post a request to a token endpoint. Errors of the endpoint are returned with the
+// response, so callers can tell a rejected grant from a failed request
+func requestOAuthToken(ctx context.Context, tokenURL string, form url.Values) (oauthTokenResponse, error) {
+	var response oauthTokenResponse
+	for key, values := range form {
+		if len(values) == 1 && values[0] == "" {
+			form.Del(key)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return response, withExitCode(exitConnection, fmt.Errorf("OAuth token request failed: %v", err))
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return response, fmt.Errorf("invalid OAuth token response (%s): %v", resp.Status, err)
+	}
+	if response.Error != "" || resp.StatusCode != http.StatusOK || response.AccessToken == "" {
+		return response, fmt.Errorf("OAuth token request rejected (%s): %s %s", resp.Status, response.Error, response.ErrorDescription)
+	}
+	logSecret(response.AccessToken)
+	return response, nil
+}
+
+// xoauth2Client structure for the XOAUTH2 SASL mechanism of Gmail and Outlook
+type xoauth2Client struct {
+	user  string
+	token string
+}
+
+// Send the user and access token as initial response
+func (a xoauth2Client) Start() (string, []byte, error) {
+	return "XOAUTH2", []byte("user=" + a.user + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// A challenge carries the error of a rejected token; the empty answer ends the
+// exchange so the server reports the failure
+func (a xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	log.Printf("XOAUTH2 login rejected: %s", challenge)
+	return []byte{}, nil
+}
+
+// Run the oauth command
+func runOAuth(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: oauth requires an action: login, status, logout")
+		os.Exit(exitUsage)
+	}
+	action, args := args[0], args[1:]
+
+	config := &Config{}
+	var providerName, clientID, clientSecretEnv string
+	var override OAuthProvider
+	fs := accountFlags("oauth", config)
+	fs.StringVar(&providerName, "provider", "", "OAuth provider: google, microsoft (default: from -server)")
+	fs.StringVar(&clientID, "client-id", os.Getenv("PEEP_OAUTH_CLIENT_ID"), "OAuth client ID (or $PEEP_OAUTH_CLIENT_ID)")
+	fs.StringVar(&clientSecretEnv, "client-secret-env", "PEEP_OAUTH_CLIENT_SECRET", "Environment variable holding the client secret")
+	fs.StringVar(&override.AuthURL, "auth-url", "", "Authorization endpoint of another provider")
+	fs.StringVar(&override.TokenURL, "token-url", "", "Token endpoint of another provider")
+	fs.StringVar(&override.Scope, "scope", "", "Scope granting IMAP access")
+	parseLocalFlags(fs, config, args)
+	if config.Username == "" {
+		fmt.Println("❌ Error: oauth requires -user")
+		os.Exit(exitUsage)
+	}
+
+	switch action {
+	case "login":
+		setupLogging(config)
+		provider, name, err := oauthProvider(providerName, config.IMAPServer, override)
+		if err != nil {
+			fmt.Printf("❌ Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		if clientID == "" {
+			fmt.Println("❌ Error: set -client-id or $PEEP_OAUTH_CLIENT_ID to the client ID of your OAuth app")
+			os.Exit(exitUsage)
+		}
+		token := &OAuthToken{Provider: name, TokenURL: provider.TokenURL, ClientID: clientID, ClientSecret: logSecret(os.Getenv(clientSecretEnv))}
+		if err := oauthLogin(config, provider, token); err != nil {
+			log.Printf("OAuth login of %s failed: %v", config.Username, err)
+			fmt.Printf("❌ OAuth login failed: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+	case "status":
+		if !hasOAuthToken(config) {
+			fmt.Printf("%s has no OAuth token, log in with: peep oauth login -user %s\n", config.Username, config.Username)
+			os.Exit(exitAuth)
+		}
+		key, err := tokenStoreKey(false)
+		var token *OAuthToken
+		if err == nil {
+			token, err = loadOAuthToken(config.TokenPath, config.Username, key)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(exitAuth)
+		}
+		fmt.Printf("Account:   %s\n", config.Username)
+		fmt.Printf("Provider:  %s\n", token.Provider)
+		fmt.Printf("Client ID: %s\n", token.ClientID)
+		fmt.Printf("Stored in: %s\n", config.TokenPath)
+		if token.AccessToken != "" && time.Now().Before(token.Expiry) {
+			fmt.Printf("Access token valid until %s, refreshed automatically\n", token.Expiry.Local().Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Println("Access token expired, refreshed at the next login")
+		}
+	case "logout":
+		if err := os.Remove(config.TokenPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("%s has no OAuth token\n", config.Username)
+				return
+			}
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ OAuth token of %s removed. Revoke Peep's access in the account settings of the provider to invalidate it there too\n", config.Username)
+	default:
+		fmt.Printf("❌ Error: unknown oauth action %q\n", action)
+		os.Exit(exitUsage)
+	}
+}
+
+// Endpoints of -provider, of the IMAP server, or given with -auth-url and -token-url
+func oauthProvider(name, server string, override OAuthProvider) (OAuthProvider, string, error) {
+	if name == "" {
+		name = oauthServerProviders[providerKey(server)]
+	}
+	provider, ok := oauthProviders[name]
+	if name != "" && !ok {
+		return provider, "", fmt.Errorf("unknown provider %q (use google or microsoft, or -auth-url and -token-url)", name)
+	}
+	if override.AuthURL != "" {
+		provider.AuthURL = override.AuthURL
+	}
+	if override.TokenURL != "" {
+		provider.TokenURL = override.TokenURL
+	}
+	if override.Scope != "" {
+		provider.Scope = override.Scope
+	}
+	if provider.AuthURL == "" || provider.TokenURL == "" {
+		return provider, "", fmt.Errorf("no OAuth provider known for %s (set -provider, or -auth-url and -token-url)", server)
+	}
+	return provider, firstNonEmpty(name, "custom"), nil
+}
+
+// Authorize Peep in the browser (authorization code with PKCE, redirected to a
+// loopback port), store the token and check that it logs in
+func oauthLogin(config *Config, provider OAuthProvider, token *OAuthToken) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	redirect := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	random := func() string {
+		raw := make([]byte, 32)
+		rand.Read(raw)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	verifier, state := random(), random()
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL := provider.AuthURL + "?" + url.Values{
+		"client_id":             {token.ClientID},
+		"redirect_uri":          {redirect},
+		"response_type":         {"code"},
+		"scope":                 {provider.Scope},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"login_hint":            {config.Username},
+		// Google only issues a refresh token for offline access, on consent
+		"access_type": {"offline"},
+		"prompt":      {"consent"},
+	}.Encode()
+
+	fmt.Printf("🔑 Open this address in a browser and allow access to %s:\n\n%s\n\n", config.Username, authURL)
+	fmt.Printf("Waiting for the authorization (%v)...\n", oauthLoginTimeout)
+
+	// Only the first callback answers; a reload or a second tab must not block
+	codes := make(chan string, 1)
+	var answered sync.Once
+	answer := func(code string) { answered.Do(func() { codes <- code }) }
+	server := &http.Server{ReadHeaderTimeout: 10 * time.Second, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path != "/callback":
+			http.NotFound(w, r)
+			return
+		case query.Get("state") != state:
+			http.Error(w, "Unexpected authorization response, start peep oauth login again.", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			fmt.Fprintf(w, "Authorization failed: %s. You can close this window.\n", query.Get("error"))
+			answer("")
+			return
+		}
+		fmt.Fprintln(w, "Peep is authorized. You can close this window.")
+		answer(query.Get("code"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var code string
+	select {
+	case code = <-codes:
+	case <-time.After(oauthLoginTimeout):
+		return withExitCode(exitAuth, fmt.Errorf("no authorization within %v", oauthLoginTimeout))
+	}
+	if code == "" {
+		return withExitCode(exitAuth, fmt.Errorf("access was not granted"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	response, err := requestOAuthToken(ctx, token.TokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect},
+		"client_id":     {token.ClientID},
+		"client_secret": {token.ClientSecret},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return withExitCode(exitAuth, err)
+	}
+	if response.RefreshToken == "" {
+		return withExitCode(exitAuth, fmt.Errorf("the provider issued no refresh token (check the scope allows offline access)"))
+	}
+	token.RefreshToken = logSecret(response.RefreshToken)
+	token.AccessToken = response.AccessToken
+	token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+
+	key, err := tokenStoreKey(true)
+	if err != nil {
+		return err
+	}
+	if err := saveOAuthToken(config.TokenPath, config.Username, key, token); err != nil {
+		return fmt.Errorf("failed to store token: %v", err)
+	}
+	log.Printf("OAuth token of %s stored in %s", config.Username, config.TokenPath)
+
+	config.Password = ""
+	c, err := dialIMAP(ctx, config)
+	if err != nil {
+		fmt.Printf("⚠️  Token stored in %s, but the IMAP login failed: %v\n", config.TokenPath, err)
+		return err
+	}
+	c.Logout()
+	fmt.Printf("✅ Logged in to %s as %s. Scans use the token stored in %s; -pass is no longer needed\n", config.IMAPServer, config.Username, config.TokenPath)
+	return nil
+}
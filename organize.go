@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// OrganizeOptions structure for the organize command
+type OrganizeOptions struct {
+	By          string
+	Prefix      string
+	Mailbox     string
+	MinMessages int
+	DryRun      bool
+}
+
+// Sender addresses searched for at a time, combined with OR
+const organizeSearchSize = 32
+
+// organizeGroup structure for the messages filed into one folder: the senders'
+// addresses, or @domain for a whole domain
+type organizeGroup struct {
+	Name    string
+	Senders []string
+}
+
+// Run the inbox organizer
+func runOrganize(args []string) {
+	config := &Config{}
+	opts := &OrganizeOptions{}
+
+	fs := accountFlags("organize", config)
+	fs.StringVar(&opts.By, "by", "domain", "Group messages by (domain, tag)")
+	fs.StringVar(&opts.Prefix, "prefix", "Peep", "Parent folder for created folders")
+	fs.StringVar(&opts.Mailbox, "mailbox", "INBOX", "Mailbox to organize")
+	fs.IntVar(&opts.MinMessages, "min", 5, "Minimum messages before a folder is created")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would be moved without changing anything")
+	parseFlags(fs, config, args)
+
+	setupLogging(config)
+
+	if opts.By != "domain" && opts.By != "tag" {
+		fmt.Printf("❌ Error: unsupported grouping %q\n", opts.By)
+		os.Exit(1)
+	}
+
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	writeStatus(config.StatusPath, "RUNNING", "Organizing mailbox")
+
+	config.Pool = newIMAPPool(config)
+	defer config.Pool.close()
+	if err := organizeMailbox(config, db, opts); err != nil {
+		errorMsg := fmt.Sprintf("Organize error: %v", err)
+		log.Printf("Organize error: %v", err)
+		fmt.Printf("❌ %s\n", errorMsg)
+		writeStatus(config.StatusPath, "ERROR", errorMsg)
+		os.Exit(exitCode(err))
+	}
+
+	writeStatus(config.StatusPath, "SUCCESS", "Mailbox organized")
+}
+
+// Extract domain part of an email address
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// Load distinct sender domains from the database
+func loadSenderDomains(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT email FROM senders")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var domains []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		domain := emailDomain(email)
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	sort.Strings(domains)
+	return domains, rows.Err()
+}
+
+// Load the groups to file messages into: one per sender domain, or one per tag with
+// the senders carrying it
+func loadOrganizeGroups(db *sql.DB, by string) ([]organizeGroup, error) {
+	if by == "domain" {
+		domains, err := loadSenderDomains(db)
+		if err != nil {
+			return nil, err
+		}
+		groups := make([]organizeGroup, len(domains))
+		for i, domain := range domains {
+			groups[i] = organizeGroup{Name: domain, Senders: []string{"@" + domain}}
+		}
+		return groups, nil
+	}
+
+	rows, err := db.Query("SELECT tag, email FROM sender_tags ORDER BY tag, email")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []organizeGroup
+	for rows.Next() {
+		var tag, email string
+		if err := rows.Scan(&tag, &email); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != tag {
+			groups = append(groups, organizeGroup{Name: tag})
+		}
+		last := &groups[len(groups)-1]
+		last.Senders = append(last.Senders, strings.ToLower(email))
+	}
+	return groups, rows.Err()
+}
+
+// Search criteria matching a From header containing any of the senders
+func fromCriteria(senders []string) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+	if len(senders) == 1 {
+		criteria.Header.Add("From", senders[0])
+		return criteria
+	}
+	half := len(senders) / 2
+	criteria.Or = [][2]*imap.SearchCriteria{{fromCriteria(senders[:half]), fromCriteria(senders[half:])}}
+	return criteria
+}
+
+// UIDs of the messages of a group in the selected mailbox. The server search matches
+// substrings ("@acme.co" also finds "@acme.com"), so the From header of every hit is
+// checked against the senders
+func searchGroup(c *client.Client, group organizeGroup) ([]uint32, error) {
+	var hits []uint32
+	for start := 0; start < len(group.Senders); start += organizeSearchSize {
+		uids, err := c.UidSearch(fromCriteria(group.Senders[start:min(start+organizeSearchSize, len(group.Senders))]))
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, uids...)
+	}
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(hits...)
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: []string{"From"}}, Peek: true}
+	messages := make(chan *imap.Message, 50)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var uids []uint32
+	for msg := range messages {
+		r := msg.GetBody(section)
+		if r == nil {
+			continue
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		header, err := mail.ReadMessage(bytes.NewReader(append(raw, "\r\n"...)))
+		if err != nil {
+			continue
+		}
+		from := header.Header.Get("From")
+		for _, sender := range group.Senders {
+			if fromMatches(from, sender) {
+				uids = append(uids, msg.Uid)
+				break
+			}
+		}
+	}
+	return uids, <-done
+}
+
+// List existing folders and detect the hierarchy delimiter
+func listFolders(c *client.Client) (map[string]bool, string, error) {
+	mailboxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	folders := make(map[string]bool)
+	delimiter := "/"
+	for m := range mailboxes {
+		folders[m.Name] = true
+		if m.Delimiter != "" {
+			delimiter = m.Delimiter
+		}
+	}
+
+	return folders, delimiter, <-done
+}
+
+// Build a folder name for a group, escaping the delimiter
+func groupFolderName(prefix, delimiter, group string) string {
+	group = strings.ReplaceAll(group, delimiter, "_")
+	if prefix == "" {
+		return group
+	}
+	return prefix + delimiter + group
+}
+
+// Move messages into per-domain or per-tag folders. A message of a sender with
+// several tags is moved to the folder of the first tag
+func organizeMailbox(config *Config, db *sql.DB, opts *OrganizeOptions) error {
+	groups, err := loadOrganizeGroups(db, opts.By)
+	if err != nil {
+		return withExitCode(exitDatabase, fmt.Errorf("failed to load sender %ss: %v", opts.By, err))
+	}
+	if len(groups) == 0 {
+		if opts.By == "tag" {
+			fmt.Println("No tagged senders in database. Tag senders or add rules first.")
+		} else {
+			fmt.Println("No senders in database. Run a scan first.")
+		}
+		return nil
+	}
+
+	log.Printf("Organizing %s by %s: %d candidate %ss", opts.Mailbox, opts.By, len(groups), opts.By)
+
+	c, err := config.Pool.get(context.Background())
+	if err != nil {
+		return err
+	}
+	defer config.Pool.put(c)
+
+	folders, delimiter, err := listFolders(c)
+	if err != nil {
+		return withExitCode(exitMailbox, fmt.Errorf("failed to list folders: %v", err))
+	}
+
+	if _, err := c.Select(opts.Mailbox, opts.DryRun); err != nil {
+		return withExitCode(exitMailbox, fmt.Errorf("failed to select %s: %v", opts.Mailbox, err))
+	}
+
+	if opts.Prefix != "" && !folders[opts.Prefix] && !opts.DryRun {
+		if err := c.Create(opts.Prefix); err != nil {
+			return fmt.Errorf("failed to create folder %s: %v", opts.Prefix, err)
+		}
+		folders[opts.Prefix] = true
+	}
+
+	movedTotal := 0
+	for _, group := range groups {
+		uids, err := searchGroup(c, group)
+		if err != nil {
+			log.Printf("Search failed (%s): %v", group.Name, err)
+			continue
+		}
+		if len(uids) < opts.MinMessages || len(uids) == 0 {
+			continue
+		}
+
+		folder := groupFolderName(opts.Prefix, delimiter, group.Name)
+		if opts.DryRun {
+			fmt.Printf("Would move %d messages to %s\n", len(uids), folder)
+			continue
+		}
+
+		if !folders[folder] {
+			if err := c.Create(folder); err != nil {
+				log.Printf("Failed to create folder %s: %v", folder, err)
+				continue
+			}
+			folders[folder] = true
+			log.Printf("Folder created: %s", folder)
+		}
+
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uids...)
+		err = c.UidMove(seqset, folder)
+		recordAudit(config, auditMove, folder, map[string]any{"mailbox": opts.Mailbox, opts.By: group.Name, "messages": len(uids)}, err)
+		if err != nil {
+			log.Printf("Failed to move messages to %s: %v", folder, err)
+			continue
+		}
+
+		movedTotal += len(uids)
+		log.Printf("Moved %d messages to %s", len(uids), folder)
+		fmt.Printf("Moved %d messages to %s\n", len(uids), folder)
+	}
+
+	log.Printf("Organize completed: %d messages moved", movedTotal)
+	fmt.Printf("✅ Organize completed: %d messages moved\n", movedTotal)
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Per-user folders of older versions, relative to the working directory
+const legacyDataRoot = "./users"
+
+// UserPaths structure for the files of one user
+type UserPaths struct {
+	DBPath         string
+	LogPath        string
+	StatusPath     string
+	HeaderCacheDir string
+	TokenPath      string
+}
+
+// PathLayout decides where the files of one user are stored below the data and state roots
+type PathLayout interface {
+	Paths(dataRoot, stateRoot, username string) UserPaths
+}
+
+// One folder per user below each root (default)
+type userDirLayout struct{}
+
+// Paths of a user in their own folders
+func (userDirLayout) Paths(dataRoot, stateRoot, username string) UserPaths {
+	dataDir := filepath.Join(dataRoot, safeUsername(username))
+	stateDir := filepath.Join(stateRoot, safeUsername(username))
+	return UserPaths{
+		DBPath:         filepath.Join(dataDir, "database.db"),
+		LogPath:        filepath.Join(stateDir, fmt.Sprintf("log_%s.txt", time.Now().Format("2006-01-02"))),
+		StatusPath:     filepath.Join(stateDir, "status.txt"),
+		HeaderCacheDir: filepath.Join(dataDir, "headers"),
+		TokenPath:      filepath.Join(dataDir, "oauth_token.enc"),
+	}
+}
+
+// All users' files side by side in the roots, prefixed with the user name
+type flatLayout struct{}
+
+// Paths of a user as prefixed files
+func (flatLayout) Paths(dataRoot, stateRoot, username string) UserPaths {
+	safe := safeUsername(username)
+	return UserPaths{
+		DBPath:         filepath.Join(dataRoot, safe+".db"),
+		LogPath:        filepath.Join(stateRoot, fmt.Sprintf("%s_log_%s.txt", safe, time.Now().Format("2006-01-02"))),
+		StatusPath:     filepath.Join(stateRoot, safe+"_status.txt"),
+		HeaderCacheDir: filepath.Join(dataRoot, safe+"_headers"),
+		TokenPath:      filepath.Join(dataRoot, safe+"_oauth_token.enc"),
+	}
+}
+
+// Layouts selectable with -layout
+var pathLayouts = map[string]PathLayout{
+	"user": userDirLayout{},
+	"flat": flatLayout{},
+}
+
+// Look up a layout by name, defaulting to per-user folders
+func pathLayout(name string) (PathLayout, error) {
+	if name == "" {
+		name = "user"
+	}
+	layout, ok := pathLayouts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %q (use user or flat)", name)
+	}
+	return layout, nil
+}
+
+// Root of databases and header caches: -data-dir, $PEEP_DATA_DIR, $XDG_DATA_HOME/peep or ./users
+func dataRoot(dataDir string) string {
+	if dir := explicitDataDir(dataDir); dir != "" {
+		return dir
+	}
+	if dir := xdgDir("XDG_DATA_HOME", ".local/share"); dir != "" {
+		return filepath.Join(dir, "peep")
+	}
+	return legacyDataRoot
+}
+
+// Root of logs and status files: -data-dir, $PEEP_DATA_DIR, $XDG_STATE_HOME/peep or ./users
+func stateRoot(dataDir string) string {
+	if dir := explicitDataDir(dataDir); dir != "" {
+		return dir
+	}
+	if dir := xdgDir("XDG_STATE_HOME", ".local/state"); dir != "" {
+		return filepath.Join(dir, "peep")
+	}
+	return legacyDataRoot
+}
+
+// Data directory chosen by the user rather than derived
+func explicitDataDir(dataDir string) string {
+	if dataDir != "" {
+		return dataDir
+	}
+	return os.Getenv("PEEP_DATA_DIR")
+}
+
+// Resolve an XDG base directory, falling back to its default below the home directory
+func xdgDir(env, defaultPath string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		// %LocalAppData%
+		dir, _ := os.UserCacheDir()
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, defaultPath)
+}
+
+// Folder name of a user ("john.doe@gmail.com" -> "john_doe_at_gmail_com")
+func safeUsername(username string) string {
+	safe := strings.ReplaceAll(username, "@", "_at_")
+	safe = strings.ReplaceAll(safe, ".", "_")
+	return strings.ReplaceAll(safe, "+", "_plus_")
+}
+
+// Paths of a user's files, moving a legacy ./users folder on first use of the default layout
+func userPaths(config *Config) (UserPaths, error) {
+	layout, err := pathLayout(config.Layout)
+	if err != nil {
+		return UserPaths{}, err
+	}
+	data, state := dataRoot(config.DataDir), stateRoot(config.DataDir)
+
+	legacyDir := filepath.Join(legacyDataRoot, safeUsername(config.Username))
+	dataDir := filepath.Join(data, safeUsername(config.Username))
+	stateDir := filepath.Join(state, safeUsername(config.Username))
+	if _, isUserDir := layout.(userDirLayout); isUserDir && config.DBPath == "" && explicitDataDir(config.DataDir) == "" &&
+		filepath.Clean(dataDir) != filepath.Clean(legacyDir) {
+		if info, err := os.Stat(legacyDir); err == nil && info.IsDir() {
+			if err := migrateLegacyUserDir(legacyDir, dataDir, stateDir); err != nil {
+				fmt.Printf("⚠️  Keeping data of %s in %s: %v\n", config.Username, legacyDir, err)
+				data, state = legacyDataRoot, legacyDataRoot
+			} else {
+				fmt.Printf("📦 Moved data of %s from %s to %s (logs and status: %s)\n", config.Username, legacyDir, dataDir, stateDir)
+			}
+		}
+	}
+
+	return layout.Paths(data, state, config.Username), nil
+}
+
+// Move a legacy user folder to the data directory, then its logs and status file to the state directory
+func migrateLegacyUserDir(legacyDir, dataDir, stateDir string) error {
+	if _, err := os.Stat(filepath.Join(dataDir, "database.db")); err == nil {
+		return fmt.Errorf("%s already has a database", dataDir)
+	}
+
+	// An empty directory left by an earlier run is replaced; the move itself is a single rename
+	os.Remove(dataDir)
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(legacyDir, dataDir); err != nil {
+		return fmt.Errorf("move failed: %v", err)
+	}
+	os.Remove(legacyDataRoot)
+
+	if filepath.Clean(stateDir) == filepath.Clean(dataDir) {
+		return nil
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil
+	}
+	stateFiles, _ := filepath.Glob(filepath.Join(dataDir, "log_*.txt"))
+	for _, path := range append(stateFiles, filepath.Join(dataDir, "status.txt")) {
+		if _, err := os.Stat(path); err == nil {
+			// Logs left behind on failure are still readable in the data directory
+			os.Rename(path, filepath.Join(stateDir, filepath.Base(path)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Page layout of generated PDFs: A4 in points, monospaced text
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+	pdfFontSize   = 9
+	pdfLeading    = 12
+	pdfTitleSize  = 14
+	// Courier glyphs are 0.6 em wide
+	pdfLineChars = (pdfPageWidth - 2*pdfMargin) * 10 / (pdfFontSize * 6)
+	pdfPageLines = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// PDFLine structure for one line of a text PDF
+type PDFLine struct {
+	Text string
+	Bold bool
+}
+
+// Write lines as a plain A4 PDF with a title, wrapping long lines and numbering the
+// pages. Only the standard Courier fonts are used, so nothing is embedded; characters
+// outside Windows-1252 are replaced
+func writeTextPDF(out io.Writer, title string, lines []PDFLine) error {
+	var wrapped []PDFLine
+	for _, line := range lines {
+		for _, part := range wrapPDFLine(line.Text, pdfLineChars) {
+			wrapped = append(wrapped, PDFLine{Text: part, Bold: line.Bold})
+		}
+	}
+
+	// The title takes the first lines of the first page
+	titleLines := 3
+	var pages [][]PDFLine
+	for first := true; first || len(wrapped) > 0; first = false {
+		n := pdfPageLines - 2
+		if first {
+			n -= titleLines
+		}
+		n = min(n, len(wrapped))
+		pages = append(pages, wrapped[:n])
+		wrapped = wrapped[n:]
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3-4 fonts, 5 info, then a page and its content per page
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title %s /Producer %s /CreationDate %s >>", pdfString(title),
+			pdfString("peep "+buildInfo().Version), pdfString(time.Now().Format("D:20060102150405"))),
+	)
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		y := pdfPageHeight - pdfMargin
+		if i == 0 {
+			fmt.Fprintf(&content, "BT /F2 %d Tf %d %d Td %s Tj ET\n", pdfTitleSize, pdfMargin, y-pdfTitleSize, pdfString(title))
+			y -= titleLines * pdfLeading
+		}
+		fmt.Fprintf(&content, "BT %d TL %d %d Td\n", pdfLeading, pdfMargin, y-pdfFontSize)
+		font := ""
+		for _, line := range page {
+			if want := map[bool]string{false: "/F1", true: "/F2"}[line.Bold]; want != font {
+				fmt.Fprintf(&content, "%s %d Tf\n", want, pdfFontSize)
+				font = want
+			}
+			fmt.Fprintf(&content, "%s Tj T*\n", pdfString(line.Text))
+		}
+		content.WriteString("ET\n")
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		fmt.Fprintf(&content, "BT /F1 8 Tf %d %d Td %s Tj ET\n",
+			pdfPageWidth-pdfMargin-len(footer)*8*6/10, pdfMargin/2, pdfString(footer))
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 7+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := out.Write(doc.Bytes())
+	return err
+}
+
+// Split a line into parts of at most width characters, at spaces where possible
+func wrapPDFLine(text string, width int) []string {
+	runes := []rune(strings.ReplaceAll(text, "\t", "    "))
+	var parts []string
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, string(runes[:cut]))
+		runes = []rune("    " + strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(parts, string(runes))
+}
+
+// PDF literal string in Windows-1252, escaping delimiters
+func pdfString(text string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range text {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 0x20 {
+				c = ' '
+			}
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
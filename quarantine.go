@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Raw headers are truncated to this size when quarantined
+const maxQuarantineHeader = 8192
+
+// QuarantineEntry structure for a message that failed parsing
+type QuarantineEntry struct {
+	ID     int64
+	Folder string
+	UID    uint32
+	Error  string
+	Header string
+}
+
+// Cut the header block from a raw message
+func rawHeader(raw []byte) []byte {
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end < 0 {
+		end = bytes.Index(raw, []byte("\n\n"))
+	}
+	if end < 0 {
+		end = len(raw)
+	}
+	return raw[:end]
+}
+
+// Save quarantined messages
+func saveQuarantine(tx *sql.Tx, folder string, uidValidity uint32, entries []QuarantineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO quarantine (folder, uid_validity, uid, error, raw_header) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(folder, uid_validity, uid) DO UPDATE SET error = excluded.error, raw_header = excluded.raw_header`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		if _, err := stmt.Exec(folder, uidValidity, entry.UID, entry.Error, entry.Header); err != nil {
+			log.Printf("Quarantine save error (UID %d): %v", entry.UID, err)
+		}
+	}
+
+	log.Printf("Quarantined %d messages", len(entries))
+	return nil
+}
+
+// Load quarantined messages
+func loadQuarantine(db *sql.DB) ([]QuarantineEntry, error) {
+	rows, err := db.Query(`
+		SELECT id, folder, uid, COALESCE(error, ''), COALESCE(raw_header, '')
+		FROM quarantine ORDER BY folder, uid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []QuarantineEntry
+	for rows.Next() {
+		var entry QuarantineEntry
+		if err := rows.Scan(&entry.ID, &entry.Folder, &entry.UID, &entry.Error, &entry.Header); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Find the From line of a raw header for display
+func headerFromLine(header string) string {
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(strings.ToLower(line), "from:") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return "(no From line)"
+}
+
+// Run the quarantine command (list/reprocess/clear)
+func runQuarantine(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: quarantine requires an action: list, reprocess or clear")
+		os.Exit(1)
+	}
+	action, args := args[0], args[1:]
+
+	config := &Config{}
+	parseLocalFlags(accountFlags("quarantine", config), config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	entries, err := loadQuarantine(db)
+	if err != nil {
+		fmt.Printf("❌ Failed to load quarantine: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "list":
+		for _, entry := range entries {
+			fmt.Printf("  - %s UID %d: %s\n      %s\n", entry.Folder, entry.UID, entry.Error, headerFromLine(entry.Header))
+		}
+		fmt.Printf("Total quarantined: %d\n", len(entries))
+	case "reprocess":
+		reprocessQuarantine(db, config, entries)
+	case "clear":
+		_, err := db.Exec("DELETE FROM quarantine")
+		recordAudit(config, auditPurge, "quarantine", map[string]any{"entries": len(entries)}, err)
+		if err != nil {
+			fmt.Printf("❌ Failed to clear quarantine: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Quarantine cleared: %d entries", len(entries))
+		fmt.Printf("Quarantine cleared: %d entries\n", len(entries))
+	default:
+		fmt.Printf("❌ Error: unknown quarantine action %q\n", action)
+		os.Exit(1)
+	}
+}
+
+// Re-run sender extraction on quarantined headers
+func reprocessQuarantine(db *sql.DB, config *Config, entries []QuarantineEntry) {
+	var senders []EmailSender
+	recovered := 0
+
+	for _, entry := range entries {
+		parsed, err := sendersFromRaw([]byte(entry.Header+"\r\n\r\n"), config)
+		if err != nil {
+			if err.Error() != entry.Error {
+				db.Exec("UPDATE quarantine SET error = ? WHERE id = ?", err.Error(), entry.ID)
+			}
+			continue
+		}
+
+		for _, sender := range parsed {
+			if !sender.Excluded {
+				senders = append(senders, sender)
+			}
+		}
+		if _, err := db.Exec("DELETE FROM quarantine WHERE id = ?", entry.ID); err != nil {
+			log.Printf("Failed to remove quarantine entry %d: %v", entry.ID, err)
+			continue
+		}
+		recovered++
+	}
+
+	newCount, err := storeSenders(db, config, senders)
+	if err != nil {
+		fmt.Printf("❌ Failed to save senders: %v\n", err)
+		os.Exit(1)
+	}
+
+	log.Printf("Quarantine reprocessed: %d/%d recovered, %d new senders", recovered, len(entries), newCount)
+	fmt.Printf("✅ Reprocessed %d/%d quarantined messages, %d new senders\n", recovered, len(entries), newCount)
+}
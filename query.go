@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// First keywords of the statements the query command runs
+var queryKeywords = []string{"SELECT", "WITH", "VALUES", "EXPLAIN"}
+
+// Run the read-only SQL query command
+func runQuery(args []string) {
+	config := &Config{ReadOnly: true}
+	var query, format, output string
+	var queryArgs stringList
+
+	fs := accountFlags("query", config)
+	fs.StringVar(&query, "sql", "", "SELECT statement, ? placeholders take the -arg values")
+	fs.Var(&queryArgs, "arg", "Value of the next ? placeholder (repeatable)")
+	fs.StringVar(&format, "format", "text", "Output format (text, csv, json)")
+	fs.StringVar(&output, "o", "", "Output file (default: stdout)")
+	fs.StringVar(&config.Remote, "remote", "", "Read the database of -user from a peep serve instance (https://host:port)")
+	parseLocalFlags(fs, config, args)
+
+	if query == "" && fs.NArg() > 0 {
+		query = strings.Join(fs.Args(), " ")
+	}
+	if err := checkReadOnlyQuery(query); err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if format != "text" && format != "csv" && format != "json" {
+		fmt.Printf("❌ Error: unsupported format %q (use text, csv or json)\n", format)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenReadOnlyDB(config)
+	defer db.Close()
+
+	values := make([]any, len(queryArgs))
+	for i, arg := range queryArgs {
+		values[i] = arg
+	}
+	rows, err := db.Query(query, values...)
+	if err != nil {
+		log.Printf("Query error: %v", err)
+		fmt.Printf("❌ Query failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	count, err := writeQueryRows(out, format, rows)
+	if err != nil {
+		log.Printf("Query error: %v", err)
+		fmt.Printf("❌ Query failed: %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Query returned %d rows", count)
+	if output != "" {
+		fmt.Printf("✅ %s written to %s\n", plural(count, "row"), output)
+	}
+}
+
+// Accept statements that read: writes are refused by the read-only connection
+// anyway, this gives a clear message first
+func checkReadOnlyQuery(query string) error {
+	words := strings.Fields(strings.ToUpper(query))
+	if len(words) == 0 {
+		return fmt.Errorf("query requires -sql \"SELECT ...\"")
+	}
+	if !slices.Contains(queryKeywords, words[0]) {
+		return fmt.Errorf("only SELECT queries are allowed, the database is opened read-only")
+	}
+	if hasStatementTail(query) {
+		return fmt.Errorf("only one statement is allowed per query")
+	}
+	return nil
+}
+
+// Check if the query goes on after the end of its first statement. SQLite runs every
+// statement of the string, so "SELECT 1; ATTACH ..." would pass the keyword check;
+// semicolons in literals, quoted names and comments don't end a statement
+func hasStatementTail(query string) bool {
+	ended := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ';':
+			ended = true
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			continue
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+			continue
+		}
+		if ended {
+			return true
+		}
+		closing := c
+		if c == '[' {
+			closing = ']'
+		}
+		if strings.IndexByte("'\"`[", c) >= 0 {
+			// A doubled quote is an escaped one, so it closes and reopens the literal
+			if end := strings.IndexByte(query[i+1:], closing); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		}
+	}
+	return false
+}
+
+// Write the result rows as an aligned table, CSV or a JSON array of objects
+func writeQueryRows(out io.Writer, format string, rows *sql.Rows) (int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	var table *tabwriter.Writer
+	var csvWriter *csv.Writer
+	var records []map[string]any
+	switch format {
+	case "text":
+		table = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.ToUpper(strings.Join(columns, "\t")))
+	case "csv":
+		csvWriter = csv.NewWriter(out)
+		csvWriter.Write(columns)
+	case "json":
+		records = []map[string]any{}
+	}
+
+	count := 0
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		count++
+		cells := make([]string, len(values))
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+			case []byte:
+				values[i] = string(v)
+				cells[i] = string(v)
+			case time.Time:
+				cells[i] = v.UTC().Format(time.DateTime)
+			default:
+				cells[i] = fmt.Sprint(v)
+			}
+		}
+
+		switch format {
+		case "text":
+			fmt.Fprintln(table, strings.Join(cells, "\t"))
+		case "csv":
+			csvWriter.Write(cells)
+		case "json":
+			record := make(map[string]any, len(columns))
+			for i, column := range columns {
+				record[column] = values[i]
+			}
+			records = append(records, record)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	switch format {
+	case "text":
+		return count, table.Flush()
+	case "csv":
+		csvWriter.Flush()
+		return count, csvWriter.Error()
+	default:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return count, encoder.Encode(records)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Parallel PTR lookups
+	rdnsWorkers = 8
+	// Timeout of a single PTR lookup
+	rdnsTimeout = 5 * time.Second
+)
+
+// Run the reverse DNS enrichment command
+func runRDNS(args []string) {
+	config := &Config{}
+	var refresh bool
+
+	fs := accountFlags("rdns", config)
+	fs.BoolVar(&refresh, "refresh", false, "Resolve IPs that already have a hostname again")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	if err := enrichRDNS(db, refresh); err != nil {
+		log.Printf("Reverse DNS error: %v", err)
+		fmt.Printf("❌ Reverse DNS error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// PTRResult structure for the outcome of one reverse lookup
+type PTRResult struct {
+	IP   string
+	Host string
+}
+
+// Resolve PTR records of recorded sending IPs
+func enrichRDNS(db *sql.DB, refresh bool) error {
+	query := "SELECT DISTINCT ip FROM sender_ips"
+	if !refresh {
+		query += " WHERE ptr_checked_at IS NULL"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			rows.Close()
+			return err
+		}
+		ips = append(ips, ip)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	jobs := make(chan string)
+	results := make(chan PTRResult)
+	var wg sync.WaitGroup
+	for range rdnsWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				results <- PTRResult{IP: ip, Host: lookupPTR(ip)}
+			}
+		}()
+	}
+	go func() {
+		for _, ip := range ips {
+			jobs <- ip
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	found := 0
+	var saveErr error
+	for result := range results {
+		if saveErr != nil {
+			continue
+		}
+		hostDomain := ""
+		if result.Host != "" {
+			hostDomain = orgDomain(result.Host)
+			found++
+		}
+		_, saveErr = db.Exec(`
+			UPDATE sender_ips SET ptr = NULLIF(?, ''), ptr_domain = NULLIF(?, ''), ptr_checked_at = CURRENT_TIMESTAMP
+			WHERE ip = ?`, result.Host, hostDomain, result.IP)
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+
+	log.Printf("Reverse DNS completed: %d IPs resolved, %d with hostname", len(ips), found)
+	fmt.Printf("✅ Reverse DNS completed: %d IPs resolved, %d with hostname\n", len(ips), found)
+	return nil
+}
+
+// Look up the first PTR hostname of an IP
+func lookupPTR(ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), rdnsTimeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(names[0], "."))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// UnreadReport structure for one row of the unread newsletter report
+type UnreadReport struct {
+	Name     string
+	Email    string
+	Messages int
+	Read     int
+	ReadRate float64
+	LastSeen string
+}
+
+// Bulk senders whose mail is rarely read, most unread messages first: candidates for
+// unsubscribing. Only messages scanned with their \Seen flag count
+func loadUnreadReport(db *sql.DB, limit, minMessages int, maxReadRate float64, tags []string, includeIgnored, starred bool) ([]UnreadReport, error) {
+	conditions := []string{"flags_count >= ?", "seen_count <= flags_count * ?", "bulk_count * 2 > message_count"}
+	args := []any{minMessages, maxReadRate}
+	if condition, tagArgs := tagFilterCondition("senders.email", tags); condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	query := `
+		SELECT COALESCE(full_name, ''), email, flags_count, seen_count, COALESCE(last_seen_at, '')
+		FROM senders WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY flags_count - seen_count DESC, email`
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []UnreadReport
+	for rows.Next() {
+		var r UnreadReport
+		if err := rows.Scan(&r.Name, &r.Email, &r.Messages, &r.Read, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		r.ReadRate = float64(r.Read) / float64(r.Messages)
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// Write the unread newsletter report as an aligned table or CSV
+func writeUnreadReport(out io.Writer, format string, reports []UnreadReport) error {
+	header := []string{"name", "email", "messages", "read", "read_rate", "last_seen"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.0f%%\t%s\n", r.Name, r.Email, r.Messages, r.Read, r.ReadRate*100, lastSeenDate(r.LastSeen))
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range reports {
+			w.Write([]string{r.Name, r.Email, strconv.Itoa(r.Messages), strconv.Itoa(r.Read),
+				strconv.FormatFloat(r.ReadRate, 'f', 2, 64), r.LastSeen})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+var (
+	receivedFromIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+	receivedBy     = regexp.MustCompile(`(?i)\bby\s+([^\s;()]+)`)
+)
+
+// Parse a public IP address, ignoring private and reserved ranges
+func publicIP(value string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return netip.Addr{}, false
+	}
+	return addr, true
+}
+
+// Find the IP that handed a message to the receiving provider
+//
+// Received headers are read from the newest (added by your provider) to the oldest.
+// Headers added by hosts outside the provider's domain could be forged, so the walk
+// stops there; the last public IP seen before that is the sending IP.
+func originatingIP(header message.Header) string {
+	provider := ""
+	origin := ""
+
+	for _, received := range header.Values("Received") {
+		received = strings.Join(strings.Fields(received), " ")
+		fromPart, _, _ := strings.Cut(received, " by ")
+
+		if match := receivedBy.FindStringSubmatch(received); match != nil {
+			by := strings.ToLower(strings.TrimSuffix(match[1], "."))
+			if _, err := netip.ParseAddr(by); err != nil && strings.Contains(by, ".") {
+				if provider == "" {
+					provider = orgDomain(by)
+				} else if orgDomain(by) != provider {
+					break
+				}
+			}
+		}
+
+		for _, match := range receivedFromIP.FindAllStringSubmatch(fromPart, -1) {
+			if addr, ok := publicIP(match[1]); ok {
+				origin = addr.String()
+				break
+			}
+		}
+	}
+
+	return origin
+}
+
+// Add sending IP counts per sender
+func saveSenderIPs(tx *sql.Tx, stats map[string]*SenderStats) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO sender_ips (email, ip, message_count) VALUES (?, ?, ?)
+		ON CONFLICT(email, ip) DO UPDATE SET
+			message_count = message_count + excluded.message_count, last_seen = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, s := range stats {
+		for ip, count := range s.IPs {
+			if _, err := stmt.Exec(email, ip, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
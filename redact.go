@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Replacement of redacted values in log lines
+const redacted = "***"
+
+var (
+	// Credentials written as key=value or key: value, on the command line as
+	// -pass value, in URLs as user:password@ and in Authorization headers
+	secretAssignment = regexp.MustCompile(`(?i)\b((?:[a-z]+[_-])?(?:pass|passwd|password|secret|token|api[_-]?key|access[_-]?key)["']?\s*[=:]\s*["']?)[^\s"',;&]+`)
+	secretFlag       = regexp.MustCompile(`(?i)(\s-{1,2}(?:pass|password)[= ]\s*)\S+`)
+	secretURLAuth    = regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://[^/\s:@]*:)[^/\s@]+@`)
+	secretAuthHeader = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[a-z0-9._~+/=-]{8,}`)
+
+	// Email addresses, redacted with -redact-emails
+	logEmailAddress = regexp.MustCompile(`(?i)[a-z0-9._%+'-]+@([a-z0-9-]+(?:\.[a-z0-9-]+)+)`)
+)
+
+// Process-wide redaction of log lines: the credentials in use, which are replaced
+// wherever they appear, and whether email addresses are redacted too
+var logRedaction struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+	emails   bool
+}
+
+// Redact a password, token or key from every log line written from now on. Returns
+// the value, so secrets can be registered where they are read
+func logSecret(value string) string {
+	// Shorter values would blank out ordinary words
+	if len(value) < 4 {
+		return value
+	}
+	logRedaction.mu.Lock()
+	defer logRedaction.mu.Unlock()
+	if logRedaction.secrets[value] {
+		return value
+	}
+	if logRedaction.secrets == nil {
+		logRedaction.secrets = make(map[string]bool)
+	}
+	logRedaction.secrets[value] = true
+
+	// Longest first, so a secret containing another is replaced whole
+	secrets := make([]string, 0, len(logRedaction.secrets))
+	for secret := range logRedaction.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	var pairs []string
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, redacted)
+	}
+	logRedaction.replacer = strings.NewReplacer(pairs...)
+	return value
+}
+
+// Redact email addresses from log lines, keeping their domain (-redact-emails)
+func setRedactEmails(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	logRedaction.mu.Lock()
+	logRedaction.emails = enabled
+	logRedaction.mu.Unlock()
+	return nil
+}
+
+// Whether email addresses are redacted from log lines
+func redactingEmails() bool {
+	logRedaction.mu.RLock()
+	defer logRedaction.mu.RUnlock()
+	return logRedaction.emails
+}
+
+// Scrub credentials, and email addresses when enabled, from a log line
+func redactLogLine(line string) string {
+	line = redactCredentials(line)
+	if redactingEmails() {
+		line = logEmailAddress.ReplaceAllString(line, redacted+"@$1")
+	}
+	return line
+}
+
+// Scrub the registered secrets and anything that looks like a credential
+func redactCredentials(line string) string {
+	logRedaction.mu.RLock()
+	replacer := logRedaction.replacer
+	logRedaction.mu.RUnlock()
+
+	if replacer != nil {
+		line = replacer.Replace(line)
+	}
+	line = secretURLAuth.ReplaceAllString(line, "${1}"+redacted+"@")
+	line = secretAuthHeader.ReplaceAllString(line, "$1 "+redacted)
+	line = secretFlag.ReplaceAllString(line, "${1}"+redacted)
+	return secretAssignment.ReplaceAllString(line, "${1}"+redacted)
+}
+
+// redactWriter structure for the log output, scrubbing each entry before it is
+// written. The log package writes one entry per Write
+type redactWriter struct {
+	w io.Writer
+}
+
+// Write a redacted log entry
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactLogLine(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// StoredSender structure for a sender row being re-extracted
+type StoredSender struct {
+	ID       int64
+	FullName string
+	Email    string
+	RawFrom  string
+}
+
+// Run the reextract command
+func runReextract(args []string) {
+	config := &Config{}
+	var dryRun bool
+
+	fs := accountFlags("reextract", config)
+	fs.BoolVar(&dryRun, "dry-run", false, "Show changes without updating the database")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	if err := reextractSenders(db, config, dryRun); err != nil {
+		log.Printf("Reextract error: %v", err)
+		fmt.Printf("❌ Reextract error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Collect raw From values from cached headers, keyed by address
+func cachedRawFroms(cacheDir string) map[string]string {
+	rawFroms := make(map[string]string)
+	if _, err := os.Stat(cacheDir); err != nil {
+		return rawFroms
+	}
+
+	err := readHeaderCache(cacheDir, func(path string, h CachedHeader) error {
+		entity, err := message.Read(strings.NewReader(string(h.Header) + "\r\n\r\n"))
+		if err != nil {
+			return nil
+		}
+		fromHeader := entity.Header.Get("From")
+		for _, group := range splitAddressGroups(fromHeader) {
+			addrs, err := mail.ParseAddressList(group.List)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				rawFroms[strings.ToLower(addr.Address)] = fromHeader
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Header cache read error: %v", err)
+	}
+
+	return rawFroms
+}
+
+// Load all stored senders
+func loadStoredSenders(db *sql.DB) ([]StoredSender, error) {
+	rows, err := db.Query("SELECT id, COALESCE(full_name, ''), email, COALESCE(raw_from, '') FROM senders ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var senders []StoredSender
+	for rows.Next() {
+		var s StoredSender
+		if err := rows.Scan(&s.ID, &s.FullName, &s.Email, &s.RawFrom); err != nil {
+			return nil, err
+		}
+		senders = append(senders, s)
+	}
+	return senders, rows.Err()
+}
+
+// Re-run sender parsing over stored raw From values and update rows in place
+func reextractSenders(db *sql.DB, config *Config, dryRun bool) error {
+	senders, err := loadStoredSenders(db)
+	if err != nil {
+		return err
+	}
+
+	// Rows scanned by older versions have no raw_from; fall back to cached headers
+	var rawFroms map[string]string
+	for _, s := range senders {
+		if s.RawFrom == "" {
+			rawFroms = cachedRawFroms(config.HeaderCacheDir)
+			break
+		}
+	}
+
+	updated, merged, missing := 0, 0, 0
+	for _, stored := range senders {
+		rawFrom := stored.RawFrom
+		if rawFrom == "" {
+			rawFrom = rawFroms[stored.Email]
+		}
+		if rawFrom == "" {
+			missing++
+			continue
+		}
+
+		parsed := parseSenders(rawFrom, config)
+		if len(parsed) == 0 {
+			continue
+		}
+
+		// Pick the mailbox this row was created from
+		sender := parsed[0]
+		for _, candidate := range parsed {
+			if candidate.Email == stored.Email {
+				sender = candidate
+				break
+			}
+		}
+		if sender.Email == stored.Email && sender.FullName == stored.FullName && stored.RawFrom != "" {
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("  %s <%s> -> %s <%s>\n", stored.FullName, stored.Email, sender.FullName, sender.Email)
+			updated++
+			continue
+		}
+
+		wasMerged, err := updateStoredSender(db, stored, sender, rawFrom)
+		if err != nil {
+			log.Printf("Reextract update error (%s): %v", stored.Email, err)
+			continue
+		}
+		if wasMerged {
+			merged++
+		} else {
+			updated++
+		}
+	}
+
+	log.Printf("Reextract completed: %d updated, %d merged, %d without raw From", updated, merged, missing)
+	if dryRun {
+		fmt.Printf("Would update %d senders (%d without raw From)\n", updated, missing)
+	} else {
+		fmt.Printf("✅ Reextract completed: %d updated, %d merged, %d without raw From\n", updated, merged, missing)
+	}
+	return nil
+}
+
+// Update one sender row, merging into an existing row when the normalized email already exists
+func updateStoredSender(db *sql.DB, stored StoredSender, sender EmailSender, rawFrom string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	merged := false
+	if sender.Email != stored.Email {
+		var existingID int64
+		err := tx.QueryRow("SELECT id FROM senders WHERE email = ?", sender.Email).Scan(&existingID)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return false, err
+		default:
+			// Keep the surviving row's earliest created_at
+			if _, err := tx.Exec(`
+				UPDATE senders SET created_at = MIN(created_at, (SELECT created_at FROM senders WHERE id = ?))
+				WHERE id = ?`, stored.ID, existingID); err != nil {
+				return false, err
+			}
+			if _, err := tx.Exec("DELETE FROM senders WHERE id = ?", stored.ID); err != nil {
+				return false, err
+			}
+			merged = true
+		}
+
+		if _, err := tx.Exec("UPDATE OR IGNORE sender_tags SET email = ? WHERE email = ?", sender.Email, stored.Email); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec("DELETE FROM sender_tags WHERE email = ?", stored.Email); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec("UPDATE sender_notes SET email = ? WHERE email = ?", sender.Email, stored.Email); err != nil {
+			return false, err
+		}
+	}
+
+	if !merged {
+		if _, err := tx.Exec("UPDATE senders SET full_name = ?, email = ?, raw_from = ? WHERE id = ?",
+			sender.FullName, sender.Email, rawFrom, stored.ID); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	log.Printf("Sender re-extracted: %s <%s> -> %s <%s>", stored.FullName, stored.Email, sender.FullName, sender.Email)
+	return merged, nil
+}
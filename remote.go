@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Analysis commands given -remote read the database of a peep serve instance
+// instead of a local file: a database/sql driver sends each of their queries to
+// the server, which runs it on the user's database opened read-only. The commands
+// themselves are the same for local and remote databases
+
+// Timeout of one remote query
+const remoteQueryTimeout = 2 * time.Minute
+
+// Error of statements that would write to a remote database
+var errRemoteReadOnly = errors.New("remote databases are read-only")
+
+// RemoteQuery structure for the request of one query
+type RemoteQuery struct {
+	User string `json:"user"`
+	SQL  string `json:"sql"`
+	Args []any  `json:"args,omitempty"`
+}
+
+// RemoteResult structure for the rows of a query, or its error
+type RemoteResult struct {
+	Columns []string `json:"columns,omitempty"`
+	Rows    [][]any  `json:"rows,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Encode a database value for JSON: times and blobs as single-key objects, so
+// they come back as what they were rather than strings
+func encodeRemoteValue(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return map[string]string{"t": v.Format(time.RFC3339Nano)}
+	case []byte:
+		return map[string]string{"b": base64.StdEncoding.EncodeToString(v)}
+	default:
+		return v
+	}
+}
+
+// Decode a value encoded by encodeRemoteValue, read with json.Number numbers
+func decodeRemoteValue(value any) (driver.Value, error) {
+	switch v := value.(type) {
+	case nil, string, bool:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]any:
+		if t, ok := v["t"].(string); ok {
+			return time.Parse(time.RFC3339Nano, t)
+		}
+		if b, ok := v["b"].(string); ok {
+			return base64.StdEncoding.DecodeString(b)
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
+
+// Open the database of config.Username on the server of -remote, checking that
+// it answers. The token of the server is read from $PEEP_REMOTE_TOKEN
+func openRemoteDB(config *Config) (*sql.DB, error) {
+	if config.Username == "" {
+		return nil, withExitCode(exitUsage, fmt.Errorf("-remote needs -user, the account on the server"))
+	}
+	if !strings.HasPrefix(config.Remote, "http://") && !strings.HasPrefix(config.Remote, "https://") {
+		return nil, withExitCode(exitUsage, fmt.Errorf("invalid -remote %q (use https://host[:port])", config.Remote))
+	}
+	db := sql.OpenDB(&remoteConnector{
+		url:    strings.TrimSuffix(config.Remote, "/") + "/v1/query",
+		user:   config.Username,
+		token:  os.Getenv("PEEP_REMOTE_TOKEN"),
+		client: &http.Client{Timeout: remoteQueryTimeout},
+	})
+	if err := db.QueryRow("SELECT COUNT(*) FROM senders").Scan(new(int)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// remoteConnector structure for the server and account of a remote database
+type remoteConnector struct {
+	url    string
+	user   string
+	token  string
+	client *http.Client
+}
+
+// Connect to the server; connections are stateless, every query is a request
+func (c *remoteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &remoteConn{c}, nil
+}
+
+// Driver of the connector
+func (c *remoteConnector) Driver() driver.Driver {
+	return remoteDriver{}
+}
+
+// remoteDriver structure for the driver, only used through remoteConnector
+type remoteDriver struct{}
+
+// Open is not supported, remote databases are opened with openRemoteDB
+func (remoteDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("remote databases are opened with -remote")
+}
+
+// Send one query to the server
+func (c *remoteConnector) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	request := RemoteQuery{User: c.user, SQL: query}
+	for _, arg := range args {
+		request.Args = append(request.Args, encodeRemoteValue(arg.Value))
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+logSecret(c.token))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, withExitCode(exitConnection, err)
+	}
+	defer resp.Body.Close()
+
+	var result RemoteResult
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid response from %s: %v", c.url, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, withExitCode(exitAuth, fmt.Errorf("%s: access denied (set PEEP_REMOTE_TOKEN)", c.url))
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, withExitCode(exitDatabase, fmt.Errorf("%s", firstNonEmpty(result.Error, "no such server endpoint: "+c.url)))
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s", firstNonEmpty(result.Error, resp.Status))
+	}
+
+	rows := &remoteRows{columns: result.Columns}
+	for _, row := range result.Rows {
+		values := make([]driver.Value, len(row))
+		for i, value := range row {
+			if values[i], err = decodeRemoteValue(value); err != nil {
+				return nil, err
+			}
+		}
+		rows.rows = append(rows.rows, values)
+	}
+	return rows, nil
+}
+
+// remoteConn structure for a connection to the server
+type remoteConn struct {
+	c *remoteConnector
+}
+
+// Prepare a statement, sent with each query
+func (conn *remoteConn) Prepare(query string) (driver.Stmt, error) {
+	return &remoteStmt{c: conn.c, query: query}, nil
+}
+
+// Close the connection
+func (conn *remoteConn) Close() error {
+	return nil
+}
+
+// Transactions would write
+func (conn *remoteConn) Begin() (driver.Tx, error) {
+	return nil, errRemoteReadOnly
+}
+
+// Run a query without preparing it
+func (conn *remoteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return conn.c.query(ctx, query, args)
+}
+
+// remoteStmt structure for a prepared statement
+type remoteStmt struct {
+	c     *remoteConnector
+	query string
+}
+
+// Close the statement
+func (s *remoteStmt) Close() error {
+	return nil
+}
+
+// Any number of placeholders, checked by the server
+func (s *remoteStmt) NumInput() int {
+	return -1
+}
+
+// Statements other than queries would write
+func (s *remoteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errRemoteReadOnly
+}
+
+// Run the statement
+func (s *remoteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.c.query(context.Background(), s.query, named)
+}
+
+// Run the statement with a context
+func (s *remoteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.query(ctx, s.query, args)
+}
+
+// remoteRows structure for the rows of a query, received at once
+type remoteRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+// Column names
+func (r *remoteRows) Columns() []string {
+	return r.columns
+}
+
+// Close the rows
+func (r *remoteRows) Close() error {
+	return nil
+}
+
+// Copy the next row into dest
+func (r *remoteRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
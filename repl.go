@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Rows shown by show and more in the REPL
+const replPageSize = 20
+
+// Numeric sender columns the REPL compares with <, <=, >, >=, = and !=
+var replNumbers = map[string]string{
+	"messages": "message_count",
+	"answered": "answered_count",
+	"flagged":  "flagged_count",
+	"bulk":     "bulk_count",
+	"score":    "score",
+}
+
+// Groupings of the REPL group command, as expressions over a "s" subquery of senders
+var replGroups = map[string]string{
+	"domain":   "lower(substr(s.email, instr(s.email, '@') + 1))",
+	"company":  "COALESCE(NULLIF(s.company, ''), '-')",
+	"category": "COALESCE(NULLIF(s.category, ''), '-')",
+	"tag":      "COALESCE(t.tag, '-')",
+}
+
+const replHelp = `Commands:
+  filter <key>=<value>   Only senders matching (domain, email, name, company, category, tag, alias, label; * matches anything)
+  filter <key>!=<value>  Exclude matching senders
+  filter <num><op><n>    Compare messages, answered, flagged, bulk or score (<, <=, >, >=, =, !=)
+  filters                Show the active filters
+  unfilter [n]           Remove filter n, or all filters
+  sort <order>           Order senders by count, flagged, last_seen, name, score or email
+  show [n]               Show the first n matching senders (default 20)
+  more                   Show the next page
+  count                  Count matching senders and their messages
+  group <key> [n]        Senders and messages per domain, company, category or tag
+  help                   Show this help
+  quit                   Leave (also Ctrl-D)
+
+Example: filter domain=*.acme.com, filter messages>10, sort score, show`
+
+// replSession structure for the state of an interactive session
+type replSession struct {
+	db             *sql.DB
+	out            io.Writer
+	filters        []string
+	order          string
+	offset         int
+	includeIgnored bool
+}
+
+// Run the interactive query command
+func runREPL(args []string) {
+	config := &Config{}
+	var includeIgnored bool
+
+	fs := accountFlags("repl", config)
+	fs.BoolVar(&includeIgnored, "include-ignored", false, "Include ignored senders")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	session := &replSession{db: db, out: os.Stdout, order: "count", includeIgnored: includeIgnored}
+	interactive := false
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+		fmt.Println("🔍 Peep query shell, type help for commands")
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Printf("peep (%s)> ", plural(len(session.filters), "filter"))
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return
+		}
+		if err := session.run(line); err != nil {
+			fmt.Printf("❌ %v\n", err)
+		}
+	}
+	if interactive {
+		fmt.Println()
+	}
+}
+
+// Run one REPL command
+func (s *replSession) run(line string) error {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch strings.ToLower(command) {
+	case "help", "?":
+		fmt.Fprintln(s.out, replHelp)
+	case "filter", "where":
+		if _, _, err := replCondition(rest); err != nil {
+			return err
+		}
+		s.filters = append(s.filters, rest)
+		s.offset = 0
+		return s.count()
+	case "filters":
+		if len(s.filters) == 0 {
+			fmt.Fprintln(s.out, "No filters, all senders match")
+		}
+		for i, filter := range s.filters {
+			fmt.Fprintf(s.out, "%d. %s\n", i+1, filter)
+		}
+	case "unfilter":
+		if rest == "" {
+			s.filters = nil
+		} else {
+			n, err := strconv.Atoi(rest)
+			if err != nil || n < 1 || n > len(s.filters) {
+				return fmt.Errorf("no filter %q (see filters)", rest)
+			}
+			s.filters = append(s.filters[:n-1], s.filters[n:]...)
+		}
+		s.offset = 0
+		return s.count()
+	case "sort":
+		if _, ok := listSorts[rest]; !ok {
+			return fmt.Errorf("unknown sort %q (use count, flagged, last_seen, name, score or email)", rest)
+		}
+		s.order = rest
+		s.offset = 0
+	case "show", "list":
+		limit, err := replLimit(rest)
+		if err != nil {
+			return err
+		}
+		s.offset = 0
+		return s.show(limit)
+	case "more":
+		return s.show(replPageSize)
+	case "count":
+		return s.count()
+	case "group":
+		key, n, _ := strings.Cut(rest, " ")
+		limit, err := replLimit(n)
+		if err != nil {
+			return err
+		}
+		return s.group(key, limit)
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", command)
+	}
+	return nil
+}
+
+// Row count of show and group, default one page
+func replLimit(value string) (int, error) {
+	if value == "" {
+		return replPageSize, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", value)
+	}
+	return n, nil
+}
+
+// SQL condition of one REPL filter: key=value and key!=value as for list -filter, or a
+// comparison of a numeric column
+func replCondition(filter string) (string, []any, error) {
+	for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		key, value, ok := strings.Cut(filter, op)
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if column, ok := replNumbers[key]; ok {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s needs a number, not %q", key, value)
+			}
+			return column + " " + op + " ?", []any{n}, nil
+		}
+		condition, ok := listFilters[key]
+		if !ok {
+			break
+		}
+		switch op {
+		case "=":
+			return condition, []any{likePattern(value)}, nil
+		case "!=":
+			return "NOT (" + condition + ")", []any{likePattern(value)}, nil
+		}
+		return "", nil, fmt.Errorf("%s can only be compared with = or !=", key)
+	}
+	return "", nil, fmt.Errorf("invalid filter %q (use key=value with domain, email, name, company, category, tag, alias or label, or e.g. messages>10)", filter)
+}
+
+// WHERE clause of the active filters
+func (s *replSession) where() (string, []any) {
+	where, args, _ := listConditions(nil, s.includeIgnored, false)
+	for _, filter := range s.filters {
+		condition, conditionArgs, _ := replCondition(filter)
+		if where == "" {
+			where = " WHERE " + condition
+		} else {
+			where += " AND " + condition
+		}
+		args = append(args, conditionArgs...)
+	}
+	return where, args
+}
+
+// Print the number of matching senders and their messages
+func (s *replSession) count() error {
+	where, args := s.where()
+	var senders, messages int
+	if err := s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(message_count), 0) FROM senders"+where, args...).
+		Scan(&senders, &messages); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%s, %s\n", plural(senders, "sender"), plural(messages, "message"))
+	return nil
+}
+
+// Print the next page of matching senders
+func (s *replSession) show(limit int) error {
+	where, args := s.where()
+	senders, total, err := loadListSenders(s.db, where, args, listSorts[s.order], limit, s.offset)
+	if err != nil {
+		return err
+	}
+	if len(senders) == 0 && s.offset > 0 {
+		fmt.Fprintln(s.out, "No more senders")
+		return nil
+	}
+	notes, err := latestNotes(s.db)
+	if err != nil {
+		log.Printf("Failed to load notes: %v", err)
+	}
+	if err := writeListTable(s.out, senders, notes, total, s.offset); err != nil {
+		return err
+	}
+	s.offset += len(senders)
+	return nil
+}
+
+// Print matching senders and messages per group, most messages first
+func (s *replSession) group(key string, limit int) error {
+	expr, ok := replGroups[key]
+	if !ok {
+		return fmt.Errorf("unknown group %q (use domain, company, category or tag)", key)
+	}
+	where, args := s.where()
+	query := `SELECT ` + expr + ` AS key, COUNT(DISTINCT s.email), SUM(s.message_count)
+		FROM (SELECT email, message_count, company, category FROM senders` + where + `) s`
+	if key == "tag" {
+		query += " LEFT JOIN sender_tags t ON t.email = s.email"
+	}
+	query += " GROUP BY key ORDER BY 3 DESC, key LIMIT ?"
+
+	rows, err := s.db.Query(query, append(args, limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tSENDERS\tMESSAGES\n", strings.ToUpper(key))
+	for rows.Next() {
+		var group string
+		var senders, messages int
+		if err := rows.Scan(&group, &senders, &messages); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", group, senders, messages)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
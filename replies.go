@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+)
+
+// Common names of the Sent folder on servers without SPECIAL-USE
+var sentFolderNames = []string{"Sent", "Sent Items", "Sent Messages", "Sent Mail", "[Gmail]/Sent Mail", "INBOX.Sent"}
+
+// Find the Sent folder by its \Sent attribute or a common name
+func findSentFolder(c *client.Client) (string, error) {
+	mailboxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	special := ""
+	names := make(map[string]string)
+	for m := range mailboxes {
+		for _, attr := range m.Attributes {
+			if attr == imap.SentAttr && special == "" {
+				special = m.Name
+			}
+		}
+		names[strings.ToLower(m.Name)] = m.Name
+	}
+	if err := <-done; err != nil {
+		return "", err
+	}
+
+	if special != "" {
+		return special, nil
+	}
+	for _, name := range sentFolderNames {
+		if folder, ok := names[strings.ToLower(name)]; ok {
+			return folder, nil
+		}
+	}
+	return "", fmt.Errorf("no Sent folder found (use -sent-folder)")
+}
+
+// Load how far the Sent folder has been scanned
+func loadSentProgress(db *sql.DB, folder string) (uint32, uint32, error) {
+	var uidValidity, lastUID uint32
+	err := db.QueryRow("SELECT uid_validity, last_uid FROM sent_progress WHERE folder = ?", folder).
+		Scan(&uidValidity, &lastUID)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return uidValidity, lastUID, err
+}
+
+// Save how far the Sent folder has been scanned
+func saveSentProgress(db *sql.DB, folder string, uidValidity, lastUID uint32) error {
+	_, err := db.Exec(`
+		INSERT INTO sent_progress (folder, uid_validity, last_uid) VALUES (?, ?, ?)
+		ON CONFLICT(folder) DO UPDATE SET
+			uid_validity = excluded.uid_validity, last_uid = excluded.last_uid, updated_at = CURRENT_TIMESTAMP`,
+		folder, uidValidity, lastUID)
+	return err
+}
+
+// Count replies per recipient in the Sent folder, continuing where the last scan stopped
+func scanSentReplies(c *client.Client, config *Config, db *sql.DB) error {
+	folder := config.SentFolder
+	if folder == "" {
+		var err error
+		if folder, err = findSentFolder(c); err != nil {
+			return err
+		}
+	}
+
+	mbox, err := c.Select(folder, true)
+	if err != nil {
+		return fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+
+	uidValidity, lastUID, err := loadSentProgress(db, folder)
+	if err != nil {
+		return fmt.Errorf("failed to load Sent progress: %v", err)
+	}
+	if uidValidity != mbox.UidValidity {
+		if uidValidity != 0 {
+			log.Printf("WARNING: %s UIDVALIDITY changed (%d -> %d), recounting replies", folder, uidValidity, mbox.UidValidity)
+		}
+		if _, err := db.Exec("DELETE FROM replies"); err != nil {
+			return err
+		}
+		lastUID = 0
+	}
+
+	log.Printf("Counting replies in %s...", folder)
+	if mbox.Messages == 0 {
+		return saveSentProgress(db, folder, mbox.UidValidity, lastUID)
+	}
+	maxUID, err := uidAtSeq(c, mbox.Messages)
+	if err != nil {
+		return err
+	}
+
+	batchSize := uint32(max(config.BatchSize, 1))
+	total := 0
+	for startUID := lastUID + 1; startUID <= maxUID; startUID += batchSize {
+		endUID := min(startUID+batchSize-1, maxUID)
+
+		replies, err := fetchSentReplies(c, config, startUID, endUID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s UID %d-%d: %v", folder, startUID, endUID, err)
+		}
+		if err := saveReplies(db, replies); err != nil {
+			return fmt.Errorf("failed to save replies: %v", err)
+		}
+		if err := saveSentProgress(db, folder, mbox.UidValidity, endUID); err != nil {
+			return fmt.Errorf("failed to save Sent progress: %v", err)
+		}
+		for _, r := range replies {
+			total += r.Count
+		}
+	}
+
+	log.Printf("Reply counting completed: %d replies in %s", total, folder)
+	if config.ShowProgress {
+		fmt.Printf("Replies counted in %s: %d\n", folder, total)
+	}
+	return nil
+}
+
+// ReplyCount structure for replies sent to one address
+type ReplyCount struct {
+	Count     int
+	LastReply time.Time
+}
+
+// Fetch reply headers of a UID range and count replies per recipient
+func fetchSentReplies(c *client.Client, config *Config, startUID, endUID uint32) (map[string]*ReplyCount, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(startUID, endUID)
+
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{
+			Specifier: imap.HeaderSpecifier,
+			Fields:    []string{"To", "In-Reply-To", "References"},
+		},
+		Peek: true,
+	}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 50)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, items, messages)
+	}()
+
+	own := strings.ToLower(config.Username)
+	replies := make(map[string]*ReplyCount)
+	for msg := range messages {
+		r := msg.GetBody(section)
+		if r == nil {
+			continue
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		entity, err := message.Read(strings.NewReader(string(raw) + "\r\n"))
+		if err != nil && !message.IsUnknownCharset(err) {
+			continue
+		}
+
+		// Only replies count, not new conversations
+		if entity.Header.Get("In-Reply-To") == "" && entity.Header.Get("References") == "" {
+			continue
+		}
+
+		addrs, err := mail.ParseAddressList(entity.Header.Get("To"))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			email := strings.ToLower(addr.Address)
+			if email == own {
+				continue
+			}
+			reply, ok := replies[email]
+			if !ok {
+				reply = &ReplyCount{}
+				replies[email] = reply
+			}
+			reply.Count++
+			if msg.InternalDate.After(reply.LastReply) {
+				reply.LastReply = msg.InternalDate
+			}
+		}
+	}
+
+	return replies, <-done
+}
+
+// Add reply counts per recipient
+func saveReplies(db *sql.DB, replies map[string]*ReplyCount) error {
+	if len(replies) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO replies (email, reply_count, last_reply_at) VALUES (?, ?, ?)
+		ON CONFLICT(email) DO UPDATE SET
+			reply_count = reply_count + excluded.reply_count,
+			last_reply_at = MAX(COALESCE(last_reply_at, ''), excluded.last_reply_at)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, reply := range replies {
+		if _, err := stmt.Exec(email, reply.Count, reply.LastReply.UTC().Format(time.DateTime)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// DomainReport structure for one row of the domain report
+type DomainReport struct {
+	Domain        string
+	Senders       int
+	Messages      int
+	Flagged       int
+	AvgScore      float64
+	Transactional int
+	SpoofSuspects int
+	Countries     string
+	Networks      string
+	Hosts         string
+	Breaches      string
+}
+
+// Run the report command
+func runReport(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: report requires a type: domains, clusters, companies, unread, aliases, leaks, summary")
+		os.Exit(1)
+	}
+	kind, args := args[0], args[1:]
+
+	config := &Config{}
+	var format, output string
+	var limit int
+	var tags stringList
+	var includeIgnored, starred bool
+	var minMessages int
+	var maxReadRate float64
+
+	fs := accountFlags("report", config)
+	fs.StringVar(&format, "format", "text", "Output format (text, csv; text, pdf for summary)")
+	fs.StringVar(&output, "o", "", "Output file (default: stdout)")
+	fs.IntVar(&limit, "limit", 0, "Maximum number of rows (0 = all)")
+	fs.Var(&tags, "tag", "Only senders with this tag (repeatable, or comma-separated)")
+	fs.BoolVar(&includeIgnored, "include-ignored", false, "Include ignored senders")
+	fs.BoolVar(&starred, "starred", false, "Only starred senders")
+	fs.IntVar(&minMessages, "min-messages", 5, "Messages with known read state needed (unread report)")
+	fs.Float64Var(&maxReadRate, "max-read-rate", 0.2, "Highest share of read messages (unread report)")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("❌ Failed to create output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch kind {
+	case "domains":
+		rows, err := loadDomainReport(db, limit, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build domain report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeDomainReport(out, format, rows); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Domain report written: %d domains", len(rows))
+	case "companies":
+		rows, err := loadCompanyReport(db, config, limit, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build company report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeCompanyReport(out, format, rows); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Company report written: %d companies", len(rows))
+	case "unread":
+		rows, err := loadUnreadReport(db, limit, minMessages, maxReadRate, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build unread report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeUnreadReport(out, format, rows); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Unread report written: %d senders", len(rows))
+	case "aliases":
+		rows, err := loadAliasReport(db, limit, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build alias report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeAliasReport(out, format, rows); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Alias report written: %d aliases", len(rows))
+	case "leaks":
+		rows, err := loadLeakReport(db, limit, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build leak report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeLeakReport(out, format, rows); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Leak report written: %d tagged addresses", len(rows))
+	case "summary":
+		summary, err := loadSummaryReport(db, config, tags, includeIgnored, starred)
+		if err != nil {
+			fmt.Printf("❌ Failed to build summary report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeSummaryReport(out, format, summary); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Summary report written: %d sections", len(summary.Sections))
+	case "clusters":
+		clusters, err := loadClusterReport(db, limit)
+		if err != nil {
+			fmt.Printf("❌ Failed to build cluster report: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeClusterReport(out, format, clusters); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Cluster report written: %d clusters", len(clusters))
+	default:
+		fmt.Printf("❌ Error: unknown report type %q\n", kind)
+		os.Exit(1)
+	}
+
+	if output != "" {
+		fmt.Printf("✅ Report written to %s\n", output)
+	}
+}
+
+// Aggregate senders per domain, busiest first, optionally only senders with any of the tags
+func loadDomainReport(db *sql.DB, limit int, tags []string, includeIgnored, starred bool) ([]DomainReport, error) {
+	var conditions []string
+	condition, tagArgs := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	query := `
+		SELECT lower(substr(email, instr(email, '@') + 1)) AS domain,
+			COUNT(*), SUM(message_count), SUM(flagged_count), AVG(score),
+			SUM(COALESCE(category, '') = ?), SUM(spoof_suspect)
+		FROM senders ` + where + `
+		GROUP BY domain
+		ORDER BY SUM(message_count) DESC, domain`
+	args := append([]any{categoryTransactional}, tagArgs...)
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var reports []DomainReport
+	for rows.Next() {
+		var r DomainReport
+		if err := rows.Scan(&r.Domain, &r.Senders, &r.Messages, &r.Flagged, &r.AvgScore, &r.Transactional, &r.SpoofSuspects); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	countries, err := domainShares(db, "country", tags, includeIgnored, starred)
+	if err != nil {
+		return nil, err
+	}
+	networks, err := domainShares(db, "CASE WHEN asn IS NULL THEN NULL ELSE 'AS' || asn || COALESCE(' ' || as_org, '') END", tags, includeIgnored, starred)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := domainShares(db, "ptr_domain", tags, includeIgnored, starred)
+	if err != nil {
+		return nil, err
+	}
+	breaches, err := domainBreaches(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		reports[i].Countries = countries[reports[i].Domain]
+		reports[i].Networks = networks[reports[i].Domain]
+		reports[i].Hosts = hosts[reports[i].Domain]
+		reports[i].Breaches = breaches[reports[i].Domain]
+	}
+
+	return reports, nil
+}
+
+// Summarize the message share of a sending IP attribute per domain ("US 80%, DE 20%")
+func domainShares(db *sql.DB, expr string, tags []string, includeIgnored, starred bool) (map[string]string, error) {
+	condition, args := tagFilterCondition("sender_ips.email", tags)
+	if condition != "" {
+		condition = "AND " + condition
+	}
+	if !includeIgnored {
+		condition += " AND " + notIgnoredCondition("sender_ips.email")
+	}
+	if starred {
+		condition += " AND sender_ips.email IN (SELECT email FROM senders WHERE " + starredCondition + ")"
+	}
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT lower(substr(email, instr(email, '@') + 1)) AS domain, %s AS value, SUM(message_count)
+		FROM sender_ips
+		WHERE value IS NOT NULL AND value != '' %s
+		GROUP BY domain, value`, expr, condition), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type share struct {
+		value string
+		count int
+	}
+	byDomain := make(map[string][]share)
+	for rows.Next() {
+		var domain string
+		var s share
+		if err := rows.Scan(&domain, &s.value, &s.count); err != nil {
+			return nil, err
+		}
+		byDomain[domain] = append(byDomain[domain], s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]string)
+	for domain, shares := range byDomain {
+		sort.Slice(shares, func(i, j int) bool {
+			if shares[i].count != shares[j].count {
+				return shares[i].count > shares[j].count
+			}
+			return shares[i].value < shares[j].value
+		})
+		total := 0
+		for _, s := range shares {
+			total += s.count
+		}
+		var parts []string
+		for _, s := range shares[:min(len(shares), 3)] {
+			parts = append(parts, fmt.Sprintf("%s %d%%", s.value, s.count*100/max(total, 1)))
+		}
+		summaries[domain] = strings.Join(parts, ", ")
+	}
+	return summaries, nil
+}
+
+// Write the domain report as an aligned table or CSV
+func writeDomainReport(out io.Writer, format string, reports []DomainReport) error {
+	header := []string{"domain", "senders", "messages", "flagged", "avg_score", "transactional", "spoof_suspects", "countries", "networks", "hosts", "breaches"}
+
+	switch format {
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f\t%d\t%d\t%s\t%s\t%s\t%s\n", r.Domain, r.Senders, r.Messages, r.Flagged, r.AvgScore,
+				r.Transactional, r.SpoofSuspects, r.Countries, r.Networks, r.Hosts, r.Breaches)
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range reports {
+			w.Write([]string{r.Domain, strconv.Itoa(r.Senders), strconv.Itoa(r.Messages), strconv.Itoa(r.Flagged),
+				strconv.FormatFloat(r.AvgScore, 'f', 1, 64), strconv.Itoa(r.Transactional),
+				strconv.Itoa(r.SpoofSuspects), r.Countries, r.Networks, r.Hosts, r.Breaches})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
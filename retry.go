@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/emersion/go-imap/client"
+)
+
+// Failed ranges are retried automatically at the end of a scan until this many attempts
+const maxAutoRetries = 3
+
+// FailedRange structure for a batch that could not be processed
+type FailedRange struct {
+	ID       int64
+	StartUID uint32
+	EndUID   uint32
+	Attempts int
+	Error    string
+}
+
+// Record a failed batch range for later retry
+func recordFailedRange(db *sql.DB, folder string, uidValidity, startUID, endUID uint32, cause error) error {
+	_, err := db.Exec(`
+		INSERT INTO failed_ranges (folder, uid_validity, start_uid, end_uid, error) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(folder, uid_validity, start_uid, end_uid) DO UPDATE SET
+			error = excluded.error, attempts = attempts + 1, last_attempt = CURRENT_TIMESTAMP`,
+		folder, uidValidity, startUID, endUID, cause.Error())
+	if err == nil {
+		log.Printf("Failed range recorded: %s UID %d-%d", folder, startUID, endUID)
+	}
+	return err
+}
+
+// Load failed ranges of a folder, optionally limited to fewer attempts than maxAttempts
+func loadFailedRanges(db *sql.DB, folder string, uidValidity uint32, maxAttempts int) ([]FailedRange, error) {
+	query := `
+		SELECT id, start_uid, end_uid, attempts, COALESCE(error, '')
+		FROM failed_ranges WHERE folder = ? AND uid_validity = ?`
+	args := []any{folder, uidValidity}
+	if maxAttempts > 0 {
+		query += " AND attempts < ?"
+		args = append(args, maxAttempts)
+	}
+	query += " ORDER BY start_uid"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranges []FailedRange
+	for rows.Next() {
+		var r FailedRange
+		if err := rows.Scan(&r.ID, &r.StartUID, &r.EndUID, &r.Attempts, &r.Error); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// Drop failed ranges recorded under an older UIDVALIDITY
+func clearStaleFailedRanges(db *sql.DB, folder string, uidValidity uint32) {
+	result, err := db.Exec("DELETE FROM failed_ranges WHERE folder = ? AND uid_validity != ?", folder, uidValidity)
+	if err != nil {
+		log.Printf("Failed to clear stale failed ranges: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Cleared %d failed ranges from previous UIDVALIDITY", n)
+	}
+}
+
+// Retry failed ranges of the selected folder, returning recovered and remaining counts
+func retryFailedRanges(ctx context.Context, c *client.Client, config *Config, db *sql.DB, progress *Progress, folder string, maxAttempts int) (int, int) {
+	ranges, err := loadFailedRanges(db, folder, progress.UIDValidity, maxAttempts)
+	if err != nil {
+		log.Printf("Failed to load failed ranges: %v", err)
+		return 0, 0
+	}
+
+	recovered := 0
+	for _, r := range ranges {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("Retrying failed range: UID %d-%d (attempt %d)", r.StartUID, r.EndUID, r.Attempts+1)
+
+		journaled, err := loadJournal(db, folder, progress.UIDValidity, r.StartUID, r.EndUID)
+		if err != nil {
+			log.Printf("Failed to load UID journal: %v", err)
+			continue
+		}
+		batchCtx, cancel := batchContext(ctx, config)
+		result, err := processBatch(batchCtx, c, config, r.StartUID, r.EndUID, journaled, nil)
+		if batchCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("batch timed out after %v", config.BatchTimeout)
+		}
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			if err := recordFailedRange(db, folder, progress.UIDValidity, r.StartUID, r.EndUID, err); err != nil {
+				log.Printf("Failed to update failed range: %v", err)
+			}
+			if imapClosed(c) {
+				log.Printf("Connection closed, the remaining failed ranges wait for the next retry")
+				break
+			}
+			continue
+		}
+
+		next := *progress
+		next.ProcessedCount += uint32(len(result.UIDs))
+		next.OversizedCount += uint32(result.Oversized)
+		if _, err := storeBatchResult(ctx, db, config, folder, progress.UIDValidity, result, &next); err != nil {
+			log.Printf("Batch save error: %v", err)
+			continue
+		}
+		*progress = next
+
+		if _, err := db.Exec("DELETE FROM failed_ranges WHERE id = ?", r.ID); err != nil {
+			log.Printf("Failed to remove recovered range: %v", err)
+		}
+		recovered++
+	}
+
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM failed_ranges WHERE folder = ? AND uid_validity = ?",
+		folder, progress.UIDValidity).Scan(&remaining)
+
+	return recovered, remaining
+}
+
+// Run the retry command
+func runRetry(args []string) {
+	if code := retry(args); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// Retry under the lock and return the exit code, so the deferred cleanup runs before exiting
+func retry(args []string) int {
+	config := &Config{}
+	parseFlags(scanFlags(config), config, args)
+	if config.Tail {
+		startTail(config)
+	}
+
+	setupLogging(config)
+	lock, err := takeLock(config)
+	if err != nil {
+		return exitCode(err)
+	}
+	defer lock.Release()
+	ctx, stop := interruptContext()
+	defer stop()
+	db, err := openDB(config)
+	if err != nil {
+		return exitDatabase
+	}
+	defer db.Close()
+
+	writeStatus(config.StatusPath, "RUNNING", "Retrying failed ranges")
+
+	config.Pool = newIMAPPool(config)
+	defer config.Pool.close()
+	err = retryFailed(ctx, config, db)
+	if ctx.Err() != nil {
+		return reportInterrupted(config)
+	}
+	if exitCode(err) == exitPartial {
+		partialMsg := fmt.Sprintf("Failed ranges retried: %v", err)
+		writeStatus(config.StatusPath, "PARTIAL", partialMsg)
+		notifyResult(config, "finished with errors", partialMsg)
+		return exitPartial
+	}
+	if err != nil {
+		errorMsg := fmt.Sprintf("Retry error: %v", err)
+		log.Printf("Retry error: %v", err)
+		fmt.Printf("❌ %s\n", errorMsg)
+		writeStatus(config.StatusPath, "ERROR", errorMsg)
+		notifyResult(config, "failed", errorMsg)
+		return exitCode(err)
+	}
+
+	writeStatus(config.StatusPath, "SUCCESS", "Failed ranges retried")
+	notifyResult(config, "finished", "Failed ranges retried")
+	return 0
+}
+
+// Connect and retry every failed range of the scanned folder
+func retryFailed(ctx context.Context, config *Config, db *sql.DB) error {
+	progress, err := loadProgress(db, config.Folder)
+	if err != nil {
+		return withExitCode(exitDatabase, fmt.Errorf("failed to load progress: %v", err))
+	}
+
+	c, err := config.Pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer config.Pool.put(c)
+	defer closeOnCancel(ctx, c)()
+
+	mbox, err := c.Select(config.Folder, true)
+	if err != nil {
+		return withExitCode(exitMailbox, fmt.Errorf("failed to select %s: %v", config.Folder, err))
+	}
+
+	if mbox.UidValidity != progress.UIDValidity {
+		clearStaleFailedRanges(db, config.Folder, mbox.UidValidity)
+		clearStaleJournal(db, config.Folder, mbox.UidValidity)
+		clearStaleMessageSenders(db, config.Folder, mbox.UidValidity)
+		fmt.Println("Mailbox UIDVALIDITY changed since the last scan; run a scan instead.")
+		return nil
+	}
+
+	if config.Counted == nil {
+		config.Counted = newCountedMessages(db)
+	}
+	recovered, remaining := retryFailedRanges(ctx, c, config, db, progress, config.Folder, 0)
+	log.Printf("Retry completed: %d recovered, %d remaining", recovered, remaining)
+	fmt.Printf("✅ Retry completed: %d ranges recovered, %d remaining\n", recovered, remaining)
+	if remaining > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d failed ranges remain", remaining))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Error classes of the retry policy
+const (
+	errorNetwork  = "network"  // server unreachable, connection dropped or timed out
+	errorAuth     = "auth"     // login rejected
+	errorProtocol = "protocol" // NO or BAD response, unparsable reply
+	errorBusy     = "busy"     // database locked by another connection
+)
+
+// Default retry policy: network errors and a busy database are retried 4 times,
+// waiting 250ms, 500ms, 1s and 2s
+const (
+	defaultMaxRetries  = 4
+	defaultBackoffBase = 250 * time.Millisecond
+	defaultBackoffCap  = 30 * time.Second
+)
+
+// Parts of error messages of a lost or unreachable connection, for errors that
+// were formatted instead of wrapped
+var networkErrorMarkers = []string{
+	"connection closed", "connection reset", "connection refused", "broken pipe",
+	"i/o timeout", "no route to host", "network is unreachable", "use of closed network connection", "EOF",
+}
+
+// RetryConfig structure for the "retry" section of the config file
+type RetryConfig struct {
+	// Retries after the first attempt, 0 turns retrying off
+	MaxRetries *int `json:"max_retries"`
+	// Wait before the first retry, doubled after each attempt up to the cap
+	BackoffBase string `json:"backoff_base"`
+	BackoffCap  string `json:"backoff_cap"`
+	// Error classes retried: network, auth, protocol and/or busy
+	RetryOn []string `json:"retry_on"`
+}
+
+// RetryPolicy structure for how connects, fetches and database writes are retried
+type RetryPolicy struct {
+	MaxRetries  int
+	BackoffBase time.Duration
+	BackoffCap  time.Duration
+	RetryOn     []string
+}
+
+// Retry policy used without a "retry" section
+func defaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:  defaultMaxRetries,
+		BackoffBase: defaultBackoffBase,
+		BackoffCap:  defaultBackoffCap,
+		RetryOn:     []string{errorNetwork, errorBusy},
+	}
+}
+
+// Check the retry section of the config file and fill in the defaults
+func compileRetryPolicy(r *RetryConfig) (*RetryPolicy, error) {
+	policy := defaultRetryPolicy()
+	if r.MaxRetries != nil {
+		if *r.MaxRetries < 0 {
+			return nil, fmt.Errorf("retry: max_retries must not be negative")
+		}
+		policy.MaxRetries = *r.MaxRetries
+	}
+	for _, setting := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"backoff_base", r.BackoffBase, &policy.BackoffBase},
+		{"backoff_cap", r.BackoffCap, &policy.BackoffCap},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("retry: invalid %s %q (e.g. 500ms, 1m)", setting.name, setting.value)
+		}
+		*setting.dest = d
+	}
+	if policy.BackoffCap < policy.BackoffBase {
+		return nil, fmt.Errorf("retry: backoff_cap %v is below backoff_base %v", policy.BackoffCap, policy.BackoffBase)
+	}
+	if r.RetryOn != nil {
+		policy.RetryOn = nil
+		for _, class := range r.RetryOn {
+			class = strings.ToLower(strings.TrimSpace(class))
+			switch class {
+			case errorNetwork, errorAuth, errorProtocol, errorBusy:
+				policy.RetryOn = append(policy.RetryOn, class)
+			default:
+				return nil, fmt.Errorf("retry: unknown error class %q (use network, auth, protocol or busy)", class)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Class of an IMAP error: connection failures are network errors, rejected logins
+// auth errors and anything else the server answered protocol errors
+func imapErrorClass(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+	switch exitCode(err) {
+	case exitAuth:
+		return errorAuth
+	case exitConnection:
+		return errorNetwork
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return errorNetwork
+	}
+	message := err.Error()
+	for _, marker := range networkErrorMarkers {
+		if strings.Contains(message, marker) {
+			return errorNetwork
+		}
+	}
+	return errorProtocol
+}
+
+// Class of a database write error: only a busy database is worth another attempt
+func writeErrorClass(err error) string {
+	if isBusyError(err) {
+		return errorBusy
+	}
+	return ""
+}
+
+// Wait before the next attempt of an operation that failed with err; false when
+// the error class is not retried, the retries are used up or ctx was cancelled
+func (p *RetryPolicy) backoff(ctx context.Context, what string, class string, attempt int, err error) bool {
+	if p == nil {
+		p = defaultRetryPolicy()
+	}
+	if class == "" || !slices.Contains(p.RetryOn, class) || attempt > p.MaxRetries {
+		return false
+	}
+	delay := p.BackoffBase << (attempt - 1)
+	if delay > p.BackoffCap || delay < p.BackoffBase {
+		delay = p.BackoffCap
+	}
+	log.Printf("%s: %s error, retrying in %v (retry %d/%d): %v", what, class, delay, attempt, p.MaxRetries, err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run an operation, retrying the error classes of the policy with backoff
+func (p *RetryPolicy) run(ctx context.Context, what string, classify func(error) string, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !p.backoff(ctx, what, classify(err), attempt, err) {
+			return err
+		}
+	}
+}
+
+// Run a database write, retrying while the database stays busy
+func retryWrite(ctx context.Context, config *Config, what string, write func() error) error {
+	return config.Retry.run(ctx, what, writeErrorClass, write)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+)
+
+// Score weights, adding up to 100
+const (
+	scoreFrequencyWeight = 35
+	scoreRecencyWeight   = 25
+	scoreReplyWeight     = 30
+	scorePersonalWeight  = 10
+)
+
+const (
+	// Message count that earns the full frequency score
+	scoreFrequencyCap = 50
+	// Replies that earn the full reply score
+	scoreReplyCap = 3
+	// Days after which the recency score halves
+	scoreRecencyHalfLife = 90
+)
+
+// SenderStats structure for per-sender message counters collected during a scan
+type SenderStats struct {
+	Messages      int
+	Answered      int
+	Seen          int
+	Flagged       int
+	Invites       int
+	Bulk          int
+	Transactional int
+	Misaligned    int
+	ReturnPath    string
+	DKIMDomain    string
+	Organization  string
+	Unsubscribe   string
+	AuthResults   string
+	Mailers       map[string]int
+	IPs           map[string]int
+	Aliases       map[string]int
+	Labels        map[string]int
+	Subjects      []string
+	FirstSeen     time.Time
+	LastSeen      time.Time
+}
+
+// Check if a message was sent by a mailing list or bulk mailer
+func isBulkMessage(header message.Header) bool {
+	if header.Get("List-Unsubscribe") != "" || header.Get("List-Id") != "" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(header.Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		return true
+	}
+	autoSubmitted := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted")))
+	return autoSubmitted != "" && autoSubmitted != "no"
+}
+
+// Unsubscribe link of a List-Unsubscribe header, preferring a web link to a mailto: address
+func unsubscribeLink(header message.Header) string {
+	var mailto string
+	for _, part := range strings.Split(header.Get("List-Unsubscribe"), ",") {
+		link := strings.Trim(strings.TrimSpace(part), "<>")
+		switch {
+		case strings.HasPrefix(strings.ToLower(link), "https://"), strings.HasPrefix(strings.ToLower(link), "http://"):
+			return link
+		case strings.HasPrefix(strings.ToLower(link), "mailto:") && mailto == "":
+			mailto = link
+		}
+	}
+	return mailto
+}
+
+// Count a message with its IMAP flags and Gmail labels for a sender in the batch statistics
+func countSenderMessage(result *BatchResult, sender EmailSender, flags, labels []string, date time.Time) {
+	if result.Stats == nil {
+		result.Stats = make(map[string]*SenderStats)
+	}
+	stats, ok := result.Stats[sender.Email]
+	if !ok {
+		stats = &SenderStats{}
+		result.Stats[sender.Email] = stats
+	}
+
+	stats.Messages++
+	if slices.Contains(flags, imap.AnsweredFlag) {
+		stats.Answered++
+	}
+	if slices.Contains(flags, imap.SeenFlag) {
+		stats.Seen++
+	}
+	if slices.Contains(flags, imap.FlaggedFlag) {
+		stats.Flagged++
+	}
+	if sender.Bulk {
+		stats.Bulk++
+	}
+	if sender.Invite {
+		stats.Invites++
+	}
+	if sender.Transactional {
+		stats.Transactional++
+	}
+	if sender.Misaligned {
+		stats.Misaligned++
+	}
+	if sender.ReturnPath != "" {
+		stats.ReturnPath = sender.ReturnPath
+	}
+	if sender.DKIMDomain != "" {
+		stats.DKIMDomain = sender.DKIMDomain
+	}
+	if sender.Organization != "" {
+		stats.Organization = sender.Organization
+	}
+	if sender.Unsubscribe != "" {
+		stats.Unsubscribe = sender.Unsubscribe
+	}
+	if sender.AuthResults != "" {
+		stats.AuthResults = sender.AuthResults
+	}
+	if sender.Mailer != "" {
+		if stats.Mailers == nil {
+			stats.Mailers = make(map[string]int)
+		}
+		stats.Mailers[sender.Mailer]++
+	}
+	if sender.SendingIP != "" {
+		if stats.IPs == nil {
+			stats.IPs = make(map[string]int)
+		}
+		stats.IPs[sender.SendingIP]++
+	}
+	if sender.DeliveredTo != "" {
+		if stats.Aliases == nil {
+			stats.Aliases = make(map[string]int)
+		}
+		stats.Aliases[sender.DeliveredTo]++
+	}
+	for _, label := range labels {
+		if stats.Labels == nil {
+			stats.Labels = make(map[string]int)
+		}
+		stats.Labels[label]++
+	}
+	addSubject(stats, sender.Subject)
+	if !date.IsZero() && (stats.FirstSeen.IsZero() || date.Before(stats.FirstSeen)) {
+		stats.FirstSeen = date
+	}
+	if date.After(stats.LastSeen) {
+		stats.LastSeen = date
+	}
+}
+
+// Add batch statistics to the sender rows
+func saveSenderStats(tx *sql.Tx, stats map[string]*SenderStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`
+		UPDATE senders SET
+			message_count = message_count + ?,
+			answered_count = answered_count + ?,
+			seen_count = seen_count + ?,
+			flags_count = flags_count + ?,
+			flagged_count = flagged_count + ?,
+			bulk_count = bulk_count + ?,
+			transactional_count = transactional_count + ?,
+			invite_count = invite_count + ?,
+			misaligned_count = misaligned_count + ?,
+			return_path = COALESCE(NULLIF(?, ''), return_path),
+			dkim_domain = COALESCE(NULLIF(?, ''), dkim_domain),
+			organization = COALESCE(NULLIF(?, ''), organization),
+			unsubscribe = COALESCE(NULLIF(?, ''), unsubscribe),
+			auth_results = COALESCE(NULLIF(?, ''), auth_results),
+			last_seen_at = MAX(COALESCE(last_seen_at, ''), ?),
+			first_seen_at = COALESCE(MIN(NULLIF(first_seen_at, ''), NULLIF(?, '')), NULLIF(first_seen_at, ''), NULLIF(?, ''))
+		WHERE email = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for email, s := range stats {
+		firstSeen, lastSeen := "", ""
+		if !s.FirstSeen.IsZero() {
+			firstSeen = s.FirstSeen.UTC().Format(time.DateTime)
+		}
+		if !s.LastSeen.IsZero() {
+			lastSeen = s.LastSeen.UTC().Format(time.DateTime)
+		}
+		if _, err := stmt.Exec(s.Messages, s.Answered, s.Seen, s.Messages, s.Flagged, s.Bulk, s.Transactional, s.Invites, s.Misaligned, s.ReturnPath, s.DKIMDomain, s.Organization,
+			s.Unsubscribe, s.AuthResults, lastSeen, firstSeen, firstSeen, email); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compute a 0-100 importance score from frequency, recency, replies and bulk ratio
+//
+// Replies are the larger of answered messages and replies counted in the Sent folder;
+// flagged messages count like answered ones.
+func senderScore(messages, answered, flagged, bulk int, daysSinceSeen float64) float64 {
+	if messages == 0 {
+		return 0
+	}
+
+	frequency := math.Min(1, math.Log1p(float64(messages))/math.Log1p(scoreFrequencyCap))
+	recency := 0.0
+	if daysSinceSeen >= 0 {
+		recency = math.Pow(0.5, daysSinceSeen/scoreRecencyHalfLife)
+	}
+	reply := math.Min(1, float64(answered+flagged)/scoreReplyCap)
+	personal := 1 - float64(bulk)/float64(messages)
+
+	score := frequency*scoreFrequencyWeight + recency*scoreRecencyWeight +
+		reply*scoreReplyWeight + personal*scorePersonalWeight
+	return math.Round(score*10) / 10
+}
+
+// Recompute the stored score of every sender
+func updateSenderScores(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT s.id, s.message_count, MAX(s.answered_count, COALESCE(r.reply_count, 0)),
+			COALESCE(s.flagged_count, 0), s.bulk_count,
+			COALESCE(julianday('now') - julianday(NULLIF(s.last_seen_at, '')), -1)
+		FROM senders s LEFT JOIN replies r ON r.email = s.email`)
+	if err != nil {
+		return err
+	}
+
+	scores := make(map[int64]float64)
+	for rows.Next() {
+		var id int64
+		var messages, answered, flagged, bulk int
+		var days float64
+		if err := rows.Scan(&id, &messages, &answered, &flagged, &bulk, &days); err != nil {
+			rows.Close()
+			return err
+		}
+		scores[id] = senderScore(messages, answered, flagged, bulk, days)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE senders SET score = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for id, score := range scores {
+		if _, err := stmt.Exec(score, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Sender scores updated: %d senders", len(scores))
+	return nil
+}
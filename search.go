@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+// Matches scoring below this are not shown
+const minSearchScore = 0.5
+
+// SearchMatch structure for a sender or domain matching a search
+type SearchMatch struct {
+	Name     string
+	Email    string
+	Domain   string
+	Field    string
+	Score    float64
+	Senders  int
+	Messages int
+	LastSeen string
+}
+
+// Run the search command
+func runSearch(args []string) {
+	var query string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		query, args = args[0], args[1:]
+	}
+
+	config := &Config{}
+	var limit int
+	var includeIgnored bool
+	fs := accountFlags("search", config)
+	fs.IntVar(&limit, "limit", 20, "Maximum number of senders and domains shown (0 = all)")
+	fs.BoolVar(&includeIgnored, "include-ignored", false, "Include ignored senders")
+	parseLocalFlags(fs, config, args)
+	if query == "" {
+		query = strings.Join(fs.Args(), " ")
+	}
+	if strings.TrimSpace(query) == "" {
+		fmt.Println("❌ Error: search requires a query, e.g. peep search \"acme\"")
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	senders, domains, err := searchSenders(db, query, includeIgnored)
+	if err != nil {
+		log.Printf("Search error: %v", err)
+		fmt.Printf("❌ Search error: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	log.Printf("Search %q: %d senders, %d domains", query, len(senders), len(domains))
+
+	if len(senders) == 0 && len(domains) == 0 {
+		fmt.Printf("No matches for %q\n", query)
+		return
+	}
+	if limit > 0 {
+		senders = senders[:min(len(senders), limit)]
+		domains = domains[:min(len(domains), limit)]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(domains) > 0 {
+		fmt.Fprintln(w, "DOMAIN\tSENDERS\tMESSAGES\tLAST SEEN")
+		for _, d := range domains {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", d.Domain, d.Senders, d.Messages, lastSeenDate(d.LastSeen))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(senders) > 0 {
+		fmt.Fprintln(w, "NAME\tEMAIL\tMATCH\tMESSAGES\tLAST SEEN")
+		for _, s := range senders {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", s.Name, s.Email, s.Field, s.Messages, lastSeenDate(s.LastSeen))
+		}
+	}
+	w.Flush()
+}
+
+// Find senders whose name, email, domain or recent subjects resemble the query, plus the matching
+// domains, best first; the full-text index narrows the candidates unless it finds nothing (typos)
+func searchSenders(db *sql.DB, query string, includeIgnored bool) ([]SearchMatch, []SearchMatch, error) {
+	columns := `COALESCE(s.full_name, ''), s.email, s.message_count, COALESCE(s.last_seen_at, ''), COALESCE(s.subjects, '')`
+	where := ""
+	if !includeIgnored {
+		where = " WHERE " + notIgnoredCondition("s.email")
+	}
+	if match := searchIndexQuery(query); match != "" {
+		rows, err := db.Query(`
+			SELECT `+columns+`
+			FROM (SELECT rowid FROM sender_fts WHERE sender_fts MATCH ? ORDER BY rank LIMIT ?) AS hits
+			JOIN senders s ON s.id = hits.rowid`+where, match, maxSearchCandidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		senders, domains, err := rankSearchRows(rows, query)
+		if err != nil || len(senders) > 0 {
+			return senders, domains, err
+		}
+	}
+
+	rows, err := db.Query(`SELECT ` + columns + ` FROM senders s` + where)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rankSearchRows(rows, query)
+}
+
+// Score sender rows against the query, closing the rows
+func rankSearchRows(rows *sql.Rows, query string) ([]SearchMatch, []SearchMatch, error) {
+	defer rows.Close()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var senders []SearchMatch
+	domains := make(map[string]*SearchMatch)
+	for rows.Next() {
+		var s SearchMatch
+		var subjects string
+		if err := rows.Scan(&s.Name, &s.Email, &s.Messages, &s.LastSeen, &subjects); err != nil {
+			return nil, nil, err
+		}
+		local, domain, _ := strings.Cut(strings.ToLower(s.Email), "@")
+		s.Domain = domain
+
+		fields := []struct{ name, text string }{{"name", s.Name}, {"email", local}, {"domain", domain}}
+		for _, subject := range strings.Split(subjects, "\n") {
+			fields = append(fields, struct{ name, text string }{"subject", subject})
+		}
+		for _, field := range fields {
+			if score := fuzzyScore(query, field.text); score > s.Score {
+				s.Score, s.Field = score, field.name
+			}
+		}
+		if s.Score >= minSearchScore {
+			senders = append(senders, s)
+		}
+
+		if score := fuzzyScore(query, domain); score >= minSearchScore {
+			d, ok := domains[domain]
+			if !ok {
+				d = &SearchMatch{Domain: domain, Field: "domain", Score: score}
+				domains[domain] = d
+			}
+			d.Senders++
+			d.Messages += s.Messages
+			d.LastSeen = max(d.LastSeen, s.LastSeen)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var domainMatches []SearchMatch
+	for _, d := range domains {
+		domainMatches = append(domainMatches, *d)
+	}
+	sortSearchMatches(senders)
+	sortSearchMatches(domainMatches)
+	return senders, domainMatches, nil
+}
+
+// Order matches by score, then by message count
+func sortSearchMatches(matches []SearchMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].Messages != matches[j].Messages {
+			return matches[i].Messages > matches[j].Messages
+		}
+		return matches[i].Email+matches[i].Domain < matches[j].Email+matches[j].Domain
+	})
+}
+
+// Score how well text matches a lower-case query, from 0 (no match) to 1 (exact):
+// substrings score highest, then letters in order ("acm" in "a.c.me"), then words within a few typos
+func fuzzyScore(query, text string) float64 {
+	text = strings.ToLower(text)
+	switch {
+	case query == "" || text == "":
+		return 0
+	case text == query:
+		return 1
+	case strings.HasPrefix(text, query):
+		return 0.95
+	case strings.Contains(text, query):
+		return 0.9
+	}
+
+	best := 0.0
+	if span := subsequenceSpan(query, text); span > 0 && span <= 2*len([]rune(query)) {
+		// Letters far apart are a weaker match than letters close together
+		best = 0.5 + 0.3*float64(len([]rune(query)))/float64(span)
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, word := range append(words, text) {
+		distance := editDistance(query, word)
+		similarity := 1 - float64(distance)/float64(max(len([]rune(query)), len([]rune(word))))
+		if distance <= max(1, len([]rune(query))/4) {
+			best = max(best, 0.8*similarity)
+		}
+	}
+	return best
+}
+
+// Length of the shortest stretch of text containing the letters of query in order, 0 if none
+func subsequenceSpan(query, text string) int {
+	q, t := []rune(query), []rune(text)
+	shortest := 0
+	for start := range t {
+		if t[start] != q[0] {
+			continue
+		}
+		i := 0
+		for end := start; end < len(t); end++ {
+			if t[end] == q[i] {
+				i++
+				if i == len(q) {
+					if span := end - start + 1; shortest == 0 || span < shortest {
+						shortest = span
+					}
+					break
+				}
+			}
+		}
+	}
+	return shortest
+}
+
+// Edit distance between two strings, counting swapped neighbouring letters as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+// Date part of a stored last-seen timestamp
+func lastSeenDate(lastSeen string) string {
+	if lastSeen == "" {
+		return "-"
+	}
+	return lastSeen[:min(len(lastSeen), len(time.DateOnly))]
+}
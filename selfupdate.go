@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ed25519 public key (base64) that release checksums must be signed with;
+// set at build time with -ldflags "-X main.updatePublicKey=..."
+var updatePublicKey = ""
+
+const (
+	// Repository whose releases self-update installs
+	updateRepo = "emir/Peep"
+	// Checksum file attached to every release (sha256sum format)
+	checksumAsset = "checksums.txt"
+	// Largest release asset downloaded
+	maxUpdateSize = 200 << 20
+)
+
+// Release structure for the GitHub releases API
+type Release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset structure for one file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Run the self-update command
+func runSelfUpdate(args []string) {
+	var checkOnly, force, insecure bool
+	var repo, tag string
+
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.BoolVar(&checkOnly, "check", false, "Only report whether an update is available")
+	fs.BoolVar(&force, "force", false, "Install even if the release is not newer (or this is a dev build)")
+	fs.StringVar(&repo, "repo", updateRepo, "GitHub repository (owner/name)")
+	fs.StringVar(&tag, "version", "", "Install this release tag instead of the latest")
+	fs.BoolVar(&insecure, "insecure", false, "Install without a release signing key, trusting the checksum file of the release")
+	fs.Parse(args)
+
+	// Without a signing key nothing ties another repository's releases to this project
+	if repo != updateRepo && updatePublicKey == "" {
+		fmt.Println("❌ Error: -repo needs a build with a release signing key (main.updatePublicKey)")
+		os.Exit(exitUsage)
+	}
+	if err := selfUpdate(repo, tag, checkOnly, force, insecure); err != nil {
+		log.Printf("Self-update error: %v", err)
+		fmt.Printf("❌ Self-update error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// Check for a newer release and replace the running binary with it
+func selfUpdate(repo, tag string, checkOnly, force, insecure bool) error {
+	release, err := fetchRelease(repo, tag)
+	if err != nil {
+		return withExitCode(exitConnection, err)
+	}
+
+	current := buildInfo().Version
+	newer := compareVersions(release.TagName, current) > 0
+	fmt.Printf("Current version: %s\n", current)
+	fmt.Printf("Latest release:  %s\n", release.TagName)
+	if checkOnly {
+		if newer {
+			fmt.Println("⚠️  An update is available. Run 'peep self-update' to install it.")
+		} else {
+			fmt.Println("✅ Up to date")
+		}
+		return nil
+	}
+	if current == "dev" && !force {
+		return fmt.Errorf("this is a development build; use -force to replace it with %s", release.TagName)
+	}
+	if !newer && !force {
+		fmt.Println("✅ Already up to date")
+		return nil
+	}
+	// The checksum file comes from the same release as the binary, so alone it only
+	// catches corrupted downloads, not a replaced release
+	if updatePublicKey == "" && !insecure {
+		return withExitCode(exitUsage, fmt.Errorf("this build has no release signing key, so %s can't be verified; "+
+			"use -insecure to trust its checksum file alone, or install a signed release build", release.TagName))
+	}
+
+	name := releaseAssetName()
+	binaryURL, checksumURL, signatureURL := "", "", ""
+	for _, asset := range release.Assets {
+		switch asset.Name {
+		case name:
+			binaryURL = asset.URL
+		case checksumAsset:
+			checksumURL = asset.URL
+		case checksumAsset + ".sig":
+			signatureURL = asset.URL
+		}
+	}
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no %s asset", release.TagName, name)
+	}
+	if checksumURL == "" {
+		return fmt.Errorf("release %s has no %s; refusing to install an unverified binary", release.TagName, checksumAsset)
+	}
+
+	checksums, err := download(checksumURL)
+	if err != nil {
+		return withExitCode(exitConnection, err)
+	}
+	if updatePublicKey != "" {
+		if signatureURL == "" {
+			return fmt.Errorf("release %s is not signed", release.TagName)
+		}
+		signature, err := download(signatureURL)
+		if err != nil {
+			return withExitCode(exitConnection, err)
+		}
+		if err := verifySignature(checksums, signature); err != nil {
+			return err
+		}
+		fmt.Println("✅ Checksum signature verified")
+	} else {
+		fmt.Println("⚠️  No release signing key built in (-insecure); verifying the checksum only")
+	}
+
+	expected, err := checksumFor(checksums, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Downloading %s...\n", name)
+	binary, err := download(binaryURL)
+	if err != nil {
+		return withExitCode(exitConnection, err)
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("checksum mismatch for %s", name)
+	}
+
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		return err
+	}
+
+	log.Printf("Self-update: %s -> %s (%s)", current, release.TagName, exe)
+	fmt.Printf("✅ Updated %s to %s\n", exe, release.TagName)
+	return nil
+}
+
+// Fetch the latest release, or the release with the given tag
+func fetchRelease(repo, tag string) (*Release, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repo)
+	if tag != "" {
+		url = fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", repo, tag)
+	}
+
+	data, err := download(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release: %v", err)
+	}
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %v", err)
+	}
+	return &release, nil
+}
+
+// Download a URL into memory, up to maxUpdateSize bytes
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, "https://api.github.com/") {
+		req.Header.Set("Authorization", "Bearer "+logSecret(token))
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpdateSize {
+		return nil, fmt.Errorf("GET %s: response too large", url)
+	}
+	return data, nil
+}
+
+// Asset name of the binary for this platform (peep_linux_amd64, peep_windows_amd64.exe)
+func releaseAssetName() string {
+	name := fmt.Sprintf("peep_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Look up the SHA-256 of a file in sha256sum output
+func checksumFor(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", name, checksumAsset)
+}
+
+// Verify the Ed25519 signature (raw or base64) of the checksum file
+func verifySignature(checksums, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid built-in release signing key")
+	}
+	if len(signature) != ed25519.SignatureSize {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err == nil {
+			signature = decoded
+		}
+	}
+	if !ed25519.Verify(key, checksums, signature) {
+		return fmt.Errorf("checksum signature verification failed")
+	}
+	return nil
+}
+
+// Replace the executable with a new binary via a temporary file in the same directory
+func replaceExecutable(exe string, binary []byte) error {
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, ".peep-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s (run with permission to replace the binary): %v", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	// A running executable cannot be overwritten on Windows, but it can be renamed
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return fmt.Errorf("failed to move the current binary aside: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Rename(old, exe)
+		return fmt.Errorf("failed to install the new binary: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// Compare two versions like v1.2.10 and 1.3.0; non-numeric parts compare as 0
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(strings.SplitN(a, "-", 2)[0], "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(strings.SplitN(b, "-", 2)[0], "v"), ".")
+	for i := range max(len(partsA), len(partsB)) {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
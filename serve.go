@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Limits of the query API
+const (
+	maxRemoteRequest = 1 << 20
+	defaultMaxRows   = 100000
+)
+
+// ServeOptions structure for the serve command
+type ServeOptions struct {
+	Listen   string
+	DataDir  string
+	Layout   string
+	TokenEnv string
+	TLSCert  string
+	TLSKey   string
+	MaxRows  int
+
+	// Scans of the mailboxes enrolled by tenants
+	ScanInterval time.Duration
+	Workers      int
+}
+
+// queryServer structure for the API answering the queries of -remote clients on
+// the databases below the data directory, opened read-only once and kept open
+type queryServer struct {
+	opts     ServeOptions
+	layout   PathLayout
+	token    string
+	registry *tenantRegistry
+
+	mu  sync.Mutex
+	dbs map[string]*sql.DB
+}
+
+// Run the serve command
+func runServe(args []string) {
+	opts := ServeOptions{}
+	var logStdout, showHelp bool
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&opts.Listen, "listen", "127.0.0.1:8421", "Address to listen on")
+	fs.StringVar(&opts.DataDir, "data-dir", "", "Root directory of the databases")
+	fs.StringVar(&opts.Layout, "layout", "", "File layout: user or flat")
+	fs.StringVar(&opts.TokenEnv, "token-env", "PEEP_SERVE_TOKEN", "Environment variable holding the token clients must send")
+	fs.StringVar(&opts.TLSCert, "tls-cert", "", "TLS certificate file (serve HTTPS)")
+	fs.StringVar(&opts.TLSKey, "tls-key", "", "TLS private key file")
+	fs.IntVar(&opts.MaxRows, "max-rows", defaultMaxRows, "Maximum rows of one query")
+	fs.DurationVar(&opts.ScanInterval, "scan-interval", time.Hour, "Time between scans of the mailboxes enrolled by tenants (0: no scans)")
+	fs.IntVar(&opts.Workers, "workers", 4, "Mailboxes of a tenant scanned at a time")
+	fs.BoolVar(&logStdout, "log-stdout", false, "Write logs to stdout instead of a log file")
+	fs.Func("encrypt-to", "Encrypt the log to a public key from peep keygen", setArtifactRecipient)
+	fs.BoolFunc("redact-emails", "Replace email addresses in logs with ***@domain", setRedactEmails)
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.Parse(args)
+
+	if showHelp {
+		showUsage()
+		os.Exit(0)
+	}
+	layout, err := pathLayout(opts.Layout)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		fmt.Println("❌ Error: -tls-cert and -tls-key go together")
+		os.Exit(exitUsage)
+	}
+	if opts.ScanInterval != 0 && opts.ScanInterval < time.Minute {
+		fmt.Println("❌ Error: -scan-interval must be at least 1m, or 0")
+		os.Exit(exitUsage)
+	}
+	opts.Workers = max(opts.Workers, 1)
+	server := &queryServer{opts: opts, layout: layout, token: logSecret(os.Getenv(opts.TokenEnv)), dbs: make(map[string]*sql.DB)}
+	if server.token == "" && !loopbackAddress(opts.Listen) {
+		fmt.Printf("❌ Error: set $%s to a token before listening on %s; without one only local clients may connect\n", opts.TokenEnv, opts.Listen)
+		os.Exit(exitUsage)
+	}
+
+	logPath := filepath.Join(stateRoot(opts.DataDir), fmt.Sprintf("serve_log_%s.txt", time.Now().Format("2006-01-02")))
+	os.MkdirAll(filepath.Dir(logPath), 0755)
+	setupLogging(&Config{Command: "serve", LogPath: logPath, LogStdout: logStdout})
+	log.Printf("Serving %s on %s", dataRoot(opts.DataDir), opts.Listen)
+
+	// Without a writable registry or its key the server still answers queries, e.g. on backups
+	registryPath := filepath.Join(dataRoot(opts.DataDir), "serve.db")
+	key, err := tokenStoreKey(true)
+	if err == nil {
+		if server.registry, err = openTenantRegistry(registryPath, key); err != nil {
+			err = fmt.Errorf("%s can't be opened: %v", registryPath, err)
+		}
+	}
+	if err != nil {
+		log.Printf("Tenants disabled: %v", err)
+		fmt.Printf("⚠️  Tenants disabled, %v\n", err)
+	} else {
+		defer server.registry.db.Close()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/query", server.handleQuery)
+	server.handleTenants(mux)
+	httpServer := &http.Server{Addr: opts.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	scans := make(chan struct{})
+	go func() {
+		defer close(scans)
+		if server.registry != nil && opts.ScanInterval > 0 {
+			server.scanLoop(ctx)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	scheme := "http"
+	if opts.TLSCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("📡 Serving the databases of %s at %s://%s\n", dataRoot(opts.DataDir), scheme, opts.Listen)
+	if opts.TLSCert != "" {
+		err = httpServer.ListenAndServeTLS(opts.TLSCert, opts.TLSKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	stop()
+	// Stopping cancels the running scans, which keep their progress
+	<-scans
+	server.close()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server error: %v", err)
+		fmt.Printf("❌ Server error: %v\n", err)
+		os.Exit(exitConnection)
+	}
+	log.Printf("Server stopped")
+}
+
+// Whether a listen address only accepts local connections
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Answer one query
+func (s *queryServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authenticate(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, RemoteResult{Error: "invalid token"})
+		return
+	}
+	var request RemoteQuery
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRemoteRequest))
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, RemoteResult{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if err := checkReadOnlyQuery(request.SQL); err != nil {
+		writeJSON(w, http.StatusBadRequest, RemoteResult{Error: err.Error()})
+		return
+	}
+	args := make([]any, len(request.Args))
+	for i, arg := range request.Args {
+		value, err := decodeRemoteValue(arg)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, RemoteResult{Error: err.Error()})
+			return
+		}
+		args[i] = value
+	}
+
+	db, err := s.database(principal, request.User)
+	if err != nil {
+		log.Printf("Query of %s from %s: %v", request.User, r.RemoteAddr, err)
+		writeJSON(w, http.StatusNotFound, RemoteResult{Error: err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), remoteQueryTimeout)
+	defer cancel()
+	result, err := s.run(ctx, db, request.SQL, args)
+	if err != nil {
+		log.Printf("Query of %s from %s failed: %v", request.User, r.RemoteAddr, err)
+		writeJSON(w, http.StatusBadRequest, RemoteResult{Error: err.Error()})
+		return
+	}
+	log.Printf("Query of %s from %s: %d rows", request.User, r.RemoteAddr, len(result.Rows))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Read-only database of a user, opened on first use. Tenants read the mailboxes
+// they enrolled, the admin the databases below the data directory
+func (s *queryServer) database(principal servePrincipal, user string) (*sql.DB, error) {
+	if user == "" || strings.ContainsAny(user, `/\`) {
+		return nil, fmt.Errorf("invalid user %q", user)
+	}
+	path := s.layout.Paths(dataRoot(s.opts.DataDir), stateRoot(s.opts.DataDir), user).DBPath
+	if principal.tenant != "" {
+		if !s.registry.enrolled(principal.tenant, user) {
+			return nil, fmt.Errorf("no mailbox %s enrolled by %s", user, principal.tenant)
+		}
+		dir := s.tenantDir(principal.tenant)
+		path = s.layout.Paths(dir, dir, user).DBPath
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if db, ok := s.dbs[path]; ok {
+		return db, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no database for %s yet", user)
+	}
+	db, err := openReadOnlyDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("database of %s: %v", user, err)
+	}
+	s.dbs[path] = db
+	return db, nil
+}
+
+// Run a query, collecting at most -max-rows rows. The connection can attach no
+// database, so a query never reaches files other than the user's database
+func (s *queryServer) run(ctx context.Context, db *sql.DB, query string, args []any) (RemoteResult, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return RemoteResult{}, err
+	}
+	defer conn.Close()
+	if _, err := sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 0); err != nil {
+		return RemoteResult{}, err
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return RemoteResult{}, err
+	}
+	defer rows.Close()
+
+	result := RemoteResult{Rows: [][]any{}}
+	if result.Columns, err = rows.Columns(); err != nil {
+		return RemoteResult{}, err
+	}
+	for rows.Next() {
+		if len(result.Rows) == s.opts.MaxRows {
+			return RemoteResult{}, fmt.Errorf("more than %d rows, narrow the query", s.opts.MaxRows)
+		}
+		values := make([]any, len(result.Columns))
+		pointers := make([]any, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return RemoteResult{}, err
+		}
+		for i, value := range values {
+			values[i] = encodeRemoteValue(value)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// Close the open databases
+func (s *queryServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, db := range s.dbs {
+		db.Close()
+	}
+}
+
+// Write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
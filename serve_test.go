@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Server on a temporary data directory with a database for user, read by the
+// admin, and the same user enrolled by tenant acme; returns the tenant's token
+func newTestServer(t *testing.T, user string) (*queryServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	layout, err := pathLayout("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := openTenantRegistry(filepath.Join(dir, "serve.db"), make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { registry.db.Close() })
+	server := &queryServer{
+		opts:     ServeOptions{DataDir: dir, MaxRows: defaultMaxRows},
+		layout:   layout,
+		token:    "admin-token",
+		registry: registry,
+		dbs:      make(map[string]*sql.DB),
+	}
+	t.Cleanup(server.close)
+
+	token, err := registry.addTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.enroll("acme", AccountConfig{User: user, Pass: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []string{dir, server.tenantDir("acme")} {
+		path := layout.Paths(root, root, user).DBPath
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		db, err := initDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+	return server, token.Token
+}
+
+// Post a query and return the status and result
+func postQuery(t *testing.T, server *queryServer, token string, query RemoteQuery) (int, RemoteResult) {
+	t.Helper()
+	body, err := json.Marshal(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/v1/query", strings.NewReader(string(body)))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	server.handleQuery(recorder, request)
+
+	var result RemoteResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code, result
+}
+
+func TestServeQueryRejectsOtherDatabases(t *testing.T) {
+	const user = "john@example.com"
+	server, tenantToken := newTestServer(t, user)
+	registry := filepath.Join(server.opts.DataDir, "serve.db")
+
+	queries := []string{
+		"SELECT 1; ATTACH DATABASE '" + registry + "' AS o; SELECT hash FROM o.tenant_tokens",
+		"SELECT 1;\nATTACH '" + registry + "' AS o",
+		"SELECT ';' /* ; */; -- ;\nDETACH main",
+		"ATTACH DATABASE '" + registry + "' AS o",
+	}
+	for _, token := range []string{"admin-token", tenantToken} {
+		for _, sql := range queries {
+			status, result := postQuery(t, server, token, RemoteQuery{User: user, SQL: sql})
+			if status != http.StatusBadRequest {
+				t.Errorf("%q: status %d, want %d (%+v)", sql, status, http.StatusBadRequest, result)
+			}
+			if len(result.Rows) > 0 {
+				t.Errorf("%q: returned rows %v", sql, result.Rows)
+			}
+		}
+
+		status, result := postQuery(t, server, token, RemoteQuery{User: user, SQL: "SELECT ';' AS x; -- one statement\n"})
+		if status != http.StatusOK || len(result.Rows) != 1 {
+			t.Errorf("single statement: status %d, result %+v", status, result)
+		}
+	}
+}
+
+func TestEnrolledAccountsAreEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serve.db")
+	key := make([]byte, 32)
+	registry, err := openTenantRegistry(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.addTenant("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.enroll("acme", AccountConfig{User: "john@example.com", Pass: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	registry.db.Close()
+
+	if registry, err = openTenantRegistry(path, key); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := registry.mailboxes("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Pass != "hunter2" {
+		t.Errorf("mailboxes: %+v", accounts)
+	}
+	registry.db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("password stored in plaintext")
+	}
+
+	registry, err = openTenantRegistry(path, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.db.Close()
+	if _, err := registry.mailboxes("acme"); err == nil {
+		t.Error("mailboxes opened with another key")
+	}
+}
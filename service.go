@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServiceOptions structure for the service command
+type ServiceOptions struct {
+	Name         string
+	AccountsPath string
+	Dir          string
+	Interval     time.Duration
+	UserUnit     bool
+	LogStdout    bool
+	DryRun       bool
+	DataDir      string
+	Layout       string
+}
+
+// Run the service command
+func runService(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: service requires an action: install, uninstall, run")
+		os.Exit(1)
+	}
+	action, args := args[0], args[1:]
+
+	opts := ServiceOptions{}
+	var showHelp bool
+
+	fs := flag.NewFlagSet("service", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&opts.Name, "name", "peep", "Service name")
+	fs.StringVar(&opts.AccountsPath, "accounts", "accounts.json", "Accounts file path")
+	fs.StringVar(&opts.Dir, "dir", "", "Working directory of the service (default: current directory)")
+	fs.DurationVar(&opts.Interval, "interval", time.Hour, "Time between scans of all accounts")
+	fs.BoolVar(&opts.UserUnit, "user-unit", false, "Install a systemd user unit instead of a system unit")
+	fs.BoolVar(&opts.LogStdout, "log-stdout", false, "Write logs to stdout instead of a log file")
+	fs.StringVar(&opts.DataDir, "data-dir", "", "Root directory for databases, logs and status files")
+	fs.StringVar(&opts.Layout, "layout", "", "File layout: user or flat")
+	fs.Func("encrypt-to", "Encrypt logs and status files to a public key from peep keygen", setArtifactRecipient)
+	fs.BoolFunc("redact-emails", "Replace email addresses in logs with ***@domain", setRedactEmails)
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would be installed without installing")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.Parse(args)
+
+	if showHelp {
+		showUsage()
+		os.Exit(0)
+	}
+	if opts.Interval < time.Minute {
+		fmt.Println("❌ Error: -interval must be at least 1m")
+		os.Exit(1)
+	}
+
+	// The service manager starts the program elsewhere, so all paths must be absolute
+	if opts.Dir == "" {
+		opts.Dir, _ = os.Getwd()
+	}
+	var err error
+	if opts.Dir, err = filepath.Abs(opts.Dir); err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !filepath.IsAbs(opts.AccountsPath) {
+		opts.AccountsPath = filepath.Join(opts.Dir, opts.AccountsPath)
+	}
+	if opts.DataDir != "" && !filepath.IsAbs(opts.DataDir) {
+		opts.DataDir = filepath.Join(opts.Dir, opts.DataDir)
+	}
+	if _, err := pathLayout(opts.Layout); err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "install":
+		if _, err := loadAccountsFile(opts.AccountsPath); err != nil {
+			fmt.Printf("❌ Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = installService(opts)
+	case "uninstall":
+		err = uninstallService(opts)
+	case "run":
+		if err := os.Chdir(opts.Dir); err != nil {
+			fmt.Printf("❌ Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = runServiceMain(opts)
+	default:
+		fmt.Printf("❌ Error: unknown service action %q\n", action)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.Printf("Service %s error: %v", action, err)
+		fmt.Printf("❌ Service %s error: %v\n", action, err)
+		os.Exit(1)
+	}
+}
+
+// Arguments the installed service is started with
+func serviceRunArgs(opts ServiceOptions) []string {
+	args := []string{"service", "run", "-name", opts.Name, "-dir", opts.Dir,
+		"-accounts", opts.AccountsPath, "-interval", opts.Interval.String()}
+	if opts.LogStdout {
+		args = append(args, "-log-stdout")
+	}
+	if opts.DataDir != "" {
+		args = append(args, "-data-dir", opts.DataDir)
+	}
+	if opts.Layout != "" {
+		args = append(args, "-layout", opts.Layout)
+	}
+	if redactingEmails() {
+		args = append(args, "-redact-emails")
+	}
+	// From -encrypt-to or $PEEP_ENCRYPT_TO at install time
+	if artifactRecipient != nil {
+		args = append(args, "-encrypt-to", formatPublicKey(artifactRecipient))
+	}
+	return args
+}
+
+// Absolute path of the running executable
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %v", err)
+	}
+	if strings.Contains(exe, "go-build") {
+		return "", fmt.Errorf("install from a built binary (go build), not go run")
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Scan all accounts every interval until ctx is cancelled
+func serviceLoop(ctx context.Context, opts ServiceOptions) {
+	logPath := filepath.Join(stateRoot(opts.DataDir), fmt.Sprintf("service_log_%s.txt", time.Now().Format("2006-01-02")))
+	os.MkdirAll(filepath.Dir(logPath), 0755)
+	setupLogging(&Config{Command: "service", LogPath: logPath, LogStdout: opts.LogStdout})
+	log.Printf("Service %s started: %s every %v", opts.Name, opts.AccountsPath, opts.Interval)
+
+	for {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			// Reload the accounts file every round so edits apply without a restart
+			accounts, err := loadAccountsFile(opts.AccountsPath)
+			if err != nil {
+				log.Printf("Service round skipped: %v", err)
+				return
+			}
+			if opts.DataDir != "" {
+				accounts.DataDir = opts.DataDir
+			}
+			if opts.Layout != "" {
+				accounts.Layout = opts.Layout
+			}
+			failed := 0
+			for _, result := range runAccountScans(ctx, accounts) {
+				if result.Status != "SUCCESS" {
+					failed++
+				}
+			}
+			log.Printf("Service round completed: %d accounts, %d failed", len(accounts.Accounts), failed)
+		}()
+
+		// Stopping cancels the running scans, which keep their progress for the next round
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Printf("Service %s stopping during a scan round", opts.Name)
+			<-done
+			log.Printf("Service %s stopped", opts.Name)
+			return
+		}
+
+		select {
+		case <-time.After(opts.Interval):
+		case <-ctx.Done():
+			log.Printf("Service %s stopped", opts.Name)
+			return
+		}
+	}
+}
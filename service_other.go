@@ -0,0 +1,163 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// systemd unit installed by "service install"
+const systemdUnitTemplate = `[Unit]
+Description=Peep email sender scanner
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+WorkingDirectory=%s
+ExecStart=%s
+%sRestart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=%s
+`
+
+// Path of the systemd unit file
+func systemdUnitPath(opts ServiceOptions) (string, error) {
+	if !opts.UserUnit {
+		return filepath.Join("/etc/systemd/system", opts.Name+".service"), nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", opts.Name+".service"), nil
+}
+
+// Quote a command line argument for ExecStart
+func systemdQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\%$;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	return `"` + arg + `"`
+}
+
+// Render the systemd unit
+func systemdUnit(opts ServiceOptions, exe string) string {
+	command := []string{systemdQuote(exe)}
+	for _, arg := range serviceRunArgs(opts) {
+		command = append(command, systemdQuote(arg))
+	}
+
+	environment := ""
+	if dir := os.Getenv("PEEP_DATA_DIR"); dir != "" {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		environment = fmt.Sprintf("Environment=%s\n", systemdQuote("PEEP_DATA_DIR="+dir))
+	}
+
+	target := "multi-user.target"
+	if opts.UserUnit {
+		target = "default.target"
+	}
+	return fmt.Sprintf(systemdUnitTemplate, systemdQuote(opts.Dir), strings.Join(command, " "), environment, target)
+}
+
+// Run systemctl for the system or user manager
+func systemctl(opts ServiceOptions, args ...string) error {
+	if opts.UserUnit {
+		args = append([]string{"--user"}, args...)
+	}
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Write, enable and start the systemd unit
+func installService(opts ServiceOptions) error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	unitPath, err := systemdUnitPath(opts)
+	if err != nil {
+		return err
+	}
+	unit := systemdUnit(opts, exe)
+
+	if opts.DryRun {
+		fmt.Printf("Would write %s:\n\n%s", unitPath, unit)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file (run as root or use -user-unit): %v", err)
+	}
+	if err := systemctl(opts, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl(opts, "enable", "--now", opts.Name+".service"); err != nil {
+		return err
+	}
+
+	log.Printf("Service installed: %s", unitPath)
+	fmt.Printf("✅ Service %s installed and started (%s)\n", opts.Name, unitPath)
+	return nil
+}
+
+// Stop, disable and remove the systemd unit
+func uninstallService(opts ServiceOptions) error {
+	unitPath, err := systemdUnitPath(opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Printf("Would stop %s and remove %s\n", opts.Name, unitPath)
+		return nil
+	}
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("service %s is not installed (%s)", opts.Name, unitPath)
+	}
+
+	if err := systemctl(opts, "disable", "--now", opts.Name+".service"); err != nil {
+		log.Printf("Service disable error: %v", err)
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	if err := systemctl(opts, "daemon-reload"); err != nil {
+		return err
+	}
+
+	log.Printf("Service uninstalled: %s", unitPath)
+	fmt.Printf("✅ Service %s uninstalled\n", opts.Name)
+	return nil
+}
+
+// Run the scan loop in the foreground until SIGINT or SIGTERM
+func runServiceMain(opts ServiceOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serviceLoop(ctx, opts)
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Windows service handler running the scan loop
+type peepService struct {
+	opts ServiceOptions
+}
+
+// Handle service control requests while the scan loop runs
+func (s *peepService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		serviceLoop(ctx, s.opts)
+		close(done)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stop()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
+
+// Register the Windows service with automatic start and restart on failure
+func installService(opts ServiceOptions) error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Printf("Would register service %s: %s %v\n", opts.Name, exe, serviceRunArgs(opts))
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager (run as administrator): %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(opts.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", opts.Name)
+	}
+
+	s, err := m.CreateService(opts.Name, exe, mgr.Config{
+		DisplayName: "Peep email sender scanner",
+		StartType:   mgr.StartAutomatic,
+	}, serviceRunArgs(opts)...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %v", err)
+	}
+	defer s.Close()
+
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 30 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, 24*60*60); err != nil {
+		log.Printf("Service recovery setup error: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %v", err)
+	}
+
+	log.Printf("Service installed: %s", opts.Name)
+	fmt.Printf("✅ Service %s installed and started\n", opts.Name)
+	return nil
+}
+
+// Stop and remove the Windows service
+func uninstallService(opts ServiceOptions) error {
+	if opts.DryRun {
+		fmt.Printf("Would stop and remove service %s\n", opts.Name)
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager (run as administrator): %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(opts.Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", opts.Name)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.Stop); err != nil {
+		log.Printf("Service stop error: %v", err)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to remove service: %v", err)
+	}
+
+	log.Printf("Service uninstalled: %s", opts.Name)
+	fmt.Printf("✅ Service %s uninstalled\n", opts.Name)
+	return nil
+}
+
+// Run under the service manager, or in the foreground when started from a console
+func runServiceMain(opts ServiceOptions) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if isService {
+		return svc.Run(opts.Name, &peepService{opts: opts})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	serviceLoop(ctx, opts)
+	return nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Subjects printed by show
+const showSubjects = 5
+
+// SenderDetails structure for everything known about one sender
+type SenderDetails struct {
+	Email         string          `json:"email"`
+	Name          string          `json:"name,omitempty"`
+	RawFrom       string          `json:"raw_from,omitempty"`
+	Company       string          `json:"company,omitempty"`
+	JobTitle      string          `json:"job_title,omitempty"`
+	Phones        []string        `json:"phones,omitempty"`
+	Photo         string          `json:"photo,omitempty"`
+	Organization  string          `json:"organization,omitempty"`
+	Category      string          `json:"category,omitempty"`
+	Score         float64         `json:"score"`
+	Messages      int             `json:"messages"`
+	Answered      int             `json:"answered"`
+	Seen          int             `json:"seen"`
+	Flagged       int             `json:"flagged"`
+	Bulk          int             `json:"bulk"`
+	Transactional int             `json:"transactional"`
+	Invites       int             `json:"invites"`
+	Replies       int             `json:"replies"`
+	FirstSeen     string          `json:"first_seen,omitempty"`
+	LastSeen      string          `json:"last_seen,omitempty"`
+	Added         string          `json:"added,omitempty"`
+	Starred       string          `json:"starred,omitempty"`
+	FlagReason    string          `json:"flag_reason,omitempty"`
+	IsFlagged     bool            `json:"is_flagged"`
+	Ignored       bool            `json:"ignored"`
+	ForwardedBy   string          `json:"forwarded_by,omitempty"`
+	ReturnPath    string          `json:"return_path,omitempty"`
+	DKIMDomain    string          `json:"dkim_domain,omitempty"`
+	AuthResults   string          `json:"auth_results,omitempty"`
+	Misaligned    int             `json:"misaligned"`
+	SpoofSuspect  bool            `json:"spoof_suspect"`
+	VerifyStatus  string          `json:"verify_status,omitempty"`
+	Unsubscribe   string          `json:"unsubscribe,omitempty"`
+	Subjects      []string        `json:"subjects,omitempty"`
+	Folders       []SenderCount   `json:"folders,omitempty"`
+	Aliases       []SenderCount   `json:"aliases,omitempty"`
+	Labels        []SenderCount   `json:"labels,omitempty"`
+	Mailers       []SenderCount   `json:"mailers,omitempty"`
+	IPs           []SenderIPCount `json:"ips,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Breaches      []string        `json:"breaches,omitempty"`
+	Notes         []SenderNote    `json:"notes,omitempty"`
+}
+
+// SenderCount structure for a folder, alias, label or mailer of a sender with its message count
+type SenderCount struct {
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+}
+
+// SenderIPCount structure for a sending IP of a sender with where it is
+type SenderIPCount struct {
+	IP       string `json:"ip"`
+	Messages int    `json:"messages"`
+	Country  string `json:"country,omitempty"`
+	PTR      string `json:"ptr,omitempty"`
+}
+
+// Run the show command
+func runShow(args []string) {
+	// The sender may come before the options: peep show foo@bar.com -user ...
+	var email string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		email, args = args[0], args[1:]
+	}
+
+	config := &Config{}
+	var format string
+	fs := accountFlags("show", config)
+	fs.StringVar(&format, "format", "text", "Output format (text, json)")
+	parseLocalFlags(fs, config, args)
+
+	if email == "" && fs.NArg() > 0 {
+		email = fs.Arg(0)
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		fmt.Println("❌ Error: usage: peep show <email> [options]")
+		os.Exit(exitUsage)
+	}
+	if format != "text" && format != "json" {
+		fmt.Printf("❌ Unsupported format %q (use text or json)\n", format)
+		os.Exit(exitUsage)
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	details, err := loadSenderDetails(db, email)
+	if err == sql.ErrNoRows {
+		fmt.Printf("❌ %s is not a known sender\n", email)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to load sender: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(details)
+		return
+	}
+	writeSenderDetails(details)
+}
+
+// Load everything known about a sender, sql.ErrNoRows for an unknown one
+func loadSenderDetails(db *sql.DB, email string) (*SenderDetails, error) {
+	d := &SenderDetails{Email: email}
+	var phone, subjects string
+	var spoofSuspect int
+	err := db.QueryRow(`
+		SELECT COALESCE(full_name, ''), COALESCE(raw_from, ''), COALESCE(company, ''), COALESCE(job_title, ''),
+			COALESCE(phone, ''), COALESCE(photo, ''), COALESCE(organization, ''), COALESCE(category, ''), COALESCE(score, 0),
+			message_count, answered_count, COALESCE(seen_count, 0), COALESCE(flagged_count, 0), bulk_count,
+			transactional_count, COALESCE(invite_count, 0),
+			COALESCE(first_seen_at, ''), COALESCE(last_seen_at, ''), COALESCE(created_at, ''), COALESCE(starred_at, ''),
+			COALESCE(forwarded_by, ''), COALESCE(return_path, ''), COALESCE(dkim_domain, ''), COALESCE(auth_results, ''),
+			COALESCE(misaligned_count, 0), COALESCE(spoof_suspect, 0), COALESCE(verify_status, ''),
+			COALESCE(unsubscribe, ''), COALESCE(subjects, '')
+		FROM senders WHERE email = ?`, email).Scan(
+		&d.Name, &d.RawFrom, &d.Company, &d.JobTitle, &phone, &d.Photo, &d.Organization, &d.Category, &d.Score,
+		&d.Messages, &d.Answered, &d.Seen, &d.Flagged, &d.Bulk, &d.Transactional, &d.Invites,
+		&d.FirstSeen, &d.LastSeen, &d.Added, &d.Starred,
+		&d.ForwardedBy, &d.ReturnPath, &d.DKIMDomain, &d.AuthResults, &d.Misaligned, &spoofSuspect, &d.VerifyStatus,
+		&d.Unsubscribe, &subjects)
+	if err != nil {
+		return nil, err
+	}
+	d.SpoofSuspect = spoofSuspect != 0
+	for _, subject := range strings.Split(subjects, "\n") {
+		if subject != "" && len(d.Subjects) < showSubjects {
+			d.Subjects = append(d.Subjects, subject)
+		}
+	}
+
+	db.QueryRow("SELECT COALESCE(reply_count, 0) FROM replies WHERE email = ?", email).Scan(&d.Replies)
+	domain := emailDomain(email)
+	var flagReason sql.NullString
+	if db.QueryRow("SELECT reason FROM flagged WHERE value IN (?, ?) ORDER BY kind = 'email' DESC LIMIT 1", email, domain).Scan(&flagReason) == nil {
+		d.IsFlagged, d.FlagReason = true, flagReason.String
+	}
+	var ignored int
+	db.QueryRow("SELECT COUNT(*) FROM ignored WHERE value IN (?, ?)", email, domain).Scan(&ignored)
+	d.Ignored = ignored > 0
+
+	counts := []struct {
+		target *[]SenderCount
+		query  string
+	}{
+		{&d.Folders, "SELECT folder, COUNT(DISTINCT uid) FROM message_senders WHERE email = ? GROUP BY folder ORDER BY 2 DESC, folder"},
+		{&d.Aliases, "SELECT alias, message_count FROM sender_aliases WHERE email = ? ORDER BY message_count DESC, alias"},
+		{&d.Labels, "SELECT label, message_count FROM sender_labels WHERE email = ? ORDER BY message_count DESC, label"},
+		{&d.Mailers, "SELECT mailer, message_count FROM sender_mailers WHERE email = ? ORDER BY message_count DESC, mailer"},
+	}
+	for _, c := range counts {
+		if *c.target, err = loadSenderCounts(db, c.query, email); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(`SELECT ip, message_count, COALESCE(country, ''), COALESCE(ptr, '') FROM sender_ips
+		WHERE email = ? ORDER BY message_count DESC, ip`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ip SenderIPCount
+		if err := rows.Scan(&ip.IP, &ip.Messages, &ip.Country, &ip.PTR); err != nil {
+			return nil, err
+		}
+		d.IPs = append(d.IPs, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lists := []struct {
+		target *[]string
+		query  string
+	}{
+		{&d.Phones, "SELECT phone FROM sender_phones WHERE email = ? ORDER BY phone"},
+		{&d.Tags, "SELECT tag FROM sender_tags WHERE email = ? ORDER BY tag"},
+		{&d.Breaches, "SELECT breach FROM sender_breaches WHERE email = ? ORDER BY breach"},
+	}
+	for _, l := range lists {
+		if *l.target, err = loadSenderStrings(db, l.query, email); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.Phones) == 0 && phone != "" {
+		d.Phones = []string{phone}
+	}
+
+	if d.Notes, err = loadNotes(db, email); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Load the names and message counts a query returns for a sender
+func loadSenderCounts(db *sql.DB, query, email string) ([]SenderCount, error) {
+	rows, err := db.Query(query, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SenderCount
+	for rows.Next() {
+		var c SenderCount
+		if err := rows.Scan(&c.Name, &c.Messages); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Load the values a query returns for a sender
+func loadSenderStrings(db *sql.DB, query, email string) ([]string, error) {
+	rows, err := db.Query(query, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// Print the details of a sender, leaving out what is not known
+func writeSenderDetails(d *SenderDetails) {
+	title := d.Email
+	if d.Name != "" {
+		title = fmt.Sprintf("%s <%s>", d.Name, d.Email)
+	}
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len([]rune(title))))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+	var status []string
+	if d.Starred != "" {
+		status = append(status, "⭐ starred "+lastSeenDate(d.Starred))
+	}
+	if d.IsFlagged {
+		status = append(status, strings.TrimSpace("🚩 flagged "+d.FlagReason))
+	}
+	if d.Ignored {
+		status = append(status, "ignored")
+	}
+	field("Status", strings.Join(status, ", "))
+	field("Company", strings.Join(nonEmpty(d.JobTitle, d.Company), ", "))
+	field("Organization", d.Organization)
+	field("Phone", strings.Join(d.Phones, ", "))
+	field("Category", d.Category)
+	field("Score", fmt.Sprintf("%.1f", d.Score))
+	field("Messages", fmt.Sprintf("%d (%d seen, %d answered, %d flagged, %d bulk, %d transactional, %d invites)",
+		d.Messages, d.Seen, d.Answered, d.Flagged, d.Bulk, d.Transactional, d.Invites))
+	field("Replies sent", fmt.Sprint(d.Replies))
+	field("First seen", lastSeenDate(d.FirstSeen))
+	field("Last seen", lastSeenDate(d.LastSeen))
+	field("Forwarded by", d.ForwardedBy)
+	field("Tags", strings.Join(d.Tags, ", "))
+	field("Unsubscribe", d.Unsubscribe)
+	w.Flush()
+
+	section := func(name string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", name)
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	var auth []string
+	if d.AuthResults != "" {
+		auth = append(auth, d.AuthResults)
+	}
+	if d.ReturnPath != "" {
+		auth = append(auth, "Return-Path: "+d.ReturnPath)
+	}
+	if d.DKIMDomain != "" {
+		auth = append(auth, "DKIM domain: "+d.DKIMDomain)
+	}
+	if d.Misaligned > 0 {
+		auth = append(auth, fmt.Sprintf("⚠️  %s with misaligned domains", plural(d.Misaligned, "message")))
+	}
+	if d.SpoofSuspect {
+		auth = append(auth, "⚠️  suspected spoofing")
+	}
+	if d.VerifyStatus != "" {
+		auth = append(auth, "Mailbox: "+d.VerifyStatus)
+	}
+	section("Authentication", auth)
+	section("Folders", countLines(d.Folders))
+	section("Delivered to", countLines(d.Aliases))
+	section("Labels", countLines(d.Labels))
+	section("Mailers", countLines(d.Mailers))
+	var ips []string
+	for _, ip := range d.IPs {
+		line := fmt.Sprintf("%s (%s)", ip.IP, plural(ip.Messages, "message"))
+		if where := strings.Join(nonEmpty(ip.Country, ip.PTR), ", "); where != "" {
+			line += " " + where
+		}
+		ips = append(ips, line)
+	}
+	section("Sending IPs", ips)
+	section("Recent subjects", d.Subjects)
+	section("Breaches", d.Breaches)
+	var notes []string
+	for _, note := range d.Notes {
+		notes = append(notes, fmt.Sprintf("%s  %s", lastSeenDate(note.CreatedAt), note.Note))
+	}
+	section("Notes", notes)
+}
+
+// Lines of names with their message counts
+func countLines(counts []SenderCount) []string {
+	var lines []string
+	for _, c := range counts {
+		lines = append(lines, fmt.Sprintf("%s (%s)", c.Name, plural(c.Messages, "message")))
+	}
+	return lines
+}
+
+// The values that are not empty
+func nonEmpty(values ...string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
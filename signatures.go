@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+const (
+	// Only this much of the text body is searched for a signature
+	maxSignatureScan = 64 * 1024
+	// Signatures longer than this are more likely to be message text
+	maxSignatureLines = 10
+)
+
+// Signature structure for contact details found in a message signature
+type Signature struct {
+	Phone   string
+	Title   string
+	Company string
+}
+
+var (
+	signatureReplyMarker = regexp.MustCompile(`(?i)^\s*(on .+ wrote:|-+\s*(original|forwarded) message\s*-+|begin forwarded message:|from:\s.+@)`)
+	signaturePhone       = regexp.MustCompile(`(?i)^(?:(?:tel|phone|mobile|mob|cell|direct|office|fax|[tmpo])\.?\s*[:|]?\s*)?(\+?\(?\d[\d ().-]{6,}\d)\s*(?:ext\.?\s*\d+)?$`)
+	signaturePhoneLabel  = regexp.MustCompile(`(?i)^(fax|f)\b`)
+	signatureTitle       = regexp.MustCompile(`(?i)\b(ceo|cto|cfo|coo|cmo|founder|co-founder|owner|president|vp|vice president|director|head of|manager|lead|engineer|developer|designer|architect|consultant|analyst|specialist|coordinator|officer|partner|recruiter|assistant|advisor|executive|administrator|representative|associate)\b`)
+	signatureCompany     = regexp.MustCompile(`(?i)\b(inc|ltd|llc|llp|gmbh|corp|corporation|company|co|plc|ag|s\.?a|b\.?v|pty|limited)\b\.?$`)
+	signatureTitleAt     = regexp.MustCompile(`(?i)^(.+?)\s+(?:at|@|\||,|-|–)\s+(.+)$`)
+	signatureSkip        = regexp.MustCompile(`(?i)(https?://|www\.|@|\bsent from my\b|\bget outlook\b)`)
+)
+
+// Extract contact details from the signature of a message's text body
+func messageSignature(raw []byte) *Signature {
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil
+	}
+
+	text := textBody(entity)
+	if text == "" {
+		return nil
+	}
+	return parseSignature(signatureBlock(text))
+}
+
+// Read the first text/plain part outside of attached messages
+func textBody(entity *message.Entity) string {
+	var text string
+
+	entity.Walk(func(path []int, part *message.Entity, err error) error {
+		if err != nil {
+			return nil
+		}
+		mediaType, _, _ := part.Header.ContentType()
+		if mediaType == "text/plain" || (mediaType == "" && len(path) == 0) {
+			body, _ := io.ReadAll(io.LimitReader(part.Body, maxSignatureScan))
+			text = string(body)
+			return errStopWalk
+		}
+		return nil
+	})
+
+	return text
+}
+
+// Cut quoted replies and return the lines that most likely form the signature
+func signatureBlock(text string) []string {
+	var lines []string
+	delimiter := -1
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, ">") || signatureReplyMarker.MatchString(line) {
+			// Everything from here on belongs to someone else
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+		if line == "--" {
+			delimiter = len(lines)
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if delimiter >= 0 {
+		lines = lines[delimiter:]
+	} else if len(lines) > maxSignatureLines/2 {
+		// Without a "-- " delimiter only the closing lines are trusted
+		lines = lines[len(lines)-maxSignatureLines/2:]
+	}
+	if len(lines) > maxSignatureLines {
+		lines = lines[:maxSignatureLines]
+	}
+	return lines
+}
+
+// Find a phone number, job title and company in signature lines
+func parseSignature(lines []string) *Signature {
+	sig := &Signature{}
+
+	for _, line := range lines {
+		if len(line) > 80 {
+			continue
+		}
+
+		if sig.Phone == "" && !signaturePhoneLabel.MatchString(line) {
+			if match := signaturePhone.FindStringSubmatch(line); match != nil && countDigits(match[1]) >= 7 {
+				sig.Phone = strings.TrimSpace(match[1])
+				continue
+			}
+		}
+		if signatureSkip.MatchString(line) {
+			continue
+		}
+
+		if sig.Title == "" && signatureTitle.MatchString(line) {
+			// "Title at Company", "Title | Company", "Title, Company"
+			if match := signatureTitleAt.FindStringSubmatch(line); match != nil && signatureTitle.MatchString(match[1]) {
+				sig.Title = strings.TrimSpace(match[1])
+				if sig.Company == "" {
+					sig.Company = strings.TrimSpace(match[2])
+				}
+			} else {
+				sig.Title = line
+			}
+			continue
+		}
+
+		if sig.Company == "" && signatureCompany.MatchString(line) {
+			sig.Company = line
+		}
+	}
+
+	if *sig == (Signature{}) {
+		return nil
+	}
+	return sig
+}
+
+// Count digits in a string
+func countDigits(s string) int {
+	count := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			count++
+		}
+	}
+	return count
+}
+
+// Store signature details on sender rows, keeping known values that were not found again
+func saveSenderSignatures(tx *sql.Tx, senders []EmailSender) error {
+	stmt, err := tx.Prepare(`
+		UPDATE senders SET
+			phone = COALESCE(NULLIF(?, ''), phone),
+			job_title = COALESCE(NULLIF(?, ''), job_title),
+			company = COALESCE(NULLIF(?, ''), company)
+		WHERE email = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updated := 0
+	for _, sender := range senders {
+		if sender.Signature == nil {
+			continue
+		}
+		sig := sender.Signature
+		if _, err := stmt.Exec(sig.Phone, sig.Title, sig.Company, sender.Email); err != nil {
+			return err
+		}
+		updated++
+	}
+
+	if updated > 0 {
+		log.Printf("Signature details saved for %d senders", updated)
+	}
+	return nil
+}
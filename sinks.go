@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Timeout for connecting to and publishing on an event sink
+const sinkTimeout = 15 * time.Second
+
+// NATSConfig structure for the "nats" section of the config file
+type NATSConfig struct {
+	URL         string `json:"url"`
+	Subject     string `json:"subject"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+	Token       string `json:"token"`
+	TokenEnv    string `json:"token_env"`
+}
+
+// KafkaConfig structure for the "kafka" section of the config file. Records are
+// produced through a Kafka REST Proxy (Confluent REST Proxy, Redpanda HTTP Proxy)
+type KafkaConfig struct {
+	RESTURL     string `json:"rest_url"`
+	Topic       string `json:"topic"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+}
+
+// SinkRecord structure for an encoded event with its key
+type SinkRecord struct {
+	Key     string
+	Payload []byte
+}
+
+// Check the nats section of the config file
+func validateNATS(n *NATSConfig) error {
+	if n.URL == "" {
+		return fmt.Errorf("nats.url is not set")
+	}
+	if _, _, err := natsAddress(n.URL); err != nil {
+		return err
+	}
+	if strings.ContainsAny(n.Subject, " \t\r\n*>") {
+		return fmt.Errorf("invalid nats.subject %q", n.Subject)
+	}
+	return nil
+}
+
+// Check the kafka section of the config file
+func validateKafka(k *KafkaConfig) error {
+	if k.RESTURL == "" {
+		return fmt.Errorf("kafka.rest_url is not set (records are sent through a Kafka REST Proxy)")
+	}
+	if k.Topic == "" {
+		return fmt.Errorf("kafka.topic is not set")
+	}
+	return nil
+}
+
+// Host:port of a NATS URL and whether TLS is required (nats://host:4222, tls://host:4222)
+func natsAddress(raw string) (string, bool, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "nats://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid nats.url %q: %v", raw, err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return "", false, fmt.Errorf("invalid nats.url %q: use nats:// or tls://", raw)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "4222"
+	}
+	return net.JoinHostPort(u.Hostname(), port), u.Scheme == "tls", nil
+}
+
+// Publish records to a NATS subject and wait until the server has processed them
+func publishNATS(n *NATSConfig, records []SinkRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	address, useTLS, err := natsAddress(n.URL)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", address, sinkTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(sinkTimeout))
+
+	// The server introduces itself before the client speaks
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no INFO from server: %v", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if useTLS || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := map[string]any{"verbose": false, "pedantic": false, "name": "peep", "lang": "go", "version": buildInfo().Version}
+	if n.User != "" {
+		connect["user"] = n.User
+		connect["pass"] = logSecret(firstNonEmpty(n.Password, os.Getenv(n.PasswordEnv)))
+	}
+	if token := firstNonEmpty(n.Token, os.Getenv(n.TokenEnv)); token != "" {
+		connect["auth_token"] = logSecret(token)
+	}
+	options, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CONNECT %s\r\n", options)
+	subject := firstNonEmpty(n.Subject, "peep.senders")
+	for _, record := range records {
+		fmt.Fprintf(&buf, "PUB %s %d\r\n%s\r\n", subject, len(record.Payload), record.Payload)
+	}
+	buf.WriteString("PING\r\n")
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	// PONG confirms every preceding command was processed; errors arrive before it
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("no PONG from server: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// Produce records to a Kafka topic through the REST Proxy v2 API
+func publishKafka(k *KafkaConfig, records []SinkRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	type restRecord struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	var body struct {
+		Records []restRecord `json:"records"`
+	}
+	for _, record := range records {
+		body.Records = append(body.Records, restRecord{Key: record.Key, Value: record.Payload})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(k.RESTURL, "/") + "/topics/" + url.PathEscape(k.Topic)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	if k.Username != "" {
+		req.SetBasicAuth(k.Username, logSecret(firstNonEmpty(k.Password, os.Getenv(k.PasswordEnv))))
+	}
+
+	client := &http.Client{Timeout: sinkTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(response)))
+	}
+
+	// The proxy answers 200 even when single records fail
+	var result struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if json.Unmarshal(response, &result) == nil {
+		failed := 0
+		var last string
+		for _, offset := range result.Offsets {
+			if offset.Error != "" {
+				failed++
+				last = offset.Error
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d records failed: %s", failed, len(records), last)
+		}
+	}
+	return nil
+}
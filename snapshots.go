@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Runs whose sender lists are kept for diffs; older runs keep only their counts
+const maxSnapshots = 50
+
+// Run snapshot tables: one row per scan with its counts, and the senders known at its end
+const createSnapshotTables = `
+	CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at DATETIME,
+		finished_at DATETIME,
+		folder TEXT,
+		status TEXT,
+		sender_count INTEGER DEFAULT 0,
+		domain_count INTEGER DEFAULT 0,
+		new_senders INTEGER DEFAULT 0,
+		new_domains INTEGER DEFAULT 0,
+		gone_senders INTEGER DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS run_senders (
+		run_id INTEGER,
+		email TEXT,
+		PRIMARY KEY (run_id, email)
+	) WITHOUT ROWID;`
+
+// RunSnapshot structure for one recorded run
+type RunSnapshot struct {
+	ID          int    `json:"id"`
+	StartedAt   string `json:"started_at"`
+	FinishedAt  string `json:"finished_at"`
+	Folder      string `json:"folder"`
+	Status      string `json:"status"`
+	Senders     int    `json:"senders"`
+	Domains     int    `json:"domains"`
+	NewSenders  int    `json:"new_senders"`
+	NewDomains  int    `json:"new_domains"`
+	GoneSenders int    `json:"gone_senders"`
+	// Domains first seen in this run, only known right after recording it
+	AddedDomains []string `json:"-"`
+}
+
+// SnapshotDiff structure for the changes between two runs
+type SnapshotDiff struct {
+	From         RunSnapshot  `json:"from"`
+	To           RunSnapshot  `json:"to"`
+	AddedSenders []DiffSender `json:"added_senders"`
+	GoneSenders  []DiffSender `json:"gone_senders"`
+	AddedDomains []string     `json:"added_domains"`
+	GoneDomains  []string     `json:"gone_domains"`
+}
+
+// DiffSender structure for a sender listed in a diff
+type DiffSender struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Record a completed scan: its counts, the changes since the previous run and the
+// senders known now. Failures are logged, a missing snapshot must not fail the scan
+func recordRunSnapshot(db *sql.DB, config *Config, started time.Time, scanErr error) *RunSnapshot {
+	run := &RunSnapshot{
+		StartedAt:  started.Format(time.RFC3339),
+		FinishedAt: time.Now().Format(time.RFC3339),
+		Folder:     firstNonEmpty(config.Folder, "INBOX"),
+		Status:     "SUCCESS",
+	}
+	if scanErr != nil {
+		run.Status = "PARTIAL"
+	}
+
+	err := retryWrite(context.Background(), config, "record run snapshot", func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		emails, err := queryEmails(tx, "SELECT email FROM senders WHERE "+notIgnoredCondition("senders.email"))
+		if err != nil {
+			return err
+		}
+		domains := make(map[string]bool)
+		for _, email := range emails {
+			domains[emailDomain(email)] = true
+		}
+		run.Senders, run.Domains = len(emails), len(domains)
+		run.AddedDomains, run.GoneSenders = nil, 0
+		tx.QueryRow("SELECT COUNT(*) FROM senders WHERE created_at >= ?", started.UTC().Format("2006-01-02 15:04:05")).Scan(&run.NewSenders)
+
+		// Changes against the sender list of the previous run, if there is one
+		var previousID int
+		if tx.QueryRow("SELECT id FROM runs ORDER BY id DESC LIMIT 1").Scan(&previousID) == nil {
+			previous, err := queryEmails(tx, "SELECT email FROM run_senders WHERE run_id = ?", previousID)
+			if err != nil {
+				return err
+			}
+			if len(previous) > 0 {
+				current := make(map[string]bool, len(emails))
+				for _, email := range emails {
+					current[email] = true
+				}
+				previousDomains := make(map[string]bool)
+				for _, email := range previous {
+					previousDomains[emailDomain(email)] = true
+					if !current[email] {
+						run.GoneSenders++
+					}
+				}
+				run.AddedDomains = domainsMissing(domains, previousDomains)
+			}
+		}
+		run.NewDomains = len(run.AddedDomains)
+
+		result, err := tx.Exec(`INSERT INTO runs (started_at, finished_at, folder, status, sender_count, domain_count,
+			new_senders, new_domains, gone_senders) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			run.StartedAt, run.FinishedAt, run.Folder, run.Status, run.Senders, run.Domains,
+			run.NewSenders, run.NewDomains, run.GoneSenders)
+		if err != nil {
+			return err
+		}
+		runID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		run.ID = int(runID)
+
+		stmt, err := tx.Prepare("INSERT OR IGNORE INTO run_senders (run_id, email) VALUES (?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, email := range emails {
+			if _, err := stmt.Exec(runID, email); err != nil {
+				return err
+			}
+		}
+
+		// Only the latest runs keep their sender lists
+		if _, err := tx.Exec(`DELETE FROM run_senders WHERE run_id <= ?`, runID-maxSnapshots); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		log.Printf("Failed to record run snapshot: %v", err)
+		return nil
+	}
+	log.Printf("Run #%d recorded: %d senders, %d domains (%d new senders, %d new domains, %d gone senders)",
+		run.ID, run.Senders, run.Domains, run.NewSenders, run.NewDomains, run.GoneSenders)
+	return run
+}
+
+// Read a single column of email addresses
+func queryEmails(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// Run the diff command
+func runDiff(args []string) {
+	config := &Config{}
+	var format string
+	var listRuns bool
+
+	fs := accountFlags("diff", config)
+	fs.StringVar(&format, "format", "text", "Output format (text, json)")
+	fs.BoolVar(&listRuns, "runs", false, "List the recorded runs")
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	if listRuns {
+		showRuns(db)
+		return
+	}
+
+	var ids []int
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			fmt.Printf("❌ Invalid run id %q\n", arg)
+			os.Exit(exitUsage)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > 2 {
+		fmt.Println("❌ Usage: peep diff [options] [run1 [run2]]")
+		os.Exit(exitUsage)
+	}
+
+	from, to, err := diffRuns(db, ids)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	diff, err := loadSnapshotDiff(db, from, to)
+	if err != nil {
+		fmt.Printf("❌ Failed to compare runs: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+
+	switch format {
+	case "text":
+		writeSnapshotDiff(diff)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(diff)
+	default:
+		fmt.Printf("❌ Unsupported format %q (use text or json)\n", format)
+		os.Exit(exitUsage)
+	}
+}
+
+// Runs to compare: the last two without ids, a run and the one before it,
+// or two given runs
+func diffRuns(db *sql.DB, ids []int) (RunSnapshot, RunSnapshot, error) {
+	var from, to RunSnapshot
+	var err error
+	switch len(ids) {
+	case 0:
+		if to, err = loadRun(db, "SELECT "+runColumns+" FROM runs ORDER BY id DESC LIMIT 1"); err != nil {
+			return from, to, fmt.Errorf("no runs recorded yet; scan first")
+		}
+		from, err = loadRun(db, "SELECT "+runColumns+" FROM runs WHERE id < ? ORDER BY id DESC LIMIT 1", to.ID)
+	case 1:
+		if to, err = loadRun(db, "SELECT "+runColumns+" FROM runs WHERE id = ?", ids[0]); err != nil {
+			return from, to, fmt.Errorf("run #%d not found", ids[0])
+		}
+		from, err = loadRun(db, "SELECT "+runColumns+" FROM runs WHERE id < ? ORDER BY id DESC LIMIT 1", to.ID)
+	case 2:
+		if from, err = loadRun(db, "SELECT "+runColumns+" FROM runs WHERE id = ?", ids[0]); err != nil {
+			return from, to, fmt.Errorf("run #%d not found", ids[0])
+		}
+		if to, err = loadRun(db, "SELECT "+runColumns+" FROM runs WHERE id = ?", ids[1]); err != nil {
+			return from, to, fmt.Errorf("run #%d not found", ids[1])
+		}
+	}
+	if err != nil {
+		return from, to, fmt.Errorf("run #%d is the first recorded run; nothing to compare with", to.ID)
+	}
+
+	for _, run := range []RunSnapshot{from, to} {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM run_senders WHERE run_id = ?", run.ID).Scan(&count)
+		if count == 0 && run.Senders > 0 {
+			return from, to, fmt.Errorf("the sender list of run #%d was pruned (only the last %d runs are kept)", run.ID, maxSnapshots)
+		}
+	}
+	return from, to, nil
+}
+
+// Columns of the runs table read into a RunSnapshot
+const runColumns = `id, COALESCE(started_at, ''), COALESCE(finished_at, ''), COALESCE(folder, ''), COALESCE(status, ''),
+	sender_count, domain_count, new_senders, new_domains, gone_senders`
+
+// Load one run
+func loadRun(db *sql.DB, query string, args ...any) (RunSnapshot, error) {
+	var r RunSnapshot
+	err := db.QueryRow(query, args...).Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Folder, &r.Status,
+		&r.Senders, &r.Domains, &r.NewSenders, &r.NewDomains, &r.GoneSenders)
+	return r, err
+}
+
+// Compare the sender lists of two runs
+func loadSnapshotDiff(db *sql.DB, from, to RunSnapshot) (*SnapshotDiff, error) {
+	diff := &SnapshotDiff{From: from, To: to}
+	changes := `
+		SELECT s.email, COALESCE(senders.full_name, '')
+		FROM run_senders s LEFT JOIN senders ON senders.email = s.email
+		WHERE s.run_id = ? AND s.email NOT IN (SELECT email FROM run_senders WHERE run_id = ?)
+		GROUP BY s.email ORDER BY s.email`
+	var err error
+	if diff.AddedSenders, err = loadDiffSenders(db, changes, to.ID, from.ID); err != nil {
+		return nil, err
+	}
+	if diff.GoneSenders, err = loadDiffSenders(db, changes, from.ID, to.ID); err != nil {
+		return nil, err
+	}
+
+	fromDomains, err := runDomains(db, from.ID)
+	if err != nil {
+		return nil, err
+	}
+	toDomains, err := runDomains(db, to.ID)
+	if err != nil {
+		return nil, err
+	}
+	diff.AddedDomains = domainsMissing(toDomains, fromDomains)
+	diff.GoneDomains = domainsMissing(fromDomains, toDomains)
+	return diff, nil
+}
+
+// Load the senders returned by a diff query
+func loadDiffSenders(db *sql.DB, query string, args ...any) ([]DiffSender, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senders := []DiffSender{}
+	for rows.Next() {
+		var s DiffSender
+		if err := rows.Scan(&s.Email, &s.Name); err != nil {
+			return nil, err
+		}
+		senders = append(senders, s)
+	}
+	return senders, rows.Err()
+}
+
+// Domains of the senders of a run
+func runDomains(db *sql.DB, runID int) (map[string]bool, error) {
+	rows, err := db.Query("SELECT email FROM run_senders WHERE run_id = ?", runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make(map[string]bool)
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		domains[emailDomain(email)] = true
+	}
+	return domains, rows.Err()
+}
+
+// Sorted domains of a that are not in b
+func domainsMissing(a, b map[string]bool) []string {
+	missing := []string{}
+	for domain := range a {
+		if !b[domain] {
+			missing = append(missing, domain)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Print a diff between two runs
+func writeSnapshotDiff(diff *SnapshotDiff) {
+	fmt.Printf("🔍 Run #%d (%s) → run #%d (%s)\n", diff.From.ID, runDate(diff.From), diff.To.ID, runDate(diff.To))
+	fmt.Printf("Senders: %d → %d (+%d, -%d)\n", diff.From.Senders, diff.To.Senders, len(diff.AddedSenders), len(diff.GoneSenders))
+	fmt.Printf("Domains: %d → %d (+%d, -%d)\n", diff.From.Domains, diff.To.Domains, len(diff.AddedDomains), len(diff.GoneDomains))
+
+	printSenders := func(title string, senders []DiffSender) {
+		if len(senders) == 0 {
+			return
+		}
+		fmt.Printf("\n%s (%d):\n", title, len(senders))
+		for _, s := range senders {
+			if s.Name != "" {
+				fmt.Printf("  %s <%s>\n", s.Name, s.Email)
+			} else {
+				fmt.Printf("  %s\n", s.Email)
+			}
+		}
+	}
+	printDomains := func(title string, domains []string) {
+		if len(domains) == 0 {
+			return
+		}
+		fmt.Printf("\n%s (%d):\n", title, len(domains))
+		for _, domain := range domains {
+			fmt.Printf("  %s\n", domain)
+		}
+	}
+	printSenders("➕ New senders", diff.AddedSenders)
+	printSenders("➖ Gone senders", diff.GoneSenders)
+	printDomains("➕ New domains", diff.AddedDomains)
+	printDomains("➖ Gone domains", diff.GoneDomains)
+	if len(diff.AddedSenders)+len(diff.GoneSenders) == 0 {
+		fmt.Println("\n✅ No changes")
+	}
+}
+
+// List the recorded runs, latest first
+func showRuns(db *sql.DB) {
+	rows, err := db.Query("SELECT " + runColumns + " FROM runs ORDER BY id DESC")
+	if err != nil {
+		fmt.Printf("❌ Failed to load runs: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tFINISHED\tFOLDER\tSTATUS\tSENDERS\tDOMAINS\tNEW SENDERS\tNEW DOMAINS\tGONE")
+	total := 0
+	for rows.Next() {
+		var r RunSnapshot
+		if err := rows.Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Folder, &r.Status, &r.Senders, &r.Domains,
+			&r.NewSenders, &r.NewDomains, &r.GoneSenders); err != nil {
+			fmt.Printf("❌ Failed to load runs: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		fmt.Fprintf(w, "#%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", r.ID, runDate(r), r.Folder, r.Status, r.Senders, r.Domains,
+			r.NewSenders, r.NewDomains, r.GoneSenders)
+		total++
+	}
+	w.Flush()
+	fmt.Printf("Total runs: %d\n", total)
+}
+
+// Local end time of a run for display
+func runDate(r RunSnapshot) string {
+	if t, err := time.Parse(time.RFC3339, r.FinishedAt); err == nil {
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	return r.FinishedAt
+}
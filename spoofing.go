@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// Minimum messages before a sender can be marked as a spoofing suspect
+const minSpoofMessages = 2
+
+var (
+	authResultDKIM  = regexp.MustCompile(`(?i)\bdkim=pass\b[^;]*?\bheader\.(?:d|i)=@?([a-z0-9.-]+)`)
+	authResultDMARC = regexp.MustCompile(`(?i)\bdmarc=pass\b`)
+	dkimSignatureD  = regexp.MustCompile(`(?i)(?:^|;)\s*d=([a-z0-9.-]+)`)
+	authResultCheck = regexp.MustCompile(`(?i)\b(spf|dkim|dmarc)=([a-z]+)`)
+)
+
+// Get the domain of the Return-Path (envelope sender) header
+func returnPathDomain(header message.Header) string {
+	value := strings.TrimSpace(header.Get("Return-Path"))
+	if value == "" || value == "<>" {
+		return ""
+	}
+	if addr, err := mail.ParseAddress(value); err == nil {
+		return emailDomain(addr.Address)
+	}
+	return emailDomain(strings.Trim(value, "<>"))
+}
+
+// Get the domain that signed a message: the passing DKIM result, or the first signature
+func dkimDomain(header message.Header) string {
+	for _, result := range header.Values("Authentication-Results") {
+		if match := authResultDKIM.FindStringSubmatch(result); match != nil {
+			return strings.ToLower(match[1])
+		}
+	}
+	for _, signature := range header.Values("DKIM-Signature") {
+		if match := dkimSignatureD.FindStringSubmatch(signature); match != nil {
+			return strings.ToLower(match[1])
+		}
+	}
+	return ""
+}
+
+// Summarize the SPF, DKIM and DMARC results the receiving server added on top,
+// e.g. "spf=pass dkim=pass dmarc=fail"
+func authSummary(header message.Header) string {
+	results := header.Values("Authentication-Results")
+	if len(results) == 0 {
+		return ""
+	}
+	var checks []string
+	seen := make(map[string]bool)
+	for _, match := range authResultCheck.FindAllStringSubmatch(results[0], -1) {
+		method := strings.ToLower(match[1])
+		if !seen[method] {
+			seen[method] = true
+			checks = append(checks, method+"="+strings.ToLower(match[2]))
+		}
+	}
+	return strings.Join(checks, " ")
+}
+
+// Approximate the organizational domain by its last two labels
+// (three for short second-level labels like co.uk or com.au)
+func orgDomain(domain string) string {
+	labels := strings.Split(strings.Trim(domain, "."), ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 && len(labels[len(labels)-2]) <= 3 {
+		n = 3
+	}
+	if len(labels) <= n {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// Check relaxed (organizational domain) alignment of two domains
+func domainsAligned(a, b string) bool {
+	return a != "" && b != "" && orgDomain(a) == orgDomain(b)
+}
+
+// Check if a DKIM signature or DMARC result vouches for the From domain
+func dkimAligned(header message.Header, fromDomain string) bool {
+	for _, result := range header.Values("Authentication-Results") {
+		if authResultDMARC.MatchString(result) {
+			return true
+		}
+		for _, match := range authResultDKIM.FindAllStringSubmatch(result, -1) {
+			if domainsAligned(strings.ToLower(match[1]), fromDomain) {
+				return true
+			}
+		}
+	}
+
+	// Without Authentication-Results, an aligned signature is the best hint available
+	if len(header.Values("Authentication-Results")) == 0 {
+		for _, signature := range header.Values("DKIM-Signature") {
+			if match := dkimSignatureD.FindStringSubmatch(signature); match != nil && domainsAligned(strings.ToLower(match[1]), fromDomain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check a message for a From domain that differs from the Return-Path domain without DKIM alignment
+func isMisaligned(header message.Header, fromDomain, returnPath string) bool {
+	if returnPath == "" || fromDomain == "" || domainsAligned(fromDomain, returnPath) {
+		return false
+	}
+	return !dkimAligned(header, fromDomain)
+}
+
+// Mark senders whose messages are mostly misaligned as spoofing suspects
+func updateSpoofSuspects(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE senders SET spoof_suspect = CASE
+			WHEN message_count >= ? AND misaligned_count * 2 > message_count THEN 1
+			ELSE 0
+		END`, minSpoofMessages)
+	return err
+}
+
+// List senders marked as spoofing suspects
+func showSpoofSuspects(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT COALESCE(full_name, ''), email, COALESCE(return_path, ''), misaligned_count, message_count
+		FROM senders WHERE spoof_suspect = 1 ORDER BY misaligned_count DESC LIMIT 10`)
+	if err != nil {
+		log.Printf("Failed to query spoofing suspects: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		if i == 0 {
+			fmt.Printf("\n⚠️  Possible spoofing (From domain differs from Return-Path without DKIM):\n")
+		}
+		var fullName, email, returnPath string
+		var misaligned, messages int
+		rows.Scan(&fullName, &email, &returnPath, &misaligned, &messages)
+		fmt.Printf("  - %s <%s> via %s (%d/%d messages)\n", fullName, email, returnPath, misaligned, messages)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long SQLite waits for a lock held by another connection before giving up
+const sqliteBusyTimeout = 10 * time.Second
+
+// Connection string for a database file: WAL lets readers (list, search, report)
+// work while a scan writes, the busy timeout makes connections wait for each
+// other's locks, and immediate transactions take the write lock up front so
+// they wait at BEGIN instead of failing halfway through
+func sqliteDSN(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+	params.Add("_txlock", "immediate")
+	return "file:" + path + "?" + params.Encode()
+}
+
+// Connection string opening a database file read-only: SQLite refuses every write,
+// whatever the statement, and query_only also covers attached databases
+func sqliteReadOnlyDSN(path string) string {
+	params := url.Values{}
+	params.Add("mode", "ro")
+	params.Add("_pragma", "query_only(1)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+	return "file:" + path + "?" + params.Encode()
+}
+
+// Open the database of an analysis command read-only, so it can never change scan
+// state: no schema upgrade runs and SQLite refuses every write. With -remote, the
+// database is the user's on a peep serve instance. Exits when the database is
+// missing or can't be read
+func mustOpenReadOnlyDB(config *Config) *sql.DB {
+	if config.Remote != "" {
+		db, err := openRemoteDB(config)
+		if err != nil {
+			log.Printf("Failed to open remote database: %v", err)
+			fmt.Printf("❌ Remote database error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		log.Printf("Database opened on %s: %s", config.Remote, config.Username)
+		return db
+	}
+
+	if _, err := os.Stat(config.DBPath); err != nil {
+		fmt.Printf("❌ Database error: no database at %s, run a scan first\n", config.DBPath)
+		os.Exit(exitDatabase)
+	}
+	db, err := openReadOnlyDB(config.DBPath)
+	if err != nil {
+		log.Printf("Failed to open database read-only: %v", err)
+		fmt.Printf("❌ Database error: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	log.Printf("Database opened read-only: %s", config.DBPath)
+	return db
+}
+
+// Open a database file read-only
+func openReadOnlyDB(path string) (*sql.DB, error) {
+	db, err := openReadOnly(sqliteReadOnlyDSN(path))
+	if err != nil {
+		// WAL databases need their -shm file; in a directory that can't be written
+		// it can't be created, so the file is read as it is, as an immutable snapshot
+		log.Printf("Read-only open failed (%v), opening as snapshot", err)
+		db, err = openReadOnly(sqliteReadOnlyDSN(path) + "&immutable=1")
+	}
+	return db, err
+}
+
+// Open a connection string, checking that the database can be read
+func openReadOnly(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(new(int)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// stmtCache structure for statements prepared once and reused, e.g. for every page of a paged read
+type stmtCache struct {
+	db    *sql.DB
+	stmts map[string]*sql.Stmt
+}
+
+// Create an empty statement cache
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// Prepared statement of a query, prepared on first use
+func (c *stmtCache) prepare(query string) (*sql.Stmt, error) {
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close all cached statements
+func (c *stmtCache) close() {
+	for query, stmt := range c.stmts {
+		stmt.Close()
+		delete(c.stmts, query)
+	}
+}
+
+// Check if an error means another connection holds the lock
+func isBusyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	return strings.Contains(message, "SQLITE_BUSY") || strings.Contains(message, "database is locked")
+}
+
+// Run writes in one transaction, committed only if all of them succeed before ctx is cancelled
+func inTx(ctx context.Context, db *sql.DB, write func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := write(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Condition selecting starred senders
+const starredCondition = "senders.starred_at IS NOT NULL"
+
+// Run the star command: star [add] <email>..., star remove <email>..., star list
+func runStar(args []string) {
+	action := "add"
+	if len(args) > 0 && (args[0] == "add" || args[0] == "remove" || args[0] == "list") {
+		action, args = args[0], args[1:]
+	}
+
+	config := &Config{}
+	fs := accountFlags("star", config)
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	switch action {
+	case "add", "remove":
+		if fs.NArg() == 0 {
+			fmt.Printf("❌ Error: usage: star %s <email>...\n", action)
+			os.Exit(exitUsage)
+		}
+		query := "UPDATE senders SET starred_at = COALESCE(starred_at, CURRENT_TIMESTAMP) WHERE lower(email) = ?"
+		if action == "remove" {
+			query = "UPDATE senders SET starred_at = NULL WHERE lower(email) = ?"
+		}
+		for _, value := range fs.Args() {
+			email := strings.ToLower(strings.TrimSpace(value))
+			result, err := db.Exec(query, email)
+			if err != nil {
+				log.Printf("Failed to %s star on %s: %v", action, email, err)
+				fmt.Printf("❌ Failed to update %s: %v\n", email, err)
+				os.Exit(exitDatabase)
+			}
+			if count, _ := result.RowsAffected(); count == 0 {
+				fmt.Printf("⚠️  %s is not a known sender\n", email)
+				continue
+			}
+			if action == "add" {
+				log.Printf("Starred: %s", email)
+				fmt.Printf("⭐ Starred %s\n", email)
+			} else {
+				log.Printf("Unstarred: %s", email)
+				fmt.Printf("Unstarred %s\n", email)
+			}
+		}
+	case "list":
+		rows, err := db.Query(`
+			SELECT COALESCE(full_name, ''), email, message_count, COALESCE(last_seen_at, '')
+			FROM senders WHERE ` + starredCondition + ` ORDER BY COALESCE(last_seen_at, '') DESC, email`)
+		if err != nil {
+			fmt.Printf("❌ Failed to load starred senders: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		defer rows.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tEMAIL\tMESSAGES\tLAST SEEN")
+		total := 0
+		for rows.Next() {
+			var name, email, lastSeen string
+			var messages int
+			if err := rows.Scan(&name, &email, &messages, &lastSeen); err != nil {
+				fmt.Printf("❌ Failed to load starred senders: %v\n", err)
+				os.Exit(exitDatabase)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", name, email, messages, lastSeenDate(lastSeen))
+			total++
+		}
+		w.Flush()
+		fmt.Printf("Total starred: %d\n", total)
+	}
+}
+
+// Record messages from starred senders in a stored batch, for the alert at the end of the scan
+func noteStarredMail(db *sql.DB, config *Config, stats map[string]*SenderStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	rows, err := db.Query("SELECT email, COALESCE(full_name, '') FROM senders WHERE " + starredCondition)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email, name string
+		if err := rows.Scan(&email, &name); err != nil {
+			return err
+		}
+		s, ok := stats[email]
+		if !ok {
+			continue
+		}
+		if config.StarredMail == nil {
+			config.StarredMail = make(map[string]int)
+		}
+		label := email
+		if name != "" {
+			label = fmt.Sprintf("%s <%s>", name, email)
+		}
+		config.StarredMail[label] += s.Messages
+		log.Printf("Starred sender emailed: %s (%d messages)", label, s.Messages)
+	}
+	return rows.Err()
+}
+
+// Alert about starred senders who sent mail during the scan
+func showStarredMail(config *Config) {
+	if len(config.StarredMail) == 0 {
+		return
+	}
+	var labels []string
+	for label := range config.StarredMail {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	fmt.Printf("\n⭐ New mail from starred senders:\n")
+	for _, label := range labels {
+		fmt.Printf("  - %s (%s)\n", label, plural(config.StarredMail[label], "message"))
+	}
+}
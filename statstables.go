@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// Senders kept in the top_senders table
+const topSendersKept = 100
+
+// Schema of the aggregate tables refreshed after every scan, for dashboards and
+// exports reading the database directly
+const createStatsTables = `
+	CREATE TABLE IF NOT EXISTS domain_stats (
+		domain TEXT PRIMARY KEY,
+		senders INTEGER,
+		messages INTEGER,
+		flagged INTEGER,
+		bulk INTEGER,
+		avg_score REAL,
+		first_seen_at DATETIME,
+		last_seen_at DATETIME,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	) WITHOUT ROWID;
+	CREATE TABLE IF NOT EXISTS monthly_stats (
+		month TEXT PRIMARY KEY,
+		new_senders INTEGER,
+		new_domains INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	) WITHOUT ROWID;
+	CREATE TABLE IF NOT EXISTS top_senders (
+		rank INTEGER PRIMARY KEY,
+		email TEXT,
+		full_name TEXT,
+		score REAL,
+		message_count INTEGER,
+		last_seen_at DATETIME,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+// Month of a sender's first message, by the last message for senders stored before
+// first messages were recorded
+const senderMonthExpr = "substr(COALESCE(NULLIF(first_seen_at, ''), NULLIF(last_seen_at, ''), created_at), 1, 7)"
+
+// Rebuild the aggregate tables from the senders in one transaction, so readers see
+// either the old or the new numbers
+func refreshStatsTables(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	domain := "lower(substr(email, instr(email, '@') + 1))"
+	for _, query := range []string{
+		"DELETE FROM domain_stats",
+		`INSERT INTO domain_stats (domain, senders, messages, flagged, bulk, avg_score, first_seen_at, last_seen_at)
+		SELECT ` + domain + ` AS domain, COUNT(*), SUM(message_count), SUM(flagged_count), SUM(bulk_count),
+			ROUND(AVG(score), 1), MIN(NULLIF(first_seen_at, '')), MAX(NULLIF(last_seen_at, ''))
+		FROM senders WHERE message_count > 0 GROUP BY domain`,
+		"DELETE FROM monthly_stats",
+		`INSERT INTO monthly_stats (month, new_senders, new_domains)
+		SELECT month, COUNT(*), SUM(first_of_domain) FROM (
+			SELECT ` + senderMonthExpr + ` AS month,
+				ROW_NUMBER() OVER (PARTITION BY ` + domain + ` ORDER BY ` + senderMonthExpr + `) = 1 AS first_of_domain
+			FROM senders WHERE message_count > 0
+		) WHERE month != '' GROUP BY month`,
+		"DELETE FROM top_senders",
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO top_senders (rank, email, full_name, score, message_count, last_seen_at)
+		SELECT ROW_NUMBER() OVER (ORDER BY score DESC, message_count DESC, email), email, full_name, score, message_count, last_seen_at
+		FROM senders WHERE message_count > 0 ORDER BY score DESC, message_count DESC, email LIMIT ?`, topSendersKept); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Senders listed by name in a summary email, the rest are only counted
+const maxSummarySenders = 50
+
+// SummaryConfig structure for the "summary_email" section of the config file
+type SummaryConfig struct {
+	Server  string   `json:"server"`
+	User    string   `json:"user"`
+	Pass    string   `json:"pass"`
+	PassEnv string   `json:"pass_env"`
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+}
+
+// ScanSummary structure for what a run found, as sent in the summary email
+type ScanSummary struct {
+	User         string
+	Started      time.Time
+	Duration     time.Duration
+	Error        error
+	NewSenders   []string
+	NewDomains   []string
+	TotalSenders int
+	Processed    uint32
+	Total        uint32
+	FailedRanges int
+	Quarantined  int
+	StarredMail  map[string]int
+}
+
+// Send the summary of a finished run by email and to chat notifiers, if the config file asks for it
+func sendScanSummary(config *Config, db *sql.DB, started time.Time, scanErr error) {
+	if config.SummaryEmail == nil && !wantsChatEvent(config, chatEventSummary) {
+		return
+	}
+	summary, err := collectScanSummary(db, config, started)
+	if err != nil {
+		log.Printf("Failed to collect scan summary: %v", err)
+		fmt.Printf("⚠️  Scan summary not sent: %v\n", err)
+		return
+	}
+	summary.Error = scanErr
+
+	notifyChats(config, chatEventSummary, formatScanSummary(summary))
+	if config.SummaryEmail == nil {
+		return
+	}
+	err = sendSummaryEmail(config, summary)
+	recordAudit(config, auditEmail, strings.Join(summaryRecipients(config), ", "),
+		map[string]any{"new_senders": len(summary.NewSenders), "new_domains": len(summary.NewDomains)}, err)
+	if err != nil {
+		log.Printf("Failed to send summary email: %v", err)
+		fmt.Printf("⚠️  Summary email not sent: %v\n", err)
+		return
+	}
+	log.Printf("Summary email sent to %s", strings.Join(summaryRecipients(config), ", "))
+}
+
+// Collect senders, domains and problems recorded since the run started
+func collectScanSummary(db *sql.DB, config *Config, started time.Time) (*ScanSummary, error) {
+	summary := &ScanSummary{
+		User:        config.Username,
+		Started:     started,
+		Duration:    time.Since(started),
+		StarredMail: config.StarredMail,
+	}
+	// created_at columns hold UTC CURRENT_TIMESTAMP values
+	since := started.UTC().Format(time.DateTime)
+
+	rows, err := db.Query("SELECT COALESCE(full_name, ''), email FROM senders WHERE created_at >= ? ORDER BY email", since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, email string
+		if err := rows.Scan(&name, &email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if name != "" {
+			email = fmt.Sprintf("%s <%s>", name, email)
+		}
+		summary.NewSenders = append(summary.NewSenders, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT domain FROM (
+			SELECT lower(substr(email, instr(email, '@') + 1)) AS domain, MIN(created_at) AS first_seen
+			FROM senders GROUP BY domain
+		) WHERE first_seen >= ? ORDER BY domain`, since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		summary.NewDomains = append(summary.NewDomains, domain)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	db.QueryRow("SELECT COUNT(*) FROM senders").Scan(&summary.TotalSenders)
+	db.QueryRow("SELECT COALESCE(SUM(processed_count), 0), COALESCE(SUM(total_messages), 0) FROM scan_progress").
+		Scan(&summary.Processed, &summary.Total)
+	db.QueryRow("SELECT COUNT(*) FROM failed_ranges").Scan(&summary.FailedRanges)
+	db.QueryRow("SELECT COUNT(*) FROM quarantine WHERE created_at >= ?", since).Scan(&summary.Quarantined)
+	return summary, nil
+}
+
+// Plain text body of a summary email
+func formatScanSummary(s *ScanSummary) string {
+	var b strings.Builder
+	status := "completed successfully"
+	if s.Error != nil {
+		status = "failed"
+		if exitCode(s.Error) == exitPartial {
+			status = "completed partially"
+		}
+	}
+	fmt.Fprintf(&b, "Peep scan of %s %s.\n\n", s.User, status)
+	fmt.Fprintf(&b, "Started:            %s\n", s.Started.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Duration:           %v\n", s.Duration.Round(time.Second))
+	fmt.Fprintf(&b, "New senders:        %d\n", len(s.NewSenders))
+	fmt.Fprintf(&b, "New domains:        %d\n", len(s.NewDomains))
+	fmt.Fprintf(&b, "Total senders:      %d\n", s.TotalSenders)
+	fmt.Fprintf(&b, "Processed messages: %d/%d\n", s.Processed, s.Total)
+
+	if s.Error != nil || s.FailedRanges > 0 || s.Quarantined > 0 {
+		b.WriteString("\nErrors:\n")
+		if s.Error != nil {
+			fmt.Fprintf(&b, "  - %v\n", s.Error)
+		}
+		if s.FailedRanges > 0 {
+			fmt.Fprintf(&b, "  - %s waiting for retry (run 'retry')\n", plural(s.FailedRanges, "failed message range"))
+		}
+		if s.Quarantined > 0 {
+			fmt.Fprintf(&b, "  - %s could not be parsed (see 'quarantine list')\n", plural(s.Quarantined, "message"))
+		}
+	}
+
+	if len(s.StarredMail) > 0 {
+		var labels []string
+		for label := range s.StarredMail {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		b.WriteString("\nMail from starred senders:\n")
+		for _, label := range labels {
+			fmt.Fprintf(&b, "  - %s (%s)\n", label, plural(s.StarredMail[label], "message"))
+		}
+	}
+
+	if len(s.NewDomains) > 0 {
+		b.WriteString("\nNew domains:\n")
+		for _, domain := range s.NewDomains {
+			fmt.Fprintf(&b, "  - %s\n", domain)
+		}
+	}
+
+	if len(s.NewSenders) > 0 {
+		b.WriteString("\nNew senders:\n")
+		for i, sender := range s.NewSenders {
+			if i == maxSummarySenders {
+				fmt.Fprintf(&b, "  ... and %d more (see 'list -sort last_seen')\n", len(s.NewSenders)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  - %s\n", sender)
+		}
+	}
+	return b.String()
+}
+
+// Recipients of the summary, the scanned address unless configured
+func summaryRecipients(config *Config) []string {
+	if len(config.SummaryEmail.To) > 0 {
+		return config.SummaryEmail.To
+	}
+	return []string{config.Username}
+}
+
+// Send the summary through the configured SMTP server. Login defaults to the
+// scanned account, as providers accept the same (app) password for SMTP
+func sendSummaryEmail(config *Config, s *ScanSummary) error {
+	sc := config.SummaryEmail
+	if sc.Server == "" {
+		return fmt.Errorf("summary_email.server is not set")
+	}
+	host, port, err := net.SplitHostPort(sc.Server)
+	if err != nil {
+		return fmt.Errorf("invalid summary_email.server %q: %v", sc.Server, err)
+	}
+
+	user := firstNonEmpty(sc.User, config.Username)
+	pass := sc.Pass
+	if pass == "" && sc.PassEnv != "" {
+		pass = os.Getenv(sc.PassEnv)
+	}
+	logSecret(pass)
+	if pass == "" && user == config.Username {
+		pass = config.Password
+	}
+	from := firstNonEmpty(sc.From, user)
+	to := summaryRecipients(config)
+
+	subject := fmt.Sprintf("Peep: %s, %s for %s", plural(len(s.NewSenders), "new sender"), plural(len(s.NewDomains), "new domain"), s.User)
+	if s.Error != nil {
+		subject = fmt.Sprintf("Peep: scan of %s had errors", s.User)
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z),
+		strings.ReplaceAll(formatScanSummary(s), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if pass != "" {
+		auth = smtp.PlainAuth("", user, pass, host)
+	}
+	if port != "465" {
+		// STARTTLS is used when the server offers it
+		return smtp.SendMail(sc.Server, auth, from, to, []byte(message))
+	}
+
+	// Port 465 expects TLS from the start
+	conn, err := tls.Dial("tcp", sc.Server, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
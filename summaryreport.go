@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Rows listed per section of the summary report
+const summaryReportRows = 15
+
+// SummaryReport structure for the mailbox summary, in sections of preformatted lines
+type SummaryReport struct {
+	Title    string
+	Sections []SummarySection
+}
+
+// SummarySection structure for one headed part of the summary report
+type SummarySection struct {
+	Heading string
+	Lines   []string
+}
+
+// Collect an overview of the database for audit paperwork: scanned folders, the last
+// run, top senders and domains, and the senders needing attention
+func loadSummaryReport(db *sql.DB, config *Config, tags []string, includeIgnored, starred bool) (*SummaryReport, error) {
+	report := &SummaryReport{Title: "Peep mailbox report: " + firstNonEmpty(config.Username, config.DBPath)}
+
+	var senders, domains, messages int
+	if err := db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT lower(substr(email, instr(email, '@') + 1))), COALESCE(SUM(message_count), 0)
+		FROM senders`).Scan(&senders, &domains, &messages); err != nil {
+		return nil, err
+	}
+	overview := []string{
+		fmt.Sprintf("Generated:      %s", time.Now().Format("2006-01-02 15:04 MST")),
+		fmt.Sprintf("Peep version:   %s", buildInfo().Version),
+		fmt.Sprintf("Senders:        %d from %d domains", senders, domains),
+		fmt.Sprintf("Messages:       %d", messages),
+	}
+	if run, err := loadRun(db, "SELECT "+runColumns+" FROM runs ORDER BY id DESC LIMIT 1"); err == nil {
+		overview = append(overview, fmt.Sprintf("Last scan:      %s (%s, %s, %s, %s)", runDate(run), run.Folder, run.Status,
+			plural(run.NewSenders, "new sender"), plural(run.NewDomains, "new domain")))
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Overview", Lines: overview})
+
+	folders, err := summaryLines(db, `
+		SELECT printf('%-30s %8d of %8d messages, last scanned %s', folder, processed_count, total_messages,
+			substr(COALESCE(last_scan_date, ''), 1, 16))
+		FROM scan_progress ORDER BY folder`)
+	if err != nil {
+		return nil, err
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Scanned folders", Lines: folders})
+
+	domainRows, err := loadDomainReport(db, summaryReportRows, tags, includeIgnored, starred)
+	if err != nil {
+		return nil, err
+	}
+	var domainLines []string
+	for _, r := range domainRows {
+		line := fmt.Sprintf("%-34s %11s %14s", r.Domain, plural(r.Senders, "sender"), plural(r.Messages, "message"))
+		if r.Breaches != "" {
+			line += "  breached: " + r.Breaches
+		}
+		domainLines = append(domainLines, line)
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Top domains", Lines: domainLines})
+
+	var conditions []string
+	condition, args := tagFilterCondition("senders.email", tags)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if !includeIgnored {
+		conditions = append(conditions, notIgnoredCondition("senders.email"))
+	}
+	if starred {
+		conditions = append(conditions, starredCondition)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " AND " + strings.Join(conditions, " AND ")
+	}
+	topSenders, err := summaryLines(db, `
+		SELECT printf('%5.1f  %-40s %6d message%s', score, email, message_count, CASE message_count WHEN 1 THEN '' ELSE 's' END)
+		FROM senders WHERE message_count > 0`+where+` ORDER BY score DESC, email LIMIT ?`, append(args, summaryReportRows)...)
+	if err != nil {
+		return nil, err
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Top senders by score", Lines: topSenders})
+
+	suspects, err := summaryLines(db, `
+		SELECT printf('%-40s via %s (%d of %d messages)', email, COALESCE(return_path, '?'), misaligned_count, message_count)
+		FROM senders WHERE spoof_suspect = 1`+where+` ORDER BY misaligned_count DESC, email`, args...)
+	if err != nil {
+		return nil, err
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Possible spoofing", Lines: suspects})
+
+	flagged, err := summaryLines(db, `
+		SELECT printf('%-40s %s', value, COALESCE(reason, '')) FROM flagged ORDER BY value`)
+	if err != nil {
+		return nil, err
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Blocklisted senders and domains", Lines: flagged})
+
+	var failedRanges, quarantined int
+	db.QueryRow("SELECT COUNT(*) FROM failed_ranges").Scan(&failedRanges)
+	db.QueryRow("SELECT COUNT(*) FROM quarantine").Scan(&quarantined)
+	var problems []string
+	if failedRanges > 0 {
+		problems = append(problems, plural(failedRanges, "failed message range")+" waiting for retry")
+	}
+	if quarantined > 0 {
+		problems = append(problems, plural(quarantined, "message")+" could not be parsed (quarantined)")
+	}
+	report.Sections = append(report.Sections, SummarySection{Heading: "Problems", Lines: problems})
+	return report, nil
+}
+
+// Lines returned by a query selecting one formatted column
+func summaryLines(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines, rows.Err()
+}
+
+// Write the summary report as text or PDF
+func writeSummaryReport(out io.Writer, format string, r *SummaryReport) error {
+	var lines []PDFLine
+	for i, section := range r.Sections {
+		if i > 0 {
+			lines = append(lines, PDFLine{})
+		}
+		lines = append(lines, PDFLine{Text: section.Heading, Bold: true})
+		if len(section.Lines) == 0 {
+			lines = append(lines, PDFLine{Text: "  none"})
+		}
+		for _, line := range section.Lines {
+			lines = append(lines, PDFLine{Text: "  " + line})
+		}
+	}
+
+	switch format {
+	case "text":
+		fmt.Fprintf(out, "%s\n%s\n\n", r.Title, strings.Repeat("=", len([]rune(r.Title))))
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(out, line.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "pdf":
+		return writeTextPDF(out, r.Title, lines)
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
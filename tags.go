@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Source of tags added with the tag command
+const tagSourceUser = "user"
+
+// TagCount structure for one tag and the number of senders carrying it
+type TagCount struct {
+	Tag     string
+	Senders int
+	Sources string
+}
+
+// Run the tag command (add/remove/list)
+func runTag(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: tag requires an action: add, remove or list")
+		os.Exit(exitUsage)
+	}
+	action, args := args[0], args[1:]
+
+	config := &Config{}
+	fs := accountFlags("tag", config)
+	parseLocalFlags(fs, config, args)
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	switch action {
+	case "add", "remove":
+		if fs.NArg() < 2 {
+			fmt.Printf("❌ Error: usage: tag %s <tag> <email|@domain>...\n", action)
+			os.Exit(exitUsage)
+		}
+		tag := normalizeTag(fs.Arg(0))
+		for _, target := range fs.Args()[1:] {
+			var count int
+			var err error
+			if action == "add" {
+				count, err = addUserTag(db, tag, target)
+			} else {
+				count, err = removeTag(db, tag, target)
+			}
+			if err != nil {
+				log.Printf("Failed to %s tag %s on %s: %v", action, tag, target, err)
+				fmt.Printf("❌ Failed to %s tag %s on %s: %v\n", action, tag, target, err)
+				os.Exit(exitDatabase)
+			}
+			if count == 0 {
+				fmt.Printf("⚠️  No sender changed for %s\n", target)
+				continue
+			}
+			log.Printf("Tag %s %s: %s (%d senders)", tag, action, target, count)
+			if action == "add" {
+				fmt.Printf("Tagged %s as %s\n", plural(count, "sender"), tag)
+			} else {
+				fmt.Printf("Removed tag %s from %s\n", tag, plural(count, "sender"))
+			}
+		}
+	case "list":
+		if fs.NArg() > 0 {
+			listTaggedSenders(db, normalizeTag(fs.Arg(0)))
+			return
+		}
+		counts, err := loadTagCounts(db)
+		if err != nil {
+			fmt.Printf("❌ Failed to load tags: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TAG\tSENDERS\tSOURCES")
+		for _, c := range counts {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", c.Tag, c.Senders, c.Sources)
+		}
+		w.Flush()
+		fmt.Printf("Total tags: %d\n", len(counts))
+	default:
+		fmt.Printf("❌ Error: unknown tag action %q\n", action)
+		os.Exit(exitUsage)
+	}
+}
+
+// Tags are stored in lower case
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Senders a tag target refers to: one address, or every known sender of a domain ("@acme.com")
+func tagTargetCondition(target string) (string, string) {
+	entry := newFlaggedEntry(target, "")
+	if entry.Kind == "domain" {
+		return "lower(substr(email, instr(email, '@') + 1)) = ?", entry.Value
+	}
+	return "lower(email) = ?", entry.Value
+}
+
+// Tag the known senders of a target, returning how many received the tag
+func addUserTag(db *sql.DB, tag, target string) (int, error) {
+	condition, value := tagTargetCondition(target)
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO sender_tags (email, tag, source)
+		SELECT email, ?, ? FROM senders WHERE `+condition, tag, tagSourceUser, value)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Remove a tag from the senders of a target, whatever added it
+func removeTag(db *sql.DB, tag, target string) (int, error) {
+	condition, value := tagTargetCondition(target)
+	result, err := db.Exec(`DELETE FROM sender_tags WHERE tag = ? AND `+condition, tag, value)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Count senders per tag
+func loadTagCounts(db *sql.DB) ([]TagCount, error) {
+	rows, err := db.Query(`
+		SELECT tag, COUNT(DISTINCT email), group_concat(DISTINCT COALESCE(source, ''))
+		FROM sender_tags GROUP BY tag ORDER BY COUNT(DISTINCT email) DESC, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TagCount
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Senders, &c.Sources); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Print the senders carrying a tag
+func listTaggedSenders(db *sql.DB, tag string) {
+	rows, err := db.Query(`
+		SELECT COALESCE(s.full_name, ''), t.email, COALESCE(s.message_count, 0), COALESCE(t.source, '')
+		FROM sender_tags t LEFT JOIN senders s ON s.email = t.email
+		WHERE t.tag = ? ORDER BY COALESCE(s.message_count, 0) DESC, t.email`, tag)
+	if err != nil {
+		fmt.Printf("❌ Failed to load tagged senders: %v\n", err)
+		os.Exit(exitDatabase)
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tEMAIL\tMESSAGES\tSOURCE")
+	total := 0
+	for rows.Next() {
+		var name, email, source string
+		var messages int
+		if err := rows.Scan(&name, &email, &messages, &source); err != nil {
+			fmt.Printf("❌ Failed to load tagged senders: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", name, email, messages, source)
+		total++
+	}
+	w.Flush()
+	fmt.Printf("Senders tagged %s: %d\n", tag, total)
+}
+
+// SQL condition restricting senders (by their email column) to those carrying any of the tags
+func tagFilterCondition(emailColumn string, tags []string) (string, []any) {
+	var placeholders []string
+	var args []any
+	for _, tag := range tags {
+		for _, t := range strings.Split(tag, ",") {
+			if t = normalizeTag(t); t != "" {
+				placeholders = append(placeholders, "?")
+				args = append(args, t)
+			}
+		}
+	}
+	if len(placeholders) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM sender_tags t WHERE t.email = %s AND t.tag IN (%s))",
+		emailColumn, strings.Join(placeholders, ", ")), args
+}
+
+// Count with its noun ("1 sender", "3 senders")
+func plural(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
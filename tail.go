@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// tailWriter structure for the -tail output: every new sender as one line as soon
+// as its batch is saved. Batches of parallel folders are saved concurrently
+type tailWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+// Print new senders to stdout and move the rest of the scan output to stderr, so
+// stdout can be piped into other tools while the scan runs
+func startTail(config *Config) {
+	if config.TailFormat != "text" && config.TailFormat != "json" {
+		fmt.Printf("❌ Error: unsupported tail format %q (use -tail-format text or json)\n", config.TailFormat)
+		os.Exit(exitUsage)
+	}
+	config.TailOut = &tailWriter{w: os.Stdout, format: config.TailFormat}
+	os.Stdout = os.Stderr
+}
+
+// Write new senders: tab-separated address, name and domain, or their events as
+// JSON lines
+func (t *tailWriter) write(events []SenderEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, event := range events {
+		var err error
+		if t.format == "json" {
+			var line []byte
+			if line, err = json.Marshal(event); err == nil {
+				_, err = fmt.Fprintf(t.w, "%s\n", line)
+			}
+		} else {
+			name := strings.NewReplacer("\t", " ", "\n", " ").Replace(event.Name)
+			_, err = fmt.Fprintf(t.w, "%s\t%s\t%s\n", event.Email, name, event.Domain)
+		}
+		if err != nil {
+			log.Printf("Tail output error: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A shared serve instance hosts tenants, e.g. the members of a team: each has API
+// tokens and enrolls mailboxes, which the server scans into databases below
+// {data}/tenants/{tenant} and which only that tenant's tokens can query. The token
+// of -token-env is the admin token: it manages tenants and their tokens and
+// mailboxes, and its queries still read the databases below the data directory
+const createTenantTables = `
+	CREATE TABLE IF NOT EXISTS tenants (
+		name TEXT PRIMARY KEY,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS tenant_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		label TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS tenant_mailboxes (
+		tenant TEXT NOT NULL,
+		user TEXT NOT NULL,
+		account TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant, user)
+	);`
+
+// Prefix of tenant API tokens
+const tenantTokenPrefix = "peep_"
+
+// Prefix of the encrypted account of an enrolled mailbox
+const sealedAccountPrefix = "sealed:"
+
+// Tenant names: lowercase, usable as a directory name
+var tenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Errors of tenants, tokens and mailboxes that don't exist
+var (
+	errUnknownTenant  = errors.New("no such tenant")
+	errUnknownToken   = errors.New("no such token")
+	errUnknownMailbox = errors.New("no such mailbox")
+)
+
+// TenantInfo structure for a tenant as listed by the admin API
+type TenantInfo struct {
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	Tokens    int    `json:"tokens"`
+	Mailboxes int    `json:"mailboxes"`
+}
+
+// TenantToken structure for an API token; the token itself is only returned when
+// created, the registry keeps its hash
+type TenantToken struct {
+	ID        int64  `json:"id"`
+	Tenant    string `json:"tenant"`
+	Label     string `json:"label,omitempty"`
+	CreatedAt string `json:"created_at"`
+	LastUsed  string `json:"last_used_at,omitempty"`
+	Token     string `json:"token,omitempty"`
+}
+
+// MailboxInfo structure for an enrolled mailbox and the state of its last scan
+type MailboxInfo struct {
+	User      string   `json:"user"`
+	Server    string   `json:"server"`
+	Folders   []string `json:"folders,omitempty"`
+	Status    string   `json:"status"`
+	Message   string   `json:"message,omitempty"`
+	Senders   int      `json:"senders"`
+	Processed uint32   `json:"processed"`
+	Total     uint32   `json:"total"`
+}
+
+// tenantRegistry structure for the tenants, tokens and mailboxes of a serve instance
+type tenantRegistry struct {
+	db  *sql.DB
+	key []byte
+}
+
+// Open the registry, creating it readable by its owner only. The accounts of
+// enrolled mailboxes, passwords included, are encrypted with key (the token key)
+func openTenantRegistry(path string, key []byte) (*tenantRegistry, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(createTenantTables); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &tenantRegistry{db: db, key: key}, nil
+}
+
+// Encrypt an account for the registry. The tenant and user are authenticated with
+// it, so a value copied to another mailbox doesn't open
+func (r *tenantRegistry) sealAccount(tenant string, account AccountConfig) (string, error) {
+	aead, err := tokenStoreAEAD(r.key)
+	if err != nil {
+		return "", err
+	}
+	plain, err := json.Marshal(account)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, plain, []byte(tenant+"\x00"+account.User))
+	return sealedAccountPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt the account of a mailbox
+func (r *tenantRegistry) openAccount(tenant, user, data string) (AccountConfig, error) {
+	var account AccountConfig
+	encoded, ok := strings.CutPrefix(data, sealedAccountPrefix)
+	if !ok {
+		return account, fmt.Errorf("mailbox %s of %s is not encrypted", user, tenant)
+	}
+	aead, err := tokenStoreAEAD(r.key)
+	if err != nil {
+		return account, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return account, fmt.Errorf("mailbox %s of %s is corrupted", user, tenant)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(tenant+"\x00"+user))
+	if err != nil {
+		return account, fmt.Errorf("mailbox %s of %s can't be decrypted, was the token key changed?", user, tenant)
+	}
+	if err := json.Unmarshal(plain, &account); err != nil {
+		return account, fmt.Errorf("mailbox %s of %s: %v", user, tenant, err)
+	}
+	return account, nil
+}
+
+// Create a random API token and its hash
+func newTenantToken() (string, string) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := tenantTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return token, tenantTokenHash(token)
+}
+
+// Hash a token is stored and looked up by
+func tenantTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Add a tenant with a first token
+func (r *tenantRegistry) addTenant(name string) (TenantToken, error) {
+	if !tenantName.MatchString(name) {
+		return TenantToken{}, fmt.Errorf("invalid tenant name %q (lowercase letters, digits, '.', '_' and '-')", name)
+	}
+	if _, err := r.db.Exec("INSERT INTO tenants (name) VALUES (?)", name); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return TenantToken{}, fmt.Errorf("tenant %s already exists", name)
+		}
+		return TenantToken{}, err
+	}
+	return r.createToken(name, "initial")
+}
+
+// Whether a tenant exists
+func (r *tenantRegistry) hasTenant(name string) bool {
+	var found int
+	return r.db.QueryRow("SELECT 1 FROM tenants WHERE name = ?", name).Scan(&found) == nil
+}
+
+// List the tenants
+func (r *tenantRegistry) tenants() ([]TenantInfo, error) {
+	rows, err := r.db.Query(`SELECT name, strftime('%Y-%m-%d %H:%M:%S', created_at),
+		(SELECT COUNT(*) FROM tenant_tokens WHERE tenant = name),
+		(SELECT COUNT(*) FROM tenant_mailboxes WHERE tenant = name)
+		FROM tenants ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []TenantInfo{}
+	for rows.Next() {
+		var tenant TenantInfo
+		if err := rows.Scan(&tenant.Name, &tenant.CreatedAt, &tenant.Tokens, &tenant.Mailboxes); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// Remove a tenant with its tokens and mailboxes; their databases stay on disk
+func (r *tenantRegistry) removeTenant(name string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM tenants WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUnknownTenant
+	}
+	for _, table := range []string{"tenant_tokens", "tenant_mailboxes"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE tenant = ?", name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Create an API token of a tenant
+func (r *tenantRegistry) createToken(tenant, label string) (TenantToken, error) {
+	if !r.hasTenant(tenant) {
+		return TenantToken{}, errUnknownTenant
+	}
+	token, hash := newTenantToken()
+	result, err := r.db.Exec("INSERT INTO tenant_tokens (tenant, hash, label) VALUES (?, ?, ?)", tenant, hash, label)
+	if err != nil {
+		return TenantToken{}, err
+	}
+	id, _ := result.LastInsertId()
+	return TenantToken{ID: id, Tenant: tenant, Label: label, CreatedAt: time.Now().UTC().Format("2006-01-02 15:04:05"), Token: token}, nil
+}
+
+// List the tokens of a tenant
+func (r *tenantRegistry) tokens(tenant string) ([]TenantToken, error) {
+	if !r.hasTenant(tenant) {
+		return nil, errUnknownTenant
+	}
+	rows, err := r.db.Query(`SELECT id, tenant, COALESCE(label, ''), strftime('%Y-%m-%d %H:%M:%S', created_at),
+		COALESCE(strftime('%Y-%m-%d %H:%M:%S', last_used_at), '') FROM tenant_tokens WHERE tenant = ? ORDER BY id`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []TenantToken{}
+	for rows.Next() {
+		var token TenantToken
+		if err := rows.Scan(&token.ID, &token.Tenant, &token.Label, &token.CreatedAt, &token.LastUsed); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke a token of a tenant
+func (r *tenantRegistry) revokeToken(tenant string, id int64) error {
+	result, err := r.db.Exec("DELETE FROM tenant_tokens WHERE tenant = ? AND id = ?", tenant, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUnknownToken
+	}
+	return nil
+}
+
+// Tenant of an API token, recording its use
+func (r *tenantRegistry) tokenTenant(token string) (string, bool) {
+	hash := tenantTokenHash(token)
+	var tenant string
+	if err := r.db.QueryRow("SELECT tenant FROM tenant_tokens WHERE hash = ?", hash).Scan(&tenant); err != nil {
+		return "", false
+	}
+	r.db.Exec("UPDATE tenant_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE hash = ?", hash)
+	return tenant, true
+}
+
+// Enroll a mailbox of a tenant, replacing its settings when already enrolled
+func (r *tenantRegistry) enroll(tenant string, account AccountConfig) error {
+	if !r.hasTenant(tenant) {
+		return errUnknownTenant
+	}
+	data, err := r.sealAccount(tenant, account)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO tenant_mailboxes (tenant, user, account) VALUES (?, ?, ?)
+		ON CONFLICT (tenant, user) DO UPDATE SET account = excluded.account`, tenant, account.User, data)
+	return err
+}
+
+// Remove a mailbox of a tenant; its database stays on disk
+func (r *tenantRegistry) unenroll(tenant, user string) error {
+	result, err := r.db.Exec("DELETE FROM tenant_mailboxes WHERE tenant = ? AND user = ?", tenant, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUnknownMailbox
+	}
+	return nil
+}
+
+// Whether a mailbox is enrolled by a tenant
+func (r *tenantRegistry) enrolled(tenant, user string) bool {
+	var found int
+	return r.db.QueryRow("SELECT 1 FROM tenant_mailboxes WHERE tenant = ? AND user = ?", tenant, user).Scan(&found) == nil
+}
+
+// Enrolled mailboxes of a tenant, as accounts to scan
+func (r *tenantRegistry) mailboxes(tenant string) ([]AccountConfig, error) {
+	if !r.hasTenant(tenant) {
+		return nil, errUnknownTenant
+	}
+	rows, err := r.db.Query("SELECT user, account FROM tenant_mailboxes WHERE tenant = ? ORDER BY user", tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []AccountConfig
+	for rows.Next() {
+		var user, data string
+		if err := rows.Scan(&user, &data); err != nil {
+			return nil, err
+		}
+		account, err := r.openAccount(tenant, user, data)
+		if err != nil {
+			return nil, err
+		}
+		logSecret(account.Pass)
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// Check a mailbox to enroll. Tenants may not name files or environment variables
+// of the server, which would let them read its files and secrets
+func checkEnrollment(account AccountConfig, admin bool) error {
+	switch {
+	case account.User == "":
+		return fmt.Errorf("mailbox has no user")
+	case account.Pass == "" && account.PassEnv == "":
+		return fmt.Errorf("mailbox %s has no password (set pass)", account.User)
+	case account.DB != "" || account.Config != "" || len(account.Exports) > 0:
+		return fmt.Errorf("db, config and exports are not available for enrolled mailboxes")
+	case account.PassEnv != "" && !admin:
+		return fmt.Errorf("pass_env is only available with the admin token")
+	}
+	return nil
+}
+
+// Directory holding the databases, logs and status files of a tenant
+func (s *queryServer) tenantDir(tenant string) string {
+	return filepath.Join(dataRoot(s.opts.DataDir), "tenants", tenant)
+}
+
+// Accounts file scanning the mailboxes of a tenant into its directory
+func (s *queryServer) tenantAccounts(tenant string, mailboxes []AccountConfig) *AccountsFile {
+	return &AccountsFile{
+		Workers:  s.opts.Workers,
+		DataDir:  s.tenantDir(tenant),
+		Layout:   s.opts.Layout,
+		Accounts: mailboxes,
+	}
+}
+
+// Scan the mailboxes of all tenants every interval until ctx is cancelled
+func (s *queryServer) scanLoop(ctx context.Context) {
+	for {
+		s.scanTenants(ctx)
+		select {
+		case <-time.After(s.opts.ScanInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Scan the mailboxes of all tenants, one tenant after the other
+func (s *queryServer) scanTenants(ctx context.Context) {
+	tenants, err := s.registry.tenants()
+	if err != nil {
+		log.Printf("Tenant scans skipped: %v", err)
+		return
+	}
+	for _, tenant := range tenants {
+		if ctx.Err() != nil {
+			return
+		}
+		mailboxes, err := s.registry.mailboxes(tenant.Name)
+		if err != nil {
+			log.Printf("Tenant %s skipped: %v", tenant.Name, err)
+			continue
+		}
+		if len(mailboxes) == 0 {
+			continue
+		}
+		failed := 0
+		for _, result := range runAccountScans(ctx, s.tenantAccounts(tenant.Name, mailboxes)) {
+			if result.Status != "SUCCESS" {
+				failed++
+			}
+		}
+		log.Printf("Tenant %s scanned: %d mailboxes, %d failed", tenant.Name, len(mailboxes), failed)
+	}
+}
+
+// servePrincipal structure for who sent a request: the admin or a tenant
+type servePrincipal struct {
+	admin  bool
+	tenant string
+}
+
+// Whether the principal may act for a tenant
+func (p servePrincipal) allows(tenant string) bool {
+	return p.admin || p.tenant == tenant
+}
+
+// Authenticate a request by its bearer token. Without an admin token the server
+// only listens on loopback, and requests without a token act as the admin
+func (s *queryServer) authenticate(r *http.Request) (servePrincipal, bool) {
+	header := r.Header.Get("Authorization")
+	token, bearer := strings.CutPrefix(header, "Bearer ")
+	switch {
+	case s.token == "" && header == "":
+		return servePrincipal{admin: true}, true
+	case !bearer:
+		return servePrincipal{}, false
+	case s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1:
+		return servePrincipal{admin: true}, true
+	case s.registry != nil && strings.HasPrefix(token, tenantTokenPrefix):
+		tenant, ok := s.registry.tokenTenant(token)
+		return servePrincipal{tenant: tenant}, ok
+	}
+	return servePrincipal{}, false
+}
+
+// Wrap a tenant API handler with authentication, the registry check and access
+// to the tenant of the path
+func (s *queryServer) tenantHandler(adminOnly bool, handler func(http.ResponseWriter, *http.Request, servePrincipal)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := s.authenticate(r)
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, RemoteResult{Error: "invalid token"})
+			return
+		}
+		if s.registry == nil {
+			writeJSON(w, http.StatusServiceUnavailable, RemoteResult{Error: "tenants are not available on this server"})
+			return
+		}
+		if tenant := r.PathValue("tenant"); (adminOnly && !principal.admin) || (tenant != "" && !principal.allows(tenant)) {
+			writeJSON(w, http.StatusForbidden, RemoteResult{Error: "not allowed with this token"})
+			return
+		}
+		handler(w, r, principal)
+	}
+}
+
+// Register the tenant API
+func (s *queryServer) handleTenants(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/tenants", s.tenantHandler(true, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		tenants, err := s.registry.tenants()
+		writeTenantResult(w, http.StatusOK, tenants, err)
+	}))
+	mux.HandleFunc("POST /v1/tenants", s.tenantHandler(true, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		var request struct {
+			Name string `json:"name"`
+		}
+		if !decodeTenantRequest(w, r, &request) {
+			return
+		}
+		token, err := s.registry.addTenant(request.Name)
+		if err == nil {
+			log.Printf("Tenant %s added", request.Name)
+		}
+		writeTenantResult(w, http.StatusCreated, token, err)
+	}))
+	mux.HandleFunc("DELETE /v1/tenants/{tenant}", s.tenantHandler(true, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		err := s.registry.removeTenant(r.PathValue("tenant"))
+		if err == nil {
+			log.Printf("Tenant %s removed", r.PathValue("tenant"))
+		}
+		writeTenantResult(w, http.StatusOK, map[string]string{"removed": r.PathValue("tenant")}, err)
+	}))
+
+	mux.HandleFunc("GET /v1/tenants/{tenant}/tokens", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		tokens, err := s.registry.tokens(r.PathValue("tenant"))
+		writeTenantResult(w, http.StatusOK, tokens, err)
+	}))
+	mux.HandleFunc("POST /v1/tenants/{tenant}/tokens", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		var request struct {
+			Label string `json:"label"`
+		}
+		if !decodeTenantRequest(w, r, &request) {
+			return
+		}
+		token, err := s.registry.createToken(r.PathValue("tenant"), request.Label)
+		writeTenantResult(w, http.StatusCreated, token, err)
+	}))
+	mux.HandleFunc("DELETE /v1/tenants/{tenant}/tokens/{id}", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, RemoteResult{Error: "invalid token id"})
+			return
+		}
+		err = s.registry.revokeToken(r.PathValue("tenant"), id)
+		writeTenantResult(w, http.StatusOK, map[string]int64{"revoked": id}, err)
+	}))
+
+	mux.HandleFunc("GET /v1/tenants/{tenant}/mailboxes", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		tenant := r.PathValue("tenant")
+		mailboxes, err := s.registry.mailboxes(tenant)
+		infos := []MailboxInfo{}
+		if err == nil {
+			accounts := s.tenantAccounts(tenant, mailboxes)
+			for _, account := range mailboxes {
+				status := accountStatus(accountScanConfig(accounts, account))
+				infos = append(infos, MailboxInfo{User: status.User, Server: status.Server, Folders: account.Folders, Status: status.Status,
+					Message: status.Message, Senders: status.Senders, Processed: status.Processed, Total: status.Total})
+			}
+		}
+		writeTenantResult(w, http.StatusOK, infos, err)
+	}))
+	mux.HandleFunc("POST /v1/tenants/{tenant}/mailboxes", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		var account AccountConfig
+		if !decodeTenantRequest(w, r, &account) {
+			return
+		}
+		if err := checkEnrollment(account, p.admin); err != nil {
+			writeJSON(w, http.StatusBadRequest, RemoteResult{Error: err.Error()})
+			return
+		}
+		err := s.registry.enroll(r.PathValue("tenant"), account)
+		if err == nil {
+			log.Printf("Tenant %s enrolled %s", r.PathValue("tenant"), account.User)
+		}
+		writeTenantResult(w, http.StatusCreated, map[string]string{"enrolled": account.User}, err)
+	}))
+	mux.HandleFunc("DELETE /v1/tenants/{tenant}/mailboxes/{user}", s.tenantHandler(false, func(w http.ResponseWriter, r *http.Request, p servePrincipal) {
+		err := s.registry.unenroll(r.PathValue("tenant"), r.PathValue("user"))
+		if err == nil {
+			log.Printf("Tenant %s unenrolled %s", r.PathValue("tenant"), r.PathValue("user"))
+		}
+		writeTenantResult(w, http.StatusOK, map[string]string{"unenrolled": r.PathValue("user")}, err)
+	}))
+}
+
+// Decode the JSON body of a tenant API request, answering bad requests
+func decodeTenantRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRemoteRequest)).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, RemoteResult{Error: fmt.Sprintf("invalid request: %v", err)})
+		return false
+	}
+	return true
+}
+
+// Write the result of a tenant API request, or its error
+func writeTenantResult(w http.ResponseWriter, status int, v any, err error) {
+	switch {
+	case errors.Is(err, errUnknownTenant) || errors.Is(err, errUnknownToken) || errors.Is(err, errUnknownMailbox):
+		writeJSON(w, http.StatusNotFound, RemoteResult{Error: err.Error()})
+	case err != nil:
+		log.Printf("Tenant request failed: %v", err)
+		writeJSON(w, http.StatusBadRequest, RemoteResult{Error: err.Error()})
+	default:
+		writeJSON(w, status, v)
+	}
+}
+
+// Send a request to the tenant API of -remote, decoding the response into out
+func tenantRequest(remote, method, path string, body, out any) error {
+	if !strings.HasPrefix(remote, "http://") && !strings.HasPrefix(remote, "https://") {
+		return withExitCode(exitUsage, fmt.Errorf("invalid -remote %q (use https://host[:port])", remote))
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(remote, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	if token := os.Getenv("PEEP_REMOTE_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+logSecret(token))
+	}
+
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return withExitCode(exitConnection, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var result RemoteResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		err := fmt.Errorf("%s", firstNonEmpty(result.Error, resp.Status))
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return withExitCode(exitAuth, err)
+		case http.StatusBadRequest, http.StatusNotFound:
+			return withExitCode(exitUsage, err)
+		}
+		return err
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// Run the tenants command
+func runTenants(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("❌ Error: tenants requires an action: add, list, remove, token, tokens, revoke, enroll, mailboxes, unenroll")
+		os.Exit(exitUsage)
+	}
+	action, args := args[0], args[1:]
+
+	var remote, label, server, pass, passEnv, folders string
+	fs := flag.NewFlagSet("tenants", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.StringVar(&remote, "remote", "", "URL of the peep serve instance (required)")
+	fs.StringVar(&label, "label", "", "Label of a new token")
+	fs.StringVar(&server, "server", "", "IMAP server of an enrolled mailbox (default: imap.gmail.com:993)")
+	fs.StringVar(&pass, "pass", "", "Password of an enrolled mailbox")
+	fs.StringVar(&passEnv, "pass-env", "", "Variable holding the password on the server (admin only)")
+	fs.StringVar(&folders, "folders", "", "Comma separated mailboxes to scan (default: INBOX)")
+	fs.Parse(args)
+	logSecret(pass)
+
+	// Actions and the number of arguments they take
+	arity := map[string]int{"add": 1, "list": 0, "remove": 1, "token": 1, "tokens": 1, "revoke": 2, "enroll": 2, "mailboxes": 1, "unenroll": 2}
+	n, ok := arity[action]
+	if !ok {
+		fmt.Printf("❌ Error: unknown tenants action %q\n", action)
+		os.Exit(exitUsage)
+	}
+	if fs.NArg() != n {
+		fmt.Printf("❌ Error: tenants %s takes %d arguments, got %d\n", action, n, fs.NArg())
+		os.Exit(exitUsage)
+	}
+	if remote == "" {
+		fmt.Println("❌ Error: tenants requires -remote, the URL of the peep serve instance")
+		os.Exit(exitUsage)
+	}
+	tenant := fs.Arg(0)
+	tenantPath := "/v1/tenants/" + tenant
+
+	var err error
+	switch action {
+	case "add", "token":
+		var token TenantToken
+		if action == "add" {
+			err = tenantRequest(remote, "POST", "/v1/tenants", map[string]string{"name": tenant}, &token)
+		} else {
+			err = tenantRequest(remote, "POST", tenantPath+"/tokens", map[string]string{"label": label}, &token)
+		}
+		if err == nil {
+			fmt.Printf("✅ Token %d of %s created, it is shown only once:\n%s\n", token.ID, token.Tenant, token.Token)
+		}
+	case "list":
+		var tenants []TenantInfo
+		if err = tenantRequest(remote, "GET", "/v1/tenants", nil, &tenants); err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TENANT\tCREATED (UTC)\tTOKENS\tMAILBOXES")
+			for _, t := range tenants {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", t.Name, t.CreatedAt, t.Tokens, t.Mailboxes)
+			}
+			w.Flush()
+		}
+	case "remove":
+		if err = tenantRequest(remote, "DELETE", tenantPath, nil, nil); err == nil {
+			fmt.Printf("✅ Tenant %s removed, its databases are kept on the server\n", tenant)
+		}
+	case "tokens":
+		var tokens []TenantToken
+		if err = tenantRequest(remote, "GET", tenantPath+"/tokens", nil, &tokens); err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tLABEL\tCREATED (UTC)\tLAST USED (UTC)")
+			for _, t := range tokens {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.Label, t.CreatedAt, t.LastUsed)
+			}
+			w.Flush()
+		}
+	case "revoke":
+		if err = tenantRequest(remote, "DELETE", tenantPath+"/tokens/"+fs.Arg(1), nil, nil); err == nil {
+			fmt.Printf("✅ Token %s of %s revoked\n", fs.Arg(1), tenant)
+		}
+	case "enroll":
+		account := AccountConfig{User: fs.Arg(1), Server: server, Pass: pass, PassEnv: passEnv}
+		if folders != "" {
+			account.Folders = strings.Split(folders, ",")
+		}
+		if err = tenantRequest(remote, "POST", tenantPath+"/mailboxes", account, nil); err == nil {
+			fmt.Printf("✅ %s enrolled for %s, it is scanned in the next round\n", account.User, tenant)
+		}
+	case "mailboxes":
+		var mailboxes []MailboxInfo
+		if err = tenantRequest(remote, "GET", tenantPath+"/mailboxes", nil, &mailboxes); err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "MAILBOX\tSERVER\tSTATUS\tSENDERS\tPROGRESS\tMESSAGE")
+			for _, m := range mailboxes {
+				fmt.Fprintf(w, "%s %s\t%s\t%s\t%d\t%d/%d\t%s\n", statusIcon(m.Status), m.User, m.Server, m.Status, m.Senders, m.Processed, m.Total, m.Message)
+			}
+			w.Flush()
+		}
+	case "unenroll":
+		if err = tenantRequest(remote, "DELETE", tenantPath+"/mailboxes/"+url.PathEscape(fs.Arg(1)), nil, nil); err == nil {
+			fmt.Printf("✅ %s unenrolled from %s, its database is kept on the server\n", fs.Arg(1), tenant)
+		}
+	}
+	if err != nil {
+		fmt.Printf("❌ tenants %s: %v\n", action, err)
+		os.Exit(exitCode(err))
+	}
+}
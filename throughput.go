@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serializes the progress writes of folders scanned in parallel
+var progressFilesMu sync.Mutex
+
+// Number of recent batches the throughput is averaged over
+const rateWindow = 10
+
+// BatchTiming structure for the work and duration of one batch
+type BatchTiming struct {
+	UIDs     uint32
+	Messages int
+	Elapsed  time.Duration
+}
+
+// RateEstimator structure for the rolling throughput of a scan, fed with the timings
+// of this run's batches only, so time spent in earlier runs does not skew the estimate
+type RateEstimator struct {
+	batches []BatchTiming
+}
+
+// Record a finished batch
+func (r *RateEstimator) Add(uids uint32, messages int, elapsed time.Duration) {
+	r.batches = append(r.batches, BatchTiming{UIDs: uids, Messages: messages, Elapsed: elapsed})
+	if len(r.batches) > rateWindow {
+		r.batches = r.batches[len(r.batches)-rateWindow:]
+	}
+}
+
+// Messages processed per second over the recent batches
+func (r *RateEstimator) Rate() float64 {
+	var messages int
+	var elapsed time.Duration
+	for _, b := range r.batches {
+		messages += b.Messages
+		elapsed += b.Elapsed
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(messages) / elapsed.Seconds()
+}
+
+// Estimated time to cover the remaining UIDs, 0 while there is no timing yet.
+// UIDs are used instead of messages because gaps, samples and skipped messages all
+// take their share of the batch time
+func (r *RateEstimator) Remaining(uids uint32) time.Duration {
+	var covered uint32
+	var elapsed time.Duration
+	for _, b := range r.batches {
+		covered += b.UIDs
+		elapsed += b.Elapsed
+	}
+	if covered == 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * float64(uids) / float64(covered))
+}
+
+// ScanMetrics structure for the progress numbers shared by the status and metrics files
+type ScanMetrics struct {
+	User      string
+	Folder    string
+	Processed uint32
+	Total     uint32
+	Percent   float64
+	Rate      float64
+	ETA       time.Duration
+}
+
+// Write the running status with the current progress, rate and ETA
+func writeProgressStatus(statusPath string, m ScanMetrics) {
+	progressFilesMu.Lock()
+	defer progressFilesMu.Unlock()
+	writeStatusDetails(statusPath, "RUNNING", fmt.Sprintf("Scanning %s", m.Folder),
+		fmt.Sprintf("PROGRESS: %.2f%% (%d/%d)", m.Percent, m.Processed, m.Total),
+		fmt.Sprintf("RATE: %.1f messages/s", m.Rate),
+		fmt.Sprintf("ETA: %v", m.ETA.Round(time.Second)))
+}
+
+// Write the progress in the Prometheus text format, for the node_exporter textfile collector.
+// The file is replaced atomically so the collector never reads a partial file
+func writeMetricsFile(path string, m ScanMetrics) error {
+	progressFilesMu.Lock()
+	defer progressFilesMu.Unlock()
+	labels := fmt.Sprintf(`{user=%q,folder=%q}`, m.User, m.Folder)
+	var b strings.Builder
+	metric := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s%s %g\n", name, help, name, name, labels, value)
+	}
+	metric("peep_scan_processed_messages", "Messages of the folder processed so far.", float64(m.Processed))
+	metric("peep_scan_total_messages", "Messages in the folder.", float64(m.Total))
+	metric("peep_scan_progress_ratio", "Share of the folder's UIDs covered (0-1).", m.Percent/100)
+	metric("peep_scan_rate_messages_per_second", "Messages per second over the recent batches.", m.Rate)
+	metric("peep_scan_eta_seconds", "Estimated seconds until the folder is scanned.", m.ETA.Seconds())
+	metric("peep_scan_updated_timestamp_seconds", "Time of the last update.", float64(time.Now().Unix()))
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// Timeout of one upload request
+const uploadTimeout = 5 * time.Minute
+
+// UploadConfig structure for the "upload" section of the config file, credentials per destination type
+type UploadConfig struct {
+	S3     S3Config     `json:"s3"`
+	SFTP   SFTPConfig   `json:"sftp"`
+	WebDAV WebDAVConfig `json:"webdav"`
+}
+
+// S3Config structure for S3-compatible buckets (AWS, MinIO, Cloudflare R2, ...)
+type S3Config struct {
+	Endpoint           string `json:"endpoint"`
+	Region             string `json:"region"`
+	AccessKeyID        string `json:"access_key_id"`
+	SecretAccessKey    string `json:"secret_access_key"`
+	SecretAccessKeyEnv string `json:"secret_access_key_env"`
+}
+
+// SFTPConfig structure for uploads with the system sftp client
+type SFTPConfig struct {
+	IdentityFile string `json:"identity_file"`
+	Port         int    `json:"port"`
+}
+
+// WebDAVConfig structure for WebDAV servers (Nextcloud, ownCloud, ...)
+type WebDAVConfig struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+}
+
+// Upload data to a destination URL (s3://bucket/key, sftp://user@host/path, https://dav/path),
+// returning the final location. A URL ending in "/" gets the default file name appended
+func uploadFile(config *Config, destination, defaultName string, data []byte) (string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("invalid upload destination %q: %v", destination, err)
+	}
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		u.Path += defaultName
+	}
+
+	var upload UploadConfig
+	if config.Upload != nil {
+		upload = *config.Upload
+	}
+	switch u.Scheme {
+	case "s3":
+		err = uploadS3(upload.S3, u, data)
+	case "sftp":
+		err = uploadSFTP(upload.SFTP, u, data)
+	case "http", "https":
+		err = uploadWebDAV(upload.WebDAV, u, data)
+	default:
+		return "", fmt.Errorf("unsupported upload destination %q (use s3://, sftp:// or https:// for WebDAV)", u.Scheme)
+	}
+	if err != nil {
+		return "", err
+	}
+	u.User = nil
+	return u.String(), nil
+}
+
+// Upload to an S3-compatible bucket with a Signature Version 4 PUT request.
+// AWS uses virtual-hosted buckets; other endpoints are addressed path-style
+func uploadS3(s3 S3Config, u *url.URL, data []byte) error {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	region := firstNonEmpty(s3.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	accessKey := firstNonEmpty(s3.AccessKeyID, os.Getenv("AWS_ACCESS_KEY_ID"))
+	secretKey := firstNonEmpty(s3.SecretAccessKey, os.Getenv(s3.SecretAccessKeyEnv), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	sessionToken := ""
+	if s3.AccessKeyID == "" {
+		// A session token belongs to the key pair of the environment
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	logSecret(secretKey)
+	logSecret(sessionToken)
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("S3 credentials missing (upload.s3 in the config file or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)")
+	}
+
+	var endpoint string
+	if s3.Endpoint != "" {
+		endpoint = strings.TrimSuffix(s3.Endpoint, "/") + "/" + awsURIEncode(bucket) + "/" + awsURIEncode(key)
+	} else {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, awsURIEncode(key))
+	}
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(data)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		signed = append(signed, "x-amz-security-token")
+		canonicalHeaders += "x-amz-security-token:" + sessionToken + "\n"
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{"PUT", req.URL.EscapedPath(), "", canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+
+	return doUpload(req)
+}
+
+// Upload with the system sftp client in batch mode, which uses the SSH keys,
+// agent and known_hosts of the user (no password prompts)
+func uploadSFTP(sftp SFTPConfig, u *url.URL, data []byte) error {
+	if u.User == nil || u.User.Username() == "" {
+		return fmt.Errorf("sftp destination needs a user (sftp://user@host/path)")
+	}
+	if _, err := exec.LookPath("sftp"); err != nil {
+		return fmt.Errorf("sftp client not found: %v", err)
+	}
+
+	tmp, err := os.CreateTemp("", "peep-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	} else if sftp.Port != 0 {
+		args = append(args, "-P", fmt.Sprint(sftp.Port))
+	}
+	if sftp.IdentityFile != "" {
+		args = append(args, "-i", sftp.IdentityFile)
+	}
+	args = append(args, u.User.Username()+"@"+u.Hostname())
+
+	// As with curl, /~/ is relative to the login directory
+	remote := u.Path
+	if strings.HasPrefix(remote, "/~/") {
+		remote = strings.TrimPrefix(remote, "/~/")
+	}
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("put %s %s\n", sftpQuote(tmp.Name()), sftpQuote(remote)))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Upload with a WebDAV PUT request
+func uploadWebDAV(dav WebDAVConfig, u *url.URL, data []byte) error {
+	target := *u
+	username, password := dav.Username, firstNonEmpty(dav.Password, os.Getenv(dav.PasswordEnv))
+	if u.User != nil {
+		// Credentials in the URL win, but are not sent as part of it
+		username = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+		target.User = nil
+	}
+	logSecret(password)
+
+	req, err := http.NewRequest("PUT", target.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	err = doUpload(req)
+	if err != nil && strings.Contains(err.Error(), "409 Conflict") {
+		return fmt.Errorf("%v (does the folder %s exist?)", err, path.Dir(target.Path))
+	}
+	return err
+}
+
+// Send an upload request and check the response
+func doUpload(req *http.Request) error {
+	req.Header.Set("User-Agent", "peep/"+buildInfo().Version)
+	client := &http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), strings.TrimSpace(resp.Status+" "+string(detail)))
+	}
+	return nil
+}
+
+// Quote a path for an sftp batch command
+func sftpQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// Percent-encode a path as required by SigV4: everything but unreserved characters and "/"
+func awsURIEncode(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HMAC-SHA256 of a message
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
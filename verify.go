@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deliverability statuses recorded by verify
+const (
+	verifyValid    = "valid"
+	verifyInvalid  = "invalid"
+	verifyCatchAll = "catch-all"
+	verifyNoMX     = "no-mx"
+	verifyMXOK     = "mx-ok"
+	verifyUnknown  = "unknown"
+)
+
+// VerifyOptions structure for the verify command
+type VerifyOptions struct {
+	SMTP    bool
+	From    string
+	Helo    string
+	Delay   time.Duration
+	Timeout time.Duration
+	Limit   int
+	Refresh bool
+}
+
+// VerifyResult structure for the deliverability of one address
+type VerifyResult struct {
+	Email  string
+	Status string
+	Detail string
+}
+
+// Run the address verification command
+func runVerify(args []string) {
+	config := &Config{}
+	opts := &VerifyOptions{}
+
+	fs := accountFlags("verify", config)
+	fs.BoolVar(&opts.SMTP, "smtp", false, "Probe mail servers with RCPT TO (otherwise only MX records are checked)")
+	fs.StringVar(&opts.From, "from", "", "MAIL FROM address for probes (default: -user)")
+	fs.StringVar(&opts.Helo, "helo", "", "HELO hostname for probes (default: system hostname)")
+	fs.DurationVar(&opts.Delay, "delay", 2*time.Second, "Pause between SMTP commands to the same server")
+	fs.DurationVar(&opts.Timeout, "timeout", 15*time.Second, "SMTP connection timeout")
+	fs.IntVar(&opts.Limit, "limit", 0, "Maximum number of addresses to verify (0 = all)")
+	fs.BoolVar(&opts.Refresh, "refresh", false, "Verify addresses that already have a status again")
+	parseLocalFlags(fs, config, args)
+
+	if opts.From == "" {
+		opts.From = config.Username
+	}
+	if opts.SMTP && opts.From == "" {
+		fmt.Println("❌ Error: -from is required for SMTP probes")
+		os.Exit(1)
+	}
+	if opts.Helo == "" {
+		opts.Helo, _ = os.Hostname()
+	}
+
+	setupLogging(config)
+	db := mustOpenDB(config)
+	defer db.Close()
+
+	if err := verifySenders(db, opts); err != nil {
+		log.Printf("Verify error: %v", err)
+		fmt.Printf("❌ Verify error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Verify stored sender addresses domain by domain
+func verifySenders(db *sql.DB, opts *VerifyOptions) error {
+	query := "SELECT email FROM senders"
+	if !opts.Refresh {
+		query += " WHERE verified_at IS NULL"
+	}
+	query += " ORDER BY email"
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	byDomain := make(map[string][]string)
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return err
+		}
+		byDomain[emailDomain(email)] = append(byDomain[emailDomain(email)], email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	domains := make([]string, 0, len(byDomain))
+	for domain := range byDomain {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	counts := make(map[string]int)
+	for _, domain := range domains {
+		results := verifyDomain(domain, byDomain[domain], opts)
+		for _, result := range results {
+			if _, err := db.Exec(`
+				UPDATE senders SET verify_status = ?, verify_detail = ?, verified_at = CURRENT_TIMESTAMP
+				WHERE email = ?`, result.Status, result.Detail, result.Email); err != nil {
+				return err
+			}
+			counts[result.Status]++
+			log.Printf("Verified %s: %s %s", result.Email, result.Status, result.Detail)
+		}
+	}
+
+	var parts []string
+	for _, status := range []string{verifyValid, verifyMXOK, verifyCatchAll, verifyInvalid, verifyNoMX, verifyUnknown} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", status, counts[status]))
+		}
+	}
+	log.Printf("Verify completed: %s", strings.Join(parts, ", "))
+	fmt.Printf("✅ Verify completed: %s\n", strings.Join(parts, ", "))
+	return nil
+}
+
+// Look up the mail exchangers of a domain, falling back to the domain itself (RFC 5321 implicit MX)
+func lookupMailHosts(domain string) ([]string, error) {
+	mxs, err := net.LookupMX(domain)
+	if err == nil && len(mxs) > 0 {
+		var hosts []string
+		for _, mx := range mxs {
+			host := strings.TrimSuffix(mx.Host, ".")
+			if host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) > 0 {
+			return hosts, nil
+		}
+		// A single "." MX means the domain accepts no mail (RFC 7505)
+		return nil, fmt.Errorf("null MX")
+	}
+
+	if addrs, aErr := net.LookupHost(domain); aErr == nil && len(addrs) > 0 {
+		return []string{domain}, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("no MX or A records")
+	}
+	return nil, err
+}
+
+// Verify all addresses of one domain over a single SMTP session
+func verifyDomain(domain string, emails []string, opts *VerifyOptions) []VerifyResult {
+	results := make([]VerifyResult, len(emails))
+	setAll := func(status, detail string) []VerifyResult {
+		for i, email := range emails {
+			results[i] = VerifyResult{Email: email, Status: status, Detail: detail}
+		}
+		return results
+	}
+
+	hosts, err := lookupMailHosts(domain)
+	if err != nil {
+		// Resolver failures say nothing about the domain
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && !dnsErr.IsNotFound {
+			return setAll(verifyUnknown, err.Error())
+		}
+		return setAll(verifyNoMX, err.Error())
+	}
+	if !opts.SMTP {
+		return setAll(verifyMXOK, hosts[0])
+	}
+
+	c, conn, host, err := dialMailHost(hosts, opts)
+	if err != nil {
+		return setAll(verifyUnknown, err.Error())
+	}
+	defer c.Close()
+
+	// Rate limit probes; every command gets its own timeout
+	pause := func() {
+		time.Sleep(opts.Delay)
+		conn.SetDeadline(time.Now().Add(opts.Timeout))
+	}
+
+	if err := c.Hello(opts.Helo); err != nil {
+		return setAll(verifyUnknown, fmt.Sprintf("%s: HELO: %v", host, err))
+	}
+	if err := c.Mail(opts.From); err != nil {
+		return setAll(verifyUnknown, fmt.Sprintf("%s: MAIL FROM: %v", host, err))
+	}
+
+	// A server that accepts a random address accepts everything
+	pause()
+	probe := fmt.Sprintf("peep-%08x@%s", rand.Uint32(), domain)
+	catchAll := c.Rcpt(probe) == nil
+
+	for i, email := range emails {
+		pause()
+		results[i] = VerifyResult{Email: email, Status: verifyValid, Detail: host}
+
+		err := c.Rcpt(email)
+		var protoErr *textproto.Error
+		switch {
+		case err == nil && catchAll:
+			results[i].Status = verifyCatchAll
+		case err == nil:
+		case errors.As(err, &protoErr) && protoErr.Code >= 500:
+			results[i].Status = verifyInvalid
+			results[i].Detail = fmt.Sprintf("%s: %d %s", host, protoErr.Code, protoErr.Msg)
+		default:
+			// 4xx replies (greylisting, rate limits) and connection errors say nothing about the address
+			results[i].Status = verifyUnknown
+			results[i].Detail = fmt.Sprintf("%s: %v", host, err)
+		}
+	}
+
+	c.Quit()
+	return results
+}
+
+// Connect to the first reachable mail host on port 25
+func dialMailHost(hosts []string, opts *VerifyOptions) (*smtp.Client, net.Conn, string, error) {
+	var lastErr error
+	for _, host := range hosts {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, "25"), opts.Timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(opts.Timeout))
+
+		c, err := smtp.NewClient(conn, host)
+		if err != nil {
+			conn.Close()
+			lastErr = err
+			continue
+		}
+		return c, conn, host, nil
+	}
+	return nil, nil, "", fmt.Errorf("no reachable mail host: %v", lastErr)
+}
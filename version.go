@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+// go build -ldflags "-X main.version=v1.2.0 -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Modules whose versions are reported by the version command
+var reportedModules = []string{
+	"github.com/emersion/go-imap",
+	"github.com/emersion/go-message",
+	"modernc.org/sqlite",
+}
+
+// BuildInfo structure for the version command
+type BuildInfo struct {
+	Version      string            `json:"version"`
+	Commit       string            `json:"commit,omitempty"`
+	Modified     bool              `json:"modified,omitempty"`
+	BuildDate    string            `json:"build_date,omitempty"`
+	CommitDate   string            `json:"commit_date,omitempty"`
+	GoVersion    string            `json:"go_version"`
+	Platform     string            `json:"platform"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// Collect version details from linker flags and the embedded module/VCS info
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:      version,
+		Commit:       commit,
+		BuildDate:    buildDate,
+		GoVersion:    runtime.Version(),
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Dependencies: make(map[string]string),
+	}
+
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range embedded.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			info.CommitDate = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	for _, dep := range embedded.Deps {
+		for _, path := range reportedModules {
+			if dep.Path == path {
+				info.Dependencies[path] = dep.Version
+			}
+		}
+	}
+	if info.Version == "dev" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+	return info
+}
+
+// One-line version for logs and the status file ("v1.2.0 (1a2b3c4d)")
+func versionString() string {
+	info := buildInfo()
+	if info.Commit == "" {
+		return info.Version
+	}
+	short := info.Commit[:min(len(info.Commit), 8)]
+	if info.Modified {
+		short += ", modified"
+	}
+	return fmt.Sprintf("%s (%s)", info.Version, short)
+}
+
+// Run the version command
+func runVersion(args []string) {
+	var asJSON bool
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Usage = showUsage
+	fs.BoolVar(&asJSON, "json", false, "Print build information as JSON")
+	fs.Parse(args)
+
+	info := buildInfo()
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(info)
+		return
+	}
+
+	fmt.Printf("peep %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("Commit:     %s%s\n", info.Commit, modified)
+	}
+	if info.CommitDate != "" {
+		fmt.Printf("Committed:  %s\n", info.CommitDate)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("Built:      %s\n", info.BuildDate)
+	}
+	fmt.Printf("Go:         %s %s\n", info.GoVersion, info.Platform)
+	for _, module := range reportedModules {
+		if v, ok := info.Dependencies[module]; ok {
+			fmt.Printf("%-11s %s\n", path.Base(module)+":", v)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Default watermark of export -since-last
+const defaultWatermark = "default"
+
+// Change sequence of the exported sender fields: triggers give a sender the next
+// number when it is added or a field export writes changes, so export -since-last
+// finds what changed after a watermark without comparing rows. Scores are compared
+// as exported, rounded to one decimal
+const createChangeTracking = `
+	CREATE INDEX IF NOT EXISTS idx_senders_change_seq ON senders(change_seq);
+
+	CREATE TABLE IF NOT EXISTS export_watermarks (
+		name TEXT PRIMARY KEY,
+		change_seq INTEGER DEFAULT 0,
+		sender_count INTEGER DEFAULT 0,
+		exported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TRIGGER IF NOT EXISTS senders_change_insert AFTER INSERT ON senders BEGIN
+		UPDATE senders SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM senders) WHERE id = new.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS senders_change_update AFTER UPDATE OF full_name, email, category, score, message_count,
+		flagged_count, last_seen_at, phone, job_title, company, verify_status, photo ON senders
+	WHEN new.full_name IS NOT old.full_name OR new.email IS NOT old.email OR new.category IS NOT old.category
+		OR round(new.score, 1) IS NOT round(old.score, 1) OR new.message_count IS NOT old.message_count
+		OR new.flagged_count IS NOT old.flagged_count OR new.last_seen_at IS NOT old.last_seen_at
+		OR new.phone IS NOT old.phone OR new.job_title IS NOT old.job_title OR new.company IS NOT old.company
+		OR new.verify_status IS NOT old.verify_status OR new.photo IS NOT old.photo
+	BEGIN
+		UPDATE senders SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM senders) WHERE id = new.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS sender_phones_change_insert AFTER INSERT ON sender_phones BEGIN
+		UPDATE senders SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM senders) WHERE email = new.email;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS sender_phones_change_delete AFTER DELETE ON sender_phones BEGIN
+		UPDATE senders SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) + 1 FROM senders) WHERE email = old.email;
+	END;
+
+	UPDATE senders SET change_seq = id WHERE change_seq IS NULL;`
+
+// Set the change range of a -since-last export: after the watermark up to the
+// latest change, so senders changed while exporting are left for the next export
+func loadExportWatermark(db *sql.DB, opts *ExportOptions) error {
+	err := db.QueryRow("SELECT change_seq FROM export_watermarks WHERE name = ?", opts.Watermark).Scan(&opts.SinceSeq)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("watermark %s: %v", opts.Watermark, err)
+	}
+	if err := db.QueryRow("SELECT COALESCE(MAX(change_seq), 0) FROM senders").Scan(&opts.UntilSeq); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Move the watermark to the end of an export that went through
+func saveExportWatermark(db *sql.DB, opts *ExportOptions, count int) error {
+	_, err := db.Exec(`
+		INSERT INTO export_watermarks (name, change_seq, sender_count, exported_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(name) DO UPDATE SET change_seq = excluded.change_seq, sender_count = excluded.sender_count,
+			exported_at = excluded.exported_at`, opts.Watermark, opts.UntilSeq, count)
+	return err
+}